@@ -0,0 +1,106 @@
+package gomq
+
+// SetAsyncConnect makes connecting asynchronous if async is set,
+// as with libzmq's zmq_connect: Connect returns once the endpoint
+// is parsed, and the socket connects in the background, retrying
+// as set by its Backoff, and connects again whenever a connection
+// is lost. Up to queue messages sent while the socket has no peer
+// are queued, and go to the first peer to connect. Beyond that,
+// sending fails with ErrNoPeers, or blocks or drops the message,
+// as the send mode says.
+func (s *Socket) SetAsyncConnect(async bool, queue int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.async = async
+	s.asyncQueue = queue
+}
+
+// asyncConnector is implemented by sockets embedding
+// *Socket, which may connect asynchronously.
+type asyncConnector interface {
+	asyncConnect() bool
+}
+
+func (s *Socket) asyncConnect() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.async
+}
+
+// connect connects s to the first of endpoints reachable with
+// dialAny, strict as for dialAny, and keeps it connected with
+// reconnect, until the endpoints are disconnected. If s connects
+// asynchronously, it only checks the endpoints and connects in
+// the background.
+func connect(s ZeroMQSocket, endpoints []string, strict bool) error {
+	if err := checkSecurity(s, endpoints, false); err != nil {
+		return err
+	}
+	if a, ok := s.(asyncConnector); ok && a.asyncConnect() {
+		for _, endpoint := range endpoints {
+			if _, _, err := splitEndpoint(endpoint); err != nil {
+				return err
+			}
+		}
+		connectInBackground(s, endpoints)
+		return nil
+	}
+
+	d := newDialer(s, endpoints)
+	conn, err := dialAny(s, endpoints, strict, d.stop)
+	if err != nil {
+		d.forget(s)
+		return err
+	}
+	reconnect(s, conn, d)
+	return nil
+}
+
+// connectInBackground connects s to endpoints like connect,
+// without waiting for the first connection.
+func connectInBackground(s ZeroMQSocket, endpoints []string) {
+	d := newDialer(s, endpoints)
+	go func() {
+		conn, err := dialAny(s, endpoints, false, d.stop)
+		if err != nil {
+			d.forget(s)
+			return
+		}
+		reconnect(s, conn, d)
+	}()
+}
+
+// SetQueueUntilConnected makes the socket queue the messages
+// sent while it has no peer, such as before its first Connect or
+// Bind completes, up to its send high-water mark, see SetSendHWM,
+// and hand them to the first peer to connect. Beyond that, the
+// queue is full and sending fails with ErrWouldBlock, or blocks
+// or drops the message, as the send mode says. It takes over from
+// the queue of SetAsyncConnect. By default, sending fails fast
+// with ErrNoPeers while the socket has no peer.
+func (s *Socket) SetQueueUntilConnected(queue bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queueEarly = queue
+}
+
+// hold queues msg until a peer connects, if the socket queues
+// until connected or connects asynchronously and its queue has
+// room. full is set if the socket queues until connected and its
+// queue has no room. The caller holds s.lock for reading.
+func (s *Socket) hold(msg *outgoing) (held, full bool) {
+	limit := s.asyncQueue
+	switch {
+	case s.queueEarly:
+		limit = s.sendHWM
+	case !s.async:
+		return false, false
+	}
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	if len(s.pending) >= limit && (limit > 0 || !s.queueEarly) {
+		return false, s.queueEarly
+	}
+	s.pending = append(s.pending, msg)
+	return true, false
+}
@@ -0,0 +1,103 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestAsyncConnect(t *testing.T) {
+	endpoint := "tcp://127.0.0.1:19066"
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetAsyncConnect(true, 1)
+	client.SetBackoff(Backoff{Initial: 10 * time.Millisecond})
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send([]byte("early")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send([]byte("too early")); !errors.Is(err, ErrNoPeers) {
+		t.Errorf("want %v, got %v", ErrNoPeers, err)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "early", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := client.Connect("bogus"); err == nil {
+		t.Error("want an invalid endpoint to fail right away")
+	}
+}
+
+func TestAsyncConnectClose(t *testing.T) {
+	dealer := NewDealer(zmtp.NewSecurityNull(), "")
+	dealer.SetAsyncConnect(true, 4)
+	dropped := make(chan DeadLetter, 4)
+	dealer.SetDeadLetterHandler(func(letter DeadLetter) {
+		dropped <- letter
+	})
+	if err := dealer.Connect("inproc://test-async-close"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dealer.Send([]byte("pending")); err != nil {
+		t.Fatal(err)
+	}
+	dealer.Close()
+
+	select {
+	case letter := <-dropped:
+		if want, got := DropLinger, letter.Reason; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Error("pending message not reported")
+	}
+}
+
+func TestQueueUntilConnected(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetQueueUntilConnected(true)
+	client.SetSendHWM(2)
+
+	for _, b := range []string{"first", "second"} {
+		if err := client.Send([]byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Send([]byte("third")); !errors.Is(err, ErrWouldBlock) {
+		t.Errorf("want %v, got %v", ErrWouldBlock, err)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://queue-until-connected"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect("inproc://queue-until-connected"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"first", "second"} {
+		msg, err := server.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
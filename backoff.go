@@ -0,0 +1,148 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ErrGaveUp is returned when connecting to an endpoint did
+// not succeed within the socket's backoff budget, see Backoff.
+var ErrGaveUp = errors.New("gomq: gave up connecting")
+
+// Backoff paces a socket's attempts at connecting to its
+// endpoints, both when first connecting and when connecting
+// again after a connection was lost. Each round of attempts
+// tries every endpoint once. The zero Backoff retries every
+// retry interval, forever.
+type Backoff struct {
+	// Initial is the delay after the first failed round,
+	// the socket's retry interval if zero.
+	Initial time.Duration
+
+	// Max caps the delay, which doubles after each
+	// failed round. The delay does not grow if zero.
+	Max time.Duration
+
+	// Jitter, between 0 and 1, is the fraction of each
+	// delay that is random, so that sockets that lost their
+	// connections together do not all retry in step.
+	Jitter float64
+
+	// MaxAttempts is the number of rounds after which
+	// connecting fails with ErrGaveUp, no limit if zero.
+	MaxAttempts int
+
+	// Timeout is how long after the first round connecting
+	// fails with ErrGaveUp, no limit if zero.
+	Timeout time.Duration
+}
+
+// SetBackoff sets how the socket paces its attempts at
+// connecting to its endpoints. It applies to the connect
+// calls and reconnections that start after the change.
+func (s *Socket) SetBackoff(b Backoff) {
+	s.lock.Lock()
+	s.backoff = b
+	s.lock.Unlock()
+}
+
+// Backoff returns how the socket paces its attempts
+// at connecting to its endpoints.
+func (s *Socket) Backoff() Backoff {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.backoff
+}
+
+// delay returns how long to wait after the given number
+// of failed rounds, retry being the socket's retry interval.
+func (b Backoff) delay(rounds int, retry time.Duration) time.Duration {
+	d := b.Initial
+	if d <= 0 {
+		d = retry
+	}
+	for i := 1; i < rounds && d < b.Max; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter > 0 {
+		jitter := b.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= time.Duration(jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// dialAny tries each endpoint in order until one of them
+// completes a handshake, waiting between rounds as set by the
+// socket's Backoff. When the budget is exhausted it returns an
+// ErrGaveUp error wrapping the last attempt's, ErrClosed if
+// the socket is closed in the meantime and errDisconnected
+// once stop is closed, see Disconnect. If strict is set,
+// errors other than failing to reach an endpoint, such as a
+// failed handshake, are returned rather than retried.
+func dialAny(s ZeroMQSocket, endpoints []string, strict bool, stop <-chan struct{}) (*Connection, error) {
+	b := baseOf(s).Backoff()
+	clock := clockOf(s)
+	var deadline <-chan time.Time
+	if b.Timeout > 0 {
+		timer := clock.NewTimer(b.Timeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+
+	for rounds := 1; ; rounds++ {
+		errs := make([]error, len(endpoints))
+		for i, endpoint := range endpoints {
+			select {
+			case <-stop:
+				return nil, errDisconnected
+			default:
+			}
+			conn, err := dial(s, endpoint)
+			if err == nil {
+				select {
+				case <-stop:
+					conn.net.Close()
+					return nil, errDisconnected
+				default:
+				}
+				return conn, nil
+			}
+			if strict && !errors.Is(err, errDial) {
+				return nil, err
+			}
+			errs[i] = err
+		}
+		last := errs[len(errs)-1]
+
+		if b.MaxAttempts > 0 && rounds >= b.MaxAttempts {
+			return nil, fmt.Errorf("%w after %d attempts: %v", ErrGaveUp, rounds, last)
+		}
+		// the timer is set before the retry is reported, so that
+		// handlers of the event can advance a fake clock past it
+		delay := b.delay(rounds, s.RetryInterval())
+		timer := clock.NewTimer(delay)
+		for i, endpoint := range endpoints {
+			emit(s, SocketEvent{Type: EventConnectRetried, Endpoint: endpoint, Err: errs[i], Delay: delay})
+		}
+		select {
+		case <-baseOf(s).Done():
+			timer.Stop()
+			return nil, ErrClosed
+		case <-stop:
+			timer.Stop()
+			return nil, errDisconnected
+		case <-deadline:
+			timer.Stop()
+			return nil, fmt.Errorf("%w after %v: %v", ErrGaveUp, b.Timeout, last)
+		case <-timer.C():
+		}
+	}
+}
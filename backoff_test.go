@@ -0,0 +1,55 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Max: 80 * time.Millisecond}
+	for rounds, want := range []time.Duration{10, 20, 40, 80, 80} {
+		if got := b.delay(rounds+1, defaultRetry); want*time.Millisecond != got {
+			t.Errorf("round %d: want %v, got %v", rounds+1, want*time.Millisecond, got)
+		}
+	}
+
+	if want, got := defaultRetry, (Backoff{}).delay(5, defaultRetry); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.delay(4, defaultRetry); d < 40*time.Millisecond || d > 80*time.Millisecond {
+			t.Fatalf("want a delay between 40ms and 80ms, got %v", d)
+		}
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	endpoint := "tcp://127.0.0.1:19065"
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetBackoff(Backoff{Initial: 10 * time.Millisecond, Max: 20 * time.Millisecond, MaxAttempts: 3})
+	if err := client.Connect(endpoint); !errors.Is(err, ErrGaveUp) {
+		t.Errorf("want %v, got %v", ErrGaveUp, err)
+	}
+
+	client.SetBackoff(Backoff{Initial: 10 * time.Millisecond, Timeout: 100 * time.Millisecond})
+	start := time.Now()
+	if err := client.Connect(endpoint); !errors.Is(err, ErrGaveUp) {
+		t.Errorf("want %v, got %v", ErrGaveUp, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want to give up after 100ms, took %v", elapsed)
+	}
+
+	dealer := NewDealer(zmtp.NewSecurityNull(), "")
+	dealer.Close()
+	if want, got := ErrClosed, dealer.Connect(endpoint); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
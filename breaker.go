@@ -0,0 +1,249 @@
+package gomq
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// BreakerState is the state of the circuit breaker
+// of one of a socket's endpoints.
+type BreakerState int
+
+const (
+	// BreakerClosed means messages are routed
+	// to the endpoint's peers as usual.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen means the endpoint failed too often,
+	// and no message is routed to its peers.
+	BreakerOpen
+
+	// BreakerHalfOpen means a single message is let
+	// through to probe the endpoint. The breaker closes
+	// if it is written, and opens again otherwise.
+	BreakerHalfOpen
+)
+
+func (st BreakerState) String() string {
+	switch st {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(st))
+}
+
+// CircuitBreaker stops a socket from routing messages to
+// the endpoints that keep failing, so that one bad backend
+// does not absorb and fail a share of all traffic. Writing
+// a message counts as a success, while failing to connect
+// and losing a connection count as failures. The peers that
+// connect to an endpoint the socket binds to share the
+// endpoint's breaker.
+type CircuitBreaker struct {
+	// Window is the number of most recent outcomes
+	// the failure rate is computed over.
+	Window int
+
+	// FailureRate is the fraction of failures in a full
+	// window, between 0 and 1, that opens the breaker.
+	FailureRate float64
+
+	// OpenTimeout is how long the breaker stays open
+	// before letting a probe through.
+	OpenTimeout time.Duration
+}
+
+// endpointBreaker is the breaker of an endpoint, guarded
+// by the socket's lock, except for probing, which is
+// accessed atomically.
+type endpointBreaker struct {
+	state    BreakerState
+	outcomes []bool // true for failures
+	next     int
+	count    int
+	failures int
+	probing  int32
+	timer    *time.Timer
+}
+
+// SetCircuitBreaker makes the socket use a circuit breaker
+// per endpoint, configured by b, or none if b is nil. The
+// breakers start closed. Their state changes are reported
+// to the endpoint state handler, see EndpointStatus.
+func (s *Socket) SetCircuitBreaker(b *CircuitBreaker) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, eb := range s.breakers {
+		if eb.timer != nil {
+			eb.timer.Stop()
+		}
+	}
+	s.breakers = make(map[string]*endpointBreaker)
+	for _, status := range s.endpoints {
+		status.Breaker = BreakerClosed
+	}
+	if b != nil {
+		c := *b
+		if c.Window < 1 {
+			c.Window = 1
+		}
+		b = &c
+	}
+	s.breaker = b
+	s.notifyPeersChanged()
+}
+
+// routable reports whether a message may be queued toward
+// conn, taking the probe of a half-open breaker if so. The
+// caller must hold the lock.
+func (s *Socket) routable(conn *Connection) (ok, probe bool) {
+	b := s.breakers[conn.endpoint]
+	if b == nil {
+		return true, false
+	}
+	switch b.state {
+	case BreakerOpen:
+		return false, false
+	case BreakerHalfOpen:
+		ok = atomic.CompareAndSwapInt32(&b.probing, 0, 1)
+		return ok, ok
+	}
+	return true, false
+}
+
+// releaseProbe gives back the probe taken for a message
+// that could not be queued toward conn after all. The
+// caller must hold the lock.
+func (s *Socket) releaseProbe(conn *Connection) {
+	if b := s.breakers[conn.endpoint]; b != nil {
+		atomic.StoreInt32(&b.probing, 0)
+	}
+}
+
+// recordOutcome counts a success or a failure of endpoint
+// toward its breaker, reporting the breaker's state change,
+// if any, to the endpoint state handler.
+func (s *Socket) recordOutcome(endpoint string, failed bool) {
+	s.lock.RLock()
+	enabled := s.breaker != nil
+	s.lock.RUnlock()
+	if !enabled {
+		return
+	}
+
+	s.lock.Lock()
+	if !s.recordOutcomeLocked(endpoint, failed) {
+		s.lock.Unlock()
+		return
+	}
+	s.reportBreaker(endpoint)
+}
+
+// recordOutcomeLocked is like recordOutcome, but leaves it to
+// the caller, which must hold the lock, to report the state
+// change it returns whether happened.
+func (s *Socket) recordOutcomeLocked(endpoint string, failed bool) bool {
+	if s.breaker == nil {
+		return false
+	}
+	b := s.breakers[endpoint]
+	if b == nil {
+		b = &endpointBreaker{outcomes: make([]bool, s.breaker.Window)}
+		s.breakers[endpoint] = b
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			s.openBreaker(endpoint, b)
+		} else {
+			s.closeBreaker(endpoint, b)
+		}
+		return true
+	case BreakerOpen:
+		return false
+	}
+
+	if b.count == len(b.outcomes) {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+	b.outcomes[b.next] = failed
+	b.next = (b.next + 1) % len(b.outcomes)
+	if failed {
+		b.failures++
+	}
+
+	if b.count == len(b.outcomes) && b.failures > 0 && float64(b.failures) >= s.breaker.FailureRate*float64(b.count) {
+		s.openBreaker(endpoint, b)
+		return true
+	}
+	return false
+}
+
+// openBreaker opens b, the breaker of endpoint, until the
+// socket's open timeout passes. The caller must hold the lock.
+func (s *Socket) openBreaker(endpoint string, b *endpointBreaker) {
+	b.state = BreakerOpen
+	s.setBreakerState(endpoint, b.state)
+	b.timer = time.AfterFunc(s.breaker.OpenTimeout, func() {
+		s.lock.Lock()
+		if s.breakers[endpoint] != b || b.state != BreakerOpen {
+			s.lock.Unlock()
+			return
+		}
+		select {
+		case <-s.done:
+			s.lock.Unlock()
+			return
+		default:
+		}
+		b.state = BreakerHalfOpen
+		atomic.StoreInt32(&b.probing, 0)
+		s.setBreakerState(endpoint, b.state)
+		s.notifyPeersChanged()
+		s.reportBreaker(endpoint)
+	})
+}
+
+// closeBreaker closes b, the breaker of endpoint, with an
+// empty window. The caller must hold the lock.
+func (s *Socket) closeBreaker(endpoint string, b *endpointBreaker) {
+	*b = endpointBreaker{outcomes: make([]bool, len(b.outcomes))}
+	s.setBreakerState(endpoint, b.state)
+	s.notifyPeersChanged()
+}
+
+// setBreakerState records the breaker state of endpoint
+// in its status. The caller must hold the lock.
+func (s *Socket) setBreakerState(endpoint string, state BreakerState) {
+	if status := s.endpoints[endpoint]; status != nil {
+		status.Breaker = state
+	}
+}
+
+// reportBreaker releases the lock, which the caller holds,
+// and passes the status of endpoint to the endpoint state
+// handler.
+func (s *Socket) reportBreaker(endpoint string) {
+	status := s.endpoints[endpoint]
+	onEndpointState := s.onEndpointState
+	var changed EndpointStatus
+	if status != nil {
+		changed = *status
+	}
+	s.lock.Unlock()
+
+	if status != nil && onEndpointState != nil {
+		onEndpointState(changed)
+	}
+}
@@ -0,0 +1,85 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	good, bad := "inproc://breaker-good", "inproc://breaker-bad"
+
+	serverA := NewServer(zmtp.NewSecurityNull())
+	defer serverA.Close()
+	if _, err := serverA.Bind(good); err != nil {
+		t.Fatal(err)
+	}
+	serverB := NewServer(zmtp.NewSecurityNull())
+	if _, err := serverB.Bind(bad); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetCircuitBreaker(&CircuitBreaker{Window: 1, FailureRate: 1, OpenTimeout: 100 * time.Millisecond})
+	breakers := make(chan BreakerState, 256)
+	client.SetEndpointStateHandler(func(status EndpointStatus) {
+		if status.Endpoint == bad {
+			breakers <- status.Breaker
+		}
+	})
+	for _, endpoint := range []string{good, bad} {
+		if err := client.Connect(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitBreaker := func(want BreakerState) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case got := <-breakers:
+				if want == got {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("breaker never became %v", want)
+			}
+		}
+	}
+
+	serverB.Close()
+	waitBreaker(BreakerOpen)
+
+	for i := 0; i < 4; i++ {
+		if err := client.Send([]byte("while open")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := serverA.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitBreaker(BreakerHalfOpen)
+
+	serverB = NewServer(zmtp.NewSecurityNull())
+	defer serverB.Close()
+	if _, err := serverB.Bind(bad); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WaitForPeers(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := client.Send([]byte("probe")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitBreaker(BreakerClosed)
+	if msg, err := serverB.Recv(); err != nil || string(msg) != "probe" {
+		t.Errorf("want the probe, got %q, %v", msg, err)
+	}
+}
@@ -0,0 +1,407 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// Forward moves one message from src to dst, waiting for it
+// to be received and then queued as long as ctx allows, as a
+// building block for custom devices. The message is moved
+// whole, its frames passed on as received without copying,
+// so messages forwarded concurrently never interleave.
+func Forward(ctx context.Context, src, dst ZeroMQSocket) error {
+	msg, err := src.RecvMultipartContext(ctx)
+	if err != nil {
+		return err
+	}
+	return dst.SendMultipartContext(ctx, msg)
+}
+
+// Bridge forwards the messages received on frontend to backend
+// and those received on backend to frontend, such as between a
+// socket bound on one transport and a socket connected over
+// another. Messages are forwarded whole, so the routing frames
+// of their envelopes, and with them the identities of the peers
+// they come from, reach the other side unchanged. Directions a
+// socket type cannot receive or send in are skipped.
+//
+// When one socket is a PubSocket and the other a SubSocket, the
+// SubSocket is kept subscribed once to each prefix the
+// PubSocket's peers are subscribed to, so that publishers behind the bridge
+// only send what subscribers in front of it asked for.
+//
+// Bridge runs until ctx is done or either socket fails, such as
+// when it is closed, and returns the error that stopped it. It
+// returns ErrNotSupported if no messages can be forwarded.
+func Bridge(ctx context.Context, frontend, backend ZeroMQSocket) error {
+	return Proxy(ctx, frontend, backend, nil, nil)
+}
+
+// ProxyCommand steers a running Proxy, like the
+// commands of zmq_proxy_steerable.
+type ProxyCommand int
+
+const (
+	// ProxyPause stops forwarding messages, which
+	// are left queued on the sockets meanwhile.
+	ProxyPause ProxyCommand = iota + 1
+
+	// ProxyResume forwards messages again after ProxyPause.
+	ProxyResume
+
+	// ProxyTerminate stops the proxy, which returns nil.
+	ProxyTerminate
+
+	// ProxyTrace makes the proxy's sockets log at LogTrace,
+	// tracing the frames they exchange, see SetLogger.
+	ProxyTrace
+
+	// ProxyUntrace gives the proxy's sockets back the
+	// log levels they had before ProxyTrace.
+	ProxyUntrace
+)
+
+// proxyLogLevel is added to a LogLevel to make the
+// ProxyCommand setting it, see ProxyLogLevel.
+const proxyLogLevel ProxyCommand = 1 << 8
+
+// ProxyLogLevel returns the command setting the log
+// level of the proxy's sockets to level.
+func ProxyLogLevel(level LogLevel) ProxyCommand {
+	return proxyLogLevel + ProxyCommand(level)
+}
+
+// Proxy forwards messages between frontend and backend like
+// Bridge, as zmq_proxy does for brokers such as ROUTER-DEALER
+// forwarders and XPUB-XSUB proxies. If capture is not nil, a
+// copy of each message forwarded is sent to it, and failing to
+// send it stops the proxy. Commands received on control, if not
+// nil, pause, resume or terminate the proxy, or change the
+// logging of its sockets. See ProxyWith for more options.
+func Proxy(ctx context.Context, frontend, backend, capture ZeroMQSocket, control <-chan ProxyCommand) error {
+	return ProxyWith(ctx, frontend, backend, ProxyOptions{Capture: capture, Control: control})
+}
+
+// ProxyOptions configures ProxyWith.
+type ProxyOptions struct {
+	// Capture, if not nil, is sent a copy of the messages
+	// forwarded, and failing to send one stops the proxy.
+	Capture ZeroMQSocket
+
+	// CaptureFilter, if not nil, restricts the capture to the
+	// messages it returns true for, such as those of a topic
+	// or under a size. It must not keep or modify msg.
+	CaptureFilter func(msg [][]byte) bool
+
+	// CaptureSample, if more than 1, captures one message
+	// out of every CaptureSample that pass CaptureFilter, so
+	// that capturing a busy proxy does not overwhelm the
+	// capture socket's consumer.
+	CaptureSample int
+
+	// Control, if not nil, steers the proxy, see ProxyCommand.
+	Control <-chan ProxyCommand
+
+	// Counters, if not nil, counts what the proxy forwards,
+	// for monitoring it while it runs.
+	Counters *ProxyCounters
+}
+
+// ProxyCounters counts the messages and bytes a proxy forwards
+// in each direction, see ProxyOptions. It is safe for
+// concurrent use.
+type ProxyCounters struct {
+	frontendToBackend counters
+	backendToFrontend counters
+	paused            int32
+}
+
+// ProxyStats is a snapshot of a ProxyCounters.
+type ProxyStats struct {
+	// FrontendToBackend counts the messages received on the
+	// frontend and sent to the backend, BackendToFrontend
+	// those going the other way.
+	FrontendToBackend ProxyFlow
+	BackendToFrontend ProxyFlow
+
+	// Paused reports whether the proxy is paused, see ProxyPause.
+	Paused bool
+}
+
+// ProxyFlow counts what a proxy forwarded one way.
+type ProxyFlow struct {
+	Messages uint64
+	Bytes    uint64
+}
+
+// Stats returns the current counts of c.
+func (c *ProxyCounters) Stats() ProxyStats {
+	flow := func(c *counters) ProxyFlow {
+		return ProxyFlow{
+			Messages: atomic.LoadUint64(&c.messagesSent),
+			Bytes:    atomic.LoadUint64(&c.bytesSent),
+		}
+	}
+	return ProxyStats{
+		FrontendToBackend: flow(&c.frontendToBackend),
+		BackendToFrontend: flow(&c.backendToFrontend),
+		Paused:            atomic.LoadInt32(&c.paused) != 0,
+	}
+}
+
+// ProxyWith is like Proxy, configured by opts.
+func ProxyWith(ctx context.Context, frontend, backend ZeroMQSocket, opts ProxyOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g := newProxyGate()
+	var frontToBack, backToFront *counters
+	if c := opts.Counters; c != nil {
+		g.counters = c
+		frontToBack, backToFront = &c.frontendToBackend, &c.backendToFrontend
+	}
+	var capture *proxyCapture
+	if opts.Capture != nil {
+		capture = &proxyCapture{socket: opts.Capture, filter: opts.CaptureFilter, sample: uint64(opts.CaptureSample)}
+	}
+	errc := make(chan error, 4)
+	go func() { errc <- forward(ctx, frontend, backend, capture, g, frontToBack) }()
+	go func() { errc <- forward(ctx, backend, frontend, capture, g, backToFront) }()
+	n := 2
+
+	if pub, sub, ok := pubSubPair(frontend, backend); ok {
+		go func() { errc <- forwardSubscriptions(ctx, pub, sub) }()
+		n++
+	}
+	if opts.Control != nil {
+		sockets := []ZeroMQSocket{frontend, backend}
+		if opts.Capture != nil {
+			sockets = append(sockets, opts.Capture)
+		}
+		go func() { errc <- steer(ctx, opts.Control, g, sockets) }()
+		n++
+	}
+
+	var err error
+	for i := 0; i < n; i++ {
+		if e := <-errc; e != nil && err == nil {
+			err = e
+			cancel()
+		}
+	}
+	switch err {
+	case nil:
+		return ErrNotSupported
+	case errProxyTerminated:
+		return nil
+	}
+	return err
+}
+
+// proxyCapture sends copies of the messages a
+// proxy forwards to a socket, see ProxyOptions.
+type proxyCapture struct {
+	seen   uint64 // first for alignment, accessed atomically
+	socket ZeroMQSocket
+	filter func(msg [][]byte) bool
+	sample uint64
+}
+
+// send captures msg, unless c is nil or
+// msg is filtered or sampled out.
+func (c *proxyCapture) send(ctx context.Context, msg [][]byte) error {
+	if c == nil || c.filter != nil && !c.filter(msg) {
+		return nil
+	}
+	if c.sample > 1 && (atomic.AddUint64(&c.seen, 1)-1)%c.sample != 0 {
+		return nil
+	}
+	return c.socket.SendMultipartContext(ctx, msg)
+}
+
+var errProxyTerminated = errors.New("gomq: proxy terminated")
+
+// proxyGate pauses the forwarding of a Proxy,
+// recording it on counters if not nil.
+type proxyGate struct {
+	lock     sync.Mutex
+	open     chan struct{}
+	counters *ProxyCounters
+}
+
+func newProxyGate() *proxyGate {
+	open := make(chan struct{})
+	close(open)
+	return &proxyGate{open: open}
+}
+
+// wait returns a channel that is closed
+// while forwarding is not paused.
+func (g *proxyGate) wait() <-chan struct{} {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.open
+}
+
+// set pauses forwarding if paused is set,
+// and resumes it otherwise.
+func (g *proxyGate) set(paused bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	select {
+	case <-g.open:
+		if paused {
+			g.open = make(chan struct{})
+		}
+	default:
+		if !paused {
+			close(g.open)
+		}
+	}
+	if g.counters != nil {
+		var flag int32
+		if paused {
+			flag = 1
+		}
+		atomic.StoreInt32(&g.counters.paused, flag)
+	}
+}
+
+// steer applies the commands received on control to g and
+// sockets until ctx is done, control is closed or ProxyTerminate
+// is received, which it returns errProxyTerminated for.
+func steer(ctx context.Context, control <-chan ProxyCommand, g *proxyGate, sockets []ZeroMQSocket) error {
+	var untraced []LogLevel
+	for {
+		select {
+		case cmd, ok := <-control:
+			if !ok {
+				return nil
+			}
+			switch cmd {
+			case ProxyPause:
+				g.set(true)
+			case ProxyResume:
+				g.set(false)
+			case ProxyTerminate:
+				return errProxyTerminated
+			case ProxyTrace:
+				if untraced == nil {
+					for _, s := range sockets {
+						untraced = append(untraced, baseOf(s).LogLevel())
+					}
+				}
+				for _, s := range sockets {
+					baseOf(s).SetLogLevel(LogTrace)
+				}
+			case ProxyUntrace:
+				for i, level := range untraced {
+					baseOf(sockets[i]).SetLogLevel(level)
+				}
+				untraced = nil
+			default:
+				if cmd >= proxyLogLevel {
+					for _, s := range sockets {
+						baseOf(s).SetLogLevel(LogLevel(cmd - proxyLogLevel))
+					}
+					untraced = nil
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// forward sends the messages received on from to to, and to
+// capture, waiting while g is paused and counting them on flow
+// if not nil. It returns nil if either socket's type does not
+// support it.
+func forward(ctx context.Context, from, to ZeroMQSocket, capture *proxyCapture, g *proxyGate, flow *counters) error {
+	for {
+		select {
+		case <-g.wait():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		msg, err := from.RecvMultipartContext(ctx)
+		if err == nil {
+			select {
+			case <-g.wait():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			err = to.SendMultipartContext(ctx, msg)
+		}
+		if errors.Is(err, ErrNotSupported) {
+			return nil
+		}
+		if err == nil {
+			if flow != nil {
+				flow.sent(msg)
+			}
+			err = capture.send(ctx, msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pubSubPair returns the PubSocket and the SubSocket
+// among a and b, if there is one of each.
+func pubSubPair(a, b ZeroMQSocket) (*PubSocket, *SubSocket, bool) {
+	if pub, ok := a.(*PubSocket); ok {
+		sub, ok := b.(*SubSocket)
+		return pub, sub, ok
+	}
+	if pub, ok := b.(*PubSocket); ok {
+		sub, ok := a.(*SubSocket)
+		return pub, sub, ok
+	}
+	return nil, nil, false
+}
+
+// forwardSubscriptions subscribes sub to the prefixes pub's
+// peers are subscribed to until ctx is done, following them
+// as peers subscribe, cancel, connect and disconnect. Each
+// prefix is subscribed to once, however many peers share it,
+// and cancelled once the last of them is gone, so that many
+// subscribers do not flood the publishers upstream. The
+// subscriptions it made are cancelled when it returns.
+func forwardSubscriptions(ctx context.Context, pub *PubSocket, sub *SubSocket) error {
+	forwarded := make(map[string]bool)
+	defer func() {
+		for prefix := range forwarded {
+			sub.Unsubscribe([]byte(prefix))
+		}
+	}()
+
+	for {
+		prefixes, subscriptionsChanged, peersChanged := pub.peerSubscriptions()
+		for prefix := range prefixes {
+			if !forwarded[prefix] {
+				sub.Subscribe([]byte(prefix))
+				forwarded[prefix] = true
+			}
+		}
+		for prefix := range forwarded {
+			if prefixes[prefix] == 0 {
+				sub.Unsubscribe([]byte(prefix))
+				delete(forwarded, prefix)
+			}
+		}
+
+		select {
+		case <-subscriptionsChanged:
+		case <-peersChanged:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
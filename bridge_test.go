@@ -0,0 +1,419 @@
+package gomq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// runBridge runs Bridge in the background until
+// the returned function is called, and returns
+// the error it stopped with.
+func runBridge(t *testing.T, frontend, backend ZeroMQSocket) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- Bridge(ctx, frontend, backend) }()
+	return func() error {
+		cancel()
+		return <-errc
+	}
+}
+
+func TestBridge(t *testing.T) {
+	upstream := NewServer(zmtp.NewSecurityNull())
+	defer upstream.Close()
+	if _, err := upstream.Bind("tcp://127.0.0.1:19051"); err != nil {
+		t.Fatal(err)
+	}
+
+	frontend := NewServer(zmtp.NewSecurityNull())
+	defer frontend.Close()
+	if _, err := frontend.Bind("tcp://127.0.0.1:19052"); err != nil {
+		t.Fatal(err)
+	}
+	backend := NewClient(zmtp.NewSecurityNull())
+	defer backend.Close()
+	if err := backend.Connect("tcp://127.0.0.1:19051"); err != nil {
+		t.Fatal(err)
+	}
+	stop := runBridge(t, frontend, backend)
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("tcp://127.0.0.1:19052"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := upstream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(b); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := upstream.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+	b, err = client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "WORLD", string(b); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if want, got := context.Canceled, stop(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestBridgeSubscriptions(t *testing.T) {
+	upstream := NewPub(zmtp.NewSecurityNull())
+	defer upstream.Close()
+	if _, err := upstream.Bind("tcp://127.0.0.1:19053"); err != nil {
+		t.Fatal(err)
+	}
+
+	frontend := NewPub(zmtp.NewSecurityNull())
+	defer frontend.Close()
+	if _, err := frontend.Bind("tcp://127.0.0.1:19054"); err != nil {
+		t.Fatal(err)
+	}
+	backend := NewSub(zmtp.NewSecurityNull())
+	defer backend.Close()
+	if err := backend.Connect("tcp://127.0.0.1:19053"); err != nil {
+		t.Fatal(err)
+	}
+	stop := runBridge(t, frontend, backend)
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	if err := sub.Connect("tcp://127.0.0.1:19054"); err != nil {
+		t.Fatal(err)
+	}
+	sub.Subscribe([]byte("weather"))
+
+	// The subscription travels through the bridge to the
+	// upstream publisher, which drops the rest.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		prefixes, _, _ := upstream.peerSubscriptions()
+		if prefixes["weather"] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want the subscription forwarded, got %v", prefixes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the upstream publisher sees a prefix subscribed
+	// to once, however many subscribers share it
+	other := NewSub(zmtp.NewSecurityNull())
+	defer other.Close()
+	if err := other.Connect("tcp://127.0.0.1:19054"); err != nil {
+		t.Fatal(err)
+	}
+	other.Subscribe([]byte("weather"))
+	other.Subscribe([]byte("news"))
+	waitForPrefix(t, upstream, "news", 1)
+	waitForPrefix(t, upstream, "weather", 1)
+	other.Unsubscribe([]byte("weather"))
+	other.Unsubscribe([]byte("news"))
+	waitForPrefix(t, upstream, "news", 0)
+	waitForPrefix(t, upstream, "weather", 1)
+
+	upstream.Send([]byte("sports"))
+	upstream.Send([]byte("weather"))
+	b, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "weather", string(b); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// Subscriptions are cancelled once the bridge stops.
+	stop()
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		prefixes, _, _ := upstream.peerSubscriptions()
+		if len(prefixes) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want no subscriptions, got %v", prefixes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForPrefix waits for the peers of pub to be
+// subscribed n times to prefix, failing t otherwise.
+func waitForPrefix(t *testing.T, pub *PubSocket, prefix string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		prefixes, _, _ := pub.peerSubscriptions()
+		if prefixes[prefix] == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want %q subscribed to %d times, got %v", prefix, n, prefixes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream := NewServer(zmtp.NewSecurityNull())
+	defer upstream.Close()
+	if _, err := upstream.Bind("inproc://proxy-upstream"); err != nil {
+		t.Fatal(err)
+	}
+	tap := NewServer(zmtp.NewSecurityNull())
+	defer tap.Close()
+	if _, err := tap.Bind("inproc://proxy-tap"); err != nil {
+		t.Fatal(err)
+	}
+
+	frontend := NewServer(zmtp.NewSecurityNull())
+	defer frontend.Close()
+	if _, err := frontend.Bind("inproc://proxy-frontend"); err != nil {
+		t.Fatal(err)
+	}
+	backend := NewClient(zmtp.NewSecurityNull())
+	defer backend.Close()
+	if err := backend.Connect("inproc://proxy-upstream"); err != nil {
+		t.Fatal(err)
+	}
+	capture := NewClient(zmtp.NewSecurityNull())
+	defer capture.Close()
+	if err := capture.Connect("inproc://proxy-tap"); err != nil {
+		t.Fatal(err)
+	}
+
+	control := make(chan ProxyCommand)
+	errc := make(chan error, 1)
+	go func() { errc <- Proxy(context.Background(), frontend, backend, capture, control) }()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("inproc://proxy-frontend"); err != nil {
+		t.Fatal(err)
+	}
+
+	recv := func(s ZeroMQSocket) string {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		b, err := s.RecvContext(ctx)
+		if err != nil {
+			return err.Error()
+		}
+		return string(b)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", recv(upstream); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "HELLO", recv(tap); want != got {
+		t.Errorf("want %q captured, got %q", want, got)
+	}
+
+	control <- ProxyPause
+	time.Sleep(10 * time.Millisecond) // let the proxy apply the command
+	if err := client.Send([]byte("LATER")); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := context.DeadlineExceeded.Error(), recv(upstream); want != got {
+		t.Errorf("want %q while paused, got %q", want, got)
+	}
+	control <- ProxyResume
+	if want, got := "LATER", recv(upstream); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	backend.SetLogLevel(LogDebug)
+	control <- ProxyTrace
+	control <- ProxyUntrace
+	control <- ProxyTrace
+	time.Sleep(10 * time.Millisecond)
+	for _, s := range []ZeroMQSocket{frontend, backend, capture} {
+		if want, got := LogTrace, baseOf(s).LogLevel(); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+	control <- ProxyUntrace
+	control <- ProxyLogLevel(LogError)
+	control <- ProxyUntrace
+	time.Sleep(10 * time.Millisecond)
+	if want, got := LogError, backend.LogLevel(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	control <- ProxyTrace
+	control <- ProxyUntrace
+	time.Sleep(10 * time.Millisecond)
+	if want, got := LogError, frontend.LogLevel(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	control <- ProxyTerminate
+	if err := <-errc; err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+func TestProxyCapture(t *testing.T) {
+	tap := NewServer(zmtp.NewSecurityNull())
+	defer tap.Close()
+	if _, err := tap.Bind("inproc://proxy-capture-tap"); err != nil {
+		t.Fatal(err)
+	}
+	frontend := NewServer(zmtp.NewSecurityNull())
+	defer frontend.Close()
+	if _, err := frontend.Bind("inproc://proxy-capture-frontend"); err != nil {
+		t.Fatal(err)
+	}
+	backend := NewServer(zmtp.NewSecurityNull())
+	defer backend.Close()
+	if _, err := backend.Bind("inproc://proxy-capture-backend"); err != nil {
+		t.Fatal(err)
+	}
+	capture := NewClient(zmtp.NewSecurityNull())
+	defer capture.Close()
+	if err := capture.Connect("inproc://proxy-capture-tap"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	control := make(chan ProxyCommand)
+	var counters ProxyCounters
+	go func() {
+		errc <- ProxyWith(ctx, frontend, backend, ProxyOptions{
+			Capture:       capture,
+			CaptureFilter: func(msg [][]byte) bool { return bytes.HasPrefix(msg[0], []byte("a.")) },
+			CaptureSample: 2,
+			Control:       control,
+			Counters:      &counters,
+		})
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("inproc://proxy-capture-frontend"); err != nil {
+		t.Fatal(err)
+	}
+	upstream := NewClient(zmtp.NewSecurityNull())
+	defer upstream.Close()
+	if err := upstream.Connect("inproc://proxy-capture-backend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.WaitForPeers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := []string{"a.1", "b.1", "a.2", "a.3", "b.2", "a.4", "a.5"}
+	for _, msg := range sent {
+		if err := client.Send([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := upstream.Recv(); err != nil || string(got) != msg {
+			t.Fatalf("want %q, got %q, %v", msg, got, err)
+		}
+	}
+
+	// only the a. messages are captured, one out of two
+	for _, want := range []string{"a.1", "a.3", "a.5"} {
+		if got, err := tap.Recv(); err != nil || string(got) != want {
+			t.Errorf("want %q captured, got %q, %v", want, got, err)
+		}
+	}
+	if _, ok, err := tap.TryRecv(); ok || err != nil {
+		t.Errorf("want no more captured messages, got %v, %v", ok, err)
+	}
+
+	if err := upstream.Send([]byte("done")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Recv(); err != nil || string(got) != "done" {
+		t.Fatalf("want %q, got %q, %v", "done", got, err)
+	}
+	control <- ProxyPause
+	control <- ProxyPause // wait for the first one to be applied
+	want := ProxyStats{
+		FrontendToBackend: ProxyFlow{Messages: 7, Bytes: 21},
+		BackendToFrontend: ProxyFlow{Messages: 1, Bytes: 4},
+		Paused:            true,
+	}
+	// the reply may be counted just after it was received
+	deadline := time.Now().Add(5 * time.Second)
+	for got := counters.Stats(); want != got; got = counters.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %+v, got %+v", want, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if want, got := context.Canceled, <-errc; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestForward(t *testing.T) {
+	server := NewPush(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://forward"); err != nil {
+		t.Fatal(err)
+	}
+	src := NewPull(zmtp.NewSecurityNull())
+	defer src.Close()
+	if err := src.Connect("inproc://forward"); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewPull(zmtp.NewSecurityNull())
+	defer sink.Close()
+	if _, err := sink.Bind("inproc://forward-sink"); err != nil {
+		t.Fatal(err)
+	}
+	dst := NewPush(zmtp.NewSecurityNull())
+	defer dst.Close()
+	if err := dst.Connect("inproc://forward-sink"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SendMultipart([][]byte{[]byte("A"), []byte("B"), []byte("C")}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Forward(ctx, src, dst); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sink.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "[A B C]", fmt.Sprintf("%s", msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if want, got := ErrNotSupported, Forward(ctx, pub, dst); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
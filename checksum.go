@@ -0,0 +1,79 @@
+package gomq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+)
+
+// checksumsProperty is the handshake metadata property
+// listing the message checksums a socket supports.
+const checksumsProperty = "checksums"
+
+// checksumCRC32C is the only checksum supported, a CRC-32
+// with the Castagnoli polynomial over a message's frames.
+const checksumCRC32C = "crc32c"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// SetChecksum enables or disables ending each message sent on
+// connections established from then on with a frame holding
+// a checksum of the message, for transports or middleboxes
+// known to corrupt data silently. Checksums are only used
+// with peers that enable them too, which is reported in
+// PeerInfo.Metadata. A message failing its checksum fails the
+// connection with ErrChecksum.
+func (s *Socket) SetChecksum(enabled bool) {
+	value := ""
+	if enabled {
+		value = checksumCRC32C
+	}
+	s.SetMetadata(checksumsProperty, value)
+}
+
+// negotiateChecksum reports whether both ends of
+// a connection support the same checksum.
+func negotiateChecksum(local, remote string) bool {
+	has := func(list string) bool {
+		for _, name := range strings.Split(list, ",") {
+			if strings.TrimSpace(name) == checksumCRC32C {
+				return true
+			}
+		}
+		return false
+	}
+	return has(local) && has(remote)
+}
+
+// checksum returns the checksum of frames, which covers
+// the length of each frame as well as its content.
+func checksum(frames [][]byte) []byte {
+	var buf [4]byte
+	sum := uint32(0)
+	for _, frame := range frames {
+		binary.BigEndian.PutUint32(buf[:], uint32(len(frame)))
+		sum = crc32.Update(sum, castagnoli, buf[:])
+		sum = crc32.Update(sum, castagnoli, frame)
+	}
+	binary.BigEndian.PutUint32(buf[:], sum)
+	return buf[:]
+}
+
+// appendChecksum returns frames followed by their checksum,
+// leaving frames untouched.
+func appendChecksum(frames [][]byte) [][]byte {
+	withSum := make([][]byte, len(frames), len(frames)+1)
+	copy(withSum, frames)
+	return append(withSum, checksum(frames))
+}
+
+// verifyChecksum checks the checksum frame ending msg,
+// and returns msg without it.
+func verifyChecksum(msg [][]byte) ([][]byte, bool) {
+	if len(msg) < 2 {
+		return nil, false
+	}
+	frames, sum := msg[:len(msg)-1], msg[len(msg)-1]
+	return frames, bytes.Equal(sum, checksum(frames))
+}
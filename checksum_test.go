@@ -0,0 +1,81 @@
+package gomq
+
+import (
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	frames := [][]byte{[]byte("key"), nil, []byte("value")}
+	msg := appendChecksum(frames)
+	if want, got := len(frames)+1, len(msg); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	got, ok := verifyChecksum(msg)
+	if !ok {
+		t.Fatal("want the checksum to match")
+	}
+	if want, got := len(frames), len(got); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	msg[2] = []byte("valve")
+	if _, ok := verifyChecksum(msg); ok {
+		t.Error("want a corrupted frame to fail the checksum")
+	}
+
+	// moving bytes between frames changes the checksum
+	moved := appendChecksum([][]byte{[]byte("ab"), []byte("c")})
+	moved[0], moved[1] = []byte("a"), []byte("bc")
+	if _, ok := verifyChecksum(moved); ok {
+		t.Error("want moved bytes to fail the checksum")
+	}
+
+	if _, ok := verifyChecksum([][]byte{[]byte("short")}); ok {
+		t.Error("want a message without checksum to fail")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetChecksum(true)
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19046"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetChecksum(true)
+
+	if err := client.Connect("tcp://127.0.0.1:19046"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := server.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "WORLD", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
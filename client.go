@@ -9,17 +9,15 @@ type ClientSocket struct {
 }
 
 // NewClient accepts a zmtp.SecurityMechanism and returns
-// a ClientSocket as a gomq.Client interface.
-func NewClient(mechanism zmtp.SecurityMechanism) Client {
+// a ClientSocket, which implements gomq.Client.
+func NewClient(mechanism zmtp.SecurityMechanism) *ClientSocket {
 	return &ClientSocket{
 		Socket: NewSocket(false, zmtp.ClientSocketType, nil, mechanism),
 	}
 }
 
 // Connect accepts a zeromq endpoint and connects the
-// client socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// client socket to it, over any registered transport.
 func (c *ClientSocket) Connect(endpoint string) error {
 	return ConnectClient(c, endpoint)
 }
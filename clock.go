@@ -0,0 +1,92 @@
+package gomq
+
+import "time"
+
+// Clock is the time source of a socket's timers: heartbeats,
+// keepalives and the delays between connection attempts. It
+// is the system clock unless replaced with SetClock, such as
+// by a gomqtest.Clock making tests of these timers run
+// without waiting.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer of a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the Clock of package time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct{ t *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time        { return t.t.C }
+func (t systemTimer) Stop() bool                 { return t.t.Stop() }
+func (t systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
+
+// SetClock makes the socket's heartbeats, keepalives and
+// reconnection delays use c, for the connections and
+// connection attempts made from then on. A nil c restores
+// the system clock.
+func (s *Socket) SetClock(c Clock) {
+	s.lock.Lock()
+	s.clock = c
+	s.lock.Unlock()
+}
+
+// clocked is implemented by sockets embedding
+// *Socket, whose clock can be replaced.
+type clocked interface {
+	currentClock() Clock
+}
+
+// clockOf returns the clock of s.
+func clockOf(s ZeroMQSocket) Clock {
+	if c, ok := s.(clocked); ok {
+		return c.currentClock()
+	}
+	return systemClock{}
+}
+
+func (s *Socket) currentClock() Clock {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.clock == nil {
+		return systemClock{}
+	}
+	return s.clock
+}
+
+// now returns the time of the connection's clock.
+func (c *Connection) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
@@ -0,0 +1,78 @@
+// Command gomq-bridge bridges the peers of one endpoint to the
+// peers of another, which may use a different transport.
+//
+// Usage:
+//
+//	gomq-bridge [flags] -bind endpoint -connect endpoint
+//
+// A socket bound to -bind forwards the messages its peers send
+// to a socket connected to -connect, and back. The -pattern
+// flag chooses the pair of sockets:
+//
+//	client    SERVER bound, CLIENT connected (the default)
+//	pubsub    PUB bound, SUB connected, following subscriptions
+//	pipeline  PULL bound, PUSH connected
+//
+// The bridge runs until it is interrupted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// sockets returns the bound and connected sockets of pattern.
+func sockets(pattern string) (frontend, backend gomq.ZeroMQSocket, err error) {
+	mechanism := zmtp.NewSecurityNull()
+	switch pattern {
+	case "client":
+		return gomq.NewServer(mechanism), gomq.NewClient(mechanism), nil
+	case "pubsub":
+		return gomq.NewPub(mechanism), gomq.NewSub(mechanism), nil
+	case "pipeline":
+		return gomq.NewPull(mechanism), gomq.NewPush(mechanism), nil
+	}
+	return nil, nil, fmt.Errorf("unknown pattern %q", pattern)
+}
+
+func main() {
+	var (
+		bind    = flag.String("bind", "", "endpoint to bind the frontend socket to")
+		connect = flag.String("connect", "", "endpoint to connect the backend socket to")
+		pattern = flag.String("pattern", "client", "sockets to bridge: client, pubsub or pipeline")
+	)
+	flag.Parse()
+
+	if *bind == "" || *connect == "" || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: gomq-bridge [-pattern client|pubsub|pipeline] -bind endpoint -connect endpoint")
+		os.Exit(2)
+	}
+
+	frontend, backend, err := sockets(*pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer frontend.Close()
+	defer backend.Close()
+
+	if _, err := frontend.(gomq.Server).Bind(*bind); err != nil {
+		log.Fatal(err)
+	}
+	if err := backend.(gomq.Client).Connect(*connect); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := gomq.Bridge(ctx, frontend, backend); err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+// Command gomq-replay publishes messages captured with a
+// gomq.Recorder into a test environment.
+//
+// Usage:
+//
+//	gomq-replay [flags] recording...
+//
+// The recordings are replayed in order through a CLIENT
+// socket connected to -connect, or a SERVER socket bound to
+// -bind once a peer has connected. Messages are sent at the
+// pace they were recorded, scaled by -speed. Each -remap
+// old=new flag replaces the topic prefix old with new at
+// the start of the first frame of each message.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// remaps collects the -remap flags.
+type remaps [][2][]byte
+
+func (r *remaps) String() string {
+	parts := make([]string, len(*r))
+	for i, remap := range *r {
+		parts[i] = string(remap[0]) + "=" + string(remap[1])
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *remaps) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 0 {
+		return fmt.Errorf("want old=new, got %q", value)
+	}
+	*r = append(*r, [2][]byte{[]byte(value[:i]), []byte(value[i+1:])})
+	return nil
+}
+
+// rewrite applies the first matching remap to the
+// topic prefix of the message's first frame.
+func (r remaps) rewrite(msg [][]byte) [][]byte {
+	if len(msg) == 0 {
+		return msg
+	}
+
+	for _, remap := range r {
+		if bytes.HasPrefix(msg[0], remap[0]) {
+			topic := append(append([]byte(nil), remap[1]...), msg[0][len(remap[0]):]...)
+			return append([][]byte{topic}, msg[1:]...)
+		}
+	}
+	return msg
+}
+
+func main() {
+	var (
+		connect = flag.String("connect", "", "endpoint to connect a CLIENT socket to")
+		bind    = flag.String("bind", "", "endpoint to bind a SERVER socket to")
+		speed   = flag.Float64("speed", 1, "pace factor, 0 to send as fast as possible")
+		remap   remaps
+	)
+	flag.Var(&remap, "remap", "replace topic prefix `old=new`, may be repeated")
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*connect == "") == (*bind == "") {
+		fmt.Fprintln(os.Stderr, "usage: gomq-replay -connect endpoint|-bind endpoint [-speed factor] [-remap old=new] recording...")
+		os.Exit(2)
+	}
+
+	var s gomq.ZeroMQSocket
+	if *connect != "" {
+		client := gomq.NewClient(zmtp.NewSecurityNull())
+		if err := client.Connect(*connect); err != nil {
+			log.Fatal(err)
+		}
+		s = client
+	} else {
+		server := gomq.NewServer(zmtp.NewSecurityNull())
+		go func() {
+			if _, err := server.Bind(*bind); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		if err := server.WaitForPeers(1, time.Minute); err != nil {
+			log.Fatal(err)
+		}
+		s = server
+	}
+	defer s.Close()
+
+	opts := gomq.ReplayOptions{Speed: *speed}
+	if len(remap) > 0 {
+		opts.Rewrite = remap.rewrite
+	}
+
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = gomq.Replay(s, gomq.NewRecordReader(f), opts)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package gomq
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// codecsProperty is the handshake metadata property
+// listing the codecs a socket supports, most preferred
+// first, separated by commas.
+const codecsProperty = "codecs"
+
+// Codec encodes and decodes message payloads. Sockets
+// negotiate which codec to use with each peer during
+// the handshake, see Socket.SetCodecs.
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsLock sync.RWMutex
+	codecs     = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec(JSONCodec{})
+}
+
+// RegisterCodec makes a codec available by name to
+// LookupCodec, replacing any codec of the same name.
+func RegisterCodec(c Codec) {
+	codecsLock.Lock()
+	codecs[strings.ToLower(c.Name())] = c
+	codecsLock.Unlock()
+}
+
+// LookupCodec returns the registered codec with the
+// given name, or nil if there is none.
+func LookupCodec(name string) Codec {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	return codecs[strings.ToLower(name)]
+}
+
+// JSONCodec is a Codec using encoding/json.
+type JSONCodec struct{}
+
+// Name returns "json".
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+// Marshal returns the JSON encoding of v.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON encoded data into v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// SetCodecs advertises the names of the codecs the socket
+// supports, most preferred first, to peers connecting from
+// then on. The codec agreed with each peer is reported in
+// PeerInfo.Codec.
+func (s *Socket) SetCodecs(names ...string) {
+	s.SetMetadata(codecsProperty, strings.ToLower(strings.Join(names, ",")))
+}
+
+// negotiateCodec returns the first of the connecting side's
+// codecs that the binding side also supports, or an empty
+// string if they have none in common.
+func negotiateCodec(connecting, binding string) string {
+	supported := make(map[string]bool)
+	for _, name := range strings.Split(binding, ",") {
+		supported[strings.TrimSpace(name)] = true
+	}
+
+	for _, name := range strings.Split(connecting, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && supported[name] {
+			return name
+		}
+	}
+	return ""
+}
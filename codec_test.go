@@ -0,0 +1,78 @@
+package gomq
+
+import (
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestNegotiateCodec(t *testing.T) {
+	for _, test := range []struct {
+		connecting, binding, want string
+	}{
+		{"protobuf,json", "json,protobuf", "protobuf"},
+		{"protobuf,json", "json", "json"},
+		{"protobuf", "json", ""},
+		{"", "json", ""},
+		{"json", "", ""},
+	} {
+		if got := negotiateCodec(test.connecting, test.binding); test.want != got {
+			t.Errorf("negotiateCodec(%q, %q): want %q, got %q", test.connecting, test.binding, test.want, got)
+		}
+	}
+}
+
+func TestCodecHandshake(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetCodecs("json")
+	server.SetMetadata("Service", "greeter")
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19016"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetCodecs("protobuf", "json")
+
+	if err := client.Connect("tcp://127.0.0.1:19016"); err != nil {
+		t.Fatal(err)
+	}
+
+	peer := client.Peers()[0]
+	if want, got := "json", peer.Codec; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "greeter", peer.Metadata["service"]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	codec := LookupCodec(peer.Codec)
+	if codec == nil {
+		t.Fatalf("codec %q is not registered", peer.Codec)
+	}
+
+	b, err := codec.Marshal(map[string]string{"greeting": "HELLO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(b); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]string
+	if err := codec.Unmarshal(msg, &v); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", v["greeting"]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,48 @@
+package gomq
+
+import (
+	"fmt"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// errorCommand is the ZMTP command a peer sends
+// before closing a connection after a fatal error.
+const errorCommand = "ERROR"
+
+// SetCommandHandler registers a function that is called,
+// without any of the socket's locks held, with each command
+// received that the socket does not handle itself, along
+// with the peer it came from. Commands handled by the socket,
+// such as PING, SUBSCRIBE or ERROR, never reach Recv either.
+func (s *Socket) SetCommandHandler(fn func(PeerInfo, string, []byte)) {
+	s.lock.Lock()
+	s.onCommand = fn
+	s.lock.Unlock()
+}
+
+// unknownCommand passes msg, a command received from conn
+// that the socket does not handle, to the command handler.
+func (s *Socket) unknownCommand(conn *Connection, msg *zmtp.Message) {
+	s.log(LogDebug, "unknown command", "command", msg.Name, "endpoint", conn.endpoint, "peer", conn.id)
+
+	info := conn.Info()
+	s.lock.RLock()
+	onCommand := s.onCommand
+	info.SocketIdentity, _ = s.namespace.Strip(info.SocketIdentity)
+	s.lock.RUnlock()
+
+	if onCommand != nil {
+		onCommand(info, msg.Name, firstFrame(msg))
+	}
+}
+
+// commandError returns the error a peer reported with
+// msg, an ERROR command holding a short reason string.
+func commandError(msg *zmtp.Message) error {
+	body := firstFrame(msg)
+	if len(body) > 0 && int(body[0]) < len(body) {
+		body = body[1 : 1+int(body[0])]
+	}
+	return fmt.Errorf("gomq: peer sent ERROR: %s", body)
+}
@@ -0,0 +1,60 @@
+package gomq
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestCommandHandler(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://command"); err != nil {
+		t.Fatal(err)
+	}
+	commands := make(chan string, 1)
+	server.SetCommandHandler(func(peer PeerInfo, name string, body []byte) {
+		commands <- name + " " + string(body)
+	})
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("inproc://command"); err != nil {
+		t.Fatal(err)
+	}
+	command := func(name string, body []byte) {
+		client.lock.RLock()
+		for _, id := range client.ids {
+			client.conns[id].outbox.push(&outgoing{frames: [][]byte{body}, command: name})
+		}
+		client.lock.RUnlock()
+	}
+
+	command(keepaliveCommand, nil)
+	command("HELLO", []byte("world"))
+	if err := client.Send([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO world", <-commands; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "data", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	command(errorCommand, append([]byte{4}, "boom"...))
+	if _, err := server.Recv(); !errors.Is(err, ErrProtocol) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("want a %v error with the peer's reason, got %v", ErrProtocol, err)
+	}
+	select {
+	case name := <-commands:
+		t.Errorf("unexpected command %v", name)
+	default:
+	}
+}
@@ -0,0 +1,121 @@
+package gomq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// TestConcurrentUse sends, receives and changes options from
+// many goroutines at once, for the race detector to check.
+func TestConcurrentUse(t *testing.T) {
+	const senders, messages = 8, 50
+
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("inproc://concurrent"); err != nil {
+		t.Fatal(err)
+	}
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	if err := push.Connect("inproc://concurrent"); err != nil {
+		t.Fatal(err)
+	}
+	other := NewPush(zmtp.NewSecurityNull())
+	defer other.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				var err error
+				switch j % 3 {
+				case 0:
+					err = push.Send([]byte("x"))
+				case 1:
+					err = push.SendMultipart([][]byte{[]byte("x"), []byte("y")})
+				default:
+					err = push.SendPriority([]byte("x"))
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			push.SetSendHWM(1000 + i)
+			push.Endpoints()
+			push.Peers()
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := other.Connect("inproc://concurrent"); err != nil {
+			t.Error(err)
+		}
+		other.Send([]byte("x"))
+	}()
+
+	got := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				if _, err := pull.RecvMultipart(); err != nil {
+					return
+				}
+				got <- struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	timeout := time.After(5 * time.Second)
+	for n := 0; n < senders*messages+1; n++ {
+		select {
+		case <-got:
+		case <-timeout:
+			t.Fatalf("want %v messages, got %v", senders*messages+1, n)
+		}
+	}
+}
+
+func TestConcurrentPubSub(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if _, err := pub.Bind("inproc://concurrent-pubsub"); err != nil {
+		t.Fatal(err)
+	}
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	if err := sub.Connect("inproc://concurrent-pubsub"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				sub.Subscribe([]byte("a"))
+				sub.Unsubscribe([]byte("a"))
+				sub.TryRecv()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := pub.Send([]byte("a")); err != nil {
+					t.Error(err)
+					return
+				}
+				pub.Peers()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,36 @@
+package gomq
+
+import "context"
+
+// RecvContext is like Recv, but returns ctx.Err() if ctx is
+// done before a message arrives. Recv and RecvContext both
+// return ErrClosed once the socket is closed and every
+// message it received has been returned.
+func (s *Socket) RecvContext(ctx context.Context) ([]byte, error) {
+	msg, _ := s.next(ctx, true)
+	return firstFrame(msg), msg.Err
+}
+
+// RecvMultipartContext is like RecvMultipart, but returns
+// ctx.Err() if ctx is done before a message arrives.
+func (s *Socket) RecvMultipartContext(ctx context.Context) ([][]byte, error) {
+	msg, _ := s.next(ctx, true)
+	return msg.Body, msg.Err
+}
+
+// SendContext is like Send, but waits until the message can
+// be queued, whatever the socket's send mode, for no longer
+// than ctx allows. If ctx is done first, it returns a
+// *SendError wrapping ctx.Err().
+func (s *Socket) SendContext(ctx context.Context, b []byte) error {
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+	return s.deliver(ctx, [][]byte{b}, SendBlock)
+}
+
+// SendMultipartContext is like SendMultipart, but waits
+// like SendContext.
+func (s *Socket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return s.sendMultipart(ctx, b, SendBlock)
+}
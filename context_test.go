@@ -0,0 +1,29 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestContext(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.RecvContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := client.SendContext(ctx, []byte("HELLO")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	client.Close()
+	if _, err := client.RecvContext(context.Background()); err != ErrClosed {
+		t.Errorf("want %v, got %v", ErrClosed, err)
+	}
+}
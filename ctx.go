@@ -0,0 +1,165 @@
+package gomq
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// contexts numbers the contexts created, for their
+// inproc:// scopes.
+var contexts uint64
+
+// Context creates sockets sharing a security mechanism and
+// default options, like a libzmq context. The inproc://
+// names its sockets bind and connect to are private to it,
+// and Terminate closes all of them in one call.
+type Context struct {
+	lock       sync.Mutex
+	scope      string
+	mechanism  zmtp.SecurityMechanism
+	options    []contextOption
+	topology   *Topology
+	terminated bool
+}
+
+// contextOption is an option set on a Context,
+// applied to the sockets it creates.
+type contextOption struct {
+	opt   Option
+	value interface{}
+}
+
+// NewContext returns a Context whose sockets use the
+// NULL security mechanism and default options.
+func NewContext() *Context {
+	return &Context{
+		scope:     strconv.FormatUint(atomic.AddUint64(&contexts, 1), 10),
+		mechanism: zmtp.NewSecurityNull(),
+		topology:  NewTopology(),
+	}
+}
+
+// SetSecurity sets the security mechanism of
+// the sockets created from then on.
+func (c *Context) SetSecurity(mechanism zmtp.SecurityMechanism) {
+	c.lock.Lock()
+	c.mechanism = mechanism
+	c.lock.Unlock()
+}
+
+// SetOption sets opt to value on the sockets created from
+// then on, as SetOption would on each of them, such as
+// OptionSendBuffer for the size of their write buffers.
+func (c *Context) SetOption(opt Option, value interface{}) error {
+	// check the value on a socket that is never used
+	if err := NewSocket(false, zmtp.PairSocketType, nil, nil).SetOption(opt, value); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i := range c.options {
+		if c.options[i].opt == opt {
+			c.options[i].value = value
+			return nil
+		}
+	}
+	c.options = append(c.options, contextOption{opt: opt, value: value})
+	return nil
+}
+
+// NewSocket returns a socket of type t, named name in the
+// context for CloseBefore, with the context's security
+// mechanism and options. It returns ErrTerminated once
+// the context is terminated.
+func (c *Context) NewSocket(name string, t zmtp.SocketType) (ZeroMQSocket, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.terminated {
+		return nil, ErrTerminated
+	}
+	if c.topology.has(name) {
+		return nil, fmt.Errorf("gomq: socket %q already exists", name)
+	}
+
+	var s ZeroMQSocket
+	switch t {
+	case zmtp.ClientSocketType:
+		s = NewClient(c.mechanism)
+	case zmtp.ServerSocketType:
+		s = NewServer(c.mechanism)
+	case zmtp.PullSocketType:
+		s = NewPull(c.mechanism)
+	case zmtp.PushSocketType:
+		s = NewPush(c.mechanism)
+	case zmtp.DealerSocketType:
+		s = NewDealer(c.mechanism, "")
+	case zmtp.RouterSocketType:
+		s = NewRouter(c.mechanism)
+	case zmtp.ReqSocketType:
+		s = NewReq(c.mechanism)
+	case zmtp.RepSocketType:
+		s = NewRep(c.mechanism)
+	case zmtp.PubSocketType:
+		s = NewPub(c.mechanism)
+	case zmtp.SubSocketType:
+		s = NewSub(c.mechanism)
+	case zmtp.XPubSocketType:
+		s = NewXPub(c.mechanism)
+	case zmtp.XSubSocketType:
+		s = NewXSub(c.mechanism)
+	case zmtp.PairSocketType:
+		s = NewPair(c.mechanism)
+	case zmtp.StreamSocketType:
+		s = NewRaw()
+	default:
+		return nil, fmt.Errorf("gomq: unknown socket type %v", t)
+	}
+
+	for _, o := range c.options {
+		if err := baseOf(s).SetOption(o.opt, o.value); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if scoped, ok := s.(contextScoped); ok {
+		scoped.setScope(c.scope)
+	}
+	c.topology.Add(name, s)
+	return s, nil
+}
+
+// contextScoped is implemented by sockets embedding *Socket,
+// whose inproc:// names can be made private to a Context.
+type contextScoped interface {
+	setScope(scope string)
+}
+
+func (s *Socket) setScope(scope string) {
+	s.lock.Lock()
+	s.scope = scope
+	s.lock.Unlock()
+}
+
+// CloseBefore makes Terminate close the socket named
+// first before the one named then, see Topology.
+func (c *Context) CloseBefore(first, then string) error {
+	return c.topology.CloseBefore(first, then)
+}
+
+// Terminate closes every socket created by the context that
+// is not closed yet, in the order set with CloseBefore, and
+// waits for them to close, see Close. No socket can be created
+// with the context afterwards. It returns a *ShutdownError if
+// any socket failed to close cleanly.
+func (c *Context) Terminate() error {
+	c.lock.Lock()
+	c.terminated = true
+	c.lock.Unlock()
+
+	return c.topology.Shutdown()
+}
@@ -0,0 +1,81 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestNewContext(t *testing.T) {
+	ctx := NewContext()
+	if err := ctx.SetOption(OptionSendHWM, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SetOption(OptionSendHWM, "7"); err == nil {
+		t.Error("want an error setting an option to a value of the wrong type")
+	}
+
+	pull, err := ctx.NewSocket("pull", zmtp.PullSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	push, err := ctx.NewSocket("push", zmtp.PushSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.NewSocket("push", zmtp.PushSocketType); err == nil {
+		t.Error("want an error reusing a name")
+	}
+	if hwm, err := push.(*PushSocket).GetOption(OptionSendHWM); err != nil || hwm != 7 {
+		t.Errorf("want 7, got %v (%v)", hwm, err)
+	}
+	if err := ctx.CloseBefore("push", "pull"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the inproc names of different contexts do not clash
+	other := NewContext()
+	defer other.Terminate()
+	otherPull, err := other.NewSocket("pull", zmtp.PullSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []ZeroMQSocket{pull, otherPull} {
+		if _, err := s.(Server).Bind("inproc://context"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, got := "inproc://context", pull.(*PullSocket).LastEndpoint(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := push.(Client).Connect("inproc://context"); err != nil {
+		t.Fatal(err)
+	}
+	if err := push.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 0, len(otherPull.(*PullSocket).Peers()); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := ctx.Terminate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []ZeroMQSocket{pull, push} {
+		if _, err := s.Recv(); err != ErrClosed {
+			t.Errorf("want %v, got %v", ErrClosed, err)
+		}
+	}
+	if _, err := ctx.NewSocket("late", zmtp.PullSocketType); !errors.Is(err, ErrTerminated) {
+		t.Errorf("want %v, got %v", ErrTerminated, err)
+	}
+}
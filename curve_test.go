@@ -0,0 +1,69 @@
+package gomq
+
+import (
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestCurve(t *testing.T) {
+	serverPublic, serverSecret, err := zmtp.NewCurveKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, clientSecret, err := zmtp.NewCurveKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range []string{"tcp://127.0.0.1:19050", "ws://127.0.0.1:19064"} {
+		t.Run(endpoint, func(t *testing.T) {
+			testCurve(t, endpoint, serverPublic, serverSecret, clientPublic, clientSecret)
+		})
+	}
+}
+
+func testCurve(t *testing.T, endpoint string, serverPublic, serverSecret, clientPublic, clientSecret string) {
+	serverMechanism, err := zmtp.NewSecurityCurveServer(serverPublic, serverSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientMechanism, err := zmtp.NewSecurityCurveClient(serverPublic, clientPublic, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(serverMechanism)
+	defer server.Close()
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(clientMechanism)
+	defer client.Close()
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := server.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "WORLD", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
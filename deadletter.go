@@ -0,0 +1,108 @@
+package gomq
+
+import (
+	"fmt"
+)
+
+// DropReason tells why a message was dropped.
+type DropReason int
+
+const (
+	// DropUnroutable means there was no peer to send the message to.
+	DropUnroutable DropReason = iota
+
+	// DropPeerLost means the peer the message was queued for went
+	// away, and no other peer could take the message.
+	DropPeerLost
+
+	// DropPurged means the message was discarded by PurgeQueue.
+	DropPurged
+
+	// DropLinger means the socket was closed before
+	// the message could be written out.
+	DropLinger
+
+	// DropMemoryLimit means the socket's memory
+	// limit was reached, see MemoryLimit.
+	DropMemoryLimit
+
+	// DropExpired means the message was a request whose
+	// deadline passed before it was processed, see RPCServer.
+	DropExpired
+
+	// DropOverloaded means the message was a request shed
+	// by an overloaded server, see AdmissionPolicy.
+	DropOverloaded
+
+	// DropHighWaterMark means the queues of the peers the
+	// message was meant for were full, see SetSendHWM.
+	DropHighWaterMark
+)
+
+func (r DropReason) String() string {
+	switch r {
+	case DropUnroutable:
+		return "unroutable"
+	case DropPeerLost:
+		return "peer lost"
+	case DropPurged:
+		return "purged"
+	case DropLinger:
+		return "linger expired"
+	case DropMemoryLimit:
+		return "memory limit reached"
+	case DropExpired:
+		return "expired"
+	case DropOverloaded:
+		return "overloaded"
+	case DropHighWaterMark:
+		return "high-water mark reached"
+	}
+	return fmt.Sprintf("DropReason(%d)", int(r))
+}
+
+// DeadLetter is a message the socket dropped without
+// the caller of Send being told, along with the reason
+// and, when known, the peer it was meant for.
+type DeadLetter struct {
+	Reason   DropReason
+	PeerID   string
+	Endpoint string
+	Message  [][]byte
+	Err      error
+}
+
+// SetDeadLetterHandler registers a function that is called,
+// without any of the socket's locks held, with every message
+// the socket drops. See DeadLetterTo for sending dead letters
+// on to another socket.
+func (s *Socket) SetDeadLetterHandler(fn func(DeadLetter)) {
+	s.lock.Lock()
+	s.onDeadLetter = fn
+	s.lock.Unlock()
+}
+
+func (s *Socket) deadLetter(letter DeadLetter) {
+	s.log(LogDebug, "message dropped", "reason", letter.Reason, "endpoint", letter.Endpoint, "peer", letter.PeerID, "err", letter.Err)
+
+	s.lock.RLock()
+	onDeadLetter := s.onDeadLetter
+	s.lock.RUnlock()
+
+	if onDeadLetter != nil {
+		onDeadLetter(letter)
+	}
+}
+
+// DeadLetterTo returns a dead letter handler that sends each
+// dead letter to sink as a multipart message made of the drop
+// reason, the endpoint and the frames of the dropped message.
+// Dead letters the sink cannot take are themselves dropped.
+func DeadLetterTo(sink ZeroMQSocket) func(DeadLetter) {
+	return func(letter DeadLetter) {
+		msg := make([][]byte, 0, len(letter.Message)+2)
+		msg = append(msg, []byte(letter.Reason.String()), []byte(letter.Endpoint))
+		msg = append(msg, letter.Message...)
+		sendMultipartWith(sink, msg, SendDrop)
+	}
+}
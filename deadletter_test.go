@@ -0,0 +1,40 @@
+package gomq
+
+import (
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestDeadLetter(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	letters := make(chan DeadLetter, 1)
+	client.SetDeadLetterHandler(func(letter DeadLetter) {
+		letters <- letter
+	})
+
+	if err := client.SendWith([]byte("HELLO"), SendDrop); err != nil {
+		t.Fatal(err)
+	}
+
+	letter := <-letters
+	if want, got := DropUnroutable, letter.Reason; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := "HELLO", string(letter.Message[0]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// dead letters are not generated for sends the caller hears about
+	if err := client.SendWith([]byte("HELLO"), SendDontWait); err == nil {
+		t.Fatal("want error sending without peers")
+	}
+
+	select {
+	case letter := <-letters:
+		t.Errorf("unexpected dead letter %v", letter)
+	default:
+	}
+}
@@ -9,17 +9,15 @@ type DealerSocket struct {
 }
 
 // NewDealer accepts a zmtp.SecurityMechanism and an ID.
-// It returns a DealerSocket as a gomq.Dealer interface.
-func NewDealer(mechanism zmtp.SecurityMechanism, id string) Dealer {
+// It returns a DealerSocket, which implements gomq.Dealer.
+func NewDealer(mechanism zmtp.SecurityMechanism, id string) *DealerSocket {
 	return &DealerSocket{
 		Socket: NewSocket(false, zmtp.DealerSocketType, zmtp.SocketIdentity(id), mechanism),
 	}
 }
 
 // Connect accepts a zeromq endpoint and connects the
-// dealer socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// dealer socket to it, over any registered transport.
 func (d *DealerSocket) Connect(endpoint string) error {
 	return ConnectDealer(d, endpoint)
 }
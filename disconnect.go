@@ -0,0 +1,161 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+var errDisconnected = errors.New("gomq: endpoint disconnected")
+
+// dialer keeps a socket connected to one of its endpoints,
+// see connect, until Disconnect closes stop.
+type dialer struct {
+	endpoints []string
+	stop      chan struct{}
+}
+
+// dialerTracker is implemented by sockets that keep
+// track of the endpoints they connect to.
+type dialerTracker interface {
+	trackDialer(d *dialer)
+	forgetDialer(d *dialer)
+}
+
+// newDialer returns a dialer for endpoints, recorded
+// on s if s keeps track of them.
+func newDialer(s ZeroMQSocket, endpoints []string) *dialer {
+	d := &dialer{endpoints: endpoints, stop: make(chan struct{})}
+	if t, ok := s.(dialerTracker); ok {
+		t.trackDialer(d)
+	}
+	return d
+}
+
+// forget removes d from s once it stopped dialing.
+func (d *dialer) forget(s ZeroMQSocket) {
+	if t, ok := s.(dialerTracker); ok {
+		t.forgetDialer(d)
+	}
+}
+
+// matches reports whether d connects to endpoint, given
+// either as one of its endpoints or as the comma separated
+// list of all of them passed to Connect.
+func (d *dialer) matches(endpoint string) bool {
+	for _, e := range d.endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return len(d.endpoints) > 1 && strings.Join(d.endpoints, ",") == endpoint
+}
+
+func (s *Socket) trackDialer(d *dialer) {
+	s.lock.Lock()
+	s.dialers = append(s.dialers, d)
+	s.lock.Unlock()
+}
+
+func (s *Socket) forgetDialer(d *dialer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, other := range s.dialers {
+		if other == d {
+			s.dialers = append(s.dialers[:i], s.dialers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Disconnect disconnects the socket from endpoint, as passed
+// to Connect, like zmq_disconnect: it stops reconnecting to
+// it and closes its connection, redirecting the messages
+// queued toward it to the remaining peers. A Connect still
+// dialing endpoint fails. Disconnecting one endpoint of a
+// failover list stops the whole list, see ConnectAny. It
+// returns an error wrapping ErrUnknownEndpoint if the socket
+// is not connected to endpoint.
+func (s *Socket) Disconnect(endpoint string) error {
+	s.lock.Lock()
+	var stopped []string
+	dialers := s.dialers[:0]
+	for _, d := range s.dialers {
+		if d.matches(endpoint) {
+			close(d.stop)
+			stopped = append(stopped, d.endpoints...)
+		} else {
+			dialers = append(dialers, d)
+		}
+	}
+	s.dialers = dialers
+	s.lock.Unlock()
+
+	if len(stopped) == 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownEndpoint, endpoint)
+	}
+	s.detach(stopped)
+	return nil
+}
+
+// Unbind unbinds the socket from endpoint, as passed to Bind
+// or as reported by LastEndpoint, like zmq_unbind: unlike
+// StopListening, it also closes the connections accepted on
+// endpoint. It returns an error wrapping ErrUnknownEndpoint
+// if the socket is not bound to endpoint.
+func (s *Socket) Unbind(endpoint string) error {
+	removed := s.removeListeners(endpoint)
+	if len(removed) == 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownEndpoint, endpoint)
+	}
+
+	var unbound []string
+	for _, l := range removed {
+		l.ln.Close()
+		unbound = append(unbound, l.endpoint)
+	}
+	s.detach(unbound)
+	return nil
+}
+
+// detach closes the connections made through endpoints,
+// waits for them to be torn down, and forgets the state
+// of endpoints, see Endpoints.
+func (s *Socket) detach(endpoints []string) {
+	detached := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		detached[endpoint] = true
+	}
+
+	s.lock.RLock()
+	var conns []*Connection
+	for _, id := range s.ids {
+		if conn := s.conns[id]; detached[conn.endpoint] {
+			conns = append(conns, conn)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, conn := range conns {
+		atomic.StoreInt32(&conn.detached, 1)
+		s.disconnected(conn, errDisconnected)
+		select {
+		case <-conn.lost:
+		case <-s.done:
+			return
+		}
+	}
+
+	s.lock.Lock()
+	order := s.endpointOrder[:0]
+	for _, endpoint := range s.endpointOrder {
+		if detached[endpoint] {
+			delete(s.endpoints, endpoint)
+		} else {
+			order = append(order, endpoint)
+		}
+	}
+	s.endpointOrder = order
+	s.lock.Unlock()
+}
@@ -0,0 +1,114 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestDisconnect(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("tcp://127.0.0.1:19071"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetBackoff(Backoff{Initial: 10 * time.Millisecond})
+	if err := client.Connect("tcp://127.0.0.1:19071"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Disconnect("tcp://127.0.0.1:19071"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(client.Peers()); want != got {
+		t.Errorf("want %v peers, got %v", want, got)
+	}
+	if want, got := 0, len(client.Endpoints()); want != got {
+		t.Errorf("want %v endpoints, got %v", want, got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if want, got := 0, len(server.Peers()); want != got {
+		t.Errorf("want %v peers after the client stopped reconnecting, got %v", want, got)
+	}
+
+	if err := client.Disconnect("tcp://127.0.0.1:19071"); !errors.Is(err, ErrUnknownEndpoint) {
+		t.Errorf("want %v, got %v", ErrUnknownEndpoint, err)
+	}
+}
+
+func TestDisconnectWhileDialing(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetBackoff(Backoff{Initial: 10 * time.Millisecond})
+
+	errs := make(chan error)
+	go func() {
+		errs <- client.Connect("tcp://127.0.0.1:19072")
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for client.Disconnect("tcp://127.0.0.1:19072") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Connect did not start dialing")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := <-errs; !errors.Is(err, errDisconnected) {
+		t.Errorf("want %v, got %v", errDisconnected, err)
+	}
+}
+
+func TestUnbind(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("tcp://127.0.0.1:19073"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Bind("inproc://unbind"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("tcp://127.0.0.1:19073"); err != nil {
+		t.Fatal(err)
+	}
+	other := NewClient(zmtp.NewSecurityNull())
+	defer other.Close()
+	if err := other.Connect("inproc://unbind"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Unbind("tcp://127.0.0.1:19074"); !errors.Is(err, ErrUnknownEndpoint) {
+		t.Errorf("want %v, got %v", ErrUnknownEndpoint, err)
+	}
+	if err := server.Unbind("tcp://127.0.0.1:19073"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(server.Peers()); want != got {
+		t.Errorf("want %v peers, got %v", want, got)
+	}
+
+	if err := other.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,143 @@
+package gomq
+
+import (
+	"context"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// goAwayCommand is the ZMTP command a draining socket
+// sends its peers, asking them to stop sending to it.
+const goAwayCommand = "GOAWAY"
+
+// listenerTracker is implemented by sockets that
+// keep track of the listeners they were bound with.
+type listenerTracker interface {
+	trackListener(endpoint string, ln net.Listener) bool
+}
+
+// boundListener is a listener a socket was bound with.
+type boundListener struct {
+	endpoint string
+	ln       net.Listener
+}
+
+// trackListener records ln, listening on endpoint, as one of
+// the listeners of s, if s keeps track of them, and its address
+// as s's last endpoint. It closes ln and returns false if s is
+// draining or closed.
+func trackListener(s ZeroMQSocket, endpoint string, ln net.Listener) bool {
+	if t, ok := s.(listenerTracker); ok {
+		return t.trackListener(endpoint, ln)
+	}
+	return true
+}
+
+func (s *Socket) trackListener(endpoint string, ln net.Listener) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	select {
+	case <-s.done:
+		s.draining = true
+	default:
+	}
+	if s.draining {
+		ln.Close()
+		return false
+	}
+
+	s.listeners = append(s.listeners, boundListener{endpoint: endpoint, ln: ln})
+	s.lastEndpoint = ln.Addr().Network() + "://" + ln.Addr().String()
+	return true
+}
+
+// handleCommand handles the commands received from conn.
+// A peer that sends GOAWAY is draining, so no more messages
+// are queued toward it. SUBSCRIBE and CANCEL update the peer's
+// subscriptions, see PubSocket. PONG answers WaitReady's PINGs.
+// KEEPALIVEs are ignored, and other commands are passed on to
+// the command handler, see SetCommandHandler.
+func (s *Socket) handleCommand(conn *Connection, msg *zmtp.Message) {
+	switch msg.Name {
+	case goAwayCommand:
+		s.lock.Lock()
+		conn.goingAway = true
+		s.lock.Unlock()
+	case goodbyeCommand:
+		s.handleGoodbye(conn, string(firstFrame(msg)))
+	case pongCommand:
+		s.handlePong(msg)
+	case subscribeCommand:
+		var dropped []DeadLetter
+		s.lock.Lock()
+		conn.subscriptions.add(firstFrame(msg))
+		if s.onSubscribe != nil {
+			dropped = s.onSubscribe(conn, firstFrame(msg))
+		}
+		s.notifySubscriptionsChanged()
+		s.lock.Unlock()
+		for _, letter := range dropped {
+			s.deadLetter(letter)
+		}
+	case cancelCommand:
+		s.lock.Lock()
+		if conn.subscriptions.remove(firstFrame(msg)) {
+			s.notifySubscriptionsChanged()
+		}
+		s.lock.Unlock()
+	case keepaliveCommand:
+	default:
+		s.unknownCommand(conn, msg)
+	}
+}
+
+// notifySubscriptionsChanged wakes up everyone waiting on a
+// change in the subscriptions of the socket's peers. The
+// caller must hold the lock.
+func (s *Socket) notifySubscriptionsChanged() {
+	close(s.subsChanged)
+	s.subsChanged = make(chan struct{})
+}
+
+// Drain closes the socket without losing messages, for
+// rolling restarts. It stops accepting connections, asks
+// every peer to stop sending to the socket, and waits for
+// the messages already queued toward peers to be written
+// before closing the socket. If ctx is done first, the
+// messages still queued go to the dead letter handler
+// and ctx's error is returned.
+func (s *Socket) Drain(ctx context.Context) error {
+	s.lock.Lock()
+	s.draining = true
+	listeners := s.listeners
+	s.listeners = nil
+	conns := make([]*Connection, 0, len(s.ids))
+	for _, id := range s.ids {
+		conns = append(conns, s.conns[id])
+	}
+	s.lock.Unlock()
+
+	for _, l := range listeners {
+		l.ln.Close()
+	}
+
+	for _, conn := range conns {
+		conn.outbox.push(&outgoing{frames: [][]byte{nil}, command: goAwayCommand})
+		conn.outbox.close()
+	}
+
+	var err error
+	for _, conn := range conns {
+		select {
+		case <-conn.outbox.drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+			s.discard(conn, DropLinger)
+		}
+	}
+
+	s.Close()
+	return err
+}
@@ -0,0 +1,59 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestDrain(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19020"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19020"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := server.Send([]byte("HELLO")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		msg, err := client.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := "HELLO", string(msg); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+
+	if err := server.Send([]byte("HELLO")); !errors.Is(err, ErrClosed) {
+		t.Errorf("want %v, got %v", ErrClosed, err)
+	}
+	if _, err := server.Bind("tcp://127.0.0.1:19020"); err != ErrClosed {
+		t.Errorf("want %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,106 @@
+package gomq
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// EdgeBuffer stores and forwards messages from a local socket,
+// such as a PULL or SERVER socket devices send to, to a central
+// endpoint over a link that may come and go, as IoT gateways do.
+// Messages received locally are stamped, see Stamp, journaled on
+// the upstream socket, and sent as soon as it has a peer, being
+// replayed from the journal if the process restarts before they
+// were written. A message may then reach the central endpoint
+// twice, which a Deduper there filters out by its stamp.
+//
+// The upstream socket, such as a PUSH or DEALER socket connected
+// to the central endpoint, must carry multipart messages for the
+// stamps to reach it.
+type EdgeBuffer struct {
+	local    ZeroMQSocket
+	upstream ZeroMQSocket
+	journal  *Journal
+	stamper  Stamper
+}
+
+// NewEdgeBuffer returns an edge buffer forwarding the messages
+// received on local to upstream, journaled in journal. It
+// attaches the journal to upstream, which queues messages until
+// it is connected from then on, see SetQueueUntilConnected, and
+// must therefore be a socket of this package.
+func NewEdgeBuffer(local, upstream ZeroMQSocket, journal *Journal) *EdgeBuffer {
+	b := baseOf(upstream)
+	b.SetQueueUntilConnected(true)
+	b.SetJournal(journal)
+	return &EdgeBuffer{local: local, upstream: upstream, journal: journal, stamper: UUIDStamper{}}
+}
+
+// Pending returns the number of messages stored
+// and not yet written to the central endpoint.
+func (e *EdgeBuffer) Pending() int {
+	return e.journal.Pending()
+}
+
+// Run forwards messages until ctx is done or either socket is
+// closed, and returns why. Sending waits for the upstream socket
+// to have room, see SetSendHWM. Other errors, such as those
+// reporting the loss of a local peer, are skipped.
+func (e *EdgeBuffer) Run(ctx context.Context) error {
+	for {
+		msg, err := e.local.RecvMultipartContext(ctx)
+		if err == nil {
+			err = e.upstream.SendMultipartContext(ctx, appendStamp(msg, e.stamper))
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrClosed) {
+			return err
+		}
+	}
+}
+
+// Deduper filters out the messages received more than once,
+// telling them apart by the ID of their stamp, see EdgeBuffer.
+// It remembers the IDs of a bounded number of recent messages.
+type Deduper struct {
+	lock  sync.Mutex
+	size  int
+	seen  map[string]*list.Element
+	order *list.List
+}
+
+// NewDeduper returns a Deduper remembering
+// the last size message IDs it saw.
+func NewDeduper(size int) *Deduper {
+	return &Deduper{size: size, seen: make(map[string]*list.Element), order: list.New()}
+}
+
+// Duplicate reports whether the stamp of msg has an ID among
+// those of the messages seen recently, and remembers it if not.
+// Messages without a stamp are never duplicates.
+func (d *Deduper) Duplicate(msg [][]byte) bool {
+	stamp, _, ok := SplitStamp(msg)
+	if !ok {
+		return false
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	id := string(stamp.ID)
+	if e, ok := d.seen[id]; ok {
+		d.order.MoveToFront(e)
+		return true
+	}
+	d.seen[id] = d.order.PushFront(id)
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.seen, oldest.Value.(string))
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package gomq
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestEdgeBuffer(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "edge.journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	local := NewPull(zmtp.NewSecurityNull())
+	defer local.Close()
+	if _, err := local.Bind("inproc://edge"); err != nil {
+		t.Fatal(err)
+	}
+	upstream := NewPush(zmtp.NewSecurityNull())
+	defer upstream.Close()
+
+	edge := NewEdgeBuffer(local, upstream, journal)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go edge.Run(ctx)
+
+	device := NewPush(zmtp.NewSecurityNull())
+	defer device.Close()
+	if err := device.Connect("inproc://edge"); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"1", "2", "3"} {
+		if err := device.Send([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; edge.Pending() != 3; i++ {
+		if i == 100 {
+			t.Fatalf("want 3 messages stored, got %v", edge.Pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the central endpoint comes up
+	central := NewPull(zmtp.NewSecurityNull())
+	defer central.Close()
+	go func() {
+		if err := upstream.Connect("tcp://127.0.0.1:19083"); err != nil {
+			t.Error(err)
+		}
+	}()
+	if _, err := central.Bind("tcp://127.0.0.1:19083"); err != nil {
+		t.Fatal(err)
+	}
+
+	dedupe := NewDeduper(16)
+	for _, want := range []string{"1", "2", "3"} {
+		msg, err := central.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dedupe.Duplicate(msg) {
+			t.Errorf("%s: unexpected duplicate", want)
+		}
+		if !dedupe.Duplicate(msg) {
+			t.Errorf("%s: want a duplicate", want)
+		}
+		_, frames, ok := SplitStamp(msg)
+		if !ok {
+			t.Fatalf("%s: want a stamp", want)
+		}
+		if got := string(frames[0]); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+	for i := 0; edge.Pending() != 0; i++ {
+		if i == 100 {
+			t.Fatalf("want no message stored, got %v", edge.Pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeduper(t *testing.T) {
+	d := NewDeduper(2)
+	msgs := make([][][]byte, 3)
+	for i := range msgs {
+		msgs[i] = appendStamp([][]byte{[]byte("x")}, UUIDStamper{})
+		if d.Duplicate(msgs[i]) {
+			t.Errorf("%d: unexpected duplicate", i)
+		}
+	}
+	// the first ID was forgotten
+	if d.Duplicate(msgs[0]) {
+		t.Error("want the oldest ID forgotten")
+	}
+	if !d.Duplicate(msgs[2]) {
+		t.Error("want a duplicate")
+	}
+	if d.Duplicate([][]byte{[]byte("x")}) || d.Duplicate([][]byte{[]byte("x")}) {
+		t.Error("want messages without stamps never duplicates")
+	}
+}
@@ -0,0 +1,151 @@
+package gomq
+
+import (
+	"fmt"
+	"time"
+)
+
+// EndpointState is the state of the connection
+// a socket maintains to one of its endpoints.
+type EndpointState int
+
+const (
+	// Connecting means the transport connection is being
+	// established. LastError holds the last failed attempt.
+	Connecting EndpointState = iota
+
+	// Handshaking means the transport connection is up
+	// and the ZMTP handshake is in progress.
+	Handshaking
+
+	// Ready means the handshake completed and
+	// messages flow to and from the peer.
+	Ready
+
+	// Degraded means the connection failed or was
+	// lost. LastError holds the reason.
+	Degraded
+
+	// Closed means the socket was closed.
+	Closed
+)
+
+func (st EndpointState) String() string {
+	switch st {
+	case Connecting:
+		return "connecting"
+	case Handshaking:
+		return "handshaking"
+	case Ready:
+		return "ready"
+	case Degraded:
+		return "degraded"
+	case Closed:
+		return "closed"
+	}
+	return fmt.Sprintf("EndpointState(%d)", int(st))
+}
+
+// EndpointStatus describes the state of one of
+// a socket's endpoints and when it was entered.
+type EndpointStatus struct {
+	Endpoint  string
+	State     EndpointState
+	Since     time.Time
+	LastError error
+	Labels    Labels
+
+	// Breaker is the state of the endpoint's circuit
+	// breaker, see SetCircuitBreaker.
+	Breaker BreakerState
+}
+
+// endpointTracker is implemented by sockets embedding
+// *Socket, which keep track of their endpoints' states.
+type endpointTracker interface {
+	setEndpointState(endpoint string, state EndpointState, err error)
+}
+
+// setEndpointState records the state of endpoint on s,
+// if s keeps track of its endpoints.
+func setEndpointState(s ZeroMQSocket, endpoint string, state EndpointState, err error) {
+	if t, ok := s.(endpointTracker); ok {
+		t.setEndpointState(endpoint, state, err)
+	}
+}
+
+func (s *Socket) setEndpointState(endpoint string, state EndpointState, err error) {
+	s.lock.Lock()
+	status, ok := s.endpoints[endpoint]
+	if !ok {
+		status = &EndpointStatus{Endpoint: endpoint, Labels: s.labels[endpoint]}
+		s.endpoints[endpoint] = status
+		s.endpointOrder = append(s.endpointOrder, endpoint)
+	}
+
+	if status.State != state || !ok {
+		status.Since = time.Now()
+	}
+	status.State = state
+	if err != nil {
+		status.LastError = err
+		if state == Connecting || state == Degraded {
+			s.recordOutcomeLocked(endpoint, true)
+		}
+	}
+
+	changed := *status
+	onEndpointState := s.onEndpointState
+	s.lock.Unlock()
+
+	if onEndpointState != nil {
+		onEndpointState(changed)
+	}
+}
+
+// Endpoints returns the status of each endpoint the
+// socket has connected or bound to, in the order they
+// were first used.
+func (s *Socket) Endpoints() []EndpointStatus {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	endpoints := make([]EndpointStatus, 0, len(s.endpointOrder))
+	for _, endpoint := range s.endpointOrder {
+		endpoints = append(endpoints, *s.endpoints[endpoint])
+	}
+	return endpoints
+}
+
+// SetEndpointStateHandler registers a function that is
+// called, without any of the socket's locks held, each
+// time one of the socket's endpoints changes state.
+func (s *Socket) SetEndpointStateHandler(fn func(EndpointStatus)) {
+	s.lock.Lock()
+	s.onEndpointState = fn
+	s.lock.Unlock()
+}
+
+// watch tears the connection down as soon as it is lost,
+// typically because the peer went away or sent a frame
+// that could not be parsed, unless the socket is being
+// closed. The connection is removed, its endpoint marked
+// as degraded and the messages queued toward it redirected
+// to the remaining peers. ZMTP frames carry no markers to
+// resynchronize on, so a connection is never reused after
+// a parse error; connecting sockets dial again instead, once
+// the connection's lost channel is closed.
+func (s *Socket) watch(conn *Connection) {
+	select {
+	case <-conn.done:
+		select {
+		case <-s.done:
+		default:
+			s.setEndpointState(conn.endpoint, Degraded, conn.err)
+			s.disconnected(conn, conn.err)
+			s.redirect(conn, conn.outbox.take(), conn.err)
+		}
+		close(conn.lost)
+	case <-s.done:
+	}
+}
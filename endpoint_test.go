@@ -0,0 +1,69 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestEndpointState(t *testing.T) {
+	endpoint := "tcp://127.0.0.1:19014"
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind(endpoint); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := client.Endpoints()
+	if want, got := 1, len(endpoints); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := Ready, endpoints[0].State; want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if endpoints[0].Since.IsZero() {
+		t.Errorf("state change has no timestamp")
+	}
+
+	changes := make(chan EndpointStatus, 16)
+	client.SetEndpointStateHandler(func(status EndpointStatus) {
+		changes <- status
+	})
+
+	server.Close()
+
+	select {
+	case status := <-changes:
+		if want, got := Degraded, status.State; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+		if status.LastError == nil {
+			t.Errorf("degraded endpoint has no error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection loss not reported")
+	}
+
+	// skip the client's attempts at reconnecting
+	client.Close()
+	for status := range changes {
+		if status.State == Closed {
+			break
+		}
+		if want, got := Connecting, status.State; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package gomq
+
+// Envelope holds the routing frames at the front of a
+// message, as used by ROUTER, REQ and REP sockets: the
+// routing ids added by each ROUTER hop, which are followed
+// on the wire by an empty delimiter frame and the body.
+type Envelope [][]byte
+
+// Unwrap splits msg into its envelope and its body at the
+// first empty delimiter frame. If msg has no delimiter, the
+// envelope is empty and the whole of msg is the body.
+func Unwrap(msg [][]byte) (Envelope, [][]byte) {
+	for i, frame := range msg {
+		if len(frame) == 0 {
+			return Envelope(msg[:i:i]), msg[i+1:]
+		}
+	}
+	return nil, msg
+}
+
+// Wrap returns a new message made of the envelope,
+// an empty delimiter frame and body.
+func (e Envelope) Wrap(body [][]byte) [][]byte {
+	msg := make([][]byte, 0, len(e)+1+len(body))
+	msg = append(msg, e...)
+	msg = append(msg, []byte{})
+	return append(msg, body...)
+}
+
+// Push returns the envelope with id added as
+// its outermost routing frame.
+func (e Envelope) Push(id []byte) Envelope {
+	env := make(Envelope, 0, len(e)+1)
+	env = append(env, id)
+	return append(env, e...)
+}
+
+// Pop returns the envelope's outermost routing frame
+// and the envelope without it. It returns a nil id
+// if the envelope is empty.
+func (e Envelope) Pop() ([]byte, Envelope) {
+	if len(e) == 0 {
+		return nil, e
+	}
+	return e[0], e[1:]
+}
@@ -0,0 +1,55 @@
+package gomq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	msg := [][]byte{[]byte("peer-a"), []byte("peer-b"), {}, []byte("HELLO"), {}}
+
+	env, body := Unwrap(msg)
+	if want, got := 2, len(env); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := 2, len(body); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	id, env := env.Pop()
+	if want, got := 0, bytes.Compare([]byte("peer-a"), id); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	env = env.Push([]byte("peer-c"))
+	wrapped := env.Wrap(body)
+	if want, got := 5, len(wrapped); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	for i, want := range [][]byte{[]byte("peer-c"), []byte("peer-b"), {}, []byte("HELLO"), {}} {
+		if !bytes.Equal(want, wrapped[i]) {
+			t.Errorf("frame %d: want %q, got %q", i, want, wrapped[i])
+		}
+	}
+
+	// pushing on an unwrapped envelope must not clobber the message
+	env, _ = Unwrap(msg)
+	env.Push([]byte("peer-d"))
+	_ = append(env, []byte("peer-e"))
+	if !bytes.Equal(msg[2], []byte{}) {
+		t.Errorf("unwrapped envelope aliases the message: %q", msg[2])
+	}
+}
+
+func TestUnwrapNoDelimiter(t *testing.T) {
+	msg := [][]byte{[]byte("HELLO")}
+
+	env, body := Unwrap(msg)
+	if len(env) != 0 {
+		t.Errorf("want empty envelope, got %q", env)
+	}
+	if want, got := 1, len(body); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,178 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+var (
+	// ErrTimeout is returned when an operation
+	// did not complete within its timeout.
+	ErrTimeout = errors.New("gomq: operation timed out")
+
+	// ErrClosed is returned when operating on
+	// a socket that has been closed.
+	ErrClosed = errors.New("gomq: socket closed")
+
+	// ErrTerminated is returned when creating a socket
+	// with a Context that has been terminated.
+	ErrTerminated = errors.New("gomq: context terminated")
+
+	// ErrNoPeers is returned when sending on a
+	// socket that has no connected peers.
+	ErrNoPeers = errors.New("gomq: no connected peers")
+
+	// ErrUnknownPeer is returned when referring to a
+	// peer the socket is not connected to.
+	ErrUnknownPeer = errors.New("gomq: unknown peer")
+
+	// ErrWouldBlock is returned by non-blocking operations
+	// that could not complete right away.
+	ErrWouldBlock = errors.New("gomq: operation would block")
+
+	// ErrPeerLeft is the error recorded for
+	// a peer that said goodbye, see Goodbye.
+	ErrPeerLeft = errors.New("gomq: peer left")
+
+	// ErrMemoryLimit is returned when sending on a socket
+	// whose memory limit is reached, see MemoryLimit.
+	ErrMemoryLimit = errors.New("gomq: memory limit reached")
+
+	// ErrMultipart is returned when sending a message of
+	// more than one frame on a socket whose type only
+	// exchanges single frame messages.
+	ErrMultipart = errors.New("gomq: socket type does not support multipart messages")
+
+	// ErrState is returned when sending or receiving out of
+	// turn on a socket with a send/receive lockstep, such as
+	// sending twice in a row on a REQ socket.
+	ErrState = errors.New("gomq: operation not allowed in the socket's current state")
+
+	// ErrNotSupported is returned for operations the socket's
+	// type does not support, such as sending on a SUB socket.
+	ErrNotSupported = errors.New("gomq: operation not supported by the socket type")
+
+	// ErrChecksum is the error recorded for a connection
+	// on which a message failed its checksum.
+	ErrChecksum = errors.New("gomq: message checksum mismatch")
+
+	// ErrOverloaded is the error of the replies an overloaded
+	// server sheds requests with, see AdmissionPolicy.
+	ErrOverloaded = errors.New("gomq: server overloaded")
+
+	// ErrUnknownEndpoint is returned by Disconnect and Unbind
+	// for endpoints the socket is not connected or bound to.
+	ErrUnknownEndpoint = errors.New("gomq: unknown endpoint")
+
+	// ErrPeerLimit is the error of connections refused by
+	// sockets that have all the peers they accept, such as a
+	// PAIR socket that already has its peer.
+	ErrPeerLimit = errors.New("gomq: socket accepts no more peers")
+
+	// ErrPeerDisconnected is the Kind of the *PeerError of
+	// a connection lost because the peer went away.
+	ErrPeerDisconnected = errors.New("gomq: peer disconnected")
+
+	// ErrProtocol is the Kind of the *PeerError of a connection
+	// lost because the peer broke the protocol, such as by
+	// sending a frame that could not be parsed.
+	ErrProtocol = errors.New("gomq: protocol error")
+
+	// ErrAuthFailed is wrapped by the errors of handshakes
+	// failing because the server rejected the client's
+	// credentials, reported by EventHandshakeFailed.
+	ErrAuthFailed = zmtp.ErrAuthFailed
+)
+
+// PeerError is the error receiving returns when the connection
+// to a peer is lost, once the messages received before were
+// returned. The connection is removed from the socket, which
+// goes on with its other peers, and dials again if it dialed.
+// Receiving only fails for good with ErrClosed, once the socket
+// is closed.
+type PeerError struct {
+	PeerID   string
+	Endpoint string
+
+	// Kind is ErrPeerDisconnected or ErrProtocol,
+	// which errors.Is matches the error against.
+	Kind error
+
+	// Err is the error the connection failed with.
+	Err error
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("gomq: connection to %s lost, %v: %v", e.Endpoint, strings.TrimPrefix(e.Kind.Error(), "gomq: "), e.Err)
+}
+
+// Is reports whether target is the kind of the error.
+func (e *PeerError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the underlying error.
+func (e *PeerError) Unwrap() error {
+	return e.Err
+}
+
+// peerError returns the *PeerError of conn, lost because of
+// err. Errors of the transport, and peers saying goodbye, mean
+// the peer went away, and any other the peer broke the protocol.
+func peerError(conn *Connection, err error) *PeerError {
+	kind := ErrProtocol
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, ErrPeerLeft) || errors.As(err, &netErr) {
+		kind = ErrPeerDisconnected
+	}
+	return &PeerError{PeerID: conn.id, Endpoint: conn.endpoint, Kind: kind, Err: err}
+}
+
+// SendOutcome describes what happened to a message
+// after sending it to a peer failed.
+type SendOutcome int
+
+const (
+	// Dropped means the message was not delivered to any peer.
+	Dropped SendOutcome = iota
+
+	// Redirected means the message was sent on to another peer.
+	Redirected
+)
+
+func (o SendOutcome) String() string {
+	switch o {
+	case Dropped:
+		return "dropped"
+	case Redirected:
+		return "redirected"
+	}
+	return fmt.Sprintf("SendOutcome(%d)", int(o))
+}
+
+// SendError describes a failure to send a message to
+// a peer, along with what became of the message.
+type SendError struct {
+	PeerID   string
+	Endpoint string
+	Outcome  SendOutcome
+	Err      error
+}
+
+func (e *SendError) Error() string {
+	if e.Endpoint == "" {
+		return fmt.Sprintf("gomq: message %v: %v", e.Outcome, e.Err)
+	}
+	return fmt.Sprintf("gomq: sending to %s failed, message %v: %v", e.Endpoint, e.Outcome, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,142 @@
+package gomq
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSendError(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	var sendErr *SendError
+	if err := client.Send([]byte("HELLO")); !errors.As(err, &sendErr) || sendErr.Outcome != Dropped || sendErr.Err != ErrNoPeers {
+		t.Fatalf("want dropped SendError wrapping ErrNoPeers, got %v", err)
+	}
+
+	endpoints := []string{"tcp://127.0.0.1:19006", "tcp://127.0.0.1:19007"}
+	servers := make([]Server, len(endpoints))
+	for i, endpoint := range endpoints {
+		servers[i] = NewServer(zmtp.NewSecurityNull())
+		defer servers[i].Close()
+
+		go func(s Server, endpoint string) {
+			if _, err := s.Bind(endpoint); err != nil {
+				t.Error(err)
+			}
+		}(servers[i], endpoint)
+
+		if err := client.Connect(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reported := make(chan *SendError, 1)
+	client.SetSendErrorHandler(func(err *SendError) {
+		reported <- err
+	})
+	disconnected := make(chan string, 4)
+	client.SetEventHandler(func(ev SocketEvent) {
+		if ev.Type == EventDisconnected {
+			disconnected <- ev.PeerID
+		}
+	})
+
+	// fail writes only, so the connection is not torn down
+	// before the message is queued toward it
+	first := client.conns[client.Peers()[0].ID]
+	first.net.(*net.TCPConn).CloseWrite()
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := servers[1].Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, bytes.Compare([]byte("HELLO"), msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	failure := <-reported
+	if want, got := endpoints[0], failure.Endpoint; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := Redirected, failure.Outcome; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// the failed peer is dropped, although the client may
+	// have connected to its endpoint again since
+	if want, got := first.id, <-disconnected; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	for _, peer := range client.Peers() {
+		if peer.ID == first.id {
+			t.Errorf("want peer %v dropped", first.id)
+		}
+	}
+}
+
+func TestPeerError(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	if _, err := server.Bind("inproc://peer-error"); err != nil {
+		t.Fatal(err)
+	}
+	server.SetMaxMessageSize(16)
+
+	connect := func() Client {
+		client := NewClient(zmtp.NewSecurityNull())
+		if err := client.Connect("inproc://peer-error"); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	client := connect()
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	peer, _, err := server.RecvFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	var peerErr *PeerError
+	if _, err := server.Recv(); !errors.As(err, &peerErr) || !errors.Is(err, ErrPeerDisconnected) {
+		t.Fatalf("want a PeerError of kind %v, got %v", ErrPeerDisconnected, err)
+	}
+	if want, got := peer, peerErr.PeerID; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := "inproc://peer-error", peerErr.Endpoint; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	for i := 0; len(server.Peers()) > 0; i++ {
+		if i == 100 {
+			t.Fatal("want the lost connection removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client = connect()
+	defer client.Close()
+	if err := client.Send(bytes.Repeat([]byte("HELLO"), 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Recv(); !errors.Is(err, ErrProtocol) || !errors.Is(err, zmtp.ErrMessageTooLarge) {
+		t.Errorf("want %v wrapping %v, got %v", ErrProtocol, zmtp.ErrMessageTooLarge, err)
+	}
+
+	server.Close()
+	if _, err := server.Recv(); err != ErrClosed {
+		t.Errorf("want %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,110 @@
+// Command chat is a chat room over CLIENT and SERVER sockets.
+//
+// Usage:
+//
+//	chat -serve endpoint
+//	chat -join endpoint -name name
+//
+// The room, started with -serve, relays the lines each member
+// sends to every member. Members, started with -join, send the
+// lines they read from standard input, prefixed with their
+// name, and print the lines the room relays to them.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// relay sends each line a member sends to server to
+// every member, until ctx is done or server is closed.
+func relay(ctx context.Context, server *gomq.ServerSocket) error {
+	for {
+		_, line, err := server.RecvFromContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, gomq.ErrClosed) {
+				return err
+			}
+			continue // a member left
+		}
+		if err := server.SendAll(line); err != nil && !errors.Is(err, gomq.ErrNoPeers) {
+			log.Print(err)
+		}
+	}
+}
+
+// say sends text to the room as name.
+func say(client gomq.Client, name, text string) error {
+	return client.Send([]byte(name + ": " + text))
+}
+
+// listen writes the lines relayed to client to w, until
+// ctx is done or client is closed.
+func listen(ctx context.Context, client gomq.Client, w io.Writer) error {
+	for {
+		line, err := client.RecvContext(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", line)
+	}
+}
+
+func main() {
+	var (
+		serve = flag.String("serve", "", "endpoint to serve the room on")
+		join  = flag.String("join", "", "endpoint of the room to join")
+		name  = flag.String("name", "anonymous", "name to chat as")
+	)
+	flag.Parse()
+
+	if (*serve == "") == (*join == "") || flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: chat -serve endpoint | chat -join endpoint [-name name]")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *serve != "" {
+		server := gomq.NewServer(zmtp.NewSecurityNull())
+		defer server.Close()
+		if _, err := server.Bind(*serve); err != nil {
+			log.Fatal(err)
+		}
+		if err := relay(ctx, server); err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	client := gomq.NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect(*join); err != nil {
+		log.Fatal(err)
+	}
+	go listen(ctx, client, os.Stdout)
+
+	if err := say(client, *name, "joined"); err != nil {
+		log.Fatal(err)
+	}
+	lines := bufio.NewScanner(os.Stdin)
+	for lines.Scan() {
+		if err := say(client, *name, lines.Text()); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
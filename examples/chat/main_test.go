@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestChat(t *testing.T) {
+	server := gomq.NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://chat"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay(ctx, server)
+
+	join := func(name string) gomq.Client {
+		client := gomq.NewClient(zmtp.NewSecurityNull())
+		if err := client.Connect("inproc://chat"); err != nil {
+			t.Fatal(err)
+		}
+		// hearing itself join tells the member is in the room
+		if err := say(client, name, "joined"); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			line, err := client.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(line) == name+": joined" {
+				return client
+			}
+		}
+	}
+	alice := join("alice")
+	defer alice.Close()
+	bob := join("bob")
+	defer bob.Close()
+
+	if err := say(alice, "alice", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []gomq.Client{alice, bob} {
+		line, err := member.Recv()
+		for err == nil && strings.HasSuffix(string(line), ": joined") {
+			line, err = member.Recv()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := "alice: hello", string(line); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
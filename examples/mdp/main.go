@@ -0,0 +1,283 @@
+// Command mdp runs a service broker after the Majordomo
+// Protocol (MDP), with clients and workers of the services.
+//
+// Usage:
+//
+//	mdp -broker endpoint
+//	mdp -worker endpoint -service name
+//	mdp -request endpoint -service name body
+//
+// Workers tell the broker which service they provide, and the
+// broker hands each request a client makes for a service to an
+// idle worker providing it, queueing the request until there
+// is one, then passes the worker's reply back to the client.
+// The example worker echoes requests back in upper case.
+//
+// MDP runs over ROUTER and DEALER sockets. Here, the broker
+// binds a SERVER socket that clients and workers connect CLIENT
+// sockets to, and each MDP message, made of several frames, is
+// packed into a single frame, each of its frames preceded by
+// its length as a uvarint. Heartbeating is left out.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// Protocol headers and worker commands.
+const (
+	clientHeader = "MDPC01"
+	workerHeader = "MDPW01"
+
+	commandReady      = "\x01"
+	commandRequest    = "\x02"
+	commandReply      = "\x03"
+	commandDisconnect = "\x05"
+)
+
+var errMalformed = errors.New("mdp: malformed message")
+
+// pack packs the frames of an MDP message into a single frame.
+func pack(frames ...[]byte) []byte {
+	var b []byte
+	for _, frame := range frames {
+		b = binary.AppendUvarint(b, uint64(len(frame)))
+		b = append(b, frame...)
+	}
+	return b
+}
+
+// unpack returns the frames of an MDP message packed by pack.
+func unpack(b []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(b) > 0 {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || n > uint64(len(b)-size) {
+			return nil, errMalformed
+		}
+		b = b[size:]
+		frames = append(frames, b[:n])
+		b = b[n:]
+	}
+	return frames, nil
+}
+
+// broker hands requests to the workers of their service.
+type broker struct {
+	server *gomq.ServerSocket
+
+	// workers maps the IDs of the workers' connections to the
+	// service they provide. idle holds the idle workers of each
+	// service, and queued the requests waiting for one, each
+	// packed with the ID of the client who sent it.
+	workers map[string]string
+	idle    map[string][]string
+	queued  map[string][][2][]byte
+}
+
+func newBroker(server *gomq.ServerSocket) *broker {
+	return &broker{
+		server:  server,
+		workers: make(map[string]string),
+		idle:    make(map[string][]string),
+		queued:  make(map[string][][2][]byte),
+	}
+}
+
+// run serves clients and workers until ctx is
+// done or the broker's socket is closed.
+func (b *broker) run(ctx context.Context) error {
+	for {
+		peer, msg, err := b.server.RecvFromContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, gomq.ErrClosed) {
+				return err
+			}
+			continue // a peer left
+		}
+		frames, err := unpack(msg)
+		if err != nil || len(frames) < 2 {
+			log.Printf("%s: %v", peer, errMalformed)
+			continue
+		}
+
+		switch string(frames[0]) {
+		case clientHeader:
+			if len(frames) != 3 {
+				log.Printf("%s: %v", peer, errMalformed)
+				continue
+			}
+			service := string(frames[1])
+			b.queued[service] = append(b.queued[service], [2][]byte{[]byte(peer), frames[2]})
+			b.dispatch(service)
+		case workerHeader:
+			b.worker(peer, frames[1:])
+		default:
+			log.Printf("%s: %v", peer, errMalformed)
+		}
+	}
+}
+
+// worker handles a command from the worker with the given ID.
+func (b *broker) worker(id string, frames [][]byte) {
+	switch command := string(frames[0]); {
+	case command == commandReady && len(frames) == 2:
+		service := string(frames[1])
+		b.workers[id] = service
+		b.idle[service] = append(b.idle[service], id)
+		b.dispatch(service)
+	case command == commandReply && len(frames) == 3:
+		service, ok := b.workers[id]
+		if !ok {
+			return
+		}
+		if err := b.server.SendTo(string(frames[1]), pack([]byte(clientHeader), []byte(service), frames[2])); err != nil {
+			log.Printf("%s: %v", frames[1], err)
+		}
+		b.idle[service] = append(b.idle[service], id)
+		b.dispatch(service)
+	case command == commandDisconnect:
+		service := b.workers[id]
+		delete(b.workers, id)
+		idle := b.idle[service][:0]
+		for _, w := range b.idle[service] {
+			if w != id {
+				idle = append(idle, w)
+			}
+		}
+		b.idle[service] = idle
+	default:
+		log.Printf("%s: %v", id, errMalformed)
+	}
+}
+
+// dispatch hands the requests queued for service
+// to its idle workers, as long as there are both.
+func (b *broker) dispatch(service string) {
+	for len(b.queued[service]) > 0 && len(b.idle[service]) > 0 {
+		req := b.queued[service][0]
+		id := b.idle[service][0]
+		b.idle[service] = b.idle[service][1:]
+
+		err := b.server.SendTo(id, pack([]byte(workerHeader), []byte(commandRequest), req[0], req[1]))
+		if err != nil {
+			// the worker is gone, the request goes to another
+			log.Printf("%s: %v", id, err)
+			delete(b.workers, id)
+			continue
+		}
+		b.queued[service] = b.queued[service][1:]
+	}
+}
+
+// serve registers client as a worker of service with the broker
+// it is connected to, and replies to the requests the broker
+// hands it with handle, until ctx is done or client is closed.
+// It then tells the broker it leaves.
+func serve(ctx context.Context, client gomq.Client, service string, handle func([]byte) []byte) error {
+	if err := client.Send(pack([]byte(workerHeader), []byte(commandReady), []byte(service))); err != nil {
+		return err
+	}
+	defer client.Send(pack([]byte(workerHeader), []byte(commandDisconnect)))
+
+	for {
+		msg, err := client.RecvContext(ctx)
+		if err != nil {
+			return err
+		}
+		frames, err := unpack(msg)
+		if err != nil || len(frames) != 4 || string(frames[0]) != workerHeader || string(frames[1]) != commandRequest {
+			log.Print(errMalformed)
+			continue
+		}
+		reply := pack([]byte(workerHeader), []byte(commandReply), frames[2], handle(frames[3]))
+		if err := client.Send(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// request sends body to service through the broker client is
+// connected to, and returns the reply, or ctx.Err() if ctx is
+// done first.
+func request(ctx context.Context, client gomq.Client, service string, body []byte) ([]byte, error) {
+	if err := client.SendContext(ctx, pack([]byte(clientHeader), []byte(service), body)); err != nil {
+		return nil, err
+	}
+	msg, err := client.RecvContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := unpack(msg)
+	if err != nil || len(frames) != 3 || string(frames[0]) != clientHeader || string(frames[1]) != service {
+		return nil, errMalformed
+	}
+	return frames[2], nil
+}
+
+func main() {
+	var (
+		brokerAt  = flag.String("broker", "", "endpoint to run the broker on")
+		workFor   = flag.String("worker", "", "endpoint of the broker to work for")
+		requestTo = flag.String("request", "", "endpoint of the broker to send a request to")
+		service   = flag.String("service", "echo", "name of the service")
+	)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch {
+	case *brokerAt != "":
+		server := gomq.NewServer(zmtp.NewSecurityNull())
+		defer server.Close()
+		if _, err := server.Bind(*brokerAt); err != nil {
+			log.Fatal(err)
+		}
+		if err := newBroker(server).run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err)
+		}
+
+	case *workFor != "":
+		client := gomq.NewClient(zmtp.NewSecurityNull())
+		defer client.Close()
+		if err := client.Connect(*workFor); err != nil {
+			log.Fatal(err)
+		}
+		err := serve(ctx, client, *service, bytes.ToUpper)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err)
+		}
+
+	case *requestTo != "":
+		client := gomq.NewClient(zmtp.NewSecurityNull())
+		defer client.Close()
+		if err := client.Connect(*requestTo); err != nil {
+			log.Fatal(err)
+		}
+		reply, err := request(ctx, client, *service, []byte(strings.Join(flag.Args(), " ")))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", reply)
+
+	default:
+		fmt.Fprintln(os.Stderr, "usage: mdp -broker endpoint | -worker endpoint [-service name] | -request endpoint [-service name] body")
+		os.Exit(2)
+	}
+}
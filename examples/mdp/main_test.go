@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestPack(t *testing.T) {
+	frames, err := unpack(pack([]byte("a"), nil, bytes.Repeat([]byte("b"), 300)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, len(frames); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := 300, len(frames[2]); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if _, err := unpack([]byte{5, 'a'}); err != errMalformed {
+		t.Errorf("want %v, got %v", errMalformed, err)
+	}
+}
+
+func TestMDP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := gomq.NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://mdp"); err != nil {
+		t.Fatal(err)
+	}
+	go newBroker(server).run(ctx)
+
+	connect := func() gomq.Client {
+		client := gomq.NewClient(zmtp.NewSecurityNull())
+		if err := client.Connect("inproc://mdp"); err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	// the request waits at the broker for a worker
+	client := connect()
+	defer client.Close()
+	replies := make(chan string, 1)
+	go func() {
+		reply, err := request(ctx, client, "echo", []byte("hello"))
+		if err != nil {
+			t.Error(err)
+		}
+		replies <- string(reply)
+	}()
+
+	reverse := func(b []byte) []byte {
+		r := make([]byte, len(b))
+		for i := range b {
+			r[len(b)-1-i] = b[i]
+		}
+		return r
+	}
+	for service, handle := range map[string]func([]byte) []byte{
+		"echo":    bytes.ToUpper,
+		"reverse": reverse,
+	} {
+		worker := connect()
+		defer worker.Close()
+		go serve(ctx, worker, service, handle)
+	}
+
+	if want, got := "HELLO", <-replies; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	reply, err := request(ctx, client, "reverse", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "olleh", string(reply); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
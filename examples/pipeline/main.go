@@ -0,0 +1,126 @@
+// Command pipeline distributes tasks to workers over PUSH and
+// PULL sockets, and collects their results.
+//
+// Usage:
+//
+//	pipeline [-workers n] [-tasks n]
+//
+// A ventilator pushes the numbers from 1 to -tasks to the
+// workers, which square them and push the squares to a sink.
+// The sink adds them up and prints the sum once it has the
+// result of every task. Tasks are spread between the workers
+// taking turns, and the workers' results fair queued.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+const (
+	ventilatorEndpoint = "inproc://pipeline-ventilator"
+	sinkEndpoint       = "inproc://pipeline-sink"
+)
+
+// ventilate pushes the numbers from 1 to n as tasks.
+func ventilate(tasks *gomq.PushSocket, n int) error {
+	for i := 1; i <= n; i++ {
+		if err := tasks.Send([]byte(strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// work squares the numbers pulled from tasks and pushes the
+// squares to results, until ctx is done or tasks is closed.
+func work(ctx context.Context, tasks *gomq.PullSocket, results *gomq.PushSocket) error {
+	for {
+		task, err := tasks.RecvContext(ctx)
+		if err != nil {
+			return err
+		}
+		i, err := strconv.Atoi(string(task))
+		if err != nil {
+			log.Printf("bad task %q: %v", task, err)
+			continue
+		}
+		if err := results.SendContext(ctx, []byte(strconv.Itoa(i*i))); err != nil {
+			return err
+		}
+	}
+}
+
+// collect returns the sum of the next n results.
+func collect(ctx context.Context, results *gomq.PullSocket, n int) (int, error) {
+	sum := 0
+	for ; n > 0; n-- {
+		result, err := results.RecvContext(ctx)
+		if err != nil {
+			return 0, err
+		}
+		i, err := strconv.Atoi(string(result))
+		if err != nil {
+			return 0, fmt.Errorf("bad result %q: %v", result, err)
+		}
+		sum += i
+	}
+	return sum, nil
+}
+
+// run runs a pipeline of the given number of workers over n
+// tasks, and returns the sum of the results.
+func run(ctx context.Context, workers, n int) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ventilator := gomq.NewPush(zmtp.NewSecurityNull())
+	defer ventilator.Close()
+	if _, err := ventilator.Bind(ventilatorEndpoint); err != nil {
+		return 0, err
+	}
+	sink := gomq.NewPull(zmtp.NewSecurityNull())
+	defer sink.Close()
+	if _, err := sink.Bind(sinkEndpoint); err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < workers; i++ {
+		tasks := gomq.NewPull(zmtp.NewSecurityNull())
+		defer tasks.Close()
+		if err := tasks.Connect(ventilatorEndpoint); err != nil {
+			return 0, err
+		}
+		results := gomq.NewPush(zmtp.NewSecurityNull())
+		defer results.Close()
+		if err := results.Connect(sinkEndpoint); err != nil {
+			return 0, err
+		}
+		go work(ctx, tasks, results)
+	}
+
+	if err := ventilate(ventilator, n); err != nil {
+		return 0, err
+	}
+	return collect(ctx, sink, n)
+}
+
+func main() {
+	var (
+		workers = flag.Int("workers", 4, "number of workers")
+		tasks   = flag.Int("tasks", 100, "number of tasks")
+	)
+	flag.Parse()
+
+	sum, err := run(context.Background(), *workers, *tasks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(sum)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sum, err := run(ctx, 3, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1² + 2² + ... + n² = n(n+1)(2n+1)/6
+	if want, got := 100*101*201/6, sum; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+// Command securepubsub publishes a feed to subscribers over
+// CURVE encrypted and authenticated PUB and SUB sockets.
+//
+// Usage:
+//
+//	securepubsub -keygen
+//	securepubsub -publish endpoint -public key -secret key [-allow key,...]
+//	securepubsub -subscribe endpoint -server key -public key -secret key [-topic prefix]
+//
+// -keygen prints a new Z85 encoded keypair. The publisher sends
+// a line of the form "topic message" for each line read from
+// standard input, to the subscribers whose public keys are
+// listed with -allow, or to any subscriber knowing its public
+// key if there is no -allow flag. Subscribers print the lines
+// of the topics they subscribed to.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// newPublisher returns a PUB socket bound to endpoint with
+// the publisher's keypair, accepting the subscribers with the
+// allowed public keys only, or any subscriber if none is.
+func newPublisher(endpoint, publicKey, secretKey string, allowed []string) (*gomq.PubSocket, error) {
+	mechanism, err := zmtp.NewSecurityCurveServer(publicKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) > 0 {
+		keys := make(map[string]bool)
+		for _, key := range allowed {
+			b, err := zmtp.Z85Decode(key)
+			if err != nil {
+				return nil, fmt.Errorf("bad key %q: %v", key, err)
+			}
+			keys[string(b)] = true
+		}
+		mechanism.SetAuthorizer(func(clientKey []byte) bool {
+			return keys[string(clientKey)]
+		})
+	}
+
+	pub := gomq.NewPub(mechanism)
+	if _, err := pub.Bind(endpoint); err != nil {
+		pub.Close()
+		return nil, err
+	}
+	return pub, nil
+}
+
+// newSubscriber returns a SUB socket connected to the publisher
+// at endpoint, whose public key is serverKey, subscribed to the
+// topics starting with prefix.
+func newSubscriber(endpoint, serverKey, publicKey, secretKey, prefix string) (*gomq.SubSocket, error) {
+	mechanism, err := zmtp.NewSecurityCurveClient(serverKey, publicKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := gomq.NewSub(mechanism)
+	if err := sub.Subscribe([]byte(prefix)); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	if err := sub.Connect(endpoint); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// publish sends msg on topic.
+func publish(pub *gomq.PubSocket, topic, msg string) error {
+	return pub.Send([]byte(topic + " " + msg))
+}
+
+// next returns the topic and message of the next line sub
+// receives, or ctx.Err() if ctx is done first.
+func next(ctx context.Context, sub *gomq.SubSocket) (topic, msg string, err error) {
+	line, err := sub.RecvContext(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if i := bytes.IndexByte(line, ' '); i >= 0 {
+		return string(line[:i]), string(line[i+1:]), nil
+	}
+	return string(line), "", nil
+}
+
+func main() {
+	var (
+		keygen    = flag.Bool("keygen", false, "print a new keypair")
+		publishTo = flag.String("publish", "", "endpoint to publish on")
+		subscribe = flag.String("subscribe", "", "endpoint to subscribe to")
+		serverKey = flag.String("server", "", "public key of the publisher")
+		publicKey = flag.String("public", "", "public key")
+		secretKey = flag.String("secret", "", "secret key")
+		allow     = flag.String("allow", "", "comma separated public keys of the subscribers allowed")
+		topic     = flag.String("topic", "", "prefix of the topics to subscribe to")
+	)
+	flag.Parse()
+
+	switch {
+	case *keygen:
+		public, secret, err := zmtp.NewCurveKeypair()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("public %s\nsecret %s\n", public, secret)
+
+	case *publishTo != "":
+		var allowed []string
+		if *allow != "" {
+			allowed = strings.Split(*allow, ",")
+		}
+		pub, err := newPublisher(*publishTo, *publicKey, *secretKey, allowed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer pub.Close()
+
+		lines := bufio.NewScanner(os.Stdin)
+		for lines.Scan() {
+			topic, msg, _ := strings.Cut(lines.Text(), " ")
+			if err := publish(pub, topic, msg); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+	case *subscribe != "":
+		sub, err := newSubscriber(*subscribe, *serverKey, *publicKey, *secretKey, *topic)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sub.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		for {
+			topic, msg, err := next(ctx, sub)
+			if err != nil {
+				return
+			}
+			fmt.Println(topic, msg)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, "usage: securepubsub -keygen | -publish endpoint ... | -subscribe endpoint ...")
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSecurePubSub(t *testing.T) {
+	keypair := func() (public, secret string) {
+		public, secret, err := zmtp.NewCurveKeypair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return public, secret
+	}
+	serverPublic, serverSecret := keypair()
+	alicePublic, aliceSecret := keypair()
+	malloryPublic, mallorySecret := keypair()
+
+	const endpoint = "tcp://127.0.0.1:19084"
+	pub, err := newPublisher(endpoint, serverPublic, serverSecret, []string{alicePublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+
+	alice, err := newSubscriber(endpoint, serverPublic, alicePublic, aliceSecret, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	mallory, err := newSubscriber(endpoint, serverPublic, malloryPublic, mallorySecret, "")
+	if err == nil {
+		defer mallory.Close()
+	}
+
+	// publish until alice's subscription reached the publisher
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			publish(pub, "weather", "rain")
+			publish(pub, "news", "hello")
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	topic, msg, err := next(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "news hello", topic+" "+msg; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if mallory != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if _, _, err := next(ctx, mallory); err == nil {
+			t.Error("want nothing for a subscriber not allowed")
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package gomq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// fallbackDelay is how long dialing waits for an address to
+// connect before trying the next one as well, see RFC 6555.
+const fallbackDelay = 300 * time.Millisecond
+
+// lookupIPAddr resolves host names, replaced in tests.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// IPFamily is the IP version a socket's TCP based
+// endpoints, such as tcp:// and ws://, use.
+type IPFamily int
+
+const (
+	// IPAny uses both IPv4 and IPv6. Host names resolving
+	// to both are dialed the Happy Eyeballs way of RFC 6555,
+	// preferring IPv6. It is the default.
+	IPAny IPFamily = iota
+
+	// IPv4Only uses IPv4 only, binding "*" to every
+	// IPv4 address and ignoring the IPv6 addresses
+	// host names resolve to.
+	IPv4Only
+
+	// IPv6Only uses IPv6 only, binding "*" to every
+	// IPv6 address and ignoring the IPv4 addresses
+	// host names resolve to.
+	IPv6Only
+)
+
+func (f IPFamily) String() string {
+	switch f {
+	case IPAny:
+		return "any"
+	case IPv4Only:
+		return "ipv4"
+	case IPv6Only:
+		return "ipv6"
+	}
+	return fmt.Sprintf("IPFamily(%d)", int(f))
+}
+
+// network returns the network of package net for
+// the family of network, such as "tcp4" for "tcp".
+func (f IPFamily) network(network string) string {
+	switch f {
+	case IPv4Only:
+		return network + "4"
+	case IPv6Only:
+		return network + "6"
+	}
+	return network
+}
+
+// allows reports whether ip is of the family.
+func (f IPFamily) allows(ip net.IP) bool {
+	switch f {
+	case IPv4Only:
+		return ip.To4() != nil
+	case IPv6Only:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// SetIPFamily restricts the socket's TCP based endpoints to
+// an IP version, for hosts or networks that only have one,
+// such as some Kubernetes clusters. It applies to the binds
+// and connection attempts made from then on.
+func (s *Socket) SetIPFamily(f IPFamily) {
+	s.lock.Lock()
+	s.ipFamily = f
+	s.lock.Unlock()
+}
+
+// IPFamily returns the IP version the socket's
+// TCP based endpoints use.
+func (s *Socket) IPFamily() IPFamily {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.ipFamily
+}
+
+// resolve returns the addresses of family host resolves to,
+// in the order they are dialed: alternating between IPv6
+// and IPv4, starting with IPv6, as RFC 8305 recommends.
+func resolve(host string, family IPFamily) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := lookupIPAddr(context.Background(), host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	var v6, v4 []net.IP
+	for _, ip := range ips {
+		switch {
+		case !family.allows(ip):
+		case ip.To4() == nil:
+			v6 = append(v6, ip)
+		default:
+			v4 = append(v4, ip)
+		}
+	}
+	if len(v6)+len(v4) == 0 {
+		return nil, fmt.Errorf("gomq: no %v address for host %q", family, host)
+	}
+
+	sorted := make([]net.IP, 0, len(v6)+len(v4))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			sorted = append(sorted, v6[i])
+		}
+		if i < len(v4) {
+			sorted = append(sorted, v4[i])
+		}
+	}
+	return sorted, nil
+}
+
+// dialResult is the outcome of a connection attempt.
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialHappyEyeballs connects to address, a "host:port" whose
+// host is resolved to the addresses of family. Addresses are
+// tried in turn, starting the next one as soon as an attempt
+// fails or after fallbackDelay, while the attempts already
+// started go on: the first connection established wins, and
+// the others are abandoned. It returns the error of the first
+// attempt if none succeeds.
+func dialHappyEyeballs(network string, family IPFamily, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolve(host, family)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan dialResult, len(ips))
+	var dialer net.Dialer
+	next, pending := 0, 0
+	start := func() {
+		target := net.JoinHostPort(ips[next].String(), port)
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(ctx, network, target)
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go closeAbandoned(results, pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		case <-timer.C:
+		}
+		if next < len(ips) {
+			start()
+			timer.Reset(fallbackDelay)
+		}
+	}
+	return nil, firstErr
+}
+
+// closeAbandoned closes the connections established by
+// the n attempts still pending once another one won.
+func closeAbandoned(results <-chan dialResult, n int) {
+	for ; n > 0; n-- {
+		if r := <-results; r.conn != nil {
+			r.conn.Close()
+		}
+	}
+}
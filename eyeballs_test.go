@@ -0,0 +1,84 @@
+package gomq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// fakeLookup makes host names resolve to addrs
+// until the returned function is called.
+func fakeLookup(addrs ...string) func() {
+	lookup := lookupIPAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		var ips []net.IPAddr
+		for _, addr := range addrs {
+			ips = append(ips, net.IPAddr{IP: net.ParseIP(addr)})
+		}
+		return ips, nil
+	}
+	return func() { lookupIPAddr = lookup }
+}
+
+func TestResolve(t *testing.T) {
+	defer fakeLookup("127.0.0.1", "10.0.0.1", "::1", "fe80::1", "192.0.2.1")()
+
+	for _, tc := range []struct {
+		host   string
+		family IPFamily
+		want   string
+	}{
+		{"gomq.test", IPAny, "[::1 127.0.0.1 fe80::1 10.0.0.1 192.0.2.1]"},
+		{"gomq.test", IPv4Only, "[127.0.0.1 10.0.0.1 192.0.2.1]"},
+		{"gomq.test", IPv6Only, "[::1 fe80::1]"},
+		{"::1", IPAny, "[::1]"},
+		{"127.0.0.1", IPv4Only, "[127.0.0.1]"},
+	} {
+		ips, err := resolve(tc.host, tc.family)
+		if err != nil {
+			t.Errorf("%s %v: %v", tc.host, tc.family, err)
+			continue
+		}
+		if want, got := tc.want, fmt.Sprint(ips); want != got {
+			t.Errorf("%s %v: want %v, got %v", tc.host, tc.family, want, got)
+		}
+	}
+
+	if _, err := resolve("127.0.0.1", IPv6Only); err == nil {
+		t.Error("want an error resolving an IPv4 address to IPv6 ones")
+	}
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	// the first addresses cannot be connected to, or
+	// take too long, the last one is the server's
+	defer fakeLookup("::1", "192.0.2.1", "127.0.0.1")()
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetIPFamily(IPv4Only)
+	if _, err := server.Bind("tcp://*:19088"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("tcp://gomq.test:19088"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewClient(zmtp.NewSecurityNull())
+	defer other.Close()
+	other.SetIPFamily(IPv6Only)
+	other.SetBackoff(Backoff{MaxAttempts: 1})
+	if err := other.Connect("tcp://127.0.0.1:19088"); err == nil {
+		t.Error("want an error connecting to an IPv4 address over IPv6")
+	}
+}
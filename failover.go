@@ -0,0 +1,126 @@
+package gomq
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectAny accepts a Client interface and a list of endpoints
+// in descending order of priority. It connects the client to the
+// highest priority endpoint that is reachable, retrying the whole
+// list as set by the client's Backoff until one is. Whenever that
+// connection is lost, the client fails over to the highest priority
+// endpoint reachable at that time, until the socket is closed or
+// the backoff budget is exhausted. While connected to a lower
+// priority endpoint, the client tries those ranked above it each
+// Backoff.Initial, or retry interval, and switches back to the
+// first that it reaches.
+func ConnectAny(c Client, endpoints []string) error {
+	if len(endpoints) == 0 {
+		return errors.New("gomq: no endpoints to connect to")
+	}
+
+	// trimmed into a copy, as the caller's slice is theirs
+	trimmed := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		trimmed[i] = strings.TrimSpace(endpoint)
+	}
+
+	return connect(c, trimmed, false)
+}
+
+// reconnect adds conn to the socket and, each time the
+// connection is lost, dials d's endpoints again with dialAny
+// and adds the new connection, until the socket is closed,
+// the endpoints are disconnected or dialAny gives up. While
+// conn is not to the first endpoint, it probes those ranked
+// above it and swaps conn for the first one reached.
+func reconnect(s ZeroMQSocket, conn *Connection, d *dialer) {
+	multipart := multipartAllowed(s.SocketType())
+	s.AddConnection(conn)
+	conn.recv(s.RecvChannel(), multipart)
+
+	go func() {
+		defer d.forget(s)
+		var probe Ticker
+		defer func() {
+			if probe != nil {
+				probe.Stop()
+			}
+		}()
+		for {
+			rank := priority(d.endpoints, conn.endpoint)
+			if probe == nil && rank > 0 {
+				probe = clockOf(s).NewTicker(baseOf(s).Backoff().delay(1, s.RetryInterval()))
+			} else if probe != nil && rank == 0 {
+				probe.Stop()
+				probe = nil
+			}
+			var tick <-chan time.Time
+			if probe != nil {
+				tick = probe.C()
+			}
+
+			select {
+			case <-baseOf(s).Done():
+				return
+			case <-d.stop:
+				return
+			case <-tick:
+				if better := dialFirst(s, d.endpoints[:rank], d.stop); better != nil {
+					s.AddConnection(better)
+					better.recv(s.RecvChannel(), multipart)
+					atomic.StoreInt32(&conn.detached, 1)
+					s.RemoveConnection(conn.id)
+					conn = better
+				}
+				continue
+			case <-conn.lost:
+			}
+
+			var err error
+			if conn, err = dialAny(s, d.endpoints, false, d.stop); err != nil {
+				return
+			}
+			recordReconnect(s)
+			s.AddConnection(conn)
+			conn.recv(s.RecvChannel(), multipart)
+		}
+	}()
+}
+
+// priority returns the index of endpoint in endpoints,
+// 0 if it is not one of them.
+func priority(endpoints []string, endpoint string) int {
+	for i, e := range endpoints {
+		if e == endpoint {
+			return i
+		}
+	}
+	return 0
+}
+
+// dialFirst tries each endpoint once, in order, returning the
+// first connection that completes a handshake, nil if none does
+// or stop is closed.
+func dialFirst(s ZeroMQSocket, endpoints []string, stop <-chan struct{}) *Connection {
+	for _, endpoint := range endpoints {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if conn, err := dial(s, endpoint); err == nil {
+			select {
+			case <-stop:
+				conn.net.Close()
+				return nil
+			default:
+			}
+			return conn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package gomq
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestConnectAny(t *testing.T) {
+	primary := "tcp://127.0.0.1:19004"
+	standby := "tcp://127.0.0.1:19003"
+
+	serverA := NewServer(zmtp.NewSecurityNull())
+	defer serverA.Close()
+
+	bound := make(chan error)
+	go func() {
+		_, err := serverA.Bind(standby)
+		bound <- err
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect(primary + "," + standby); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-bound; err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := standby, client.Peers()[0].Endpoint; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	serverB := NewServer(zmtp.NewSecurityNull())
+	defer serverB.Close()
+
+	go func() {
+		_, err := serverB.Bind(primary)
+		bound <- err
+	}()
+
+	serverA.Close()
+
+	if err := <-bound; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; len(client.Peers()) == 0 || client.Peers()[0].Endpoint != primary; i++ {
+		if i == 100 {
+			t.Fatal("client did not fail over to the primary endpoint")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := serverB.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 0, bytes.Compare([]byte("HELLO"), msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestConnectAnyEndpoints(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://failover-trim"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	endpoints := []string{" inproc://failover-trim "}
+	if err := ConnectAny(client, endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := " inproc://failover-trim ", endpoints[0]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "inproc://failover-trim", client.Peers()[0].Endpoint; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestReconnectAfterMalformedFrame(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:19023")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// a server that sends a frame with reserved flags set on
+	// its first connection, and a valid one on the next
+	go func() {
+		for i := 0; i < 2; i++ {
+			netConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer netConn.Close()
+
+			conn := zmtp.NewConnection(netConn)
+			if _, err := conn.Prepare(zmtp.NewSecurityNull(), zmtp.ServerSocketType, nil, true, nil); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if i == 0 {
+				netConn.Write([]byte{0xF0, 0})
+			} else {
+				conn.SendFrame([]byte("HELLO"))
+			}
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19023"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Recv(); err == nil {
+		t.Error("want error for malformed frame")
+	}
+
+	msg, err := client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,25 @@
+package gomq
+
+// SetFrozen freezes or thaws the socket. A frozen socket
+// keeps receiving and keeps queueing the messages sent on
+// it, subject to its send mode and memory limit, but writes
+// nothing to its peers until it is thawed, which helps with
+// diagnosing downstream issues without dropping connections.
+// Closing or draining the socket writes out queued messages
+// even while frozen.
+func (s *Socket) SetFrozen(frozen bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.frozen = frozen
+	for _, conn := range s.conns {
+		conn.outbox.pause(frozen)
+	}
+}
+
+// Frozen reports whether the socket is frozen, see SetFrozen.
+func (s *Socket) Frozen() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.frozen
+}
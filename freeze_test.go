@@ -0,0 +1,67 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestFrozen(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19029"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19029"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetFrozen(true)
+	if !server.Frozen() {
+		t.Error("want frozen socket")
+	}
+
+	if err := server.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a frozen socket still receives
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, ok, _ := client.TryRecv(); ok {
+		t.Error("frozen socket wrote a message")
+	}
+	if want, got := 1, server.Peers()[0].QueuedMessages; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	server.SetFrozen(false)
+	msg, err = client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "WORLD", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
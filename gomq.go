@@ -1,36 +1,289 @@
 package gomq
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/zeromq/gomq/zmtp"
 )
 
 var (
-	defaultRetry = 250 * time.Millisecond
+	defaultRetry            = 250 * time.Millisecond
+	defaultLinger           = time.Second
+	defaultGreetingTimeout  = 5 * time.Second
+	defaultHandshakeTimeout = 30 * time.Second
+	defaultSendBuffer       = 64 << 10
 )
 
 // Connection is a gomq connection. It holds
 // both the net.Conn transport as well as the
 // zmtp connection information.
 type Connection struct {
-	net  net.Conn
-	zmtp *zmtp.Connection
+	// lastSent and lastRecv are the times, in nanoseconds
+	// since the epoch, anything was last written to or read
+	// from the connection. They are accessed atomically.
+	lastSent int64
+	lastRecv int64
+
+	// detached is set, atomically, once the connection is
+	// closed by Disconnect or Unbind, so that its closing is
+	// not reported as an error.
+	detached int32
+
+	id          string
+	routingID   []byte
+	userID      string
+	endpoint    string
+	net         net.Conn
+	zmtp        *zmtp.Connection
+	outbox      *outbox
+	done        chan struct{}
+	lost        chan struct{}
+	err         error
+	metadata    map[string]string
+	codec       string
+	subprotocol string
+	labels      Labels
+
+	// onCommand, if set, is called with the ZMTP
+	// commands received on the connection.
+	onCommand func(*Connection, *zmtp.Message)
+	goingAway bool
+
+	// socketDone is closed once the socket the
+	// connection was added to is closed.
+	socketDone <-chan struct{}
+
+	// subscriptions are the prefixes the peer subscribed
+	// to, guarded by the socket's lock.
+	subscriptions subscriptions
+
+	// checksum is set when both ends agreed to end each
+	// message with a checksum frame, see SetChecksum.
+	checksum bool
+
+	// stamper, if set, stamps the messages
+	// sent on the connection, see SetStamper.
+	stamper Stamper
+
+	// clock, if set, replaces the system clock for the
+	// connection's timers and times, see SetClock.
+	clock Clock
+
+	// recvHWM is the number of messages read ahead
+	// from the peer, see SetRecvHWM.
+	recvHWM int
+
+	// checkEnvelope, if set, checks the envelope of the
+	// messages received, see SetStrict.
+	checkEnvelope func([][]byte) error
+
+	// stats count the messages sent and received on the
+	// connection, and socketStats, once it is added to a
+	// socket, those of the socket.
+	stats       *counters
+	socketStats *counters
 }
 
 // NewConnection accepts a net.Conn, a *zmtp.Connection
 // and returns a *gomq.Connection.
 func NewConnection(netConn net.Conn, zmtpConn *zmtp.Connection) *Connection {
+	now := time.Now().UnixNano()
 	conn := &Connection{
-		net:  netConn,
-		zmtp: zmtpConn,
+		lastSent: now,
+		lastRecv: now,
+		net:      netConn,
+		zmtp:     zmtpConn,
+		outbox:   newOutbox(),
+		stats:    &counters{},
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
 	}
 	return conn
 }
 
-// ZeroMQSocket is the base gomq interface.
+// Done returns a channel that is closed once
+// the connection stops receiving messages,
+// typically because the peer went away.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// recv starts passing messages received on the connection
+// to messageOut. Commands are passed to the connection's
+// command handler instead. The connection's done channel
+// is closed as soon as receiving fails or the peer says
+// goodbye, after which nothing more is passed on. Messages
+// failing their checksum or envelope check, and ERROR
+// commands from the peer, fail the connection.
+func (c *Connection) recv(messageOut chan<- *zmtp.Message, multipart bool) {
+	in := make(chan *zmtp.Message, c.recvHWM)
+	if multipart || c.checksum {
+		c.zmtp.RecvMultipart(in)
+	} else {
+		c.zmtp.Recv(in)
+	}
+
+	go func() {
+		for msg := range in {
+			msg.Received = c.now()
+			atomic.StoreInt64(&c.lastRecv, msg.Received.UnixNano())
+			if msg.Err != nil {
+				c.err = msg.Err
+				close(c.done)
+				if atomic.LoadInt32(&c.detached) == 0 {
+					c.deliver(messageOut, &zmtp.Message{Err: peerError(c, msg.Err), MessageType: zmtp.ErrorMessage})
+				}
+				return
+			}
+			if msg.MessageType != zmtp.CommandMessage {
+				var err error
+				if c.checksum {
+					var ok bool
+					if msg.Body, ok = verifyChecksum(msg.Body); !ok {
+						err = ErrChecksum
+					}
+				}
+				if err == nil && c.checkEnvelope != nil {
+					err = c.checkEnvelope(msg.Body)
+				}
+				if err != nil {
+					c.fail(messageOut, in, err)
+					return
+				}
+				msg.Peer = c.id
+				c.received(msg.Body)
+				if !c.deliver(messageOut, msg) {
+					discardUntilError(in)
+					return
+				}
+				continue
+			}
+
+			if msg.Name == errorCommand {
+				c.fail(messageOut, in, commandError(msg))
+				return
+			}
+			if msg.Name == goodbyeCommand {
+				c.err = ErrPeerLeft
+				close(c.done)
+			}
+			if c.onCommand != nil {
+				c.onCommand(c, msg)
+			}
+			if msg.Name == goodbyeCommand {
+				// wait for the connection to be closed
+				discardUntilError(in)
+				return
+			}
+		}
+	}()
+}
+
+// fail fails the connection with err, which is passed on
+// to messageOut, and closes it.
+func (c *Connection) fail(messageOut chan<- *zmtp.Message, in <-chan *zmtp.Message, err error) {
+	c.err = err
+	close(c.done)
+	c.deliver(messageOut, &zmtp.Message{Err: peerError(c, err), MessageType: zmtp.ErrorMessage})
+	c.net.Close()
+	discardUntilError(in)
+}
+
+// deliver passes msg on to messageOut, unless the socket
+// the connection was added to is closed first. It returns
+// whether msg was passed on.
+func (c *Connection) deliver(messageOut chan<- *zmtp.Message, msg *zmtp.Message) bool {
+	select {
+	case messageOut <- msg:
+		return true
+	case <-c.socketDone:
+		return false
+	}
+}
+
+// discardUntilError receives messages from in until
+// one of them is an error.
+func discardUntilError(in <-chan *zmtp.Message) {
+	for msg := range in {
+		if msg.Err != nil {
+			return
+		}
+	}
+}
+
+// multipartAllowed reports whether sockets of type t may
+// exchange messages of more than one frame. Thread safe
+// socket types, such as CLIENT and SERVER, only exchange
+// single frame messages.
+func multipartAllowed(t zmtp.SocketType) bool {
+	return t != zmtp.ClientSocketType && t != zmtp.ServerSocketType
+}
+
+// PeerInfo describes a connection to a peer along with
+// the protocol and security details negotiated during
+// the ZMTP handshake.
+type PeerInfo struct {
+	ID             string
+	Endpoint       string
+	LocalAddr      net.Addr
+	RemoteAddr     net.Addr
+	Version        string
+	SocketType     zmtp.SocketType
+	SocketIdentity zmtp.SocketIdentity
+	RoutingID      []byte
+	UserID         string
+	Security       zmtp.SecurityDetails
+	QueuedMessages int
+	QueuedBytes    int
+	Metadata       map[string]string
+	Codec          string
+	Subprotocol    string
+	Labels         Labels
+}
+
+// Info returns the PeerInfo for the connection.
+func (c *Connection) Info() PeerInfo {
+	queued, queuedBytes := c.outbox.len()
+	return PeerInfo{
+		ID:             c.id,
+		Endpoint:       c.endpoint,
+		LocalAddr:      c.net.LocalAddr(),
+		RemoteAddr:     c.net.RemoteAddr(),
+		Version:        c.zmtp.Version(),
+		SocketType:     c.zmtp.PeerSocketType(),
+		SocketIdentity: c.zmtp.PeerIdentity(),
+		RoutingID:      c.routingID,
+		UserID:         c.userID,
+		Security:       c.zmtp.Security(),
+		QueuedMessages: queued,
+		QueuedBytes:    queuedBytes,
+		Metadata:       c.metadata,
+		Codec:          c.codec,
+		Subprotocol:    c.subprotocol,
+		Labels:         c.labels,
+	}
+}
+
+// ZeroMQSocket is the base gomq interface. Sockets are safe
+// for concurrent use: each connection has an outbox written
+// out by its own goroutine, as libzmq does with mailboxes,
+// so any number of goroutines may send, receive and change
+// options at once. Sockets with a send/receive lockstep,
+// such as REQ and REP, fail operations made out of turn by
+// one of them with ErrState.
+//
+// The interface is kept to sending and receiving messages and
+// the connections carrying them, so that adding a feature does
+// not break its implementations: options and features are set
+// on the socket types, which embed *Socket, and the functions
+// of this package taking a ZeroMQSocket reach them with type
+// assertions, using the defaults for other implementations.
 type ZeroMQSocket interface {
 	Recv() ([]byte, error)
 	Send([]byte) error
@@ -45,7 +298,30 @@ type ZeroMQSocket interface {
 	SendMultipart([][]byte) error
 	RecvMultipart() ([][]byte, error)
 
-	Close()
+	SendContext(context.Context, []byte) error
+	SendMultipartContext(context.Context, [][]byte) error
+	RecvContext(context.Context) ([]byte, error)
+	RecvMultipartContext(context.Context) ([][]byte, error)
+
+	Close() error
+}
+
+// based is implemented by sockets embedding *Socket.
+type based interface {
+	base() *Socket
+}
+
+// baseOf returns the *Socket holding the options of s, or,
+// if s does not embed one, a *Socket with the default options.
+func baseOf(s ZeroMQSocket) *Socket {
+	if b, ok := s.(based); ok {
+		return b.base()
+	}
+	return NewSocket(false, s.SocketType(), s.SocketIdentity(), s.SecurityMechanism())
+}
+
+func (s *Socket) base() *Socket {
+	return s
 }
 
 // Client is a gomq interface used for client sockets.
@@ -58,31 +334,78 @@ type Client interface {
 
 // ConnectClient accepts a Client interface and an endpoint
 // in the format <proto>://<address>:<port>. It then attempts
-// to connect to the endpoint and perform a ZMTP handshake.
+// to connect to the endpoint and perform a ZMTP handshake,
+// retrying as set by the client's Backoff while the endpoint
+// cannot be reached. The client connects again whenever the
+// connection is lost. If the client connects asynchronously,
+// see SetAsyncConnect, it returns without waiting.
+// A comma separated list of endpoints is connected with
+// failover, see ConnectAny.
 func ConnectClient(c Client, endpoint string) error {
-	parts := strings.Split(endpoint, "://")
+	if strings.Contains(endpoint, ",") {
+		return ConnectAny(c, strings.Split(endpoint, ","))
+	}
+
+	return connect(c, []string{endpoint}, true)
+}
 
-Connect:
-	netConn, err := net.Dial(parts[0], parts[1])
+var errDial = errors.New("gomq: could not dial endpoint")
+
+// dial makes a single attempt at connecting the socket to
+// endpoint and performing the ZMTP handshake. It returns
+// an error wrapping errDial if the endpoint could not be reached.
+func dial(s ZeroMQSocket, endpoint string) (*Connection, error) {
+	transport, address, err := splitEndpoint(endpoint)
 	if err != nil {
-		time.Sleep(c.RetryInterval())
-		goto Connect
+		return nil, err
 	}
 
-	zmtpConn := zmtp.NewConnection(netConn)
-	_, err = zmtpConn.Prepare(c.SecurityMechanism(), c.SocketType(), c.SocketIdentity(), false, nil)
+	if !acceptsPeer(s) {
+		setEndpointState(s, endpoint, Connecting, ErrPeerLimit)
+		return nil, ErrPeerLimit
+	}
+	setEndpointState(s, endpoint, Connecting, nil)
+	netConn, err := dialNet(s, transport, address)
 	if err != nil {
-		return err
+		setEndpointState(s, endpoint, Connecting, err)
+		if err == errNoTLSConfig {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errDial, err)
 	}
 
-	conn := &Connection{
-		net:  netConn,
-		zmtp: zmtpConn,
+	emit(s, SocketEvent{Type: EventConnected, Endpoint: endpoint, Addr: netConn.RemoteAddr().String()})
+	setEndpointState(s, endpoint, Handshaking, nil)
+	o := baseOf(s)
+	zmtpConn := zmtp.NewConnection(netConn)
+	zmtpConn.SetTrace(traceFunc(s, endpoint))
+	zmtpConn.SetGreetingTimeout(o.GreetingTimeout())
+	zmtpConn.SetHandshakeTimeout(o.HandshakeTimeout())
+	zmtpConn.SetMaxMessageSize(handshakeSizeLimit(o.MaxMessageSize()))
+	zmtpConn.SetStrict(o.Strict())
+	metadata, err := zmtpConn.Prepare(s.SecurityMechanism(), s.SocketType(), handshakeIdentity(s), false, o.Metadata())
+	if err == nil {
+		err = checkNamespace(s, metadata)
+	}
+	var subprotocol string
+	if err == nil {
+		subprotocol, err = negotiateSubprotocol(o.Metadata()[subprotocolsProperty], metadata[subprotocolsProperty], true)
+	}
+	if err != nil {
+		netConn.Close()
+		setEndpointState(s, endpoint, Degraded, err)
+		emit(s, SocketEvent{Type: EventHandshakeFailed, Endpoint: endpoint, Err: err})
+		return nil, err
 	}
 
-	c.AddConnection(conn)
-	zmtpConn.Recv(c.RecvChannel())
-	return nil
+	configureConnection(s, zmtpConn)
+	conn := NewConnection(netConn, zmtpConn)
+	conn.endpoint = endpoint
+	conn.metadata = metadata
+	conn.codec = negotiateCodec(o.Metadata()[codecsProperty], metadata[codecsProperty])
+	conn.subprotocol = subprotocol
+	conn.checksum = negotiateChecksum(o.Metadata()[checksumsProperty], metadata[checksumsProperty])
+	return conn, nil
 }
 
 // Server is a gomq interface used for server sockets.
@@ -94,38 +417,158 @@ type Server interface {
 }
 
 // BindServer accepts a Server interface and an endpoint
-// in the format <proto>://<address>:<port>. It then attempts
-// to bind to the endpoint. TODO: change this to starting
-// a listener on the endpoint that performs handshakes
-// with any client that connects
+// in the format <proto>://<address>:<port>, where address
+// may be "*" and port "*" or 0 for an ephemeral port, or a
+// range such as "[6000-6100]". It listens on the endpoint and
+// returns the address listened on, also reported by
+// LastEndpoint, accepting connections and performing the ZMTP handshake
+// with each of them in the background until the socket is
+// closed or stops listening on the endpoint.
 func BindServer(s Server, endpoint string) (net.Addr, error) {
-	var addr net.Addr
-	parts := strings.Split(endpoint, "://")
+	ln, err := bindListener(s, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	go acceptLoop(s, endpoint, ln)
+	return ln.Addr(), nil
+}
 
-	ln, err := net.Listen(parts[0], parts[1])
+// bindListener listens on endpoint and records the
+// listener on s.
+func bindListener(s Server, endpoint string) (net.Listener, error) {
+	transport, address, err := splitEndpoint(endpoint)
 	if err != nil {
-		return addr, err
+		return nil, err
 	}
 
-	netConn, err := ln.Accept()
+	if err := checkSecurity(s, []string{endpoint}, true); err != nil {
+		return nil, err
+	}
+	ln, err := listenNet(s, transport, address)
 	if err != nil {
-		return addr, err
+		return nil, err
+	}
+	if !trackListener(s, endpoint, ln) {
+		return nil, ErrClosed
+	}
+	return ln, nil
+}
+
+// peerLimiter is implemented by sockets that
+// accept a limited number of peers.
+type peerLimiter interface {
+	acceptsPeer() bool
+}
+
+// acceptsPeer reports whether s may take one more peer,
+// checked before dialing and handshaking, so that sockets
+// with all their peers neither connect nor accept more.
+func acceptsPeer(s ZeroMQSocket) bool {
+	if l, ok := s.(peerLimiter); ok {
+		return l.acceptsPeer()
+	}
+	return true
+}
+
+// acceptLoop accepts connections on ln, which listens on
+// endpoint, until ln is closed, and performs the ZMTP
+// handshake with each of them concurrently. Handshakes
+// still in progress are abandoned when s is closed.
+func acceptLoop(s Server, endpoint string, ln net.Listener) {
+	closed := socketClosed(s)
+	for {
+		netConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		handshaken := make(chan struct{})
+		go func() {
+			select {
+			case <-handshaken:
+			case <-closed:
+				netConn.Close()
+			}
+		}()
+		go func() {
+			acceptServer(s, endpoint, netConn)
+			close(handshaken)
+		}()
 	}
+}
 
+// acceptServer performs the ZMTP handshake with netConn,
+// accepted on endpoint, and adds it to s's connections.
+// Failures are recorded as the endpoint's state.
+func acceptServer(s Server, endpoint string, netConn net.Conn) error {
+	emit(s, SocketEvent{Type: EventAccepted, Endpoint: endpoint, Addr: netConn.RemoteAddr().String()})
+	setEndpointState(s, endpoint, Handshaking, nil)
+	if !acceptsPeer(s) {
+		netConn.Close()
+		setEndpointState(s, endpoint, Degraded, ErrPeerLimit)
+		emit(s, SocketEvent{Type: EventHandshakeFailed, Endpoint: endpoint, Err: ErrPeerLimit})
+		return ErrPeerLimit
+	}
+	o := baseOf(s)
+	if o.ProxyProtocol() {
+		proxied, err := acceptProxy(netConn, o.GreetingTimeout())
+		if err != nil {
+			netConn.Close()
+			setEndpointState(s, endpoint, Degraded, err)
+			emit(s, SocketEvent{Type: EventHandshakeFailed, Endpoint: endpoint, Err: err})
+			return err
+		}
+		netConn = proxied
+	}
+	if onForeign := foreignHandler(s); onForeign != nil && !isWS(netConn) {
+		sniffed, isZMTP, err := sniffZMTP(netConn, o.GreetingTimeout())
+		if err != nil {
+			netConn.Close()
+			setEndpointState(s, endpoint, Degraded, err)
+			emit(s, SocketEvent{Type: EventHandshakeFailed, Endpoint: endpoint, Err: err})
+			return err
+		}
+		if !isZMTP {
+			emit(s, SocketEvent{Type: EventForeign, Endpoint: endpoint, Addr: sniffed.RemoteAddr().String()})
+			onForeign(sniffed)
+			return nil
+		}
+		netConn = sniffed
+	}
 	zmtpConn := zmtp.NewConnection(netConn)
-	_, err = zmtpConn.Prepare(s.SecurityMechanism(), s.SocketType(), s.SocketIdentity(), true, nil)
+	zmtpConn.SetTrace(traceFunc(s, endpoint))
+	zmtpConn.SetGreetingTimeout(o.GreetingTimeout())
+	zmtpConn.SetHandshakeTimeout(o.HandshakeTimeout())
+	zmtpConn.SetMaxMessageSize(handshakeSizeLimit(o.MaxMessageSize()))
+	zmtpConn.SetStrict(o.Strict())
+	userID := setAuthenticator(s, zmtpConn, netConn.RemoteAddr())
+	metadata, err := zmtpConn.Prepare(s.SecurityMechanism(), s.SocketType(), handshakeIdentity(s), true, o.Metadata())
+	if err == nil {
+		err = checkNamespace(s, metadata)
+	}
+	var subprotocol string
+	if err == nil {
+		subprotocol, err = negotiateSubprotocol(o.Metadata()[subprotocolsProperty], metadata[subprotocolsProperty], false)
+	}
 	if err != nil {
-		return netConn.LocalAddr(), err
+		netConn.Close()
+		setEndpointState(s, endpoint, Degraded, err)
+		emit(s, SocketEvent{Type: EventHandshakeFailed, Endpoint: endpoint, Err: err})
+		return err
 	}
 
-	conn := &Connection{
-		net:  netConn,
-		zmtp: zmtpConn,
-	}
+	configureConnection(s, zmtpConn)
+	conn := NewConnection(netConn, zmtpConn)
+	conn.endpoint = endpoint
+	conn.metadata = metadata
+	conn.codec = negotiateCodec(metadata[codecsProperty], o.Metadata()[codecsProperty])
+	conn.subprotocol = subprotocol
+	conn.checksum = negotiateChecksum(o.Metadata()[checksumsProperty], metadata[checksumsProperty])
+	conn.userID = userID()
 
 	s.AddConnection(conn)
-	zmtpConn.Recv(s.RecvChannel())
-	return netConn.LocalAddr(), nil
+	conn.recv(s.RecvChannel(), multipartAllowed(s.SocketType()))
+	return nil
 }
 
 // Dealer is a gomq interface used for dealer sockets.
@@ -138,29 +581,11 @@ type Dealer interface {
 
 // ConnectDealer accepts a Dealer interface and an endpoint
 // in the format <proto>://<address>:<port>. It then attempts
-// to connect to the endpoint and perform a ZMTP handshake.
+// to connect to the endpoint and perform a ZMTP handshake,
+// retrying as set by the dealer's Backoff while the endpoint
+// cannot be reached. The dealer connects again whenever the
+// connection is lost. If the dealer connects asynchronously,
+// see SetAsyncConnect, it returns without waiting.
 func ConnectDealer(d Dealer, endpoint string) error {
-	parts := strings.Split(endpoint, "://")
-
-Connect:
-	netConn, err := net.Dial(parts[0], parts[1])
-	if err != nil {
-		time.Sleep(d.RetryInterval())
-		goto Connect
-	}
-
-	zmtpConn := zmtp.NewConnection(netConn)
-	_, err = zmtpConn.Prepare(d.SecurityMechanism(), d.SocketType(), d.SocketIdentity(), false, nil)
-	if err != nil {
-		return err
-	}
-
-	conn := &Connection{
-		net:  netConn,
-		zmtp: zmtpConn,
-	}
-
-	d.AddConnection(conn)
-	zmtpConn.RecvMultipart(d.RecvChannel())
-	return nil
+	return connect(d, []string{endpoint}, true)
 }
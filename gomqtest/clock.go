@@ -0,0 +1,157 @@
+package gomqtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeromq/gomq"
+)
+
+// Clock is a gomq.Clock whose time only moves when Advance is
+// called, so that the heartbeats, keepalives and reconnection
+// delays of the sockets using it, see gomq.Socket.SetClock,
+// fire when a test chooses rather than after real waits. Its
+// methods are safe for concurrent use.
+type Clock struct {
+	lock    sync.Mutex
+	now     time.Time
+	timers  []*timer
+	changed chan struct{}
+}
+
+// NewClock returns a Clock set to the current time.
+func NewClock() *Clock {
+	return &Clock{now: time.Now(), changed: make(chan struct{})}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer firing once the clock
+// is advanced by d from now.
+func (c *Clock) NewTimer(d time.Duration) gomq.Timer {
+	t := &timer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker returns a ticker firing each time the
+// clock is advanced past another period d.
+func (c *Clock) NewTicker(d time.Duration) gomq.Ticker {
+	t := &timer{clock: c, ch: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return ticker{t}
+}
+
+// Advance moves the clock forward by d, firing the timers
+// and tickers due by then in order. Like those of package
+// time, a ticker whose previous tick was not received yet
+// drops the next ones.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	end := c.now.Add(d)
+	for len(c.timers) > 0 {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].when.Before(c.timers[j].when)
+		})
+		t := c.timers[0]
+		if t.when.After(end) {
+			break
+		}
+		c.now = t.when
+		select {
+		case t.ch <- t.when:
+		default:
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.remove(t)
+		}
+	}
+	c.now = end
+}
+
+// Timers returns the number of timers and
+// tickers running.
+func (c *Clock) Timers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until at least n timers and tickers are
+// running, such as once a socket started heartbeating, so that
+// advancing the clock fires them. It returns gomq.ErrTimeout if
+// that has not happened within timeout, a real duration.
+func (c *Clock) WaitForTimers(n int, timeout time.Duration) error {
+	expired := time.After(timeout)
+	for {
+		c.lock.Lock()
+		count, changed := len(c.timers), c.changed
+		c.lock.Unlock()
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-expired:
+			return gomq.ErrTimeout
+		}
+	}
+}
+
+// remove stops t. The caller must hold the lock.
+func (c *Clock) remove(t *timer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// timer is a timer, or a ticker if period is not zero, of a Clock.
+type timer struct {
+	clock  *Clock
+	ch     chan time.Time
+	period time.Duration
+	when   time.Time
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *timer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	active := c.remove(t)
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return active
+}
+
+// ticker is a timer with a period, whose Stop reports nothing.
+type ticker struct{ *timer }
+
+func (t ticker) Stop() { t.timer.Stop() }
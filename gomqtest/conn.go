@@ -0,0 +1,241 @@
+package gomqtest
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// chunk is the bytes of a write, readable from at on.
+type chunk struct {
+	b  []byte
+	at time.Time
+}
+
+// pipe is one direction of a mem:// connection. It
+// buffers without limit, so that writes never block.
+type pipe struct {
+	lock   sync.Mutex
+	chunks []chunk
+	closed bool
+	err    error
+	data   chan struct{}
+}
+
+func newPipe() *pipe {
+	return &pipe{data: make(chan struct{}, 1)}
+}
+
+// notify wakes up the reader of p, if any, or the next one otherwise.
+func (p *pipe) notify() {
+	select {
+	case p.data <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the pipe, letting its reader drain it.
+func (p *pipe) close() {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+	p.notify()
+}
+
+// isClosed reports whether either end closed p.
+func (p *pipe) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.closed
+}
+
+// fail makes reading p return err once it is drained.
+func (p *pipe) fail(err error) {
+	p.lock.Lock()
+	p.err = err
+	p.lock.Unlock()
+	p.notify()
+}
+
+// deadline is a read or write deadline
+// waiters can tell has changed.
+type deadline struct {
+	lock    sync.Mutex
+	t       time.Time
+	changed chan struct{}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.lock.Lock()
+	d.t = t
+	if d.changed != nil {
+		close(d.changed)
+	}
+	d.changed = make(chan struct{})
+	d.lock.Unlock()
+}
+
+func (d *deadline) get() (time.Time, <-chan struct{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.changed == nil {
+		d.changed = make(chan struct{})
+	}
+	return d.t, d.changed
+}
+
+// conn is an end of a mem:// connection to name
+// on network, reading rx and writing tx.
+type conn struct {
+	network   *Network
+	name      string
+	rx, tx    *pipe
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	readLock                    sync.Mutex
+	readDeadline, writeDeadline deadline
+}
+
+// newPair returns both ends of a new connection to name.
+func newPair(n *Network, name string) (*conn, *conn) {
+	a, b := newPipe(), newPipe()
+	return &conn{network: n, name: name, rx: a, tx: b, closed: make(chan struct{})},
+		&conn{network: n, name: name, rx: b, tx: a, closed: make(chan struct{})}
+}
+
+func (c *conn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for {
+		if c.isClosed() {
+			return 0, net.ErrClosed
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		p := c.rx
+		var wait time.Duration
+		p.lock.Lock()
+		switch {
+		case len(p.chunks) > 0:
+			head := &p.chunks[0]
+			if wait = time.Until(head.at); wait <= 0 {
+				n := copy(b, head.b)
+				if head.b = head.b[n:]; len(head.b) == 0 {
+					p.chunks = p.chunks[1:]
+				}
+				p.lock.Unlock()
+				return n, nil
+			}
+		case p.err != nil:
+			err := p.err
+			p.lock.Unlock()
+			return 0, err
+		case p.closed:
+			p.lock.Unlock()
+			return 0, io.EOF
+		}
+		p.lock.Unlock()
+
+		if err := c.wait(p.data, wait); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// wait waits for ch, c being closed, the read deadline
+// passing or changing, or ready passing if not zero.
+func (c *conn) wait(ch <-chan struct{}, ready time.Duration) error {
+	t, changed := c.readDeadline.get()
+	var expired, delivered <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	if ready > 0 {
+		timer := time.NewTimer(ready)
+		defer timer.Stop()
+		delivered = timer.C
+	}
+
+	select {
+	case <-ch:
+	case <-changed:
+	case <-c.closed:
+	case <-delivered:
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	if c.isClosed() {
+		return 0, net.ErrClosed
+	}
+	if t, _ := c.writeDeadline.get(); !t.IsZero() && !time.Now().Before(t) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	at := time.Now().Add(c.network.delay(c.name))
+	p := c.tx
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	p.chunks = append(p.chunks, chunk{b: append([]byte(nil), b...), at: at})
+	p.lock.Unlock()
+	p.notify()
+	return len(b), nil
+}
+
+// Close closes both directions of the connection. The
+// other end reads the data already written, then io.EOF.
+func (c *conn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.rx.close()
+		c.tx.close()
+		err = nil
+	})
+	return err
+}
+
+func (c *conn) LocalAddr() net.Addr  { return addr(c.network.Endpoint(c.name)) }
+func (c *conn) RemoteAddr() net.Addr { return addr(c.network.Endpoint(c.name)) }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
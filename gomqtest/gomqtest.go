@@ -0,0 +1,311 @@
+// Package gomqtest helps testing code built on gomq without
+// TCP listeners or sleeps.
+//
+// Importing it registers the mem:// transport, connecting
+// sockets of the same process through the in-memory pipes of a
+// Network. Unlike inproc://, a Network lets tests break its
+// connections, delay what they carry and make handshakes fail,
+// at the moment they choose, to exercise reconnection and error
+// handling deterministically. Pair connects two sockets over a
+// new Network in one call. A Clock, given to sockets with
+// SetClock, fires their heartbeats and reconnection delays when
+// the test advances it.
+//
+// Socket is a test double of the version 2 Socket interface,
+// for unit tests of code that sends and receives messages
+// without needing a peer.
+package gomqtest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq"
+)
+
+// pairTimeout bounds the wait for the sockets
+// connected by Pair to see each other.
+const pairTimeout = 5 * time.Second
+
+// PairName is the name of the endpoint Pair
+// connects its sockets through.
+const PairName = "pair"
+
+// ErrHandshakeFailed is the error the connections made
+// to fail with Network.FailHandshakes read.
+var ErrHandshakeFailed = errors.New("gomqtest: handshake failed")
+
+// errRefused is returned when dialing a name no socket is bound to.
+var errRefused = errors.New("gomqtest: connection refused")
+
+func init() {
+	gomq.RegisterTransport(memTransport{})
+}
+
+// networks numbers the networks created, for their endpoints.
+var networks uint64
+
+// registry holds the networks by number.
+var registry = struct {
+	sync.Mutex
+	m map[string]*Network
+}{m: make(map[string]*Network)}
+
+// Network is a set of in-memory endpoints, named
+// mem://<network>/<name>, see Endpoint. Its methods
+// are safe for concurrent use.
+type Network struct {
+	id string
+
+	lock      sync.Mutex
+	listeners map[string]*listener
+	conns     map[string][]*conn
+	delays    map[string]time.Duration
+	failures  map[string]int
+}
+
+// NewNetwork returns a Network with no endpoint bound.
+func NewNetwork() *Network {
+	n := &Network{
+		id:        strconv.FormatUint(atomic.AddUint64(&networks, 1), 10),
+		listeners: make(map[string]*listener),
+		conns:     make(map[string][]*conn),
+		delays:    make(map[string]time.Duration),
+		failures:  make(map[string]int),
+	}
+	registry.Lock()
+	registry.m[n.id] = n
+	registry.Unlock()
+	return n
+}
+
+// Endpoint returns the endpoint of the network named
+// name, for sockets to bind and connect to.
+func (n *Network) Endpoint(name string) string {
+	return "mem://" + n.id + "/" + name
+}
+
+// Disconnect breaks every connection established to name,
+// as if the network failed: both ends read what was already
+// written, then io.EOF. Sockets bound to name keep listening,
+// so that connecting sockets reconnect. It returns the number
+// of connections broken.
+func (n *Network) Disconnect(name string) int {
+	n.lock.Lock()
+	conns := n.conns[name]
+	delete(n.conns, name)
+	n.lock.Unlock()
+
+	for _, c := range conns {
+		c.rx.close()
+		c.tx.close()
+	}
+	return len(conns)
+}
+
+// SetDelay delays the bytes written from then on to either
+// end of the connections to name by d before the other end
+// can read them, keeping their order. A zero d delivers
+// them right away, the default.
+func (n *Network) SetDelay(name string, d time.Duration) {
+	n.lock.Lock()
+	n.delays[name] = d
+	n.lock.Unlock()
+}
+
+// FailHandshakes makes the next count connections dialed
+// to name fail their handshake: the dialing socket reads
+// ErrHandshakeFailed, and no socket bound to name sees them.
+func (n *Network) FailHandshakes(name string, count int) {
+	n.lock.Lock()
+	n.failures[name] += count
+	n.lock.Unlock()
+}
+
+// delay returns the delay of the connections to name.
+func (n *Network) delay(name string) time.Duration {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.delays[name]
+}
+
+func (n *Network) dial(name string) (net.Conn, error) {
+	client, server := newPair(n, name)
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.failures[name] > 0 {
+		n.failures[name]--
+		client.rx.fail(ErrHandshakeFailed)
+		return client, nil
+	}
+	l := n.listeners[name]
+	if l == nil || !l.enqueue(server) {
+		return nil, errRefused
+	}
+
+	open := n.conns[name][:0]
+	for _, c := range n.conns[name] {
+		if !c.tx.isClosed() {
+			open = append(open, c)
+		}
+	}
+	n.conns[name] = append(open, client)
+	return client, nil
+}
+
+func (n *Network) listen(name string) (net.Listener, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if _, bound := n.listeners[name]; bound {
+		return nil, fmt.Errorf("gomqtest: endpoint %q already bound", n.Endpoint(name))
+	}
+	l := &listener{
+		network: n,
+		name:    name,
+		queued:  make(chan *conn, 16),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[name] = l
+	return l, nil
+}
+
+// memTransport is the mem:// transport, whose addresses
+// are <network>/<name>, see Network.Endpoint.
+type memTransport struct{}
+
+func (memTransport) Scheme() string { return "mem" }
+
+func (memTransport) Dial(address string) (net.Conn, error) {
+	n, name, err := lookup(address)
+	if err != nil {
+		return nil, err
+	}
+	return n.dial(name)
+}
+
+func (memTransport) Listen(address string) (net.Listener, error) {
+	n, name, err := lookup(address)
+	if err != nil {
+		return nil, err
+	}
+	return n.listen(name)
+}
+
+// lookup returns the network and the name of address.
+func lookup(address string) (*Network, string, error) {
+	id, name, ok := strings.Cut(address, "/")
+	registry.Lock()
+	n := registry.m[id]
+	registry.Unlock()
+	if !ok || n == nil {
+		return nil, "", fmt.Errorf("gomqtest: unknown network in address %q", address)
+	}
+	return n, name, nil
+}
+
+// addr is the address of an end of a mem:// connection.
+type addr string
+
+func (a addr) Network() string { return "mem" }
+func (a addr) String() string  { return string(a) }
+
+// listener accepts the connections dialed to its name.
+type listener struct {
+	network   *Network
+	name      string
+	queued    chan *conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// enqueue queues c to be accepted. It returns false
+// if the listener has too many connections queued.
+func (l *listener) enqueue(c *conn) bool {
+	select {
+	case l.queued <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.queued:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close frees the listener's name and refuses
+// the connections it has not accepted.
+func (l *listener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		l.network.lock.Lock()
+		if l.network.listeners[l.name] == l {
+			delete(l.network.listeners, l.name)
+		}
+		l.network.lock.Unlock()
+
+		close(l.closed)
+		for len(l.queued) > 0 {
+			(<-l.queued).Close()
+		}
+		err = nil
+	})
+	return err
+}
+
+func (l *listener) Addr() net.Addr {
+	return addr(l.network.Endpoint(l.name))
+}
+
+// Pair binds server to the endpoint PairName of a new Network,
+// connects client to it and waits for them to see each other,
+// failing t otherwise. Both sockets are closed when the test
+// ends. The Network returned breaks, delays or fails their
+// connection on demand.
+func Pair(t testing.TB, server gomq.Server, client gomq.Client) *Network {
+	t.Helper()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	n := NewNetwork()
+	endpoint := n.Endpoint(PairName)
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatalf("gomqtest: bind %s: %v", endpoint, err)
+	}
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatalf("gomqtest: connect %s: %v", endpoint, err)
+	}
+	if err := waitForPeer(server); err != nil {
+		t.Fatalf("gomqtest: server: %v", err)
+	}
+	if err := waitForPeer(client); err != nil {
+		t.Fatalf("gomqtest: client: %v", err)
+	}
+	return n
+}
+
+// waitForPeer waits for s to have a peer, if
+// it can tell, as the sockets of gomq can.
+func waitForPeer(s gomq.ZeroMQSocket) error {
+	if w, ok := s.(interface {
+		WaitForPeers(n int, timeout time.Duration) error
+	}); ok {
+		return w.WaitForPeers(1, pairTimeout)
+	}
+	return nil
+}
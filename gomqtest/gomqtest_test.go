@@ -0,0 +1,290 @@
+package gomqtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq"
+	v2 "github.com/zeromq/gomq/v2"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestPair(t *testing.T) {
+	server := gomq.NewPair(zmtp.NewSecurityNull())
+	client := gomq.NewPair(zmtp.NewSecurityNull())
+	n := Pair(t, server, client)
+
+	if err := client.Send([]byte("PING")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := server.Recv(); err != nil || string(got) != "PING" {
+		t.Errorf("want %q, got %q, %v", "PING", got, err)
+	}
+
+	// a second bind to the same name fails
+	other := gomq.NewPair(zmtp.NewSecurityNull())
+	defer other.Close()
+	if _, err := other.Bind(n.Endpoint(PairName)); err == nil {
+		t.Error("want an error binding a bound endpoint")
+	}
+	other.SetBackoff(gomq.Backoff{MaxAttempts: 1})
+	if err := other.Connect(n.Endpoint("nobody")); err == nil {
+		t.Error("want an error connecting to an unbound endpoint")
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	server := gomq.NewServer(zmtp.NewSecurityNull())
+	client := gomq.NewClient(zmtp.NewSecurityNull())
+	client.SetBackoff(gomq.Backoff{Initial: time.Millisecond})
+	events := make(chan gomq.SocketEvent, 16)
+	client.SetEventHandler(func(ev gomq.SocketEvent) { events <- ev })
+	n := Pair(t, server, client)
+
+	if want, got := 1, n.Disconnect(PairName); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	for _, want := range []gomq.EventType{gomq.EventConnected, gomq.EventHandshakeSucceeded, gomq.EventDisconnected, gomq.EventConnected, gomq.EventHandshakeSucceeded} {
+		select {
+		case ev := <-events:
+			if want != ev.Type {
+				t.Fatalf("want %v, got %v", want, ev.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %v event", want)
+		}
+	}
+
+	if _, _, err := server.RecvFrom(); !errors.Is(err, gomq.ErrPeerDisconnected) {
+		t.Errorf("want %v, got %v", gomq.ErrPeerDisconnected, err)
+	}
+	if err := client.Send([]byte("AGAIN")); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := server.RecvFrom(); err != nil || string(got) != "AGAIN" {
+		t.Errorf("want %q, got %q, %v", "AGAIN", got, err)
+	}
+}
+
+func TestSetDelay(t *testing.T) {
+	server := gomq.NewPair(zmtp.NewSecurityNull())
+	client := gomq.NewPair(zmtp.NewSecurityNull())
+	n := Pair(t, server, client)
+
+	const delay = 50 * time.Millisecond
+	n.SetDelay(PairName, delay)
+	start := time.Now()
+	for _, b := range []string{"1", "2"} {
+		if err := client.Send([]byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"1", "2"} {
+		if got, err := server.Recv(); err != nil || string(got) != want {
+			t.Errorf("want %q, got %q, %v", want, got, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("want a delay of at least %v, got %v", delay, elapsed)
+	}
+}
+
+func TestFailHandshakes(t *testing.T) {
+	n := NewNetwork()
+	endpoint := n.Endpoint("server")
+	server := gomq.NewPair(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	client := gomq.NewPair(zmtp.NewSecurityNull())
+	defer client.Close()
+	var failed []error
+	client.SetEventHandler(func(ev gomq.SocketEvent) {
+		if ev.Type == gomq.EventHandshakeFailed {
+			failed = append(failed, ev.Err)
+		}
+	})
+
+	n.FailHandshakes("server", 1)
+	if err := client.Connect(endpoint); !errors.Is(err, ErrHandshakeFailed) {
+		t.Errorf("want %v, got %v", ErrHandshakeFailed, err)
+	}
+	if want, got := 1, len(failed); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if !errors.Is(failed[0], ErrHandshakeFailed) {
+		t.Errorf("want %v, got %v", ErrHandshakeFailed, failed[0])
+	}
+
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClock(t *testing.T) {
+	server := gomq.NewServer(zmtp.NewSecurityNull())
+	client := gomq.NewClient(zmtp.NewSecurityNull())
+	clock := NewClock()
+	client.SetClock(clock)
+	client.SetHeartbeat(gomq.Heartbeat{Interval: time.Second, Timeout: time.Second / 2})
+	client.SetBackoff(gomq.Backoff{Initial: time.Hour})
+	events := make(chan gomq.SocketEvent, 16)
+	client.SetEventHandler(func(ev gomq.SocketEvent) { events <- ev })
+	n := Pair(t, server, client)
+
+	next := func(want gomq.EventType) {
+		t.Helper()
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no %v event", want)
+			}
+		}
+	}
+
+	// the server's answers are held up, so the
+	// client's heartbeat times out
+	n.SetDelay(PairName, time.Hour)
+	n.FailHandshakes(PairName, 1)
+	if err := clock.WaitForTimers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if err := clock.WaitForTimers(2, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second / 2)
+	next(gomq.EventDisconnected)
+
+	// the failed reconnection is retried an hour later
+	next(gomq.EventConnectRetried)
+	n.SetDelay(PairName, 0)
+	clock.Advance(time.Hour)
+	next(gomq.EventHandshakeSucceeded)
+}
+
+func TestConnectAnyFailback(t *testing.T) {
+	primary := "tcp://127.0.0.1:19092"
+	standby := "tcp://127.0.0.1:19091"
+
+	serverA := gomq.NewServer(zmtp.NewSecurityNull())
+	defer serverA.Close()
+	if _, err := serverA.Bind(standby); err != nil {
+		t.Fatal(err)
+	}
+
+	client := gomq.NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	clock := NewClock()
+	client.SetClock(clock)
+	client.SetBackoff(gomq.Backoff{Initial: time.Minute})
+	if err := gomq.ConnectAny(client, []string{primary, standby}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := standby, client.Peers()[0].Endpoint; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	// the primary comes back, and is switched
+	// back to at the next probe
+	serverB := gomq.NewServer(zmtp.NewSecurityNull())
+	defer serverB.Close()
+	if _, err := serverB.Bind(primary); err != nil {
+		t.Fatal(err)
+	}
+	if err := clock.WaitForTimers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	for i := 0; ; i++ {
+		peers := client.Peers()
+		if len(peers) == 1 && peers[0].Endpoint == primary {
+			break
+		}
+		if i == 100 {
+			t.Fatal("client did not switch back to the primary endpoint")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := serverB.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	var s v2.Socket = NewSocket()
+	fake := s.(*Socket)
+	ctx := context.Background()
+
+	if err := s.Connect("tcp://localhost:5555"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "tcp://localhost:5555", fake.Endpoints()[0]; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	frame := []byte("HELLO")
+	if err := s.Send(ctx, frame, []byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+	frame[0] = 'J'
+	if want, got := "HELLO WORLD", string(fake.Sent()[0][0])+" "+string(fake.Sent()[0][1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	fake.Deliver([]byte("REPLY"))
+	if msg, err := s.Recv(ctx); err != nil || string(msg[0]) != "REPLY" {
+		t.Errorf("want %q, got %q, %v", "REPLY", msg, err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Recv(timeout); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	errLost := errors.New("lost")
+	fake.Fail(errLost)
+	if want, got := errLost, s.Send(ctx, frame); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	fake.Fail(nil)
+
+	var events []v2.SocketEvent
+	s.SetEventHandler(func(ev v2.SocketEvent) { events = append(events, ev) })
+	fake.Emit(v2.SocketEvent{Type: gomq.EventDisconnected})
+	if want, got := 1, len(events); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := s.SetOption(v2.OptionLinger, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.GetOption(v2.OptionLinger); err != nil || value != time.Second {
+		t.Errorf("want %v, got %v, %v", time.Second, value, err)
+	}
+
+	s.Close()
+	if want, got := v2.ErrClosed, s.Send(ctx, frame); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,223 @@
+package gomqtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	v2 "github.com/zeromq/gomq/v2"
+)
+
+// Socket is a test double of v2.Socket, without any
+// connection: it records the messages sent to it, and
+// Recv returns the messages given to Deliver. Its methods
+// are safe for concurrent use.
+type Socket struct {
+	lock      sync.Mutex
+	sent      [][][]byte
+	inbox     [][][]byte
+	delivered chan struct{}
+	err       error
+	endpoints []string
+	options   map[v2.Option]interface{}
+	peers     []v2.PeerInfo
+	handler   func(v2.SocketEvent)
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSocket returns a Socket with no message to receive.
+func NewSocket() *Socket {
+	return &Socket{
+		delivered: make(chan struct{}, 1),
+		options:   make(map[v2.Option]interface{}),
+		closed:    make(chan struct{}),
+	}
+}
+
+// Deliver queues a message of the given frames for Recv.
+func (s *Socket) Deliver(frames ...[]byte) {
+	s.lock.Lock()
+	s.inbox = append(s.inbox, copyFrames(frames))
+	s.lock.Unlock()
+	select {
+	case s.delivered <- struct{}{}:
+	default:
+	}
+}
+
+// Sent returns the messages sent so far, oldest first.
+func (s *Socket) Sent() [][][]byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([][][]byte(nil), s.sent...)
+}
+
+// Endpoints returns the endpoints bound
+// and connected to so far.
+func (s *Socket) Endpoints() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.endpoints...)
+}
+
+// Fail makes Bind, Connect, Send and Recv return err from
+// then on, as if the socket had lost its peers. A nil err
+// makes them succeed again.
+func (s *Socket) Fail(err error) {
+	s.lock.Lock()
+	s.err = err
+	s.lock.Unlock()
+	select {
+	case s.delivered <- struct{}{}:
+	default:
+	}
+}
+
+// SetPeers sets the connections Peers describes.
+func (s *Socket) SetPeers(peers ...v2.PeerInfo) {
+	s.lock.Lock()
+	s.peers = append([]v2.PeerInfo(nil), peers...)
+	s.lock.Unlock()
+}
+
+// Emit calls the event handler with ev, if one is set.
+func (s *Socket) Emit(ev v2.SocketEvent) {
+	s.lock.Lock()
+	fn := s.handler
+	s.lock.Unlock()
+	if fn != nil {
+		fn(ev)
+	}
+}
+
+// check returns the error the socket fails with, if any.
+// The caller holds s.lock.
+func (s *Socket) check() error {
+	select {
+	case <-s.closed:
+		return v2.ErrClosed
+	default:
+	}
+	return s.err
+}
+
+// Bind records endpoint, returning it as the address bound.
+func (s *Socket) Bind(endpoint string) (net.Addr, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	s.endpoints = append(s.endpoints, endpoint)
+	return addr(endpoint), nil
+}
+
+// Connect records endpoint.
+func (s *Socket) Connect(endpoint string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.check(); err != nil {
+		return err
+	}
+	s.endpoints = append(s.endpoints, endpoint)
+	return nil
+}
+
+// Send records a message of the given frames, see Sent.
+func (s *Socket) Send(ctx context.Context, frames ...[]byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.check(); err != nil {
+		return err
+	}
+	s.sent = append(s.sent, copyFrames(frames))
+	return nil
+}
+
+// Recv returns the oldest message given to Deliver,
+// waiting for one until ctx is done.
+func (s *Socket) Recv(ctx context.Context) ([][]byte, error) {
+	for {
+		s.lock.Lock()
+		if err := s.check(); err != nil {
+			s.lock.Unlock()
+			return nil, err
+		}
+		if len(s.inbox) > 0 {
+			msg := s.inbox[0]
+			s.inbox = s.inbox[1:]
+			s.lock.Unlock()
+			return msg, nil
+		}
+		s.lock.Unlock()
+
+		select {
+		case <-s.delivered:
+		case <-s.closed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// GetOption returns the value opt was set to.
+func (s *Socket) GetOption(opt v2.Option) (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	value, ok := s.options[opt]
+	if !ok {
+		return nil, fmt.Errorf("gomqtest: option %v not set", opt)
+	}
+	return value, nil
+}
+
+// SetOption records value as the value of opt.
+func (s *Socket) SetOption(opt v2.Option, value interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.options[opt] = value
+	return nil
+}
+
+// Peers returns the connections set with SetPeers.
+func (s *Socket) Peers() []v2.PeerInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]v2.PeerInfo(nil), s.peers...)
+}
+
+// SetEventHandler registers a function called
+// with the events given to Emit.
+func (s *Socket) SetEventHandler(fn func(v2.SocketEvent)) {
+	s.lock.Lock()
+	s.handler = fn
+	s.lock.Unlock()
+}
+
+// Close makes Bind, Connect, Send and Recv
+// return v2.ErrClosed from then on.
+func (s *Socket) Close() error {
+	err := v2.ErrClosed
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = nil
+	})
+	return err
+}
+
+// copyFrames returns a copy of frames, so that
+// callers may reuse theirs.
+func copyFrames(frames [][]byte) [][]byte {
+	msg := make([][]byte, len(frames))
+	for i, frame := range frames {
+		msg[i] = append([]byte{}, frame...)
+	}
+	return msg
+}
+
+var _ v2.Socket = (*Socket)(nil)
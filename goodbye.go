@@ -0,0 +1,49 @@
+package gomq
+
+// goodbyeCommand is the ZMTP command a socket sends
+// its peers when it is leaving, see Goodbye.
+const goodbyeCommand = "BYE"
+
+// Goodbye tells every peer that the socket is leaving, with
+// an optional reason, and closes the socket. Peers clean up
+// right away instead of waiting to notice the connection
+// is gone. The goodbye is sent after the messages already
+// queued toward each peer.
+func (s *Socket) Goodbye(reason string) {
+	s.lock.RLock()
+	for _, id := range s.ids {
+		s.conns[id].outbox.push(&outgoing{
+			frames:  [][]byte{[]byte(reason)},
+			command: goodbyeCommand,
+		})
+	}
+	s.lock.RUnlock()
+
+	s.Close()
+}
+
+// SetGoodbyeHandler registers a function that is called,
+// without any of the socket's locks held, each time a peer
+// says goodbye, with the peer and the reason it gave.
+func (s *Socket) SetGoodbyeHandler(fn func(PeerInfo, string)) {
+	s.lock.Lock()
+	s.onGoodbye = fn
+	s.lock.Unlock()
+}
+
+// handleGoodbye removes conn, whose peer said goodbye, and
+// redirects the messages queued toward it to other peers.
+func (s *Socket) handleGoodbye(conn *Connection, reason string) {
+	info := conn.Info()
+	s.disconnected(conn, ErrPeerLeft)
+	s.redirect(conn, conn.outbox.take(), ErrPeerLeft)
+
+	s.lock.RLock()
+	onGoodbye := s.onGoodbye
+	info.SocketIdentity, _ = s.namespace.Strip(info.SocketIdentity)
+	s.lock.RUnlock()
+
+	if onGoodbye != nil {
+		onGoodbye(info, reason)
+	}
+}
@@ -0,0 +1,55 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestGoodbye(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	reasons := make(chan string, 1)
+	server.SetGoodbyeHandler(func(peer PeerInfo, reason string) {
+		reasons <- reason
+	})
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19021"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	if err := client.Connect("tcp://127.0.0.1:19021"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	client.Goodbye("restarting")
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	select {
+	case reason := <-reasons:
+		if want, got := "restarting", reason; want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("goodbye not received")
+	}
+
+	if want, got := 0, len(server.Peers()); want != got {
+		t.Errorf("want %v peers, got %v", want, got)
+	}
+}
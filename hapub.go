@@ -0,0 +1,155 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// States a HAPublisher tells its peer about.
+const (
+	haActive  = "ACTIVE"
+	haPassive = "PASSIVE"
+)
+
+// HAPublisher is one of a pair of publishers serving the same
+// feed for high availability, as in the Binary Star pattern.
+// The two publishers exchange their state over a PAIR link,
+// and only the active one publishes, so that subscribers can
+// connect to both endpoints and still receive each message
+// once. Both are meant to be fed the same messages, those
+// sent on the passive one being discarded.
+//
+// The primary is active when both run. The backup takes over
+// once it has not heard from the primary for three heartbeat
+// intervals, and keeps the feed when the primary comes back.
+// If both find themselves active, such as after the link
+// between them was cut, the backup steps down. While the link
+// is cut but both still run, both publish, so it should take
+// the same network path as subscribers.
+type HAPublisher struct {
+	pub      *PubSocket
+	peer     *PairSocket
+	primary  bool
+	interval time.Duration
+
+	lock     sync.Mutex
+	active   bool
+	onChange func(active bool)
+}
+
+// NewHAPublisher returns a publisher publishing on pub while
+// active, coordinating with its peer over peer, which must be
+// connected or bound to the other publisher's PAIR socket.
+// Exactly one of the two must be primary. They send each other
+// their state every interval. Run starts the election.
+func NewHAPublisher(pub *PubSocket, peer *PairSocket, primary bool, interval time.Duration) *HAPublisher {
+	return &HAPublisher{pub: pub, peer: peer, primary: primary, interval: interval}
+}
+
+// SetStateHandler registers a function that is called,
+// without the publisher's lock held, whenever it becomes
+// active or passive.
+func (p *HAPublisher) SetStateHandler(fn func(active bool)) {
+	p.lock.Lock()
+	p.onChange = fn
+	p.lock.Unlock()
+}
+
+// Active reports whether the publisher is publishing.
+func (p *HAPublisher) Active() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.active
+}
+
+// Send publishes b if the publisher is active,
+// and discards it otherwise.
+func (p *HAPublisher) Send(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendMultipart publishes msg if the publisher is
+// active, and discards it otherwise.
+func (p *HAPublisher) SendMultipart(msg [][]byte) error {
+	if !p.Active() {
+		return nil
+	}
+	return p.pub.SendMultipart(msg)
+}
+
+// Run elects the active publisher with the peer until ctx is
+// done or the PAIR socket is closed, and returns why. The
+// publisher is passive once Run returns.
+func (p *HAPublisher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer p.setActive(false)
+
+	states := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := p.peer.RecvContext(ctx)
+			switch {
+			case err == nil:
+				select {
+				case states <- string(msg):
+				case <-ctx.Done():
+				}
+			case ctx.Err() != nil || errors.Is(err, ErrClosed):
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	heard := time.Now()
+	p.tell()
+
+	for {
+		select {
+		case state := <-states:
+			heard = time.Now()
+			active := p.Active()
+			switch {
+			case state == haActive && active && !p.primary:
+				p.setActive(false)
+			case state == haPassive && !active && p.primary:
+				p.setActive(true)
+			}
+		case now := <-ticker.C:
+			if !p.Active() && now.Sub(heard) >= 3*p.interval {
+				p.setActive(true)
+			}
+			p.tell()
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+// tell sends the publisher's state to its peer,
+// if the PAIR socket can take it right away.
+func (p *HAPublisher) tell() {
+	state := haPassive
+	if p.Active() {
+		state = haActive
+	}
+	p.peer.TrySend([]byte(state))
+}
+
+func (p *HAPublisher) setActive(active bool) {
+	p.lock.Lock()
+	changed := p.active != active
+	p.active = active
+	onChange := p.onChange
+	p.lock.Unlock()
+
+	if changed && onChange != nil {
+		onChange(active)
+	}
+}
@@ -0,0 +1,111 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestHAPublisher(t *testing.T) {
+	newPub := func(endpoint string) *PubSocket {
+		pub := NewPub(zmtp.NewSecurityNull())
+		if _, err := pub.Bind(endpoint); err != nil {
+			t.Fatal(err)
+		}
+		return pub
+	}
+	pub1 := newPub("inproc://ha-pub1")
+	defer pub1.Close()
+	pub2 := newPub("inproc://ha-pub2")
+	defer pub2.Close()
+
+	pair1 := NewPair(zmtp.NewSecurityNull())
+	defer pair1.Close()
+	if _, err := pair1.Bind("inproc://ha-pair"); err != nil {
+		t.Fatal(err)
+	}
+	pair2 := NewPair(zmtp.NewSecurityNull())
+	defer pair2.Close()
+	if err := pair2.Connect("inproc://ha-pair"); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	for _, endpoint := range []string{"inproc://ha-pub1", "inproc://ha-pub2"} {
+		if err := sub.Connect(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub.Subscribe(nil)
+
+	interval := 20 * time.Millisecond
+	primary := NewHAPublisher(pub1, pair1, true, interval)
+	backup := NewHAPublisher(pub2, pair2, false, interval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primaryCtx, stopPrimary := context.WithCancel(ctx)
+	go primary.Run(primaryCtx)
+	go backup.Run(ctx)
+
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		for i := 0; !cond(); i++ {
+			if i == 100 {
+				t.Fatal("condition not met")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(primary.Active)
+	if backup.Active() {
+		t.Fatal("want only the primary active")
+	}
+	subscribed := func(pub *PubSocket) func() bool {
+		return func() bool {
+			prefixes, _, _ := pub.peerSubscriptions()
+			return len(prefixes) > 0
+		}
+	}
+	waitFor(subscribed(pub1))
+
+	for _, msg := range []string{"1", "2"} {
+		primary.Send([]byte(msg))
+		backup.Send([]byte(msg))
+	}
+	for _, want := range []string{"1", "2"} {
+		msg, err := sub.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+
+	stopPrimary()
+	waitFor(backup.Active)
+	if primary.Active() {
+		t.Error("want the stopped primary passive")
+	}
+	waitFor(subscribed(pub2))
+
+	primary.Send([]byte("3"))
+	backup.Send([]byte("3"))
+	msg, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "3", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel2()
+	if _, err := sub.RecvContext(ctx2); err == nil {
+		t.Error("want no duplicate")
+	}
+}
@@ -0,0 +1,86 @@
+package gomq
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// pingCommand is the ZMTP 3.1 heartbeat command,
+// which peers answer with a PONG.
+const pingCommand = "PING"
+
+// Heartbeat configures the ZMTP 3.1 heartbeats a socket sends
+// to detect peers that went away without closing their
+// connection, as happens when a NAT or firewall drops an idle
+// connection. Unlike keepalives, heartbeats are answered, so a
+// silent peer is noticed, and its connection torn down and
+// reestablished by connecting sockets. Peers are asked to do
+// the same on their end after TTL.
+type Heartbeat struct {
+	// Interval is how often a PING is sent on each
+	// connection. Zero disables heartbeats.
+	Interval time.Duration
+
+	// TTL, if not zero, asks peers to drop the connection
+	// if they receive nothing from the socket for that long.
+	// It is sent in deciseconds, up to about 6553 seconds.
+	TTL time.Duration
+
+	// Timeout is how long to wait for anything to be
+	// received after a PING before dropping the connection.
+	// It defaults to Interval.
+	Timeout time.Duration
+}
+
+// SetHeartbeat sets the heartbeats sent on connections
+// added to the socket from then on.
+func (s *Socket) SetHeartbeat(h Heartbeat) {
+	s.lock.Lock()
+	s.heartbeat = h
+	s.lock.Unlock()
+}
+
+// sendHeartbeats pings conn as set by h until the connection
+// or the socket is closed, closing the connection once nothing
+// was received for h's timeout after a ping.
+func (s *Socket) sendHeartbeats(conn *Connection, h Heartbeat) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = h.Interval
+	}
+	clock := conn.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	ticker := clock.NewTicker(h.Interval)
+	defer ticker.Stop()
+	expiry := clock.NewTimer(timeout)
+	expiry.Stop()
+	defer expiry.Stop()
+
+	body := zmtp.PingBody(h.TTL, nil)
+	var pinged time.Time
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-s.done:
+			return
+		case now := <-ticker.C():
+			if pinged.IsZero() {
+				pinged = now
+				expiry.Reset(timeout)
+				conn.outbox.push(&outgoing{frames: [][]byte{body}, command: pingCommand, priority: true})
+			}
+		case <-expiry.C():
+			recv := time.Unix(0, atomic.LoadInt64(&conn.lastRecv))
+			if recv.Before(pinged) {
+				conn.net.Close()
+				return
+			}
+			pinged = time.Time{}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestHeartbeat(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://heartbeat"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetHeartbeat(Heartbeat{Interval: 20 * time.Millisecond})
+
+	events := make(chan SocketEvent, 64)
+	client.SetEventHandler(func(ev SocketEvent) { events <- ev })
+
+	if err := client.Connect("inproc://heartbeat"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server's pongs keep the idle connection open
+	time.Sleep(200 * time.Millisecond)
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == EventDisconnected {
+			t.Fatalf("connection dropped: %v", ev.Err)
+		}
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	// the name is new to each run, so that the reconnections
+	// of an earlier run's client do not reach this listener
+	uuid, err := newUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "heartbeat-silent-" + uuid
+	ln, err := inprocTransport{}.Listen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the peer completes the handshake, then never answers
+	done := make(chan struct{})
+	defer close(done)
+	handshaken := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			handshaken <- err
+			return
+		}
+		defer conn.Close()
+		_, err = zmtp.NewConnection(conn).Prepare(zmtp.NewSecurityNull(), zmtp.ServerSocketType, nil, true, nil)
+		handshaken <- err
+		<-done
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetHeartbeat(Heartbeat{Interval: 20 * time.Millisecond, Timeout: 100 * time.Millisecond})
+
+	events := make(chan SocketEvent, 64)
+	client.SetEventHandler(func(ev SocketEvent) { events <- ev })
+
+	if err := client.Connect("inproc://" + name); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-handshaken; err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == EventDisconnected {
+				return
+			}
+		case <-timeout:
+			t.Fatal("want the silent peer dropped")
+		}
+	}
+}
+
+func TestHeartbeatTTL(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	events := make(chan SocketEvent, 64)
+	server.SetEventHandler(func(ev SocketEvent) { events <- ev })
+	if _, err := server.Bind("inproc://heartbeat-ttl"); err != nil {
+		t.Fatal(err)
+	}
+
+	netConn, err := inprocTransport{}.Dial("heartbeat-ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netConn.Close()
+	conn := zmtp.NewConnection(netConn)
+	if _, err := conn.Prepare(zmtp.NewSecurityNull(), zmtp.ClientSocketType, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan *zmtp.Message, 1)
+	conn.Recv(in)
+
+	if err := conn.SendCommand("PING", zmtp.PingBody(100*time.Millisecond, []byte("ctx"))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-in:
+		if msg.Name != "PONG" || string(msg.Body[0]) != "ctx" {
+			t.Fatalf("want a PONG echoing the context, got %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want a PONG")
+	}
+
+	// the server drops the connection once the TTL passes
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == EventDisconnected {
+				return
+			}
+		case <-timeout:
+			t.Fatal("want the connection dropped after the TTL")
+		}
+	}
+}
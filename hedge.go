@@ -0,0 +1,73 @@
+package gomq
+
+import (
+	"context"
+	"time"
+)
+
+// HedgedClient sends idempotent requests to several backends
+// to cut tail latency. Each request goes to the first backend,
+// then to the next one whenever Delay passes without a reply,
+// or right away if a backend fails. The first reply is used,
+// and the requests still in flight are abandoned, closing
+// the dealers they were made with so that their replies are
+// ignored.
+type HedgedClient struct {
+	Backends []*DealerPool
+	Delay    time.Duration
+}
+
+// Do sends request as described for HedgedClient and returns
+// the first reply. If every backend fails, it returns the
+// last error.
+func (h *HedgedClient) Do(ctx context.Context, request [][]byte) ([][]byte, error) {
+	if len(h.Backends) == 0 {
+		return nil, ErrNoPeers
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		reply [][]byte
+		err   error
+	}
+	results := make(chan result, len(h.Backends))
+
+	next, pending := 0, 0
+	var hedgeAt time.Time
+	send := func() {
+		p := h.Backends[next]
+		next++
+		pending++
+		hedgeAt = time.Now().Add(h.Delay)
+		go func() {
+			reply, err := p.Do(ctx, request)
+			results <- result{reply, err}
+		}()
+	}
+
+	send()
+	var err error
+	for pending > 0 {
+		var hedge <-chan time.Time
+		if next < len(h.Backends) {
+			hedge = time.After(time.Until(hedgeAt))
+		}
+
+		select {
+		case <-hedge:
+			send()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.reply, nil
+			}
+			err = r.err
+			if next < len(h.Backends) && ctx.Err() == nil {
+				send()
+			}
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,63 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// serveRep replies to each request on rep with
+// reply, after waiting for delay.
+func serveRep(rep *RepSocket, delay time.Duration, reply string) {
+	for {
+		msg, err := rep.RecvMultipart()
+		if err != nil {
+			return
+		}
+		time.Sleep(delay)
+		rep.SendMultipart(append(msg[:len(msg):len(msg)], []byte(reply)))
+	}
+}
+
+func TestHedgedClient(t *testing.T) {
+	var backends []*DealerPool
+	for i, delay := range []time.Duration{time.Second, 0} {
+		rep := NewRep(zmtp.NewSecurityNull())
+		defer rep.Close()
+		endpoint := "tcp://127.0.0.1:" + []string{"19059", "19060"}[i]
+		if _, err := rep.Bind(endpoint); err != nil {
+			t.Fatal(err)
+		}
+		go serveRep(rep, delay, endpoint)
+
+		pool, err := NewDealerPool(zmtp.NewSecurityNull(), endpoint, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Close()
+		backends = append(backends, pool)
+	}
+
+	h := &HedgedClient{Backends: backends, Delay: 50 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	reply, err := h.Do(ctx, [][]byte{{}, []byte("ping")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "tcp://127.0.0.1:19060", string(reply[len(reply)-1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("want the hedged reply, waited %v", elapsed)
+	}
+
+	h.Backends = nil
+	if _, err := h.Do(ctx, nil); err != ErrNoPeers {
+		t.Errorf("want %v, got %v", ErrNoPeers, err)
+	}
+}
@@ -0,0 +1,114 @@
+package gomq
+
+import (
+	"sync"
+)
+
+// SetSendHWM sets the send high-water mark: the number of
+// messages that may be queued for each peer, zero for no limit.
+// Once every peer's queue is full, sending blocks, drops the
+// message or fails with ErrWouldBlock according to the send
+// mode. PUB sockets drop the message for the peers whose queue
+// is full, as do replies routed to such a peer. Either way, the
+// dropped messages go to the dead letter handler.
+func (s *Socket) SetSendHWM(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sendHWM = n
+	for _, conn := range s.conns {
+		conn.outbox.setHWM(n, s.sendRoom)
+	}
+}
+
+// SetRecvHWM sets the receive high-water mark: the number of
+// messages read ahead from each peer, and waiting to be received,
+// before the socket stops reading from the peer, leaving it to
+// the transport to hold it back. It applies to the connections
+// made after the change.
+func (s *Socket) SetRecvHWM(n int) {
+	s.lock.Lock()
+	s.recvHWM = n
+	s.lock.Unlock()
+}
+
+// SetSendBuffer sets the size, in bytes, of the buffer each
+// connection batches the frames of queued messages in before
+// writing them to the transport, so that many small messages
+// go out in a few large writes. Whatever the size, frames are
+// written out as soon as no more messages are queued for the
+// peer. Zero writes each message out on its own. It defaults
+// to 64 KiB and applies to existing and future connections.
+func (s *Socket) SetSendBuffer(size int) {
+	s.lock.Lock()
+	s.sendBuffer = size
+	conns := make([]*Connection, 0, len(s.conns))
+	for _, conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.lock.Unlock()
+
+	for _, conn := range conns {
+		conn.zmtp.SetWriteBuffer(size)
+	}
+}
+
+// roomSignal tells senders waiting for room
+// in outboxes that a full one was popped.
+type roomSignal struct {
+	lock sync.Mutex
+	ch   chan struct{}
+}
+
+func newRoomSignal() *roomSignal {
+	return &roomSignal{ch: make(chan struct{})}
+}
+
+// wait returns a channel that is closed
+// the next time room is made.
+func (r *roomSignal) wait() <-chan struct{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.ch
+}
+
+func (r *roomSignal) notify() {
+	r.lock.Lock()
+	close(r.ch)
+	r.ch = make(chan struct{})
+	r.lock.Unlock()
+}
+
+// setHWM sets the outbox's high-water mark, signaling
+// room when a message is popped from a full outbox.
+func (o *outbox) setHWM(n int, room *roomSignal) {
+	o.lock.Lock()
+	o.hwm = n
+	o.room = room
+	o.lock.Unlock()
+}
+
+// offer queues a message like push, unless the outbox holds
+// as many messages as its high-water mark. It returns whether
+// the message was queued, and if not, whether the outbox is full.
+func (o *outbox) offer(msg *outgoing) (ok, full bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.closed {
+		return false, false
+	}
+	if o.hwm > 0 && !msg.priority && len(o.msgs) >= o.hwm {
+		return false, true
+	}
+	o.add(msg)
+	return true, false
+}
+
+// full reports whether the outbox holds as many
+// messages as its high-water mark.
+func (o *outbox) full() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.hwm > 0 && len(o.msgs) >= o.hwm
+}
@@ -0,0 +1,155 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestOutboxHWM(t *testing.T) {
+	room := newRoomSignal()
+	o := newOutbox()
+	o.setHWM(2, room)
+	for i := 0; i < 2; i++ {
+		if ok, _ := o.offer(&outgoing{frames: [][]byte{[]byte("msg")}}); !ok {
+			t.Fatalf("want message %d queued", i)
+		}
+	}
+	if ok, full := o.offer(&outgoing{frames: [][]byte{[]byte("msg")}}); ok || !full {
+		t.Errorf("want a full outbox, got %v, %v", ok, full)
+	}
+	if ok, _ := o.offer(&outgoing{frames: [][]byte{nil}, priority: true}); !ok {
+		t.Error("want priority messages past the high-water mark")
+	}
+
+	made := room.wait()
+	o.pop()
+	select {
+	case <-made:
+		t.Error("want no room made by popping the priority lane")
+	default:
+	}
+	o.pop()
+	select {
+	case <-made:
+	default:
+		t.Error("want room made by popping a full outbox")
+	}
+}
+
+func TestSendHWM(t *testing.T) {
+	endpoint := "inproc://test-send-hwm"
+
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	push.SetSendHWM(1)
+	push.SetSendMode(SendDontWait)
+	if err := push.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	push.SetFrozen(true)
+
+	if err := push.Send([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := push.Send([]byte("second")); !errors.Is(err, ErrWouldBlock) {
+		t.Errorf("want %v, got %v", ErrWouldBlock, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sent := make(chan error, 1)
+	go func() {
+		sent <- push.SendContext(ctx, []byte("second"))
+	}()
+	push.SetFrozen(false)
+	for _, want := range []string{"first", "second"} {
+		msg, err := pull.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != string(msg) {
+			t.Errorf("want %q, got %q", want, msg)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSendBuffer(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("tcp://127.0.0.1:19080"); err != nil {
+		t.Fatal(err)
+	}
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	push.SetSendBuffer(16)
+	if err := push.Connect("tcp://127.0.0.1:19080"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, size := range []int{16, 0, 1 << 20} {
+		push.SetSendBuffer(size)
+		for j := 0; j < 100; j++ {
+			if err := push.SendMultipart([][]byte{{byte(i)}, {byte(j)}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for j := 0; j < 100; j++ {
+			msg, err := pull.RecvMultipart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := [2]byte{byte(i), byte(j)}, [2]byte{msg[0][0], msg[1][0]}; want != got {
+				t.Fatalf("want %v, got %v", want, got)
+			}
+		}
+	}
+}
+
+func BenchmarkSendBuffer(b *testing.B) {
+	for i, size := range []int{0, defaultSendBuffer} {
+		b.Run("size="+strconv.Itoa(size), func(b *testing.B) {
+			endpoint := "tcp://127.0.0.1:" + strconv.Itoa(19081+i)
+			pull := NewPull(zmtp.NewSecurityNull())
+			defer pull.Close()
+			if _, err := pull.Bind(endpoint); err != nil {
+				b.Fatal(err)
+			}
+
+			push := NewPush(zmtp.NewSecurityNull())
+			defer push.Close()
+			push.SetSendBuffer(size)
+			if err := push.Connect(endpoint); err != nil {
+				b.Fatal(err)
+			}
+
+			msg := make([]byte, 64)
+			b.SetBytes(int64(len(msg)))
+			b.ResetTimer()
+			go func() {
+				for n := 0; n < b.N; n++ {
+					push.Send(msg)
+				}
+			}()
+			for n := 0; n < b.N; n++ {
+				if _, err := pull.Recv(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package gomq
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inprocBufferSize is the number of bytes each direction
+// of an inproc:// connection buffers.
+const inprocBufferSize = 256 << 10
+
+func init() {
+	RegisterTransport(inprocTransport{})
+}
+
+// inprocTransport is the inproc:// transport, connecting
+// sockets of the same process through in-memory pipes. Its
+// addresses are names in a registry global to the process.
+// As with libzmq, a socket may connect to a name before
+// another binds to it: the connection then waits for the
+// bind to be accepted.
+type inprocTransport struct{}
+
+func (inprocTransport) Scheme() string { return "inproc" }
+
+// inproc is the registry of inproc:// names, holding
+// their listeners and the connections dialed before
+// they were bound.
+var inproc = struct {
+	sync.Mutex
+	listeners map[string]*inprocListener
+	pending   map[string][]net.Conn
+}{
+	listeners: make(map[string]*inprocListener),
+	pending:   make(map[string][]net.Conn),
+}
+
+// inprocScoper is implemented by sockets embedding *Socket,
+// whose inproc:// names are private to their Context.
+type inprocScoper interface {
+	inprocScope() string
+}
+
+// inprocName returns the name in the registry of the inproc://
+// name s binds or connects to, prefixed with a zero byte by
+// the scope of s's Context, if any, so that the names of
+// different contexts do not clash.
+func inprocName(s ZeroMQSocket, name string) string {
+	if i, ok := s.(inprocScoper); ok {
+		if scope := i.inprocScope(); scope != "" {
+			return scope + "\x00" + name
+		}
+	}
+	return name
+}
+
+func (s *Socket) inprocScope() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.scope
+}
+
+func (inprocTransport) Dial(name string) (net.Conn, error) {
+	client, server := newInprocPair(name)
+
+	inproc.Lock()
+	defer inproc.Unlock()
+	if l := inproc.listeners[name]; l != nil {
+		l.enqueue(server)
+	} else {
+		inproc.pending[name] = append(inproc.pending[name], server)
+	}
+	return client, nil
+}
+
+func (inprocTransport) Listen(name string) (net.Listener, error) {
+	inproc.Lock()
+	defer inproc.Unlock()
+
+	if _, bound := inproc.listeners[name]; bound {
+		return nil, fmt.Errorf("gomq: inproc endpoint %q already bound", name)
+	}
+	l := &inprocListener{
+		name:    name,
+		queue:   inproc.pending[name],
+		queued:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		address: inprocAddr(name[strings.IndexByte(name, 0)+1:]),
+	}
+	delete(inproc.pending, name)
+	inproc.listeners[name] = l
+	return l, nil
+}
+
+// inprocAddr is the address of either end of
+// an inproc:// connection.
+type inprocAddr string
+
+func (a inprocAddr) Network() string { return "inproc" }
+func (a inprocAddr) String() string  { return string(a) }
+
+// inprocListener accepts the connections dialed to its name.
+type inprocListener struct {
+	name      string
+	lock      sync.Mutex
+	queue     []net.Conn
+	queued    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	address   inprocAddr
+}
+
+func (l *inprocListener) enqueue(conn net.Conn) {
+	l.lock.Lock()
+	l.queue = append(l.queue, conn)
+	l.lock.Unlock()
+	pipeNotify(l.queued)
+}
+
+func (l *inprocListener) Accept() (net.Conn, error) {
+	for {
+		l.lock.Lock()
+		if len(l.queue) > 0 {
+			conn := l.queue[0]
+			l.queue = l.queue[1:]
+			l.lock.Unlock()
+			return conn, nil
+		}
+		l.lock.Unlock()
+
+		select {
+		case <-l.queued:
+		case <-l.closed:
+			return nil, net.ErrClosed
+		}
+	}
+}
+
+// Close frees the listener's name and closes the
+// connections it has not accepted.
+func (l *inprocListener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		inproc.Lock()
+		if inproc.listeners[l.name] == l {
+			delete(inproc.listeners, l.name)
+		}
+		inproc.Unlock()
+
+		close(l.closed)
+		l.lock.Lock()
+		for _, conn := range l.queue {
+			conn.Close()
+		}
+		l.queue = nil
+		l.lock.Unlock()
+		err = nil
+	})
+	return err
+}
+
+func (l *inprocListener) Addr() net.Addr {
+	return l.address
+}
+
+// pipeDeadline is a read or write deadline waiters
+// can tell has changed.
+type pipeDeadline struct {
+	lock    sync.Mutex
+	t       time.Time
+	changed chan struct{}
+}
+
+func (d *pipeDeadline) set(t time.Time) {
+	d.lock.Lock()
+	d.t = t
+	if d.changed != nil {
+		close(d.changed)
+	}
+	d.changed = make(chan struct{})
+	d.lock.Unlock()
+}
+
+func (d *pipeDeadline) get() (time.Time, <-chan struct{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.changed == nil {
+		d.changed = make(chan struct{})
+	}
+	return d.t, d.changed
+}
+
+// pipeNotify wakes up the waiter on ch, if any, or
+// the next one otherwise.
+func pipeNotify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// inprocPipe is one direction of an inproc:// connection.
+type inprocPipe struct {
+	lock       sync.Mutex
+	buf        []byte
+	closed     bool
+	data, room chan struct{}
+}
+
+func newInprocPipe() *inprocPipe {
+	return &inprocPipe{
+		data: make(chan struct{}, 1),
+		room: make(chan struct{}, 1),
+	}
+}
+
+// close stops the pipe, letting its reader drain it.
+func (p *inprocPipe) close() {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+	pipeNotify(p.data)
+	pipeNotify(p.room)
+}
+
+// inprocConn is an end of an inproc:// connection,
+// reading rx and writing tx.
+type inprocConn struct {
+	rx, tx    *inprocPipe
+	addr      inprocAddr
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	readLock, writeLock         sync.Mutex
+	readDeadline, writeDeadline pipeDeadline
+}
+
+// newInprocPair returns both ends of a new connection to name.
+func newInprocPair(name string) (*inprocConn, *inprocConn) {
+	a, b := newInprocPipe(), newInprocPipe()
+	return &inprocConn{rx: a, tx: b, addr: inprocAddr(name), closed: make(chan struct{})},
+		&inprocConn{rx: b, tx: a, addr: inprocAddr(name), closed: make(chan struct{})}
+}
+
+// wait waits for ch, c being closed,
+// or d passing or changing.
+func (c *inprocConn) wait(ch <-chan struct{}, d *pipeDeadline) error {
+	t, changed := d.get()
+	var expired <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-ch:
+	case <-changed:
+	case <-c.closed:
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+func (c *inprocConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for {
+		select {
+		case <-c.closed:
+			return 0, net.ErrClosed
+		default:
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		p := c.rx
+		p.lock.Lock()
+		if len(p.buf) > 0 {
+			n := copy(b, p.buf)
+			p.buf = p.buf[n:]
+			p.lock.Unlock()
+			pipeNotify(p.room)
+			return n, nil
+		}
+		closed := p.closed
+		p.lock.Unlock()
+		if closed {
+			return 0, io.EOF
+		}
+
+		if err := c.wait(p.data, &c.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *inprocConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	var n int
+	for n < len(b) {
+		select {
+		case <-c.closed:
+			return n, net.ErrClosed
+		default:
+		}
+
+		p := c.tx
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			return n, io.ErrClosedPipe
+		}
+		if room := inprocBufferSize - len(p.buf); room > 0 {
+			m := min(room, len(b)-n)
+			p.buf = append(p.buf, b[n:n+m]...)
+			p.lock.Unlock()
+			n += m
+			pipeNotify(p.data)
+			continue
+		}
+		p.lock.Unlock()
+
+		if err := c.wait(p.room, &c.writeDeadline); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Close closes both directions of the connection. The
+// other end reads the data already written, then io.EOF.
+func (c *inprocConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.rx.close()
+		c.tx.close()
+		err = nil
+	})
+	return err
+}
+
+func (c *inprocConn) LocalAddr() net.Addr  { return c.addr }
+func (c *inprocConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *inprocConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *inprocConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *inprocConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
@@ -0,0 +1,105 @@
+package gomq
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestInprocConn(t *testing.T) {
+	l, err := inprocTransport{}.Listen("conn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := (inprocTransport{}).Listen("conn"); err == nil {
+		t.Error("want an error binding a bound name")
+	}
+
+	client, err := inprocTransport{}.Dial("conn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes larger than the buffer complete as they are read.
+	msg := make([]byte, 3*inprocBufferSize)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	go func() {
+		client.Write(msg)
+		client.Close()
+	}()
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := string(msg), string(got); want != got {
+		t.Errorf("want %d bytes, got %d", len(want), len(got))
+	}
+
+	server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("want %v, got %v", io.EOF, err)
+	}
+	server.Close()
+
+	c, s := newInprocPair("deadline")
+	defer c.Close()
+	defer s.Close()
+	s.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := s.Read(make([]byte, 1)); err != os.ErrDeadlineExceeded {
+		t.Errorf("want %v, got %v", os.ErrDeadlineExceeded, err)
+	}
+}
+
+func TestInproc(t *testing.T) {
+	endpoint := "inproc://test-inproc"
+
+	// Connect before the server binds, as libzmq allows.
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	connected := make(chan error, 1)
+	go func() {
+		connected <- client.Connect(endpoint)
+	}()
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ping", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := server.Send([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "pong", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
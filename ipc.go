@@ -0,0 +1,107 @@
+//go:build unix
+
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// maxIPCPath is the length of the longest socket file
+// path the system takes, its sockaddr_un's sun_path
+// less the terminating zero byte.
+var maxIPCPath = len(syscall.RawSockaddrUnix{}.Path) - 1
+
+func init() {
+	RegisterTransport(ipcTransport{})
+}
+
+// ipcTransport is the ipc:// transport, carrying connections
+// over Unix domain sockets. Its address is the path of the
+// socket file, as in "ipc:///tmp/feed", and binding to "*"
+// creates one in the temporary directory. The socket file is
+// removed when the listener is closed, and a stale one left
+// behind by a process that did not close its listener is
+// replaced.
+type ipcTransport struct{}
+
+func (ipcTransport) Scheme() string { return "ipc" }
+
+// ValidateAddress checks that path can name a socket file,
+// as binding or connecting to a path that is too long fails
+// with an error that does not say so.
+func (ipcTransport) ValidateAddress(path string) error {
+	switch {
+	case path == "*":
+		return nil
+	case strings.IndexByte(path, 0) >= 0:
+		return fmt.Errorf("gomq: ipc path %q contains a zero byte", path)
+	case len(path) > maxIPCPath:
+		return fmt.Errorf("gomq: ipc path %q is %d bytes long, over the limit of %d on %s", path, len(path), maxIPCPath, runtime.GOOS)
+	}
+	return nil
+}
+
+func (ipcTransport) Dial(path string) (net.Conn, error) {
+	return net.Dial("unix", path)
+}
+
+func (ipcTransport) Listen(path string) (net.Listener, error) {
+	if path == "*" {
+		id, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(os.TempDir(), "gomq-ipc-"+id)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket == 0 {
+		return nil, fmt.Errorf("gomq: ipc path %q exists and is not a socket", path)
+	}
+	removeStaleSocket(path)
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(true)
+	return ipcListener{ln}, nil
+}
+
+// removeStaleSocket removes the socket file at path
+// if nothing listens on it anymore.
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		os.Remove(path)
+	}
+}
+
+// ipcAddr is the address of an ipc:// listener.
+type ipcAddr string
+
+func (a ipcAddr) Network() string { return "ipc" }
+func (a ipcAddr) String() string  { return string(a) }
+
+// ipcListener is a listener on a Unix domain socket,
+// reporting its address as an ipc:// one.
+type ipcListener struct {
+	*net.UnixListener
+}
+
+func (l ipcListener) Addr() net.Addr {
+	return ipcAddr(l.UnixListener.Addr().String())
+}
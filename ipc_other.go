@@ -0,0 +1,29 @@
+//go:build !unix
+
+package gomq
+
+import (
+	"errors"
+	"net"
+	"runtime"
+)
+
+func init() {
+	RegisterTransport(ipcTransport{})
+}
+
+var errIPCNotSupported = errors.New("gomq: ipc:// is not supported on " + runtime.GOOS)
+
+// ipcTransport is the ipc:// transport, which needs
+// Unix domain sockets and fails on this platform.
+type ipcTransport struct{}
+
+func (ipcTransport) Scheme() string { return "ipc" }
+
+func (ipcTransport) Dial(path string) (net.Conn, error) {
+	return nil, errIPCNotSupported
+}
+
+func (ipcTransport) Listen(path string) (net.Listener, error) {
+	return nil, errIPCNotSupported
+}
@@ -0,0 +1,88 @@
+//go:build unix
+
+package gomq
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestIPC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sock")
+
+	// A socket file left behind is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	server := NewServer(zmtp.NewSecurityNull())
+	if _, err := server.Bind("ipc://" + path); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ipc://"+path, server.LastEndpoint(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("ipc://" + path); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ping", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	server.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want the socket file removed, got %v", err)
+	}
+}
+
+func TestIPCWildcard(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("ipc://*"); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := server.LastEndpoint()
+	if !strings.HasPrefix(endpoint, "ipc://"+os.TempDir()) {
+		t.Errorf("want a socket in the temporary directory, got %q", endpoint)
+	}
+}
+
+func TestIPCInvalidPath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/tmp/" + strings.Repeat("x", maxIPCPath),
+		"/tmp/nul\x00",
+		file,
+	} {
+		server := NewServer(zmtp.NewSecurityNull())
+		if _, err := server.Bind("ipc://" + path); err == nil || !strings.HasPrefix(err.Error(), "gomq: ipc path") {
+			t.Errorf("%q: want an ipc path error, got %v", path, err)
+		}
+		server.Close()
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("want the file left alone, got %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package gomq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	journalMessage = 'm'
+	journalAck     = 'a'
+)
+
+// Journal is a write-ahead log of the messages queued by
+// a socket. Every message sent on a socket with a journal
+// is appended to it, and acknowledged once it has been
+// written to a peer or deliberately dropped. Messages that
+// were still queued when the process stopped are replayed
+// when the journal is reopened and attached to a socket.
+//
+// The journal is written without fsync, so it survives
+// the process crashing or restarting, not the host losing
+// power.
+type Journal struct {
+	lock      sync.Mutex
+	file      *os.File
+	w         *bufio.Writer
+	seq       uint64
+	pending   map[uint64][][]byte
+	transform JournalTransform
+}
+
+// JournalTransform transforms messages on their way to and
+// from a journal's file, for instance to compress them or to
+// encrypt them at rest. Seal is applied to each message before
+// it is written, and Unseal to each message read back.
+type JournalTransform interface {
+	Seal(msg [][]byte) ([][]byte, error)
+	Unseal(msg [][]byte) ([][]byte, error)
+}
+
+// OpenJournal opens the journal at path, creating it if
+// needed, and loads the messages it holds that were never
+// acknowledged.
+func OpenJournal(path string) (*Journal, error) {
+	return OpenJournalWith(path, nil)
+}
+
+// OpenJournalWith is like OpenJournal, but messages are
+// passed through t on their way to and from the file.
+// The journal must always be opened with the same t.
+func OpenJournalWith(path string, t JournalTransform) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		file:      file,
+		pending:   make(map[uint64][][]byte),
+		transform: t,
+	}
+
+	if err := j.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := j.compact(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// load reads every record in the journal. A truncated
+// record at the end, left by a crash mid-write, is ignored.
+func (j *Journal) load() error {
+	r := bufio.NewReader(j.file)
+	for {
+		kind, seq, frames, err := readJournalRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if seq > j.seq {
+			j.seq = seq
+		}
+
+		switch kind {
+		case journalMessage:
+			if j.transform != nil {
+				if frames, err = j.transform.Unseal(frames); err != nil {
+					return err
+				}
+			}
+			j.pending[seq] = frames
+		case journalAck:
+			delete(j.pending, seq)
+		}
+	}
+}
+
+// compact rewrites the journal with only the
+// messages that are still pending.
+func (j *Journal) compact() error {
+	seqs := j.pendingSeqs()
+	sealed := make([][][]byte, len(seqs))
+	for i, seq := range seqs {
+		frames, err := j.seal(j.pending[seq])
+		if err != nil {
+			return err
+		}
+		sealed[i] = frames
+	}
+
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	j.w = bufio.NewWriter(j.file)
+	for i, seq := range seqs {
+		writeJournalRecord(j.w, journalMessage, seq, sealed[i])
+	}
+	return j.w.Flush()
+}
+
+// seal returns frames as they are written
+// to the file, see JournalTransform.
+func (j *Journal) seal(frames [][]byte) ([][]byte, error) {
+	if j.transform == nil {
+		return frames, nil
+	}
+	return j.transform.Seal(frames)
+}
+
+func (j *Journal) pendingSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(j.pending))
+	for seq := range j.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(a, b int) bool { return seqs[a] < seqs[b] })
+	return seqs
+}
+
+// Pending returns the number of messages in the
+// journal that have not been acknowledged.
+func (j *Journal) Pending() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return len(j.pending)
+}
+
+// Close closes the journal's file.
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.file.Close()
+}
+
+// append adds a message to the journal and
+// returns its sequence number.
+func (j *Journal) append(frames [][]byte) (uint64, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	sealed, err := j.seal(frames)
+	if err != nil {
+		return 0, err
+	}
+
+	j.seq++
+	writeJournalRecord(j.w, journalMessage, j.seq, sealed)
+	if err := j.w.Flush(); err != nil {
+		return 0, err
+	}
+
+	j.pending[j.seq] = frames
+	return j.seq, nil
+}
+
+// ack marks the message with sequence number seq as
+// delivered. The journal is emptied whenever no
+// message is left pending.
+func (j *Journal) ack(seq uint64) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if _, ok := j.pending[seq]; !ok {
+		return nil
+	}
+	delete(j.pending, seq)
+
+	if len(j.pending) == 0 {
+		return j.compact()
+	}
+
+	writeJournalRecord(j.w, journalAck, seq, nil)
+	return j.w.Flush()
+}
+
+// replay returns the pending messages, oldest first.
+func (j *Journal) replay() []*outgoing {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	msgs := make([]*outgoing, 0, len(j.pending))
+	for _, seq := range j.pendingSeqs() {
+		msgs = append(msgs, &outgoing{frames: j.pending[seq], seq: seq})
+	}
+	return msgs
+}
+
+// writeJournalRecord writes a record made of its kind, its
+// sequence number and, for messages, the number of frames
+// followed by each length prefixed frame. Errors are left
+// for the caller to pick up when flushing w.
+func writeJournalRecord(w *bufio.Writer, kind byte, seq uint64, frames [][]byte) {
+	var buf [8]byte
+
+	w.WriteByte(kind)
+	binary.BigEndian.PutUint64(buf[:], seq)
+	w.Write(buf[:])
+
+	if kind != journalMessage {
+		return
+	}
+
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(frames)))
+	w.Write(buf[:4])
+	for _, frame := range frames {
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(frame)))
+		w.Write(buf[:4])
+		w.Write(frame)
+	}
+}
+
+func readJournalRecord(r *bufio.Reader) (byte, uint64, [][]byte, error) {
+	var buf [8]byte
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	seq := binary.BigEndian.Uint64(buf[:])
+
+	switch kind {
+	case journalAck:
+		return kind, seq, nil, nil
+	case journalMessage:
+	default:
+		return 0, 0, nil, errors.New("gomq: corrupt journal record")
+	}
+
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return 0, 0, nil, err
+	}
+	frames := make([][]byte, binary.BigEndian.Uint32(buf[:4]))
+	for i := range frames {
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return 0, 0, nil, err
+		}
+		frames[i] = make([]byte, binary.BigEndian.Uint32(buf[:4]))
+		if _, err := io.ReadFull(r, frames[i]); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return kind, seq, frames, nil
+}
+
+// SetJournal attaches a journal to the socket. Messages
+// sent from then on are journaled, and the messages left
+// pending in the journal are queued again as soon as the
+// socket has peers to send them to.
+func (s *Socket) SetJournal(j *Journal) {
+	s.lock.Lock()
+	s.journal = j
+	s.lock.Unlock()
+
+	go func() {
+		for _, msg := range j.replay() {
+			for {
+				changed, err := s.enqueue(msg)
+				if err == nil {
+					break
+				}
+				if err != ErrNoPeers {
+					return
+				}
+
+				select {
+				case <-changed:
+				case <-s.done:
+					return
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,193 @@
+package gomq
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := j.append([][]byte{[]byte("HELLO")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.append([][]byte{[]byte("GOODBYE"), {}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.ack(first); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// simulate a crash in the middle of writing a record
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{journalMessage, 0, 0})
+	f.Close()
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	if want, got := 1, j.Pending(); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	msgs := j.replay()
+	if want, got := "GOODBYE", string(msgs[0].frames[0]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := 2, len(msgs[0].frames); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	seq, err := j.append([][]byte{[]byte("AGAIN")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq <= msgs[0].seq {
+		t.Errorf("sequence number %v reused after reopening", seq)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.append([][]byte{[]byte("HELLO")}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetJournal(j)
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19015"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := client.Connect("tcp://127.0.0.1:19015"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := client.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "WORLD", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	client.Close()
+	if want, got := 0, j.Pending(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+// reverseTransform reverses the bytes of every frame.
+type reverseTransform struct{}
+
+func (reverseTransform) Seal(msg [][]byte) ([][]byte, error) {
+	sealed := make([][]byte, len(msg))
+	for i, frame := range msg {
+		sealed[i] = make([]byte, len(frame))
+		for k, b := range frame {
+			sealed[i][len(frame)-1-k] = b
+		}
+	}
+	return sealed, nil
+}
+
+func (t reverseTransform) Unseal(msg [][]byte) ([][]byte, error) {
+	return t.Seal(msg)
+}
+
+func TestJournalTransform(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.journal")
+
+	j, err := OpenJournalWith(path, reverseTransform{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.append([][]byte{[]byte("HELLO")}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte("OLLEH")) || bytes.Contains(b, []byte("HELLO")) {
+		t.Errorf("message not sealed in %q", b)
+	}
+
+	j, err = OpenJournalWith(path, reverseTransform{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	if want, got := "HELLO", string(j.replay()[0].frames[0]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestJournalEmptyFrames(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	frames := [][]byte{nil, {}, []byte("body"), nil}
+	writeJournalRecord(w, journalMessage, 7, frames)
+	w.Flush()
+
+	_, seq, got, err := readJournalRecord(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(7), seq; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := len(frames), len(got); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range frames {
+		if want, got := frames[i], got[i]; !bytes.Equal(want, got) {
+			t.Errorf("frame %d: want %q, got %q", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package gomq
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// keepaliveCommand is the ZMTP command sent on connections
+// that have been idle for the keepalive interval. Sockets
+// receiving it ignore it.
+const keepaliveCommand = "KEEPALIVE"
+
+// Keepalive configures the traffic a socket sends on idle
+// connections so that NATs and load balancers with short
+// idle timeouts do not silently drop them. It is separate
+// from ZMTP heartbeats, which peers answer, see Heartbeat.
+type Keepalive struct {
+	// Interval is how long a connection may go without
+	// anything being written to it before a keepalive is
+	// sent. Zero disables keepalives.
+	Interval time.Duration
+
+	// Payload is the body of the keepalives sent.
+	Payload []byte
+
+	// IdleTimeout, if not zero, closes connections on which
+	// nothing was received for that long, so that they are
+	// reestablished. Peers should send keepalives more often.
+	IdleTimeout time.Duration
+}
+
+// SetKeepalive sets the keepalive policy of connections
+// added to the socket from then on.
+func (s *Socket) SetKeepalive(k Keepalive) {
+	s.lock.Lock()
+	s.keepalive = k
+	s.lock.Unlock()
+}
+
+// keepAlive applies k to conn until the connection or
+// the socket is closed.
+func (s *Socket) keepAlive(conn *Connection, k Keepalive) {
+	period := k.Interval
+	if period == 0 || (k.IdleTimeout > 0 && k.IdleTimeout < period) {
+		period = k.IdleTimeout
+	}
+	clock := conn.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	ticker := clock.NewTicker(period / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-s.done:
+			return
+		case now := <-ticker.C():
+			// no keepalive is needed while messages are queued,
+			// as they are either being written or stuck
+			sent := time.Unix(0, atomic.LoadInt64(&conn.lastSent))
+			queued, _ := conn.outbox.len()
+			if k.Interval > 0 && now.Sub(sent) >= k.Interval && queued == 0 {
+				conn.outbox.push(&outgoing{frames: [][]byte{k.Payload}, command: keepaliveCommand})
+			}
+
+			recv := time.Unix(0, atomic.LoadInt64(&conn.lastRecv))
+			if k.IdleTimeout > 0 && now.Sub(recv) >= k.IdleTimeout {
+				conn.net.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestKeepalive(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetKeepalive(Keepalive{Interval: 20 * time.Millisecond, Payload: []byte("ka")})
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19033"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetKeepalive(Keepalive{IdleTimeout: 100 * time.Millisecond})
+
+	states := make(chan EndpointStatus, 64)
+	client.SetEndpointStateHandler(func(st EndpointStatus) { states <- st })
+
+	if err := client.Connect("tcp://127.0.0.1:19033"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server's keepalives keep the idle connection open
+	time.Sleep(300 * time.Millisecond)
+	for len(states) > 0 {
+		if st := <-states; st.State == Degraded {
+			t.Fatalf("connection dropped: %v", st.LastError)
+		}
+	}
+}
+
+func TestKeepaliveIdleTimeout(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19034"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetKeepalive(Keepalive{IdleTimeout: 50 * time.Millisecond})
+
+	states := make(chan EndpointStatus, 64)
+	client.SetEndpointStateHandler(func(st EndpointStatus) { states <- st })
+
+	if err := client.Connect("tcp://127.0.0.1:19034"); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case st := <-states:
+			if st.State == Degraded {
+				return
+			}
+		case <-timeout:
+			t.Fatal("idle connection was not dropped")
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package gomq
+
+import (
+	"strings"
+)
+
+// Labels are key/value pairs attached to a socket's endpoint,
+// such as region=us-east or role=replica, see SetEndpointLabels.
+// They are reported with the endpoint's status and with the
+// peers connected through it, and can be matched by selectors.
+type Labels map[string]string
+
+// Match reports whether the labels satisfy selector, a comma
+// separated list of requirements that must all hold. Each one
+// is either "key=value", "key!=value", or a lone "key" that
+// must be present. An empty selector matches any labels.
+func (l Labels) Match(selector string) bool {
+	for _, req := range strings.Split(selector, ",") {
+		req = strings.TrimSpace(req)
+		if req == "" {
+			continue
+		}
+
+		if i := strings.Index(req, "!="); i >= 0 {
+			if value, ok := l[strings.TrimSpace(req[:i])]; ok && value == strings.TrimSpace(req[i+2:]) {
+				return false
+			}
+			continue
+		}
+
+		if i := strings.Index(req, "="); i >= 0 {
+			if value, ok := l[strings.TrimSpace(req[:i])]; !ok || value != strings.TrimSpace(req[i+1:]) {
+				return false
+			}
+			continue
+		}
+
+		if _, ok := l[req]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// SetEndpointLabels attaches labels to endpoint, to be set
+// before connecting or binding to it. The labels are reported
+// in the endpoint's EndpointStatus and in the PeerInfo of the
+// peers connected through it.
+func (s *Socket) SetEndpointLabels(endpoint string, labels Labels) {
+	copied := make(Labels, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	s.lock.Lock()
+	s.labels[endpoint] = copied
+	if status, ok := s.endpoints[endpoint]; ok {
+		status.Labels = copied
+	}
+	s.lock.Unlock()
+}
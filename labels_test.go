@@ -0,0 +1,111 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestLabelsMatch(t *testing.T) {
+	labels := Labels{"region": "us-east", "role": "replica"}
+
+	for _, test := range []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"role=replica", true},
+		{"role=replica, region=us-east", true},
+		{"role=primary", false},
+		{"region!=eu-west", true},
+		{"region!=us-east", false},
+		{"role", true},
+		{"zone", false},
+	} {
+		if got := labels.Match(test.selector); test.want != got {
+			t.Errorf("Match(%q): want %v, got %v", test.selector, test.want, got)
+		}
+	}
+}
+
+func TestEndpointLabels(t *testing.T) {
+	endpoint := "tcp://127.0.0.1:19026"
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetEndpointLabels(endpoint, Labels{"role": "frontend"})
+
+	go func() {
+		if _, err := server.Bind(endpoint); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetEndpointLabels(endpoint, Labels{"region": "us-east"})
+
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "us-east", client.Peers()[0].Labels["region"]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "us-east", client.Endpoints()[0].Labels["region"]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "frontend", server.Peers()[0].Labels["role"]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestSendToLabel(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	endpoints := []string{"tcp://127.0.0.1:19027", "tcp://127.0.0.1:19028"}
+	roles := []string{"primary", "replica"}
+	clients := make([]*ClientSocket, len(endpoints))
+	for i, endpoint := range endpoints {
+		server.SetEndpointLabels(endpoint, Labels{"role": roles[i]})
+		go func(endpoint string) {
+			if _, err := server.Bind(endpoint); err != nil {
+				t.Error(err)
+			}
+		}(endpoint)
+
+		clients[i] = NewClient(zmtp.NewSecurityNull())
+		defer clients[i].Close()
+		if err := clients[i].Connect(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.WaitForPeers(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SendToLabel("role=replica", []byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SendToLabel("role=standby", []byte("HELLO")); err == nil {
+		t.Error("want error sending to no matching peer")
+	}
+
+	msg, err := clients[1].Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, ok, _ := clients[0].TryRecv(); ok {
+		t.Error("message sent to peer not matching the selector")
+	}
+}
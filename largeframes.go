@@ -0,0 +1,49 @@
+package gomq
+
+import "github.com/zeromq/gomq/zmtp"
+
+// SetLargeFrames makes connections established from then on
+// read frames of more than threshold bytes as they arrive,
+// into buffers grown with the data received, calling progress, if not nil, with the bytes
+// of the frame read so far and its total size. See
+// zmtp.Connection.SetLargeFrames. Zero disables it.
+func (s *Socket) SetLargeFrames(threshold int64, progress func(read, total uint64)) {
+	s.lock.Lock()
+	s.largeFrameThreshold = threshold
+	s.onFrameProgress = progress
+	s.lock.Unlock()
+}
+
+// SetBufferPool makes connections established from then on read
+// messages into pooled buffers, which messages returned by
+// RecvMessage hand back for reuse when released, see
+// Message.Release, sparing the garbage collector at high
+// message rates. Messages received otherwise are left to the
+// garbage collector as usual. It is disabled by default.
+func (s *Socket) SetBufferPool(enabled bool) {
+	s.lock.Lock()
+	s.bufferPool = enabled
+	s.lock.Unlock()
+}
+
+// connectionConfigurer is implemented by sockets that
+// configure the ZMTP connections they establish.
+type connectionConfigurer interface {
+	configureConnection(*zmtp.Connection)
+}
+
+// configureConnection applies the options of s to a ZMTP
+// connection after its handshake, if s configures them.
+func configureConnection(s ZeroMQSocket, c *zmtp.Connection) {
+	c.SetMaxMessageSize(baseOf(s).MaxMessageSize())
+	if cc, ok := s.(connectionConfigurer); ok {
+		cc.configureConnection(c)
+	}
+}
+
+func (s *Socket) configureConnection(c *zmtp.Connection) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	c.SetLargeFrames(s.largeFrameThreshold, s.onFrameProgress)
+	c.SetBufferPool(s.bufferPool)
+}
@@ -0,0 +1,28 @@
+package gomq
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrLinger is returned by Close when the linger period
+// expired before every queued message was written out.
+var ErrLinger = errors.New("gomq: linger period expired")
+
+// SetLinger sets how long Close waits for the messages still
+// queued to be written out before dropping them to the dead
+// letter handler. Zero drops them right away, and a negative
+// linger waits as long as it takes. It defaults to a second.
+func (s *Socket) SetLinger(linger time.Duration) {
+	s.lock.Lock()
+	s.linger = linger
+	s.lock.Unlock()
+}
+
+// Linger returns how long Close waits for
+// queued messages to be written out.
+func (s *Socket) Linger() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.linger
+}
@@ -0,0 +1,94 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestCloseFlushes(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://linger-flush"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	if err := client.Connect("inproc://linger-flush"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := client.Send([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ErrClosed, client.Close(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	for i := 0; i < 10; i++ {
+		msg, err := server.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := byte(i), msg[0]; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+}
+
+func TestCloseLingerExpires(t *testing.T) {
+	ln, err := inprocTransport{}.Listen("linger-stuck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the peer completes the handshake, then never reads
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		zmtp.NewConnection(conn).Prepare(zmtp.NewSecurityNull(), zmtp.ServerSocketType, nil, true, nil)
+		time.Sleep(time.Second)
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	client.SetLinger(50 * time.Millisecond)
+	if want, got := 50*time.Millisecond, client.Linger(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	letters := make(chan DeadLetter, 16)
+	client.SetDeadLetterHandler(func(dl DeadLetter) { letters <- dl })
+
+	if err := client.Connect("inproc://linger-stuck"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := client.Send(make([]byte, inprocBufferSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	err = client.Close()
+	if !errors.Is(err, ErrLinger) {
+		t.Fatalf("want %v, got %v", ErrLinger, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("want Close to give up after the linger period, took %v", elapsed)
+	}
+	if len(letters) == 0 {
+		t.Fatal("want the dropped messages dead lettered")
+	}
+	if want, got := DropLinger, (<-letters).Reason; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
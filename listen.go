@@ -0,0 +1,125 @@
+package gomq
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// listen listens on address, which may use "*" as its host
+// to listen on all interfaces, "*" or 0 as its port to listen
+// on an ephemeral port, and a port range such as "[6000-6100]",
+// in which case the first free port of the range is used.
+func listen(network, address string) (net.Listener, error) {
+	i := strings.LastIndex(address, ":")
+	if i < 0 {
+		return net.Listen(network, address)
+	}
+	host, port := address[:i], address[i+1:]
+	if host == "*" {
+		host = ""
+	}
+	if port == "*" {
+		port = "0"
+	}
+	if !strings.HasPrefix(port, "[") {
+		return net.Listen(network, host+":"+port)
+	}
+
+	first, last, err := parsePortRange(port)
+	if err != nil {
+		return nil, err
+	}
+	for p := first; ; p++ {
+		ln, err := net.Listen(network, host+":"+strconv.Itoa(p))
+		if err == nil || p == last {
+			return ln, err
+		}
+	}
+}
+
+// parsePortRange parses a port range such as "[6000-6100]".
+func parsePortRange(s string) (first, last int, err error) {
+	bounds := strings.Split(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"), "-")
+	if len(bounds) == 2 && strings.HasSuffix(s, "]") {
+		first, err = strconv.Atoi(bounds[0])
+		if err == nil {
+			last, err = strconv.Atoi(bounds[1])
+		}
+		if err == nil && 0 < first && first <= last && last <= 65535 {
+			return first, last, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("gomq: invalid port range %q", s)
+}
+
+// LastEndpoint returns the endpoint the socket was last
+// bound to, with the address and port actually listened
+// on, such as the port picked from a range.
+func (s *Socket) LastEndpoint() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.lastEndpoint
+}
+
+// StopListening closes the listeners the socket was bound
+// to endpoint with, so that no more connections are accepted
+// on it, while connections already accepted are kept.
+func (s *Socket) StopListening(endpoint string) error {
+	stopped := s.removeListeners(endpoint)
+	if len(stopped) == 0 {
+		return fmt.Errorf("gomq: not listening on %q", endpoint)
+	}
+	for _, l := range stopped {
+		l.ln.Close()
+	}
+	return nil
+}
+
+// removeListeners forgets and returns the listeners the socket
+// was bound to endpoint with, or listening on endpoint, as
+// reported by LastEndpoint.
+func (s *Socket) removeListeners(endpoint string) []boundListener {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var removed []boundListener
+	listeners := s.listeners[:0]
+	for _, l := range s.listeners {
+		addr := l.ln.Addr()
+		if l.endpoint == endpoint || addr.Network()+"://"+addr.String() == endpoint {
+			removed = append(removed, l)
+		} else {
+			listeners = append(listeners, l)
+		}
+	}
+	s.listeners = listeners
+	return removed
+}
+
+// resumeListening binds s to endpoint again, after
+// StopListening, accepting connections in the background.
+func resumeListening(s Server, endpoint string) error {
+	_, err := BindServer(s, endpoint)
+	return err
+}
+
+// closeNotifier is implemented by sockets embedding *Socket,
+// which tell when they are closed.
+type closeNotifier interface {
+	closed() <-chan struct{}
+}
+
+// socketClosed returns a channel that is closed when s is
+// closed, or nil if s does not tell.
+func socketClosed(s ZeroMQSocket) <-chan struct{} {
+	if n, ok := s.(closeNotifier); ok {
+		return n.closed()
+	}
+	return nil
+}
+
+func (s *Socket) closed() <-chan struct{} {
+	return s.done
+}
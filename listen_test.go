@@ -0,0 +1,146 @@
+package gomq
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestParsePortRange(t *testing.T) {
+	first, last, err := parsePortRange("[6000-6100]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 6000, first; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 6100, last; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	for _, s := range []string{"[6000]", "[6100-6000]", "[0-10]", "[a-b]", "[6000-70000]", "[6000-6100"} {
+		if _, _, err := parsePortRange(s); err == nil {
+			t.Errorf("%q: want an error", s)
+		}
+	}
+}
+
+func TestBindPortRange(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:19038")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:[19038-19040]"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for server.LastEndpoint() == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if want, got := "tcp://127.0.0.1:19039", server.LastEndpoint(); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect(server.LastEndpoint()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBindEphemeralPort(t *testing.T) {
+	for _, endpoint := range []string{"tcp://*:0", "tcp://*:*", "tcp://127.0.0.1:*"} {
+		server := NewServer(zmtp.NewSecurityNull())
+		defer server.Close()
+
+		addr, err := server.Bind(endpoint)
+		if err != nil {
+			t.Fatalf("%s: %v", endpoint, err)
+		}
+		port := addr.(*net.TCPAddr).Port
+		if port == 0 {
+			t.Errorf("%s: want an ephemeral port, got %v", endpoint, addr)
+		}
+		if want, got := "tcp://"+addr.String(), server.LastEndpoint(); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+
+		client := NewClient(zmtp.NewSecurityNull())
+		defer client.Close()
+		if err := client.Connect(server.LastEndpoint()); err != nil {
+			t.Fatalf("%s: %v", endpoint, err)
+		}
+		if err := server.WaitForPeers(1, time.Second); err != nil {
+			t.Errorf("%s: %v", endpoint, err)
+		}
+	}
+}
+
+func TestStopResumeListening(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	if _, err := server.Bind("tcp://127.0.0.1:19041"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.StopListening("tcp://127.0.0.1:19041"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.Dial("tcp", "127.0.0.1:19041"); err == nil {
+		t.Error("want dialing a stopped endpoint to fail")
+	}
+	if err := server.StopListening("tcp://127.0.0.1:19041"); err == nil {
+		t.Error("want an error stopping an endpoint not listened on")
+	}
+
+	if err := server.ResumeListening("tcp://127.0.0.1:19041"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19041"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBindAcceptsMany(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	if _, err := server.Bind("tcp://127.0.0.1:19049"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		client := NewClient(zmtp.NewSecurityNull())
+		defer client.Close()
+		if err := client.Connect("tcp://127.0.0.1:19049"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.WaitForPeers(3, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	if _, err := net.Dial("tcp", "127.0.0.1:19049"); err == nil {
+		t.Error("want dialing a closed socket's endpoint to fail")
+	}
+}
@@ -0,0 +1,161 @@
+package gomq
+
+import "fmt"
+
+// LogLevel is the verbosity of a socket's logging,
+// each level logging what the previous ones do.
+type LogLevel int
+
+const (
+	// LogError logs failed handshakes and
+	// connections lost because of an error.
+	LogError LogLevel = iota
+
+	// LogInfo logs the other events of the socket's
+	// connections, see SocketEvent. It is the default.
+	LogInfo
+
+	// LogDebug logs the messages dropped, see
+	// DeadLetter, and the commands the socket does
+	// not handle, see SetCommandHandler.
+	LogDebug
+
+	// LogTrace logs the greetings, commands and frame
+	// headers exchanged with peers, in hex, see
+	// zmtp.Connection.SetTrace. It is meant for diagnosing
+	// interoperability problems, as it slows sockets down.
+	LogTrace
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogError:
+		return "error"
+	case LogInfo:
+		return "info"
+	case LogDebug:
+		return "debug"
+	case LogTrace:
+		return "trace"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Logger receives the records a socket logs: a message
+// along with alternating keys and values, such as "endpoint"
+// followed by an endpoint, so that structured loggers such
+// as those of log/slog can be plugged in.
+type Logger interface {
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc is a function used as a Logger.
+type LoggerFunc func(level LogLevel, msg string, keyvals ...interface{})
+
+// Log calls f.
+func (f LoggerFunc) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// SetLogger makes the socket log to l, which is called
+// without any of the socket's locks held. A nil Logger,
+// the default, logs nothing.
+func (s *Socket) SetLogger(l Logger) {
+	s.lock.Lock()
+	s.logger = l
+	s.lock.Unlock()
+	s.traceConnections()
+}
+
+// SetLogLevel sets the verbosity of the socket's logging.
+// Changing it from or to LogTrace starts or stops tracing
+// the socket's connections right away.
+func (s *Socket) SetLogLevel(level LogLevel) {
+	s.lock.Lock()
+	s.logLevel = level
+	s.lock.Unlock()
+	s.traceConnections()
+}
+
+// LogLevel returns the verbosity of the socket's logging.
+func (s *Socket) LogLevel() LogLevel {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.logLevel
+}
+
+// log logs msg at level, if the socket logs at that level.
+func (s *Socket) log(level LogLevel, msg string, keyvals ...interface{}) {
+	s.lock.RLock()
+	logger := s.logger
+	enabled := level <= s.logLevel
+	s.lock.RUnlock()
+
+	if logger != nil && enabled {
+		logger.Log(level, msg, keyvals...)
+	}
+}
+
+// traceConnections starts or stops tracing the socket's
+// connections after a change to its logging.
+func (s *Socket) traceConnections() {
+	s.lock.RLock()
+	conns := make([]*Connection, 0, len(s.ids))
+	for _, id := range s.ids {
+		conns = append(conns, s.conns[id])
+	}
+	s.lock.RUnlock()
+
+	for _, conn := range conns {
+		conn.zmtp.SetTrace(s.traceFunc(conn.endpoint))
+	}
+}
+
+// tracer is implemented by sockets embedding
+// *Socket, which can trace their connections.
+type tracer interface {
+	traceFunc(endpoint string) func(string)
+}
+
+// traceFunc returns the function tracing a connection of s
+// on endpoint, or nil if s does not log at LogTrace.
+func traceFunc(s ZeroMQSocket, endpoint string) func(string) {
+	if t, ok := s.(tracer); ok {
+		return t.traceFunc(endpoint)
+	}
+	return nil
+}
+
+func (s *Socket) traceFunc(endpoint string) func(string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.logger == nil || s.logLevel < LogTrace {
+		return nil
+	}
+	return func(line string) {
+		s.log(LogTrace, line, "endpoint", endpoint)
+	}
+}
+
+// logEvent logs ev, failed handshakes and connections
+// lost because of an error as errors.
+func (s *Socket) logEvent(ev SocketEvent) {
+	level := LogInfo
+	if ev.Type == EventHandshakeFailed || ev.Type == EventDisconnected && ev.Err != nil {
+		level = LogError
+	}
+	keyvals := []interface{}{"endpoint", ev.Endpoint}
+	if ev.Addr != "" {
+		keyvals = append(keyvals, "addr", ev.Addr)
+	}
+	if ev.PeerID != "" {
+		keyvals = append(keyvals, "peer", ev.PeerID)
+	}
+	if ev.Err != nil {
+		keyvals = append(keyvals, "err", ev.Err)
+	}
+	if ev.Delay != 0 {
+		keyvals = append(keyvals, "delay", ev.Delay)
+	}
+	s.log(level, ev.Type.String(), keyvals...)
+}
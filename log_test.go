@@ -0,0 +1,78 @@
+package gomq
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// logRecorder records the messages logged to it.
+type logRecorder struct {
+	lock sync.Mutex
+	msgs []string
+}
+
+func (r *logRecorder) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	r.lock.Lock()
+	r.msgs = append(r.msgs, level.String()+" "+msg)
+	r.lock.Unlock()
+}
+
+func (r *logRecorder) take() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	msgs := r.msgs
+	r.msgs = nil
+	return msgs
+}
+
+func TestLogger(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://logger"); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := &logRecorder{}
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetLogger(logs)
+	if want, got := LogInfo, client.LogLevel(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	client.SetLogLevel(LogTrace)
+	if err := client.Connect("inproc://logger"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := strings.Join(logs.take(), "\n")
+	for _, want := range []string{"info connected", "trace send greeting: ff", "trace recv command READY", "info handshake succeeded"} {
+		if !strings.Contains(msgs, want) {
+			t.Errorf("want %q in:\n%s", want, msgs)
+		}
+	}
+
+	client.SetLogLevel(LogInfo)
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := logs.take(); len(msgs) != 0 {
+		t.Errorf("want nothing logged, got %q", msgs)
+	}
+
+	server.Close()
+	for i := 0; ; i++ {
+		if msgs := strings.Join(logs.take(), "\n"); strings.Contains(msgs, "error disconnected") {
+			break
+		}
+		if i == 100 {
+			t.Fatal("want the lost connection logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,114 @@
+package gomq
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryLimit caps the number of bytes queued for sending
+// across every socket sharing it, so that an application
+// embedding gomq cannot run its host out of memory. Once
+// the limit is reached, sending on any of those sockets
+// blocks, drops or fails according to the socket's send
+// mode until enough queued messages are written out.
+type MemoryLimit struct {
+	lock  sync.Mutex
+	max   int64
+	used  int64
+	freed chan struct{}
+}
+
+// NewMemoryLimit returns a MemoryLimit of max bytes.
+func NewMemoryLimit(max int64) *MemoryLimit {
+	return &MemoryLimit{
+		max:   max,
+		freed: make(chan struct{}),
+	}
+}
+
+// Used returns the number of bytes currently
+// queued by the sockets sharing the limit.
+func (m *MemoryLimit) Used() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.used
+}
+
+// add charges n bytes to the limit, or releases them
+// if n is negative. It does nothing if m is nil.
+func (m *MemoryLimit) add(n int64) {
+	if m == nil || n == 0 {
+		return
+	}
+
+	m.lock.Lock()
+	m.used += n
+	if n < 0 {
+		close(m.freed)
+		m.freed = make(chan struct{})
+	}
+	m.lock.Unlock()
+}
+
+// admit returns true if more messages may be queued. If not,
+// it returns a channel that is closed the next time queued
+// bytes are released. A nil MemoryLimit admits everything.
+func (m *MemoryLimit) admit() (<-chan struct{}, bool) {
+	if m == nil {
+		return nil, true
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.freed, m.used < m.max
+}
+
+// SetMemoryLimit makes the socket share m with other sockets,
+// counting the messages it queues against it. A nil limit
+// removes the socket from its current limit.
+func (s *Socket) SetMemoryLimit(m *MemoryLimit) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.memoryLimit = m
+	for _, conn := range s.conns {
+		conn.outbox.setLimit(m)
+	}
+}
+
+// admit waits, if mode is SendBlock, until the socket's
+// memory limit has room for msg or ctx is done. Otherwise,
+// if the limit is reached, it drops msg and returns false,
+// along with the error to return for it, if any.
+func (s *Socket) admit(ctx context.Context, msg *outgoing, mode SendMode) (bool, error) {
+	s.lock.RLock()
+	limit := s.memoryLimit
+	s.lock.RUnlock()
+
+	for {
+		freed, ok := limit.admit()
+		if ok {
+			return true, nil
+		}
+
+		switch mode {
+		case SendBlock:
+			select {
+			case <-freed:
+			case <-ctx.Done():
+				s.settle(msg)
+				return false, &SendError{Outcome: Dropped, Err: ctx.Err()}
+			case <-s.done:
+				s.settle(msg)
+				return false, &SendError{Outcome: Dropped, Err: ErrClosed}
+			}
+		case SendDrop:
+			s.settle(msg)
+			s.deadLetter(DeadLetter{Reason: DropMemoryLimit, Message: msg.frames, Err: ErrMemoryLimit})
+			return false, nil
+		default:
+			s.settle(msg)
+			return false, &SendError{Outcome: Dropped, Err: ErrMemoryLimit}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	limit := NewMemoryLimit(5)
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetMemoryLimit(limit)
+
+	other := NewClient(zmtp.NewSecurityNull())
+	defer other.Close()
+	other.SetMemoryLimit(limit)
+
+	// nothing reads from the other end of the pipe,
+	// so the first message written blocks the writer
+	netConn, peer := net.Pipe()
+	defer peer.Close()
+	client.AddConnection(NewConnection(netConn, zmtp.NewConnection(netConn)))
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; limit.Used() != 0; i++ {
+		if i == 100 {
+			t.Fatal("message not handed to the writer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := int64(5), limit.Used(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if want, got := ErrWouldBlock, client.TrySend([]byte("HELLO")); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if err := other.Send([]byte("HELLO")); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("want %v, got %v", ErrMemoryLimit, err)
+	}
+
+	dropped := make(chan DeadLetter, 4)
+	client.SetDeadLetterHandler(func(dl DeadLetter) {
+		dropped <- dl
+	})
+	if err := client.SendWith([]byte("HELLO"), SendDrop); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := DropMemoryLimit, (<-dropped).Reason; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := client.PurgeQueue(client.Peers()[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := int64(0), limit.Used(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
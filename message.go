@@ -0,0 +1,105 @@
+package gomq
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// Message is a message received by a socket along with
+// what the socket knows of where it came from, see
+// RecvMessage.
+type Message struct {
+	Frames [][]byte
+
+	// Peer describes the connection the message was received
+	// on, with its routing ID, the metadata the peer sent in
+	// the ZMTP handshake and the user it authenticated as.
+	// Only its ID is set if the peer is already gone.
+	Peer PeerInfo
+
+	// Received is when the message was read
+	// from the connection.
+	Received time.Time
+
+	// Properties holds arbitrary properties of the message,
+	// for applications and middleware to annotate it.
+	Properties map[string]string
+
+	pooled bool
+}
+
+// Release hands the frames of the message back to the buffer
+// pool they were read into, if the socket uses one, see
+// SetBufferPool, and clears them. Neither the frames nor
+// slices of them may be used once the message is released.
+func (m *Message) Release() {
+	if m.pooled {
+		for _, frame := range m.Frames {
+			zmtp.ReleaseBuffer(frame)
+		}
+	}
+	m.Frames = nil
+}
+
+// Property returns the property name of the message, looked up
+// first in its Properties, then, as zmq_msg_gets does, among
+// "Socket-Type", "Identity", "Routing-Id", "User-Id" and
+// "Peer-Address", and the application metadata the peer sent,
+// with or without its "X-" prefix. Names are case insensitive,
+// and missing properties are empty.
+func (m *Message) Property(name string) string {
+	if v, ok := m.Properties[name]; ok {
+		return v
+	}
+
+	switch lower := strings.ToLower(name); lower {
+	case "socket-type":
+		return string(m.Peer.SocketType)
+	case "identity":
+		return string(m.Peer.SocketIdentity)
+	case "routing-id":
+		return string(m.Peer.RoutingID)
+	case "user-id":
+		return m.Peer.UserID
+	case "peer-address":
+		if m.Peer.RemoteAddr == nil {
+			return ""
+		}
+		return m.Peer.RemoteAddr.String()
+	default:
+		return m.Peer.Metadata[strings.TrimPrefix(lower, "x-")]
+	}
+}
+
+// RecvMessage is like RecvMultipart, but returns the
+// message along with where it came from.
+func (s *Socket) RecvMessage() (*Message, error) {
+	return s.RecvMessageContext(context.Background())
+}
+
+// RecvMessageContext is like RecvMessage, but returns
+// ctx.Err() if ctx is done before a message arrives.
+func (s *Socket) RecvMessageContext(ctx context.Context) (*Message, error) {
+	msg, _ := s.next(ctx, true)
+	if msg.Err != nil {
+		return nil, msg.Err
+	}
+
+	m := &Message{
+		Frames:     msg.Body,
+		Peer:       PeerInfo{ID: msg.Peer},
+		Received:   msg.Received,
+		Properties: make(map[string]string),
+		pooled:     msg.Pooled,
+	}
+	s.lock.RLock()
+	if conn := s.conns[msg.Peer]; conn != nil {
+		m.Peer = conn.Info()
+		m.Peer.SocketIdentity, _ = s.namespace.Strip(m.Peer.SocketIdentity)
+	}
+	s.lock.RUnlock()
+	return m, nil
+}
@@ -0,0 +1,95 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestRecvMessage(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityPlainServer())
+	defer pull.Close()
+	pull.SetAuthenticator(PlainAuthenticator{"admin": "secret"})
+	if _, err := pull.Bind("inproc://message"); err != nil {
+		t.Fatal(err)
+	}
+
+	push := NewPush(zmtp.NewSecurityPlainClient("admin", "secret"))
+	defer push.Close()
+	push.SetSocketIdentity(zmtp.SocketIdentity("pusher"))
+	push.SetMetadata("service", "greeter")
+	if err := push.Connect("inproc://message"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := push.SendMultipart([][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := pull.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(msg.Frames); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if msg.Received.Before(before) {
+		t.Errorf("want a time after %v, got %v", before, msg.Received)
+	}
+
+	msg.Properties["trace"] = "t1"
+	for name, want := range map[string]string{
+		"Socket-Type": "PUSH",
+		"Identity":    "pusher",
+		"routing-id":  "pusher",
+		"User-Id":     "admin",
+		"X-Service":   "greeter",
+		"service":     "greeter",
+		"trace":       "t1",
+		"missing":     "",
+	} {
+		if got := msg.Property(name); want != got {
+			t.Errorf("%s: want %q, got %q", name, want, got)
+		}
+	}
+	if msg.Property("Peer-Address") == "" {
+		t.Error("want a peer address")
+	}
+}
+
+func TestMessageRelease(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	pull.SetBufferPool(true)
+	if _, err := pull.Bind("inproc://message-release"); err != nil {
+		t.Fatal(err)
+	}
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	if err := push.Connect("inproc://message-release"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"first", "second", "third"} {
+		if err := push.SendMultipart([][]byte{[]byte(want), []byte(want)}); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := pull.RecvMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !msg.pooled {
+			t.Error("want pooled frames")
+		}
+		for _, frame := range msg.Frames {
+			if got := string(frame); want != got {
+				t.Errorf("want %v, got %v", want, got)
+			}
+		}
+		msg.Release()
+		if msg.Frames != nil {
+			t.Error("want no frames once released")
+		}
+	}
+}
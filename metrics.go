@@ -0,0 +1,276 @@
+package gomq
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// defaultStatsPeers is the number of peers above
+// which Stats aggregates per-peer counters.
+const defaultStatsPeers = 100
+
+// Stats is a snapshot of a socket's counters, see Socket.Stats.
+// Message and byte counts cover application messages only,
+// and include peers that are gone.
+type Stats struct {
+	MessagesSent      uint64
+	BytesSent         uint64
+	MessagesReceived  uint64
+	BytesReceived     uint64
+	Reconnects        uint64
+	HandshakeFailures uint64
+
+	// Peers is the number of connected peers, and
+	// QueuedMessages and QueuedBytes what is queued
+	// toward them or waiting for a first peer.
+	Peers          int
+	QueuedMessages int
+	QueuedBytes    int
+
+	// PeerStats holds the counters of each connected peer,
+	// or only those opted in with StatsConfig.Include once
+	// there are more than StatsConfig.MaxPeers peers.
+	PeerStats []PeerStats
+
+	// Others sums the counters of the connected peers
+	// left out of PeerStats, if any.
+	Others PeerStats
+}
+
+// PeerStats holds the counters of one of a
+// socket's peers, or of several, see Stats.Others.
+type PeerStats struct {
+	ID               string
+	Endpoint         string
+	SocketIdentity   zmtp.SocketIdentity
+	MessagesSent     uint64
+	BytesSent        uint64
+	MessagesReceived uint64
+	BytesReceived    uint64
+	QueuedMessages   int
+	QueuedBytes      int
+}
+
+// StatsConfig bounds the number of per-peer counters Stats
+// returns, so that sockets with thousands of peers do not
+// make metric labels explode.
+type StatsConfig struct {
+	// MaxPeers is the number of peers above which only
+	// the peers in Include are reported individually, and
+	// the others are summed up. It defaults to 100, and
+	// is unlimited if negative.
+	MaxPeers int
+
+	// Include lists the peers, by ID, endpoint or socket
+	// identity, that are always reported individually.
+	Include []string
+}
+
+// counters are message and byte counts, accessed atomically.
+type counters struct {
+	messagesSent      uint64
+	bytesSent         uint64
+	messagesReceived  uint64
+	bytesReceived     uint64
+	reconnects        uint64
+	handshakeFailures uint64
+}
+
+// sent records msg, a message written to a peer.
+func (c *counters) sent(msg [][]byte) {
+	atomic.AddUint64(&c.messagesSent, 1)
+	atomic.AddUint64(&c.bytesSent, uint64(messageSize(msg)))
+}
+
+// received records msg, a message read from a peer.
+func (c *counters) received(msg [][]byte) {
+	atomic.AddUint64(&c.messagesReceived, 1)
+	atomic.AddUint64(&c.bytesReceived, uint64(messageSize(msg)))
+}
+
+// peerStats returns the message and byte counts of c.
+func (c *counters) peerStats() PeerStats {
+	return PeerStats{
+		MessagesSent:     atomic.LoadUint64(&c.messagesSent),
+		BytesSent:        atomic.LoadUint64(&c.bytesSent),
+		MessagesReceived: atomic.LoadUint64(&c.messagesReceived),
+		BytesReceived:    atomic.LoadUint64(&c.bytesReceived),
+	}
+}
+
+// sent records msg, a message written to the
+// connection, on it and on its socket.
+func (c *Connection) sent(msg [][]byte) {
+	c.stats.sent(msg)
+	if c.socketStats != nil {
+		c.socketStats.sent(msg)
+	}
+}
+
+// received records msg, a message read from the
+// connection, on it and on its socket.
+func (c *Connection) received(msg [][]byte) {
+	c.stats.received(msg)
+	if c.socketStats != nil {
+		c.socketStats.received(msg)
+	}
+}
+
+// messageSize returns the number of bytes in msg's frames.
+func messageSize(msg [][]byte) int {
+	n := 0
+	for _, frame := range msg {
+		n += len(frame)
+	}
+	return n
+}
+
+// statsRecorder is implemented by sockets embedding
+// *Socket, which count their reconnections.
+type statsRecorder interface {
+	recordReconnect()
+}
+
+// recordReconnect counts a connection of s added again
+// after being lost, if s keeps statistics.
+func recordReconnect(s ZeroMQSocket) {
+	if r, ok := s.(statsRecorder); ok {
+		r.recordReconnect()
+	}
+}
+
+func (s *Socket) recordReconnect() {
+	atomic.AddUint64(&s.stats.reconnects, 1)
+}
+
+// SetStatsConfig sets how Stats reports per-peer counters.
+func (s *Socket) SetStatsConfig(config StatsConfig) {
+	s.lock.Lock()
+	s.statsConfig = config
+	s.lock.Unlock()
+}
+
+// Stats returns a snapshot of the socket's counters,
+// for monitoring. See PublishStats and WritePrometheus
+// to export them.
+func (s *Socket) Stats() Stats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	total := s.stats.peerStats()
+	stats := Stats{
+		MessagesSent:      total.MessagesSent,
+		BytesSent:         total.BytesSent,
+		MessagesReceived:  total.MessagesReceived,
+		BytesReceived:     total.BytesReceived,
+		Reconnects:        atomic.LoadUint64(&s.stats.reconnects),
+		HandshakeFailures: atomic.LoadUint64(&s.stats.handshakeFailures),
+		Peers:             len(s.ids),
+	}
+	s.pendingLock.Lock()
+	stats.QueuedMessages = len(s.pending)
+	for _, msg := range s.pending {
+		stats.QueuedBytes += messageSize(msg.frames)
+	}
+	s.pendingLock.Unlock()
+
+	maxPeers := s.statsConfig.MaxPeers
+	if maxPeers == 0 {
+		maxPeers = defaultStatsPeers
+	}
+	aggregate := maxPeers > 0 && len(s.ids) > maxPeers
+	for _, id := range s.ids {
+		conn := s.conns[id]
+		peer := conn.stats.peerStats()
+		peer.ID = conn.id
+		peer.Endpoint = conn.endpoint
+		peer.SocketIdentity, _ = s.namespace.Strip(conn.zmtp.PeerIdentity())
+		peer.QueuedMessages, peer.QueuedBytes = conn.outbox.len()
+		stats.QueuedMessages += peer.QueuedMessages
+		stats.QueuedBytes += peer.QueuedBytes
+
+		if !aggregate || s.statsConfig.included(peer) {
+			stats.PeerStats = append(stats.PeerStats, peer)
+			continue
+		}
+		stats.Others.MessagesSent += peer.MessagesSent
+		stats.Others.BytesSent += peer.BytesSent
+		stats.Others.MessagesReceived += peer.MessagesReceived
+		stats.Others.BytesReceived += peer.BytesReceived
+		stats.Others.QueuedMessages += peer.QueuedMessages
+		stats.Others.QueuedBytes += peer.QueuedBytes
+	}
+	return stats
+}
+
+// included reports whether peer was opted in to be
+// reported individually.
+func (c StatsConfig) included(peer PeerStats) bool {
+	for _, name := range c.Include {
+		if name == peer.ID || name == peer.Endpoint || name == string(peer.SocketIdentity) {
+			return true
+		}
+	}
+	return false
+}
+
+// PublishStats publishes the stats of s as the expvar
+// variable name. Like expvar.Publish, it panics if
+// name is already in use.
+func PublishStats(name string, s ZeroMQSocket) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return baseOf(s).Stats()
+	}))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes stats to w in the Prometheus text
+// exposition format, with metric names starting with prefix.
+// Peers are labelled by ID and endpoint, and those summed up
+// in stats.Others by the peer label "other".
+func WritePrometheus(w io.Writer, prefix string, stats Stats) error {
+	var buf bytes.Buffer
+	metric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", prefix, name, help, prefix, name, kind)
+		fmt.Fprintf(&buf, "%s_%s %v\n", prefix, name, value)
+	}
+	metric("messages_sent_total", "counter", "Messages sent.", stats.MessagesSent)
+	metric("bytes_sent_total", "counter", "Bytes sent.", stats.BytesSent)
+	metric("messages_received_total", "counter", "Messages received.", stats.MessagesReceived)
+	metric("bytes_received_total", "counter", "Bytes received.", stats.BytesReceived)
+	metric("reconnects_total", "counter", "Connections reestablished.", stats.Reconnects)
+	metric("handshake_failures_total", "counter", "Failed handshakes.", stats.HandshakeFailures)
+	metric("peers", "gauge", "Connected peers.", stats.Peers)
+	metric("queued_messages", "gauge", "Messages queued toward peers.", stats.QueuedMessages)
+	metric("queued_bytes", "gauge", "Bytes queued toward peers.", stats.QueuedBytes)
+
+	peers := stats.PeerStats
+	if stats.Peers > len(stats.PeerStats) {
+		peers = append(peers[:len(peers):len(peers)], stats.Others)
+	}
+	peerMetric := func(name, kind, help string, value func(PeerStats) interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s_peer_%s %s\n# TYPE %s_peer_%s %s\n", prefix, name, help, prefix, name, kind)
+		for i, peer := range peers {
+			labels := fmt.Sprintf(`peer="%s",endpoint="%s"`, labelEscaper.Replace(peer.ID), labelEscaper.Replace(peer.Endpoint))
+			if i == len(stats.PeerStats) {
+				labels = `peer="other"`
+			}
+			fmt.Fprintf(&buf, "%s_peer_%s{%s} %v\n", prefix, name, labels, value(peer))
+		}
+	}
+	peerMetric("messages_sent_total", "counter", "Messages sent to the peer.", func(p PeerStats) interface{} { return p.MessagesSent })
+	peerMetric("bytes_sent_total", "counter", "Bytes sent to the peer.", func(p PeerStats) interface{} { return p.BytesSent })
+	peerMetric("messages_received_total", "counter", "Messages received from the peer.", func(p PeerStats) interface{} { return p.MessagesReceived })
+	peerMetric("bytes_received_total", "counter", "Bytes received from the peer.", func(p PeerStats) interface{} { return p.BytesReceived })
+	peerMetric("queued_messages", "gauge", "Messages queued toward the peer.", func(p PeerStats) interface{} { return p.QueuedMessages })
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,120 @@
+package gomq
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestStats(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("inproc://stats"); err != nil {
+		t.Fatal(err)
+	}
+
+	pushes := make([]*PushSocket, 3)
+	for i, id := range []string{"a", "b", "c"} {
+		pushes[i] = NewPush(zmtp.NewSecurityNull())
+		defer pushes[i].Close()
+		pushes[i].SetSocketIdentity(zmtp.SocketIdentity(id))
+		if err := pushes[i].Connect("inproc://stats"); err != nil {
+			t.Fatal(err)
+		}
+		if err := pushes[i].Send([]byte("HELLO")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pull.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := pull.Stats()
+	if want, got := uint64(3), stats.MessagesReceived; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := uint64(15), stats.BytesReceived; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 3, len(stats.PeerStats); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := uint64(1), stats.PeerStats[0].MessagesReceived; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	for i := 0; pushes[0].Stats().MessagesSent != 1; i++ {
+		if i == 100 {
+			t.Fatal("want the message counted as sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pull.SetStatsConfig(StatsConfig{MaxPeers: 1, Include: []string{"b"}})
+	stats = pull.Stats()
+	if want, got := 3, stats.Peers; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 1, len(stats.PeerStats); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := "b", string(stats.PeerStats[0].SocketIdentity); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := uint64(2), stats.Others.MessagesReceived; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, "gomq", stats); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"gomq_messages_received_total 3\n",
+		"gomq_peers 3\n",
+		`gomq_peer_messages_received_total{peer="other"} 2` + "\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("want %q in:\n%s", line, buf.String())
+		}
+	}
+
+	if expvar.Get("gomq-stats-test") == nil {
+		PublishStats("gomq-stats-test", pull)
+	}
+	var published Stats
+	if err := json.Unmarshal([]byte(expvar.Get("gomq-stats-test").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(3), published.MessagesReceived; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestStatsHandshakeFailures(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityPlainServer())
+	defer server.Close()
+	server.SetAuthenticator(PlainAuthenticator{"admin": "secret"})
+	if _, err := server.Bind("tcp://127.0.0.1:19086"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityPlainClient("admin", "guess"))
+	defer client.Close()
+	if err := client.Connect("tcp://127.0.0.1:19086"); err == nil {
+		t.Fatal("want an error connecting with a wrong password")
+	}
+	if want, got := uint64(1), client.Stats().HandshakeFailures; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	for i := 0; server.Stats().HandshakeFailures != 1; i++ {
+		if i == 100 {
+			t.Fatalf("want 1 handshake failure, got %v", server.Stats().HandshakeFailures)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
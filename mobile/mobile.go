@@ -0,0 +1,204 @@
+// Package mobile is a subset of gomq that gomobile can bind,
+// so that Android and iOS apps can talk ZMTP, CURVE secured
+// or not, to their backends. Its API only uses types gomobile
+// supports: messages are Message values rather than [][]byte,
+// and messages are received through a Handler callback.
+package mobile
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+var (
+	errUnknownSocketType = errors.New("gomq/mobile: unknown socket type")
+	errNotSub            = errors.New("gomq/mobile: only SUB sockets subscribe")
+)
+
+// Keypair is a CURVE keypair, both keys Z85 encoded.
+type Keypair struct {
+	Public string
+	Secret string
+}
+
+// NewKeypair generates a CURVE keypair.
+func NewKeypair() (*Keypair, error) {
+	public, secret, err := zmtp.NewCurveKeypair()
+	if err != nil {
+		return nil, err
+	}
+	return &Keypair{Public: public, Secret: secret}, nil
+}
+
+// Security is the security mechanism of a socket.
+type Security struct {
+	mechanism zmtp.SecurityMechanism
+}
+
+// NewNullSecurity returns the NULL mechanism,
+// which neither authenticates nor encrypts.
+func NewNullSecurity() *Security {
+	return &Security{zmtp.NewSecurityNull()}
+}
+
+// NewPlainSecurity returns the PLAIN mechanism, authenticating
+// with username and password sent in the clear.
+func NewPlainSecurity(username, password string) *Security {
+	return &Security{zmtp.NewSecurityPlainClient(username, password)}
+}
+
+// NewCurveSecurity returns the CURVE mechanism for a client
+// with keypair, talking to the server of public key serverKey.
+func NewCurveSecurity(serverKey string, keypair *Keypair) (*Security, error) {
+	mechanism, err := zmtp.NewSecurityCurveClient(serverKey, keypair.Public, keypair.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Security{mechanism}, nil
+}
+
+// Message is a message of one or more frames.
+type Message struct {
+	frames [][]byte
+}
+
+// NewMessage returns an empty message.
+func NewMessage() *Message {
+	return &Message{}
+}
+
+// Add appends a frame to the message.
+func (m *Message) Add(frame []byte) {
+	m.frames = append(m.frames, frame)
+}
+
+// Len returns the number of frames of the message.
+func (m *Message) Len() int {
+	return len(m.frames)
+}
+
+// Frame returns the frame at index i,
+// or nil if there is none.
+func (m *Message) Frame(i int) []byte {
+	if i < 0 || i >= len(m.frames) {
+		return nil
+	}
+	return m.frames[i]
+}
+
+// Handler is implemented by the app to receive the
+// messages of a socket, see Socket.SetHandler.
+type Handler interface {
+	// OnMessage is called with each message received.
+	OnMessage(msg *Message)
+
+	// OnError is called once receiving stops, with
+	// gomq.ErrClosed if the socket was closed.
+	OnError(err error)
+}
+
+// Socket is a socket connecting to a backend. Its type is one
+// of CLIENT, DEALER, REQ, SUB, PUSH and PULL.
+type Socket struct {
+	socket  gomq.Client
+	lock    sync.Mutex
+	handler Handler
+}
+
+// NewSocket returns a socket of type socketType,
+// as in "DEALER", secured with security.
+func NewSocket(socketType string, security *Security) (*Socket, error) {
+	mechanism := security.mechanism
+	var s gomq.Client
+	switch strings.ToUpper(socketType) {
+	case "CLIENT":
+		s = gomq.NewClient(mechanism)
+	case "DEALER":
+		s = gomq.NewDealer(mechanism, "")
+	case "REQ":
+		s = gomq.NewReq(mechanism)
+	case "SUB":
+		s = gomq.NewSub(mechanism)
+	case "PUSH":
+		s = gomq.NewPush(mechanism)
+	case "PULL":
+		s = gomq.NewPull(mechanism)
+	default:
+		return nil, errUnknownSocketType
+	}
+	return &Socket{socket: s}, nil
+}
+
+// Connect connects the socket to endpoint, such
+// as "tcp://backend.example.com:5555".
+func (s *Socket) Connect(endpoint string) error {
+	return s.socket.Connect(endpoint)
+}
+
+// Subscribe subscribes a SUB socket to the
+// messages starting with prefix.
+func (s *Socket) Subscribe(prefix []byte) error {
+	sub, ok := s.socket.(*gomq.SubSocket)
+	if !ok {
+		return errNotSub
+	}
+	return sub.Subscribe(prefix)
+}
+
+// Unsubscribe cancels a subscription of a SUB socket.
+func (s *Socket) Unsubscribe(prefix []byte) error {
+	sub, ok := s.socket.(*gomq.SubSocket)
+	if !ok {
+		return errNotSub
+	}
+	return sub.Unsubscribe(prefix)
+}
+
+// Send sends a message of a single frame.
+func (s *Socket) Send(b []byte) error {
+	return s.socket.Send(b)
+}
+
+// SendMessage sends a message of one or more frames.
+func (s *Socket) SendMessage(msg *Message) error {
+	return s.socket.SendMultipart(msg.frames)
+}
+
+// SetHandler makes the socket pass the messages it receives
+// to h, from a goroutine of its own, until it is closed or
+// receiving fails. Only the first handler set is used.
+func (s *Socket) SetHandler(h Handler) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.handler != nil {
+		return
+	}
+	s.handler = h
+	go func() {
+		for {
+			frames, err := s.socket.RecvMultipart()
+			if err != nil {
+				if d, ok := s.socket.(interface{ Done() <-chan struct{} }); ok {
+					select {
+					case <-d.Done():
+						err = gomq.ErrClosed
+					default:
+					}
+				}
+				h.OnError(err)
+				return
+			}
+			h.OnMessage(&Message{frames: frames})
+		}
+	}()
+}
+
+// Close closes the socket, see gomq.Socket.Close.
+func (s *Socket) Close() error {
+	return s.socket.Close()
+}
@@ -0,0 +1,107 @@
+package mobile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// recorder is a Handler passing on what it receives.
+type recorder struct {
+	msgs chan *Message
+	errs chan error
+}
+
+func (r *recorder) OnMessage(msg *Message) { r.msgs <- msg }
+func (r *recorder) OnError(err error)      { r.errs <- err }
+
+func TestSocket(t *testing.T) {
+	serverKeys, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeys, err := NewKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mechanism, err := zmtp.NewSecurityCurveServer(serverKeys.Public, serverKeys.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := gomq.NewServer(mechanism)
+	defer server.Close()
+	if _, err := server.Bind("inproc://mobile"); err != nil {
+		t.Fatal(err)
+	}
+
+	security, err := NewCurveSecurity(serverKeys.Public, clientKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewSocket("client", security)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{msgs: make(chan *Message, 1), errs: make(chan error, 1)}
+	client.SetHandler(r)
+	if err := client.Connect("inproc://mobile"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := server.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-r.msgs:
+		if want, got := 1, msg.Len(); want != got {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+		if want, got := "WORLD", string(msg.Frame(0)); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+		if msg.Frame(1) != nil {
+			t.Error("want no second frame")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want a message")
+	}
+
+	client.Close()
+	select {
+	case err := <-r.errs:
+		if err != gomq.ErrClosed {
+			t.Errorf("want %v, got %v", gomq.ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the handler told about closing")
+	}
+}
+
+func TestNewSocket(t *testing.T) {
+	if _, err := NewSocket("ROUTER", NewNullSecurity()); err != errUnknownSocketType {
+		t.Errorf("want %v, got %v", errUnknownSocketType, err)
+	}
+
+	s, err := NewSocket("DEALER", NewNullSecurity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Subscribe(nil); err != errNotSub {
+		t.Errorf("want %v, got %v", errNotSub, err)
+	}
+}
@@ -0,0 +1,114 @@
+package gomq
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the kind of a SocketEvent.
+type EventType int
+
+const (
+	// EventConnected means a transport connection
+	// to the endpoint was established.
+	EventConnected EventType = iota
+
+	// EventAccepted means a transport connection was
+	// accepted on the endpoint. Addr is the peer's address.
+	EventAccepted
+
+	// EventHandshakeSucceeded means the ZMTP handshake
+	// completed and the peer, PeerID, was added.
+	EventHandshakeSucceeded
+
+	// EventHandshakeFailed means the ZMTP handshake
+	// failed. Err holds the reason.
+	EventHandshakeFailed
+
+	// EventDisconnected means the connection to the
+	// peer PeerID was lost. Err holds the reason.
+	EventDisconnected
+
+	// EventConnectRetried means connecting to the endpoint
+	// failed with Err, and will be retried after Delay.
+	EventConnectRetried
+
+	// EventForeign means a connection accepted on the
+	// endpoint did not start with a ZMTP greeting and was
+	// handed to the foreign handler, see SetForeignHandler.
+	// Addr is the client's address.
+	EventForeign
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventAccepted:
+		return "accepted"
+	case EventHandshakeSucceeded:
+		return "handshake succeeded"
+	case EventHandshakeFailed:
+		return "handshake failed"
+	case EventDisconnected:
+		return "disconnected"
+	case EventConnectRetried:
+		return "connect retried"
+	case EventForeign:
+		return "foreign"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// SocketEvent is a step in the lifecycle of
+// one of a socket's connections.
+type SocketEvent struct {
+	Type     EventType
+	Time     time.Time
+	Endpoint string
+	Addr     string
+	PeerID   string
+	Err      error
+	Delay    time.Duration
+}
+
+// monitored is implemented by sockets embedding
+// *Socket, which report their connections' events.
+type monitored interface {
+	emit(SocketEvent)
+}
+
+// emit reports ev to s's event handler, if s has one.
+func emit(s ZeroMQSocket, ev SocketEvent) {
+	if m, ok := s.(monitored); ok {
+		m.emit(ev)
+	}
+}
+
+func (s *Socket) emit(ev SocketEvent) {
+	if ev.Type == EventHandshakeFailed {
+		atomic.AddUint64(&s.stats.handshakeFailures, 1)
+	}
+	s.logEvent(ev)
+
+	s.lock.RLock()
+	onEvent := s.onEvent
+	s.lock.RUnlock()
+
+	if onEvent != nil {
+		ev.Time = time.Now()
+		onEvent(ev)
+	}
+}
+
+// SetEventHandler registers a function that is called,
+// without any of the socket's locks held, with each event
+// in the lifecycle of the socket's connections, much like
+// zmq_socket_monitor. Events of different connections may
+// be reported concurrently.
+func (s *Socket) SetEventHandler(fn func(SocketEvent)) {
+	s.lock.Lock()
+	s.onEvent = fn
+	s.lock.Unlock()
+}
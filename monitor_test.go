@@ -0,0 +1,117 @@
+package gomq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// eventLog collects the events a socket reports.
+type eventLog struct {
+	lock   sync.Mutex
+	events []SocketEvent
+}
+
+func (l *eventLog) add(ev SocketEvent) {
+	l.lock.Lock()
+	l.events = append(l.events, ev)
+	l.lock.Unlock()
+}
+
+func (l *eventLog) types() []EventType {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var types []EventType
+	for _, ev := range l.events {
+		types = append(types, ev.Type)
+	}
+	return types
+}
+
+// waitFor waits until the log holds want, or fails t.
+func (l *eventLog) waitFor(t *testing.T, want ...EventType) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := l.types()
+		if len(got) >= len(want) {
+			for i := range want {
+				if want[i] != got[i] {
+					t.Fatalf("want %v, got %v", want, got)
+				}
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetBackoff(Backoff{Initial: time.Millisecond, MaxAttempts: 2})
+
+	var clientEvents, serverEvents eventLog
+	client.SetEventHandler(clientEvents.add)
+
+	if err := client.Connect("tcp://127.0.0.1:19068"); err == nil {
+		t.Fatal("want error connecting to nothing")
+	}
+	clientEvents.waitFor(t, EventConnectRetried)
+	if ev := clientEvents.events[0]; ev.Endpoint != "tcp://127.0.0.1:19068" || ev.Err == nil || ev.Delay <= 0 {
+		t.Errorf("want the failed attempt and delay, got %+v", ev)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetEventHandler(serverEvents.add)
+	if _, err := server.Bind("tcp://127.0.0.1:19068"); err != nil {
+		t.Fatal(err)
+	}
+
+	clientEvents = eventLog{}
+	if err := client.Connect("tcp://127.0.0.1:19068"); err != nil {
+		t.Fatal(err)
+	}
+	clientEvents.waitFor(t, EventConnected, EventHandshakeSucceeded)
+	serverEvents.waitFor(t, EventAccepted, EventHandshakeSucceeded)
+
+	peers := client.Peers()
+	if len(peers) != 1 {
+		t.Fatalf("want 1 peer, got %v", len(peers))
+	}
+	if want, got := peers[0].ID, clientEvents.events[1].PeerID; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	server.Close()
+	clientEvents.waitFor(t, EventConnected, EventHandshakeSucceeded, EventDisconnected)
+	if ev := clientEvents.events[2]; ev.PeerID != peers[0].ID || ev.Err == nil {
+		t.Errorf("want the lost peer and reason, got %+v", ev)
+	}
+}
+
+func TestEventHandlerHandshakeFailed(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	var events eventLog
+	server.SetEventHandler(events.add)
+	if _, err := server.Bind("inproc://monitor-failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewPull(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.Connect("inproc://monitor-failed")
+
+	events.waitFor(t, EventAccepted, EventHandshakeFailed)
+	if events.events[1].Err == nil {
+		t.Error("want the reason the handshake failed")
+	}
+}
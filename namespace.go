@@ -0,0 +1,71 @@
+package gomq
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// namespaceProperty is the handshake metadata
+// property carrying the socket's tenant namespace.
+const namespaceProperty = "namespace"
+
+// Namespace isolates the tenants of a shared broker. A
+// socket with a namespace prefixes it to the identity it
+// sends to peers, strips it from the identities of its
+// peers, and only completes handshakes with peers in the
+// same namespace. The namespace is prefixed as is, so it
+// usually ends with a separator such as "tenant-a/".
+type Namespace string
+
+// Prefix returns b prefixed with the namespace. An
+// empty b is returned unchanged, so that sockets without
+// an identity keep relying on their peers assigning one.
+func (ns Namespace) Prefix(b []byte) []byte {
+	if ns == "" || len(b) == 0 {
+		return b
+	}
+	return append([]byte(ns), b...)
+}
+
+// Strip returns b without the namespace prefix. It
+// returns false if b does not start with the namespace.
+func (ns Namespace) Strip(b []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(b, []byte(ns)) {
+		return b, false
+	}
+	return b[len(ns):], true
+}
+
+// Namespace returns the socket's tenant namespace.
+func (s *Socket) Namespace() Namespace {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.namespace
+}
+
+// SetNamespace sets the socket's tenant namespace for
+// future connections. An empty namespace disables it.
+func (s *Socket) SetNamespace(ns Namespace) {
+	s.SetMetadata(namespaceProperty, string(ns))
+
+	s.lock.Lock()
+	s.namespace = ns
+	s.lock.Unlock()
+}
+
+// handshakeIdentity returns the identity s sends
+// to peers, prefixed with its namespace.
+func handshakeIdentity(s ZeroMQSocket) zmtp.SocketIdentity {
+	return zmtp.SocketIdentity(baseOf(s).Namespace().Prefix(s.SocketIdentity()))
+}
+
+// checkNamespace returns an error if the peer that sent
+// metadata in its handshake is not in the namespace of s.
+func checkNamespace(s ZeroMQSocket, metadata map[string]string) error {
+	if want, got := string(baseOf(s).Namespace()), metadata[namespaceProperty]; want != got {
+		return fmt.Errorf("gomq: peer namespace %q does not match %q", got, want)
+	}
+	return nil
+}
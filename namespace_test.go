@@ -0,0 +1,71 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestNamespace(t *testing.T) {
+	ns := Namespace("tenant-a/")
+
+	if want, got := "tenant-a/client", string(ns.Prefix([]byte("client"))); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := 0, len(ns.Prefix(nil)); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	b, ok := ns.Strip([]byte("tenant-a/client"))
+	if want, got := "client", string(b); !ok || want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if _, ok := ns.Strip([]byte("tenant-b/client")); ok {
+		t.Error("want prefix from another namespace not stripped")
+	}
+}
+
+func TestNamespaceIdentity(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetNamespace("tenant-a/")
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19018"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetNamespace("tenant-a/")
+	client.SetSocketIdentity(zmtp.SocketIdentity("client"))
+
+	if err := client.Connect("tcp://127.0.0.1:19018"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "client", string(server.Peers()[0].SocketIdentity); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestNamespaceMismatch(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetNamespace("tenant-a/")
+
+	go server.Bind("tcp://127.0.0.1:19019")
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetNamespace("tenant-b/")
+
+	if err := client.Connect("tcp://127.0.0.1:19019"); err == nil {
+		t.Error("want error connecting to another namespace")
+	}
+}
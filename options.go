@@ -0,0 +1,322 @@
+package gomq
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// Option identifies a socket option read with GetOption
+// and changed with SetOption.
+type Option int
+
+// Socket options, with the type of their values. Options are
+// applied to the socket's existing connections as well as to
+// future ones, except where noted.
+const (
+	// OptionIdentity is the zmtp.SocketIdentity sent to peers,
+	// see SetSocketIdentity. It applies to future connections.
+	OptionIdentity Option = iota + 1
+
+	// OptionSendHWM is the int send high-water mark, see SetSendHWM.
+	OptionSendHWM
+
+	// OptionRecvHWM is the int receive high-water mark, see
+	// SetRecvHWM. It applies to future connections.
+	OptionRecvHWM
+
+	// OptionLinger is the time.Duration Close waits for queued
+	// messages to be written out, see SetLinger.
+	OptionLinger
+
+	// OptionReconnectInterval is the time.Duration between
+	// attempts at connecting, see Backoff.Initial.
+	OptionReconnectInterval
+
+	// OptionReconnectIntervalMax is the time.Duration the delay
+	// between attempts at connecting grows up to, see Backoff.Max.
+	OptionReconnectIntervalMax
+
+	// OptionTCPKeepalive is the time.Duration between TCP
+	// keepalive probes on idle TCP connections. Zero leaves the
+	// system's default, and a negative duration disables them.
+	OptionTCPKeepalive
+
+	// OptionTCPNoDelay is the bool enabling TCP_NODELAY on TCP
+	// connections, so that small messages are not delayed to be
+	// coalesced. It defaults to true.
+	OptionTCPNoDelay
+
+	// OptionHandshakeTimeout is the time.Duration peers have to
+	// complete the ZMTP handshake, see SetHandshakeTimeout. It
+	// applies to future connections.
+	OptionHandshakeTimeout
+
+	// OptionMaxMessageSize is the int64 size of the largest
+	// message accepted from peers, see SetMaxMessageSize.
+	OptionMaxMessageSize
+
+	// OptionSendBuffer is the int size of the buffer frames are
+	// batched in before being written out, see SetSendBuffer.
+	OptionSendBuffer
+
+	// OptionBufferPool is the bool making messages be read into
+	// pooled buffers, see SetBufferPool. It applies to future
+	// connections.
+	OptionBufferPool
+
+	// OptionIPFamily is the IPFamily of the socket's TCP based
+	// endpoints, see SetIPFamily. It applies to future binds
+	// and connections.
+	OptionIPFamily
+)
+
+var optionNames = map[Option]string{
+	OptionIdentity:             "identity",
+	OptionSendHWM:              "send-hwm",
+	OptionRecvHWM:              "recv-hwm",
+	OptionLinger:               "linger",
+	OptionReconnectInterval:    "reconnect-interval",
+	OptionReconnectIntervalMax: "reconnect-interval-max",
+	OptionTCPKeepalive:         "tcp-keepalive",
+	OptionTCPNoDelay:           "tcp-nodelay",
+	OptionHandshakeTimeout:     "handshake-timeout",
+	OptionMaxMessageSize:       "max-message-size",
+	OptionSendBuffer:           "send-buffer",
+	OptionBufferPool:           "buffer-pool",
+	OptionIPFamily:             "ip-family",
+}
+
+func (o Option) String() string {
+	if name, ok := optionNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Option(%d)", int(o))
+}
+
+// option reads and changes a socket option. The values
+// set are of the same type as those get returns.
+type option struct {
+	get func(s *Socket) interface{}
+	set func(s *Socket, value interface{}) error
+}
+
+var options = map[Option]option{
+	OptionIdentity: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.sockID
+		},
+		set: func(s *Socket, value interface{}) error {
+			s.SetSocketIdentity(value.(zmtp.SocketIdentity))
+			return nil
+		},
+	},
+	OptionSendHWM: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.sendHWM
+		},
+		set: func(s *Socket, value interface{}) error {
+			if value.(int) < 0 {
+				return fmt.Errorf("gomq: negative high-water mark %v", value)
+			}
+			s.SetSendHWM(value.(int))
+			return nil
+		},
+	},
+	OptionRecvHWM: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.recvHWM
+		},
+		set: func(s *Socket, value interface{}) error {
+			if value.(int) < 0 {
+				return fmt.Errorf("gomq: negative high-water mark %v", value)
+			}
+			s.SetRecvHWM(value.(int))
+			return nil
+		},
+	},
+	OptionLinger: {
+		get: func(s *Socket) interface{} { return s.Linger() },
+		set: func(s *Socket, value interface{}) error {
+			s.SetLinger(value.(time.Duration))
+			return nil
+		},
+	},
+	OptionReconnectInterval: {
+		get: func(s *Socket) interface{} { return s.RetryInterval() },
+		set: func(s *Socket, value interface{}) error {
+			d := value.(time.Duration)
+			if d <= 0 {
+				return fmt.Errorf("gomq: duration %v is not positive", d)
+			}
+			s.lock.Lock()
+			s.retryInterval = d
+			s.lock.Unlock()
+			return nil
+		},
+	},
+	OptionReconnectIntervalMax: {
+		get: func(s *Socket) interface{} { return s.Backoff().Max },
+		set: func(s *Socket, value interface{}) error {
+			d := value.(time.Duration)
+			if d < 0 {
+				return fmt.Errorf("gomq: negative duration %v", d)
+			}
+			s.lock.Lock()
+			s.backoff.Max = d
+			s.lock.Unlock()
+			return nil
+		},
+	},
+	OptionTCPKeepalive: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.tcpKeepalive
+		},
+		set: func(s *Socket, value interface{}) error {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.tcpKeepalive = value.(time.Duration)
+			for _, conn := range s.conns {
+				setTCPOptions(conn.net, s.tcpKeepalive, s.tcpNoDelay)
+			}
+			return nil
+		},
+	},
+	OptionTCPNoDelay: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.tcpNoDelay
+		},
+		set: func(s *Socket, value interface{}) error {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.tcpNoDelay = value.(bool)
+			for _, conn := range s.conns {
+				setTCPOptions(conn.net, s.tcpKeepalive, s.tcpNoDelay)
+			}
+			return nil
+		},
+	},
+	OptionHandshakeTimeout: {
+		get: func(s *Socket) interface{} { return s.HandshakeTimeout() },
+		set: func(s *Socket, value interface{}) error {
+			d := value.(time.Duration)
+			if d < 0 {
+				return fmt.Errorf("gomq: negative duration %v", d)
+			}
+			s.SetHandshakeTimeout(d)
+			return nil
+		},
+	},
+	OptionMaxMessageSize: {
+		get: func(s *Socket) interface{} { return s.MaxMessageSize() },
+		set: func(s *Socket, value interface{}) error {
+			if value.(int64) < 0 {
+				return fmt.Errorf("gomq: negative size %v", value)
+			}
+			s.SetMaxMessageSize(value.(int64))
+			return nil
+		},
+	},
+	OptionSendBuffer: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.sendBuffer
+		},
+		set: func(s *Socket, value interface{}) error {
+			if value.(int) < 0 {
+				return fmt.Errorf("gomq: negative size %v", value)
+			}
+			s.SetSendBuffer(value.(int))
+			return nil
+		},
+	},
+	OptionBufferPool: {
+		get: func(s *Socket) interface{} {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.bufferPool
+		},
+		set: func(s *Socket, value interface{}) error {
+			s.SetBufferPool(value.(bool))
+			return nil
+		},
+	},
+	OptionIPFamily: {
+		get: func(s *Socket) interface{} { return s.IPFamily() },
+		set: func(s *Socket, value interface{}) error {
+			f := value.(IPFamily)
+			if f < IPAny || f > IPv6Only {
+				return fmt.Errorf("gomq: unknown IP family %v", f)
+			}
+			s.SetIPFamily(f)
+			return nil
+		},
+	},
+}
+
+// GetOption returns the value of opt, of the type
+// documented with the option, such as an int for
+// OptionSendHWM.
+func (s *Socket) GetOption(opt Option) (interface{}, error) {
+	o, ok := options[opt]
+	if !ok {
+		return nil, fmt.Errorf("gomq: unknown option %v", opt)
+	}
+	return o.get(s), nil
+}
+
+// SetOption changes opt to value, which must be of the
+// type documented with the option, such as a time.Duration
+// for OptionLinger.
+func (s *Socket) SetOption(opt Option, value interface{}) error {
+	o, ok := options[opt]
+	if !ok {
+		return fmt.Errorf("gomq: unknown option %v", opt)
+	}
+	if want := reflect.TypeOf(o.get(s)); reflect.TypeOf(value) != want {
+		return fmt.Errorf("gomq: option %v takes a %v, not %T", opt, want, value)
+	}
+	return o.set(s, value)
+}
+
+// netConner is implemented by connections wrapping
+// another, such as TLS ones.
+type netConner interface {
+	NetConn() net.Conn
+}
+
+// setTCPOptions applies the TCP keepalive period and
+// TCP_NODELAY setting to conn, if it runs over TCP.
+func setTCPOptions(conn net.Conn, keepalive time.Duration, noDelay bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			if keepalive != 0 {
+				c.SetKeepAlive(keepalive > 0)
+			}
+			if keepalive > 0 {
+				c.SetKeepAlivePeriod(keepalive)
+			}
+			c.SetNoDelay(noDelay)
+			return
+		case netConner:
+			conn = c.NetConn()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package gomq
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestOptions(t *testing.T) {
+	s := NewClient(zmtp.NewSecurityNull())
+	defer s.Close()
+
+	for _, tc := range []struct {
+		opt   Option
+		value interface{}
+	}{
+		{OptionIdentity, zmtp.SocketIdentity("alice")},
+		{OptionSendHWM, 10},
+		{OptionRecvHWM, 20},
+		{OptionLinger, time.Duration(0)},
+		{OptionReconnectInterval, 50 * time.Millisecond},
+		{OptionReconnectIntervalMax, time.Second},
+		{OptionTCPKeepalive, -time.Second},
+		{OptionTCPNoDelay, false},
+		{OptionHandshakeTimeout, 2 * time.Second},
+		{OptionMaxMessageSize, int64(1024)},
+		{OptionSendBuffer, 4096},
+		{OptionBufferPool, true},
+		{OptionIPFamily, IPv6Only},
+	} {
+		if err := s.SetOption(tc.opt, tc.value); err != nil {
+			t.Errorf("%v: %v", tc.opt, err)
+			continue
+		}
+		got, err := s.GetOption(tc.opt)
+		if err != nil {
+			t.Errorf("%v: %v", tc.opt, err)
+		}
+		if want := tc.value; !optionEqual(want, got) {
+			t.Errorf("%v: want %v, got %v", tc.opt, want, got)
+		}
+	}
+	if want, got := time.Second, s.Backoff().Max; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	for _, tc := range []struct {
+		opt   Option
+		value interface{}
+	}{
+		{OptionSendHWM, int64(10)},
+		{OptionIdentity, []byte("bob")},
+		{OptionLinger, 1},
+		{OptionReconnectInterval, time.Duration(0)},
+		{OptionMaxMessageSize, int64(-1)},
+		{OptionIPFamily, IPFamily(3)},
+		{Option(0), 1},
+	} {
+		if err := s.SetOption(tc.opt, tc.value); err == nil {
+			t.Errorf("%v=%v: want an error", tc.opt, tc.value)
+		}
+	}
+	if _, err := s.GetOption(Option(0)); err == nil {
+		t.Error("want an error for an unknown option")
+	}
+}
+
+func optionEqual(a, b interface{}) bool {
+	if id, ok := a.(zmtp.SocketIdentity); ok {
+		return bytes.Equal(id, b.(zmtp.SocketIdentity))
+	}
+	return a == b
+}
+
+func TestOptionsLiveConnections(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19076"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19076"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetOption(OptionTCPNoDelay, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetOption(OptionTCPKeepalive, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SetOption(OptionMaxMessageSize, int64(16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(bytes.Repeat([]byte("HELLO"), 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Recv(); err == nil {
+		t.Error("want an error for a message over the limit")
+	}
+}
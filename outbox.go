@@ -0,0 +1,234 @@
+package gomq
+
+import (
+	"sync"
+	"time"
+)
+
+// outbox is the queue of messages waiting to be
+// written to a single peer. Messages are pushed by
+// Send and popped by the connection's writer goroutine.
+// Priority messages are kept in a separate lane that
+// is always popped first.
+type outbox struct {
+	lock    sync.Mutex
+	msgs    []*outgoing
+	urgent  []*outgoing
+	size    int
+	closed  bool
+	wake    chan struct{}
+	drained chan struct{}
+	limit   *MemoryLimit
+	paused  bool
+	hwm     int
+	room    *roomSignal
+	prof    *profiler
+}
+
+// outgoing is a message queued in an outbox. seq is
+// the message's sequence number in the socket's journal,
+// or zero if the message is not journaled. If command is
+// set, the message is sent as that ZMTP command, with its
+// first frame as the command's body.
+type outgoing struct {
+	frames   [][]byte
+	seq      uint64
+	command  string
+	priority bool
+
+	// queued is when the message was queued,
+	// if it is sampled, see SetProfiling.
+	queued time.Time
+}
+
+func newOutbox() *outbox {
+	return &outbox{
+		wake:    make(chan struct{}, 1),
+		drained: make(chan struct{}),
+	}
+}
+
+// push queues a message. It returns false if
+// the outbox no longer accepts messages.
+func (o *outbox) push(msg *outgoing) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.closed {
+		return false
+	}
+	o.add(msg)
+	return true
+}
+
+func (o *outbox) add(msg *outgoing) {
+	if msg.command == "" && msg.queued.IsZero() && o.prof.sample() {
+		msg.queued = time.Now()
+	}
+	if msg.priority {
+		o.urgent = append(o.urgent, msg)
+	} else {
+		o.msgs = append(o.msgs, msg)
+	}
+	o.grow(msgSize(msg.frames))
+	o.signal()
+}
+
+// pop blocks until a message is available and the outbox
+// is not paused, and removes the message from the outbox.
+// It returns false once the outbox is closed and empty.
+// Closing the outbox resumes it.
+func (o *outbox) pop() (*outgoing, bool) {
+	for {
+		o.lock.Lock()
+		lane := &o.msgs
+		if len(o.urgent) > 0 {
+			lane = &o.urgent
+		}
+		if len(*lane) > 0 && (!o.paused || o.closed) {
+			msg := (*lane)[0]
+			(*lane)[0] = nil
+			*lane = (*lane)[1:]
+			o.grow(-msgSize(msg.frames))
+			room := o.room
+			roomMade := o.hwm > 0 && lane == &o.msgs && len(o.msgs) == o.hwm-1
+			o.lock.Unlock()
+			if roomMade {
+				room.notify()
+			}
+			return msg, true
+		}
+		closed := o.closed
+		o.lock.Unlock()
+
+		if closed {
+			return nil, false
+		}
+		<-o.wake
+	}
+}
+
+// close stops the outbox from accepting new messages.
+// Messages already queued are still handed out by pop.
+func (o *outbox) close() {
+	o.lock.Lock()
+	o.closed = true
+	o.signal()
+	o.lock.Unlock()
+}
+
+// pause stops pop from handing out messages, or resumes
+// it, while the outbox keeps accepting new messages.
+func (o *outbox) pause(paused bool) {
+	o.lock.Lock()
+	o.paused = paused
+	o.signal()
+	o.lock.Unlock()
+}
+
+// take closes the outbox and removes every
+// queued message from it.
+func (o *outbox) take() []*outgoing {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	msgs := append(o.urgent, o.msgs...)
+	o.msgs, o.urgent = nil, nil
+	o.grow(-o.size)
+	o.closed = true
+	o.signal()
+	return msgs
+}
+
+// purge removes every queued message from the outbox,
+// which keeps accepting new messages, and returns them.
+func (o *outbox) purge() []*outgoing {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	msgs := append(o.urgent, o.msgs...)
+	full := o.hwm > 0 && len(o.msgs) >= o.hwm
+	o.msgs, o.urgent = nil, nil
+	o.grow(-o.size)
+	if full {
+		o.room.notify()
+	}
+	return msgs
+}
+
+// idle reports whether pop would have to wait
+// for a message to be queued or resumed.
+func (o *outbox) idle() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	queued := len(o.urgent)+len(o.msgs) > 0
+	return !o.closed && (!queued || o.paused)
+}
+
+// len returns the number of queued messages
+// and their total size in bytes.
+func (o *outbox) len() (int, int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.urgent) + len(o.msgs), o.size
+}
+
+// grow adds n bytes to the size of the outbox and to
+// its memory limit, if any. The caller must hold the lock.
+func (o *outbox) grow(n int) {
+	o.size += n
+	o.limit.add(int64(n))
+}
+
+// setLimit moves the bytes queued in the outbox
+// from its current memory limit, if any, to m.
+func (o *outbox) setLimit(m *MemoryLimit) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.limit.add(int64(-o.size))
+	o.limit = m
+	o.limit.add(int64(o.size))
+}
+
+// signal wakes up pop. The caller must hold the lock.
+func (o *outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func msgSize(msg [][]byte) int {
+	size := 0
+	for _, frame := range msg {
+		size += len(frame)
+	}
+	return size
+}
+
+// setProfiler sets the profiler sampling
+// the messages queued from then on.
+func (o *outbox) setProfiler(p *profiler) {
+	o.lock.Lock()
+	o.prof = p
+	o.lock.Unlock()
+}
+
+// recordWrite records the time a sampled message, queued
+// at queued, spent in the outbox until written started
+// and being written since.
+func (o *outbox) recordWrite(queued, written time.Time) {
+	o.lock.Lock()
+	p := o.prof
+	o.lock.Unlock()
+
+	if p == nil {
+		return
+	}
+	done := time.Now()
+	p.record(func(profile *Profile) {
+		profile.Queue.add(written.Sub(queued))
+		profile.Write.add(done.Sub(written))
+	})
+}
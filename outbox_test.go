@@ -0,0 +1,91 @@
+package gomq
+
+import (
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestOutbox(t *testing.T) {
+	o := newOutbox()
+
+	o.push(&outgoing{frames: [][]byte{[]byte("HELLO")}})
+	o.push(&outgoing{frames: [][]byte{[]byte("HELLO"), []byte("WORLD")}})
+
+	n, size := o.len()
+	if want, got := 2, n; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 15, size; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	msg, ok := o.pop()
+	if !ok || len(msg.frames) != 1 {
+		t.Fatalf("want single frame message, got %q", msg.frames)
+	}
+
+	if purged := o.purge(); len(purged) != 1 || msgSize(purged[0].frames) != 10 {
+		t.Errorf("want 1 message of 10 bytes purged, got %v", len(purged))
+	}
+	if n, size := o.len(); n != 0 || size != 0 {
+		t.Errorf("want empty outbox, got %v messages of %v bytes", n, size)
+	}
+
+	o.close()
+	if o.push(&outgoing{frames: [][]byte{[]byte("HELLO")}}) {
+		t.Errorf("closed outbox accepted a message")
+	}
+	if _, ok := o.pop(); ok {
+		t.Errorf("closed and empty outbox returned a message")
+	}
+}
+
+func TestOutboxPriority(t *testing.T) {
+	o := newOutbox()
+
+	o.push(&outgoing{frames: [][]byte{[]byte("BULK1")}})
+	o.push(&outgoing{frames: [][]byte{[]byte("BULK2")}})
+	o.push(&outgoing{frames: [][]byte{[]byte("PING")}, priority: true})
+
+	if n, _ := o.len(); n != 3 {
+		t.Errorf("want 3 queued messages, got %v", n)
+	}
+
+	for _, want := range []string{"PING", "BULK1", "BULK2"} {
+		msg, ok := o.pop()
+		if !ok {
+			t.Fatal("outbox empty")
+		}
+		if got := string(msg.frames[0]); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestPurgeQueue(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if _, err := client.PurgeQueue("nope"); err != ErrUnknownPeer {
+		t.Fatalf("want %v, got %v", ErrUnknownPeer, err)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19008"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := client.Connect("tcp://127.0.0.1:19008"); err != nil {
+		t.Fatal(err)
+	}
+
+	id := client.Peers()[0].ID
+	if _, err := client.PurgeQueue(id); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package gomq
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// AdmissionPolicy sheds the requests an RPCServer receives
+// while it is overloaded, rather than letting them queue up
+// for longer than their callers wait.
+type AdmissionPolicy struct {
+	// MaxQueue is the number of requests that may wait for
+	// a worker. Requests arriving once it is reached are shed.
+	// If zero, requests wait for a worker without being queued,
+	// holding up the ones behind them.
+	MaxQueue int
+
+	// MaxLatency is the handler latency, averaged over recent
+	// requests, beyond which the requests that cannot be handled
+	// right away are shed. Zero means no limit.
+	MaxLatency time.Duration
+
+	// Drop makes shed requests go unanswered, to the socket's
+	// dead letter handler. Otherwise they are answered with a
+	// reply whose error is ErrOverloaded's text.
+	Drop bool
+}
+
+// latencyWeight is the weight of the latest request in
+// the moving average of an RPCServer's handler latency.
+const latencyWeight = 8
+
+// RPCStats counts the requests an RPCServer received.
+type RPCStats struct {
+	// Served is the number of requests answered,
+	// replays and errors included.
+	Served uint64
+
+	// Expired is the number of requests dropped
+	// because their deadline passed.
+	Expired uint64
+
+	// Shed is the number of requests shed by
+	// the server's admission policy.
+	Shed uint64
+
+	// Latency is the handler latency,
+	// averaged over recent requests.
+	Latency time.Duration
+}
+
+// Stats returns the server's counters.
+func (srv *RPCServer) Stats() RPCStats {
+	return RPCStats{
+		Served:  atomic.LoadUint64(&srv.served),
+		Expired: atomic.LoadUint64(&srv.expired),
+		Shed:    atomic.LoadUint64(&srv.shed),
+		Latency: time.Duration(atomic.LoadInt64(&srv.latency)),
+	}
+}
+
+// observeLatency adds d to the moving average
+// of the handler's latency.
+func (srv *RPCServer) observeLatency(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&srv.latency)
+		avg := int64(d)
+		if old != 0 {
+			avg = old + (int64(d)-old)/latencyWeight
+		}
+		if atomic.CompareAndSwapInt64(&srv.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// enqueue queues call, received on r, for the workers, unless
+// the server's admission policy sheds it. Without a queue, it
+// waits for a worker, until ctx is done.
+func (srv *RPCServer) enqueue(ctx context.Context, r *RepSocket, call rpcCall, queue chan<- rpcCall, workers int) error {
+	if srv.overloaded(len(queue), workers) {
+		srv.shedCall(r, call)
+		return nil
+	}
+
+	if p := srv.Admission; p != nil && p.MaxQueue > 0 {
+		select {
+		case queue <- call:
+		default:
+			srv.shedCall(r, call)
+		}
+		return nil
+	}
+
+	select {
+	case queue <- call:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// overloaded reports whether the handler's latency is beyond
+// the admission policy's limit while a request cannot be handled
+// right away, with queued requests waiting for the workers.
+func (srv *RPCServer) overloaded(queued, workers int) bool {
+	p := srv.Admission
+	return p != nil && p.MaxLatency > 0 &&
+		time.Duration(atomic.LoadInt64(&srv.latency)) > p.MaxLatency &&
+		(queued > 0 || int(atomic.LoadInt32(&srv.busy)) >= workers)
+}
+
+// shedCall answers or drops call, received on r,
+// according to the server's admission policy.
+func (srv *RPCServer) shedCall(r *RepSocket, call rpcCall) {
+	atomic.AddUint64(&srv.shed, 1)
+	if srv.Admission.Drop {
+		r.deadLetter(DeadLetter{Reason: DropOverloaded, PeerID: call.peer, Message: call.msg})
+		return
+	}
+
+	h, _, _ := ParseRPC(call.msg)
+	reply := RPCHeader{
+		CorrelationID:  h.CorrelationID,
+		IdempotencyKey: h.IdempotencyKey,
+		Error:          ErrOverloaded.Error(),
+	}.Wrap(nil)
+	r.sendTo(call.peer, append(call.envelope, reply...))
+}
@@ -0,0 +1,124 @@
+package gomq
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestAdmissionPolicy(t *testing.T) {
+	endpoint := "inproc://test-admission"
+
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	if _, err := rep.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}, 4), make(chan struct{})
+	srv := &RPCServer{
+		Handler: func(ctx context.Context, h RPCHeader, request [][]byte) ([][]byte, error) {
+			started <- struct{}{}
+			<-release
+			return request, nil
+		},
+		Admission: &AdmissionPolicy{MaxQueue: 1},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, rep)
+
+	dealer := NewDealer(zmtp.NewSecurityNull(), "")
+	defer dealer.Close()
+	if err := dealer.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(id int) {
+		t.Helper()
+		h := RPCHeader{CorrelationID: strconv.Itoa(id)}
+		if err := dealer.SendMultipart(h.Wrap([][]byte{[]byte("work")})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func() RPCHeader {
+		t.Helper()
+		msg, err := dealer.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, msg = Unwrap(msg)
+		h, _, err := ParseRPC(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	// The first request keeps the worker busy, the second one
+	// waits in the queue, and the third one is shed.
+	send(1)
+	<-started
+	send(2)
+	send(3)
+	h := recv()
+	if want, got := "3", h.CorrelationID; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := ErrOverloaded.Error(), h.Error; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	close(release)
+	for _, want := range []string{"1", "2"} {
+		if h := recv(); want != h.CorrelationID || h.Error != "" {
+			t.Errorf("want a reply to %q, got %+v", want, h)
+		}
+	}
+
+	stats := srv.Stats()
+	if want, got := uint64(2), stats.Served; want != got {
+		t.Errorf("want %d served, got %d", want, got)
+	}
+	if want, got := uint64(1), stats.Shed; want != got {
+		t.Errorf("want %d shed, got %d", want, got)
+	}
+}
+
+func TestAdmissionPolicyLatency(t *testing.T) {
+	srv := &RPCServer{Admission: &AdmissionPolicy{MaxLatency: time.Millisecond, Drop: true}}
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	dropped := make(chan DeadLetter, 1)
+	rep.SetDeadLetterHandler(func(letter DeadLetter) {
+		dropped <- letter
+	})
+
+	srv.observeLatency(time.Second)
+	queue := make(chan rpcCall, 1)
+	call := rpcCall{msg: [][]byte{[]byte("work")}}
+
+	// An idle worker takes the request despite the latency.
+	if err := srv.enqueue(context.Background(), rep, call, queue, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(queue); want != got {
+		t.Fatalf("want %d queued, got %d", want, got)
+	}
+
+	srv.busy = 1
+	if err := srv.enqueue(context.Background(), rep, call, queue, 1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case letter := <-dropped:
+		if want, got := DropOverloaded, letter.Reason; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	default:
+		t.Error("request not shed")
+	}
+}
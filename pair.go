@@ -0,0 +1,81 @@
+package gomq
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// PairSocket is a ZMQ_PAIR socket type, for exclusive two-way
+// links between two PAIR sockets, most often over inproc://
+// between goroutines. It has at most one peer at a time:
+// while it has one, connections accepted on its endpoints are
+// refused and closed, Connect fails with ErrPeerLimit, and
+// reconnecting waits, retrying after its backoff delay until
+// the peer goes away. Like PUSH, it waits for its peer by
+// default when sending without one.
+// See: https://rfc.zeromq.org/spec:31
+type PairSocket struct {
+	*Socket
+	addLock sync.Mutex
+}
+
+// NewPair accepts a zmtp.SecurityMechanism
+// and returns a PairSocket.
+func NewPair(mechanism zmtp.SecurityMechanism) *PairSocket {
+	s := &PairSocket{
+		Socket: NewSocket(false, zmtp.PairSocketType, nil, mechanism),
+	}
+	s.SetSendMode(SendBlock)
+	return s
+}
+
+// acceptsPeer reports whether the socket has no peer yet.
+func (s *PairSocket) acceptsPeer() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.ids) == 0
+}
+
+// AddConnection adds a gomq.Connection to the socket,
+// unless the socket already has a peer, when conn is
+// closed instead. It is goroutine safe.
+func (s *PairSocket) AddConnection(conn *Connection) {
+	s.addLock.Lock()
+	defer s.addLock.Unlock()
+
+	if !s.acceptsPeer() {
+		atomic.StoreInt32(&conn.detached, 1)
+		conn.outbox.close()
+		conn.net.Close()
+		close(conn.lost)
+		s.setEndpointState(conn.endpoint, Degraded, ErrPeerLimit)
+		return
+	}
+	s.Socket.AddConnection(conn)
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// pair socket to it, over any registered transport.
+func (s *PairSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(s, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (s *PairSocket) ResumeListening(endpoint string) error {
+	return resumeListening(s, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// pair socket to it, over any registered transport.
+func (s *PairSocket) Connect(endpoint string) error {
+	return ConnectClient(s, endpoint)
+}
+
+var (
+	_ Client = (*PairSocket)(nil)
+	_ Server = (*PairSocket)(nil)
+)
@@ -0,0 +1,71 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestPair(t *testing.T) {
+	a := NewPair(zmtp.NewSecurityNull())
+	defer a.Close()
+	if _, err := a.Bind("inproc://pair"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewPair(zmtp.NewSecurityNull())
+	defer b.Close()
+	if err := b.Connect("inproc://pair"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.SendMultipart([][]byte{[]byte("PING"), []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := a.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "PING 1", string(msg[0])+" "+string(msg[1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if err := a.Send([]byte("PONG")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.Recv(); err != nil || string(got) != "PONG" {
+		t.Errorf("want %q, got %q, %v", "PONG", got, err)
+	}
+
+	if _, err := b.Bind("inproc://pair-other"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ErrPeerLimit, b.Connect("inproc://pair-other"); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	c := NewPair(zmtp.NewSecurityNull())
+	defer c.Close()
+	if err := c.Connect("inproc://pair"); err == nil {
+		t.Fatal("want an error connecting to a pair with a peer")
+	}
+
+	// the pair accepts a new peer once its peer is gone
+	b.Close()
+	for i := 0; c.Connect("inproc://pair") != nil; i++ {
+		if i == 100 {
+			t.Fatal("pair did not accept a new peer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := c.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	// the loss of the previous peer is reported first
+	got, err := a.Recv()
+	if err != nil {
+		got, err = a.Recv()
+	}
+	if err != nil || string(got) != "HELLO" {
+		t.Errorf("want %q, got %q, %v", "HELLO", got, err)
+	}
+}
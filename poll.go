@@ -0,0 +1,180 @@
+package gomq
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// PollEvents are the events a Poller waits for on a socket.
+type PollEvents int
+
+const (
+	// PollIn is set when a message can be received
+	// from the socket without blocking.
+	PollIn PollEvents = 1 << iota
+
+	// PollOut is set when a message can be sent
+	// on the socket without blocking.
+	PollOut
+)
+
+var errNotPollable = errors.New("gomq: socket cannot be polled")
+
+// Polled is a socket found ready by a Poller,
+// along with the events it is ready for.
+type Polled struct {
+	Socket ZeroMQSocket
+	Events PollEvents
+}
+
+// Poller waits on several sockets at once from a single
+// goroutine, like zmq_poll. Unlike Select, it does not
+// receive anything: a message that makes a socket ready is
+// kept for the socket's next receive call. A closed socket
+// is ready for every event it is polled for, as operations
+// on it fail right away. A Poller is not safe for concurrent
+// use, and the sockets it polls should not be received from
+// by other goroutines while it waits.
+type Poller struct {
+	items []Polled
+}
+
+// pollable is implemented by sockets embedding
+// *Socket, which can be polled.
+type pollable interface {
+	unread(*zmtp.Message)
+	readable() bool
+	writable() (ok bool, peersChanged, room <-chan struct{})
+}
+
+// Add makes the poller wait for events on s, replacing
+// the events it waited for on s, if any.
+func (p *Poller) Add(s ZeroMQSocket, events PollEvents) error {
+	if _, ok := s.(pollable); !ok {
+		return errNotPollable
+	}
+	for i := range p.items {
+		if p.items[i].Socket == s {
+			p.items[i].Events = events
+			return nil
+		}
+	}
+	p.items = append(p.items, Polled{Socket: s, Events: events})
+	return nil
+}
+
+// Remove stops the poller from waiting on s.
+func (p *Poller) Remove(s ZeroMQSocket) {
+	for i := range p.items {
+		if p.items[i].Socket == s {
+			p.items = append(p.items[:i], p.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// Wait waits until at least one of the sockets is ready for
+// one of the events it is polled for, or until timeout has
+// passed, and returns the ready sockets. A negative timeout
+// waits forever. ErrTimeout is returned on timeout.
+func (p *Poller) Wait(timeout time.Duration) ([]Polled, error) {
+	var timer <-chan time.Time
+	if timeout >= 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		var ready []Polled
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer)}}
+		receiving := make(map[int]pollable)
+		for _, item := range p.items {
+			s := item.Socket.(pollable)
+			var events PollEvents
+			select {
+			case <-baseOf(item.Socket).Done():
+				events = item.Events
+			default:
+			}
+
+			if item.Events&PollIn != 0 && events&PollIn == 0 {
+				if s.readable() {
+					events |= PollIn
+				} else if item.Socket.SocketType() != zmtp.PubSocketType {
+					receiving[len(cases)] = s
+					cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(item.Socket.RecvChannel())})
+				}
+			}
+			if item.Events&PollOut != 0 && events&PollOut == 0 {
+				ok, peersChanged, room := s.writable()
+				if ok {
+					events |= PollOut
+				} else {
+					cases = append(cases,
+						reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(peersChanged)},
+						reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(room)})
+				}
+			}
+			if events != 0 {
+				ready = append(ready, Polled{Socket: item.Socket, Events: events})
+			}
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(baseOf(item.Socket).Done())})
+		}
+		if len(ready) > 0 {
+			return ready, nil
+		}
+
+		i, v, _ := reflect.Select(cases)
+		if i == 0 {
+			return nil, ErrTimeout
+		}
+		if s, ok := receiving[i]; ok {
+			s.unread(v.Interface().(*zmtp.Message))
+		}
+	}
+}
+
+// unread keeps msg for the next receive call.
+func (s *Socket) unread(msg *zmtp.Message) {
+	s.lock.Lock()
+	s.polled = msg
+	s.lock.Unlock()
+}
+
+// readable reports whether a message was kept by unread.
+func (s *Socket) readable() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.polled != nil
+}
+
+// writable reports whether a message can be queued to one of
+// the socket's peers right away. If not, it returns channels
+// closed when the peers change or an outbox has room again.
+func (s *Socket) writable() (bool, <-chan struct{}, <-chan struct{}) {
+	room := s.sendRoom.wait()
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	switch s.sockType {
+	case zmtp.PubSocketType:
+		return true, nil, nil
+	case zmtp.SubSocketType, zmtp.PullSocketType:
+		return false, s.peersChanged, room
+	}
+	for _, id := range s.ids {
+		conn := s.conns[id]
+		if conn.goingAway {
+			continue
+		}
+		if !conn.outbox.full() {
+			return true, nil, nil
+		}
+	}
+	return false, s.peersChanged, room
+}
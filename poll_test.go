@@ -0,0 +1,80 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestPoller(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://poller"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("inproc://poller"); err != nil {
+		t.Fatal(err)
+	}
+
+	var p Poller
+	if err := p.Add(server, PollIn); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(client, PollIn|PollOut); err != nil {
+		t.Fatal(err)
+	}
+
+	ready, err := p.Wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(ready); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if ready[0].Socket != client || ready[0].Events != PollOut {
+		t.Errorf("want client ready for output, got %+v", ready[0])
+	}
+
+	p.Add(client, PollIn)
+	if _, err := p.Wait(10 * time.Millisecond); err != ErrTimeout {
+		t.Fatalf("want %v, got %v", ErrTimeout, err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	ready, err = p.Wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 1 || ready[0].Socket != server || ready[0].Events != PollIn {
+		t.Fatalf("want server ready for input, got %+v", ready)
+	}
+
+	// The message is kept until it is received.
+	if ready, err := p.Wait(0); err != nil || len(ready) != 1 {
+		t.Fatalf("want server still ready, got %+v and %v", ready, err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	p.Remove(server)
+	server.Close()
+	client.Close()
+	ready, err = p.Wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 1 || ready[0].Socket != client || ready[0].Events != PollIn {
+		t.Errorf("want closed client ready, got %+v", ready)
+	}
+}
@@ -0,0 +1,160 @@
+package gomq
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// DealerPool manages parallel DEALER sockets connected to the
+// same service, for clients issuing more concurrent requests
+// than one connection carries well. Each request checks out a
+// dealer of its own, so replies cannot reach the wrong caller.
+type DealerPool struct {
+	mechanism zmtp.SecurityMechanism
+	endpoint  string
+	lock      sync.Mutex
+	members   []*poolMember
+	released  chan struct{}
+	closed    bool
+}
+
+// poolMember is a dealer of a pool.
+type poolMember struct {
+	dealer Dealer
+	busy   bool
+	served uint64
+}
+
+// NewDealerPool returns a pool of size dealers connecting to
+// endpoint in the background, each reconnecting whenever its
+// connection is lost.
+func NewDealerPool(mechanism zmtp.SecurityMechanism, endpoint string, size int) (*DealerPool, error) {
+	if _, _, err := splitEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	p := &DealerPool{
+		mechanism: mechanism,
+		endpoint:  endpoint,
+		members:   make([]*poolMember, size),
+		released:  make(chan struct{}),
+	}
+	for i := range p.members {
+		p.members[i] = &poolMember{dealer: p.dial()}
+	}
+	return p, nil
+}
+
+// dial returns a new dealer connecting to the pool's endpoint.
+func (p *DealerPool) dial() Dealer {
+	d := NewDealer(p.mechanism, "")
+	connectInBackground(d, []string{p.endpoint})
+	return d
+}
+
+// Get checks out the healthiest idle dealer of the pool:
+// one with a connected peer if possible, and among those
+// the one that served the fewest requests. It waits for a
+// dealer to be put back if all are checked out, until ctx
+// is done. Checked out dealers must be returned with Put.
+func (p *DealerPool) Get(ctx context.Context) (Dealer, error) {
+	for {
+		p.lock.Lock()
+		if p.closed {
+			p.lock.Unlock()
+			return nil, ErrClosed
+		}
+
+		var best *poolMember
+		bestConnected := false
+		for _, m := range p.members {
+			if m.busy {
+				continue
+			}
+			connected := len(baseOf(m.dealer).Peers()) > 0
+			if best == nil || connected && !bestConnected ||
+				connected == bestConnected && m.served < best.served {
+				best, bestConnected = m, connected
+			}
+		}
+		if best != nil {
+			best.busy = true
+			best.served++
+			p.lock.Unlock()
+			return best.dealer, nil
+		}
+		released := p.released
+		p.lock.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Put returns a dealer checked out with Get to the pool. If
+// err is not nil, the request made with the dealer failed,
+// and the dealer is closed and replaced, as a reply may still
+// be on its way and the dealer cannot be trusted anymore.
+func (p *DealerPool) Put(d Dealer, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, m := range p.members {
+		if m.dealer != d || !m.busy {
+			continue
+		}
+		m.busy = false
+		if p.closed {
+			d.Close()
+			return
+		}
+		if err != nil {
+			d.Close()
+			*m = poolMember{dealer: p.dial(), served: m.served}
+		}
+		close(p.released)
+		p.released = make(chan struct{})
+		return
+	}
+}
+
+// Do sends request with a dealer of the pool and returns
+// the reply, giving up when ctx is done. Requests to REP
+// sockets must start with an empty delimiter frame.
+func (p *DealerPool) Do(ctx context.Context, request [][]byte) ([][]byte, error) {
+	d, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.SendMultipartContext(ctx, request)
+	var reply [][]byte
+	if err == nil {
+		reply, err = d.RecvMultipartContext(ctx)
+	}
+	p.Put(d, err)
+	return reply, err
+}
+
+// Close closes the idle dealers of the pool, and the others
+// once they are put back. Get fails with ErrClosed from then on.
+func (p *DealerPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, m := range p.members {
+		if !m.busy {
+			m.dealer.Close()
+		}
+	}
+	close(p.released)
+}
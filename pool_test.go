@@ -0,0 +1,97 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestDealerPool(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	if _, err := rep.Bind("tcp://127.0.0.1:19055"); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			// peers going away, such as the broken
+			// dealer, are reported and skipped
+			msg, err := rep.RecvMultipart()
+			if errors.Is(err, ErrClosed) {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			rep.SendMultipart(msg)
+		}
+	}()
+
+	pool, err := NewDealerPool(zmtp.NewSecurityNull(), "tcp://127.0.0.1:19055", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(request string) {
+			defer wg.Done()
+			reply, err := pool.Do(ctx, [][]byte{{}, []byte(request)})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want, got := request, string(reply[len(reply)-1]); want != got {
+				t.Errorf("want %q, got %q", want, got)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	// With every dealer checked out, Get waits.
+	var dealers []Dealer
+	for i := 0; i < 3; i++ {
+		d, err := pool.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dealers = append(dealers, d)
+	}
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := pool.Get(short); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// A dealer put back with an error is replaced.
+	pool.Put(dealers[0], errors.New("broken"))
+	pool.Put(dealers[1], nil)
+	pool.Put(dealers[2], nil)
+	select {
+	case <-baseOf(dealers[0]).Done():
+	default:
+		t.Error("want the broken dealer closed")
+	}
+	reply, err := pool.Do(ctx, [][]byte{{}, []byte("again")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "again", string(reply[len(reply)-1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	pool.Close()
+	if _, err := pool.Get(ctx); err != ErrClosed {
+		t.Errorf("want %v, got %v", ErrClosed, err)
+	}
+}
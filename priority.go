@@ -0,0 +1,182 @@
+package gomq
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// PriorityClass is a class of the requests an RPCServer
+// receives, served by its workers in proportion to the
+// class's weight, see RPCServer.Priorities.
+type PriorityClass struct {
+	// Selector matches the labels of the endpoints whose
+	// peers' requests are in the class, see Labels.Match.
+	// An empty selector matches every peer.
+	Selector string
+
+	// Topic, if set, only lets requests whose body starts
+	// with a frame prefixed by it into the class.
+	Topic string
+
+	// Weight is the share of the workers the class gets
+	// while other classes have requests waiting too.
+	// It is one if zero.
+	Weight int
+}
+
+// match reports whether the request msg, from a peer
+// with labels, is in the class.
+func (c PriorityClass) match(labels Labels, msg [][]byte) bool {
+	if !labels.Match(c.Selector) {
+		return false
+	}
+	if c.Topic == "" {
+		return true
+	}
+	_, body, err := ParseRPC(msg)
+	return err == nil && len(body) > 0 && bytes.HasPrefix(body[0], []byte(c.Topic))
+}
+
+// rpcClass queues the requests of a priority class.
+type rpcClass struct {
+	weight  int
+	current int // smooth weighted round robin credit
+	calls   []rpcCall
+}
+
+// rpcScheduler queues the requests of an RPCServer with
+// priorities, one queue per class, and hands them to the
+// workers by smooth weighted round robin over the classes
+// with requests waiting.
+type rpcScheduler struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	classes []*rpcClass // the last one for requests in no class
+	limit   int
+	queued  int
+	closed  bool
+}
+
+func newRPCScheduler(priorities []PriorityClass, limit int) *rpcScheduler {
+	q := &rpcScheduler{limit: limit}
+	q.cond = sync.NewCond(&q.lock)
+	for _, p := range append(priorities, PriorityClass{}) {
+		weight := p.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		q.classes = append(q.classes, &rpcClass{weight: weight})
+	}
+	return q
+}
+
+// len returns the number of requests waiting.
+func (q *rpcScheduler) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.queued
+}
+
+// push queues call in class i. If the class already has limit
+// requests waiting, it fails if wait is not set, and waits for
+// one of them to be taken otherwise, until q is closed.
+func (q *rpcScheduler) push(i int, call rpcCall, wait bool) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	c := q.classes[i]
+	for !q.closed && len(c.calls) >= q.limit {
+		if !wait {
+			return false
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		return false
+	}
+	c.calls = append(c.calls, call)
+	q.queued++
+	q.cond.Broadcast()
+	return true
+}
+
+// pop waits for a request and returns it, picking its class
+// by weight. It returns false once q is closed.
+func (q *rpcScheduler) pop() (rpcCall, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for !q.closed && q.queued == 0 {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return rpcCall{}, false
+	}
+
+	var best *rpcClass
+	total := 0
+	for _, c := range q.classes {
+		if len(c.calls) == 0 {
+			continue
+		}
+		c.current += c.weight
+		total += c.weight
+		if best == nil || c.current > best.current {
+			best = c
+		}
+	}
+	best.current -= total
+
+	call := best.calls[0]
+	best.calls[0] = rpcCall{}
+	best.calls = best.calls[1:]
+	q.queued--
+	q.cond.Broadcast()
+	return call, true
+}
+
+// close wakes up the workers and the pushes waiting on q,
+// and makes them fail.
+func (q *rpcScheduler) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.lock.Unlock()
+}
+
+// classify returns the index of the first class of the
+// server's priorities call, received on r, is in.
+func (srv *RPCServer) classify(r *RepSocket, call rpcCall) int {
+	r.Socket.lock.RLock()
+	var labels Labels
+	if conn, ok := r.conns[call.peer]; ok {
+		labels = conn.labels
+	}
+	r.Socket.lock.RUnlock()
+
+	for i, p := range srv.Priorities {
+		if p.match(labels, call.msg) {
+			return i
+		}
+	}
+	return len(srv.Priorities)
+}
+
+// schedule queues call, received on r, for the workers by
+// priority, unless the server's admission policy sheds it.
+func (srv *RPCServer) schedule(ctx context.Context, r *RepSocket, call rpcCall, q *rpcScheduler, workers int) error {
+	if srv.overloaded(q.len(), workers) {
+		srv.shedCall(r, call)
+		return nil
+	}
+
+	shed := srv.Admission != nil && srv.Admission.MaxQueue > 0
+	if !q.push(srv.classify(r, call), call, !shed) {
+		if !shed {
+			return ctx.Err()
+		}
+		srv.shedCall(r, call)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestRPCScheduler(t *testing.T) {
+	admin := PriorityClass{Selector: "role=admin", Weight: 3}
+	q := newRPCScheduler([]PriorityClass{admin}, 4)
+	for _, id := range []string{"b1", "b2", "b3", "b4"} {
+		if !q.push(1, rpcCall{peer: id}, false) {
+			t.Fatalf("want %s queued", id)
+		}
+	}
+	if q.push(1, rpcCall{peer: "b5"}, false) {
+		t.Error("want a full class to refuse requests")
+	}
+	for _, id := range []string{"a1", "a2", "a3"} {
+		q.push(0, rpcCall{peer: id}, false)
+	}
+
+	var order string
+	for q.len() > 0 {
+		call, _ := q.pop()
+		order += call.peer + " "
+	}
+	if want, got := "a1 a2 b1 a3 b2 b3 b4 ", order; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	q.close()
+	if _, ok := q.pop(); ok {
+		t.Error("want pop to fail once closed")
+	}
+}
+
+func TestPriorityClass(t *testing.T) {
+	admin := PriorityClass{Selector: "role=admin", Topic: "ctl."}
+	msg := RPCHeader{CorrelationID: "1"}.Wrap([][]byte{[]byte("ctl.drain")})
+	if !admin.match(Labels{"role": "admin"}, msg) {
+		t.Error("want an admin control request in the class")
+	}
+	if admin.match(Labels{"role": "admin"}, [][]byte{[]byte("bulk")}) {
+		t.Error("want requests of other topics out of the class")
+	}
+	if admin.match(nil, msg) {
+		t.Error("want requests of other peers out of the class")
+	}
+}
+
+func TestRPCServerPriorities(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	rep.SetEndpointLabels("inproc://test-priorities-admin", Labels{"role": "admin"})
+	for _, endpoint := range []string{"inproc://test-priorities", "inproc://test-priorities-admin"} {
+		if _, err := rep.Bind(endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := &RPCServer{
+		Handler: func(ctx context.Context, h RPCHeader, request [][]byte) ([][]byte, error) {
+			return request, nil
+		},
+		Priorities: []PriorityClass{{Selector: "role=admin", Weight: 4}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, rep)
+
+	for _, endpoint := range []string{"inproc://test-priorities", "inproc://test-priorities-admin"} {
+		dealer := NewDealer(zmtp.NewSecurityNull(), "")
+		defer dealer.Close()
+		if err := dealer.Connect(endpoint); err != nil {
+			t.Fatal(err)
+		}
+		if err := dealer.SendMultipart([][]byte{{}, []byte(endpoint)}); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := dealer.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := endpoint, string(msg[len(msg)-1]); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package gomq
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StageProfile aggregates the time the sampled
+// messages spent in one stage, see Profile.
+type StageProfile struct {
+	Samples uint64
+	Total   time.Duration
+	Max     time.Duration
+}
+
+// Mean returns the mean time spent in the stage,
+// or zero without samples.
+func (p StageProfile) Mean() time.Duration {
+	if p.Samples == 0 {
+		return 0
+	}
+	return p.Total / time.Duration(p.Samples)
+}
+
+// add records a sample of d.
+func (p *StageProfile) add(d time.Duration) {
+	p.Samples++
+	p.Total += d
+	if d > p.Max {
+		p.Max = d
+	}
+}
+
+// Profile tells where the messages sampled by a socket spent
+// their time, see SetProfiling, to guide tuning high
+// throughput deployments.
+type Profile struct {
+	// Read is the time spent reading received messages from
+	// the transport, once their first frame header arrived.
+	Read StageProfile
+
+	// Parse is the time spent decoding received messages,
+	// such as decrypting them.
+	Parse StageProfile
+
+	// Handoff is the time from a received message being
+	// parsed to the application receiving it, including
+	// waiting for the application to ask for it.
+	Handoff StageProfile
+
+	// Queue is the time messages sent waited in
+	// their peer's outbox to be written.
+	Queue StageProfile
+
+	// Write is the time spent writing messages
+	// sent to the transport.
+	Write StageProfile
+}
+
+// profiler samples one in every n messages
+// and aggregates their timings.
+type profiler struct {
+	every   uint64
+	count   uint64 // accessed atomically
+	lock    sync.Mutex
+	profile Profile
+}
+
+// sample reports whether the next message is sampled.
+// A nil profiler samples nothing.
+func (p *profiler) sample() bool {
+	return p != nil && atomic.AddUint64(&p.count, 1)%p.every == 0
+}
+
+// record adds the timings of a sample with f.
+func (p *profiler) record(f func(*Profile)) {
+	p.lock.Lock()
+	f(&p.profile)
+	p.lock.Unlock()
+}
+
+// SetProfiling makes the socket time one in every n of the
+// messages it sends and receives, aggregating where their
+// time went, see Profile. Timing a message costs a few clock
+// readings, so sampling keeps profiling cheap enough to leave
+// on in production. Setting it starts a new profile. Zero,
+// the default, disables profiling.
+func (s *Socket) SetProfiling(n int) {
+	var p *profiler
+	if n > 0 {
+		p = &profiler{every: uint64(n)}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.profiler = p
+	for _, conn := range s.conns {
+		conn.zmtp.SetTiming(n)
+		conn.outbox.setProfiler(p)
+	}
+}
+
+// Profile returns where the messages sampled since
+// SetProfiling spent their time.
+func (s *Socket) Profile() Profile {
+	s.lock.RLock()
+	p := s.profiler
+	s.lock.RUnlock()
+
+	if p == nil {
+		return Profile{}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.profile
+}
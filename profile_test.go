@@ -0,0 +1,61 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestProfiling(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("inproc://profile"); err != nil {
+		t.Fatal(err)
+	}
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	if err := push.Connect("inproc://profile"); err != nil {
+		t.Fatal(err)
+	}
+
+	push.SetProfiling(2)
+	pull.SetProfiling(2)
+	for i := 0; i < 10; i++ {
+		if err := push.SendMultipart([][]byte{[]byte("a"), []byte("b")}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pull.RecvMultipart(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last write may be recorded after the message arrived
+	sent, received := push.Profile(), pull.Profile()
+	for i := 0; sent.Write.Samples < 5 && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+		sent = push.Profile()
+	}
+	for name, stage := range map[string]StageProfile{
+		"queue":   sent.Queue,
+		"write":   sent.Write,
+		"read":    received.Read,
+		"parse":   received.Parse,
+		"handoff": received.Handoff,
+	} {
+		if want, got := uint64(5), stage.Samples; want != got {
+			t.Errorf("%s: want %v samples, got %v", name, want, got)
+		}
+		if stage.Max < stage.Mean() {
+			t.Errorf("%s: want max %v at least the mean %v", name, stage.Max, stage.Mean())
+		}
+	}
+	if want, got := uint64(0), received.Queue.Samples; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	push.SetProfiling(0)
+	if want, got := (Profile{}), push.Profile(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
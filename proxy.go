@@ -0,0 +1,167 @@
+package gomq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxySignature starts every PROXY protocol version 2 header.
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyHeader = errors.New("gomq: invalid PROXY protocol header")
+
+// SetProxyProtocol makes the socket expect a HAProxy PROXY
+// protocol header, version 1 or 2, before the ZMTP greeting
+// of connections it accepts from then on, so that servers
+// behind a proxy or load balancer report the real address
+// of their clients in PeerInfo.RemoteAddr. Connections that
+// do not start with a valid header are dropped.
+func (s *Socket) SetProxyProtocol(enabled bool) {
+	s.lock.Lock()
+	s.proxyProtocol = enabled
+	s.lock.Unlock()
+}
+
+// ProxyProtocol reports whether the socket expects a PROXY
+// protocol header on the connections it accepts.
+func (s *Socket) ProxyProtocol() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.proxyProtocol
+}
+
+// bufferedConn is a net.Conn read through a bufio.Reader,
+// which may hold data read past a proxy's header. If remote
+// is set, it is reported as the connection's remote address,
+// such as the client's address found in a PROXY header.
+type bufferedConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// NetConn returns the connection read through c.
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *bufferedConn) RemoteAddr() net.Addr {
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+// acceptProxy reads the PROXY protocol header conn starts
+// with, waiting for it for no longer than timeout unless it
+// is zero, and returns the connection that follows it.
+func acceptProxy(conn net.Conn, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	r := bufio.NewReader(conn)
+	remote, err := readProxyHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedConn{Conn: conn, r: r, remote: remote}, nil
+}
+
+// readProxyHeader reads a PROXY protocol header from r and
+// returns the source address it carries, or nil if it has
+// none, such as for health checks from the proxy itself.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(proxySignature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(b, proxySignature) {
+		return readProxyHeaderV2(r)
+	}
+	return readProxyHeaderV1(r)
+}
+
+// readProxyHeaderV1 reads a human readable header, such as
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasPrefix(line, []byte("PROXY ")) || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errProxyHeader
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) > 1 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads a binary header.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[12]>>4 != 2 {
+		return nil, errProxyHeader
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(head[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	// a LOCAL command carries no addresses
+	if head[12]&0xF == 0 {
+		return nil, nil
+	}
+	if head[12]&0xF != 1 {
+		return nil, errProxyHeader
+	}
+
+	switch head[13] {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}, nil
+	}
+	return nil, nil
+}
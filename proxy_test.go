@@ -0,0 +1,94 @@
+package gomq
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte(nil), proxySignature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12, 198, 51, 100, 7, 127, 0, 0, 1, 0x1f, 0x90, 0, 80)
+
+	for _, tc := range []struct {
+		header string
+		want   string
+		err    bool
+	}{
+		{header: "PROXY TCP4 203.0.113.7 127.0.0.1 5555 80\r\n", want: "203.0.113.7:5555"},
+		{header: "PROXY TCP6 2001:db8::1 ::1 5555 80\r\n", want: "[2001:db8::1]:5555"},
+		{header: "PROXY UNKNOWN\r\n", want: "<nil>"},
+		{header: string(v2), want: "198.51.100.7:8080"},
+		{header: "PROXY TCP4 nonsense\r\n", err: true},
+		{header: "GET / HTTP/1.1\r\n", err: true},
+	} {
+		r := bufio.NewReader(strings.NewReader(tc.header + "rest"))
+		addr, err := readProxyHeader(r)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: want an error", tc.header)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.header, err)
+			continue
+		}
+
+		got := "<nil>"
+		if addr != nil {
+			got = addr.String()
+		}
+		if want := tc.want; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+
+		rest := make([]byte, 4)
+		r.Read(rest)
+		if want, got := []byte("rest"), rest; !bytes.Equal(want, got) {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetProxyProtocol(true)
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19035"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var conn net.Conn
+	for {
+		var err error
+		if conn, err = net.Dial("tcp", "127.0.0.1:19035"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("PROXY TCP4 203.0.113.7 127.0.0.1 5555 19035\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	client := zmtp.NewConnection(conn)
+	if _, err := client.Prepare(zmtp.NewSecurityNull(), zmtp.ClientSocketType, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "203.0.113.7:5555", server.Peers()[0].RemoteAddr.String(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
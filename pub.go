@@ -0,0 +1,374 @@
+package gomq
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// Commands SUB sockets send to subscribe to the messages
+// starting with a prefix, and to cancel a subscription.
+const (
+	subscribeCommand = "SUBSCRIBE"
+	cancelCommand    = "CANCEL"
+)
+
+// subscriptions is a trie of the prefixes a peer subscribed
+// to. Subscribing to a prefix more than once takes as many
+// cancellations to undo.
+type subscriptions struct {
+	count    int
+	children map[byte]*subscriptions
+}
+
+// add subscribes to prefix.
+func (t *subscriptions) add(prefix []byte) {
+	n := t
+	for _, c := range prefix {
+		if n.children == nil {
+			n.children = make(map[byte]*subscriptions)
+		}
+		child, ok := n.children[c]
+		if !ok {
+			child = &subscriptions{}
+			n.children[c] = child
+		}
+		n = child
+	}
+	n.count++
+}
+
+// remove cancels a subscription to prefix, pruning the
+// nodes left unused. It returns false if there was none.
+func (t *subscriptions) remove(prefix []byte) bool {
+	path := []*subscriptions{t}
+	for _, c := range prefix {
+		child, ok := path[len(path)-1].children[c]
+		if !ok {
+			return false
+		}
+		path = append(path, child)
+	}
+
+	n := path[len(path)-1]
+	if n.count == 0 {
+		return false
+	}
+	n.count--
+
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i].count > 0 || len(path[i].children) > 0 {
+			break
+		}
+		delete(path[i-1].children, prefix[i-1])
+	}
+	return true
+}
+
+// each calls fn with every prefix subscribed to
+// below t, and how many times it was subscribed to.
+func (t *subscriptions) each(prefix []byte, fn func(prefix []byte, count int)) {
+	if t.count > 0 {
+		fn(prefix, t.count)
+	}
+	for c, child := range t.children {
+		child.each(append(prefix[:len(prefix):len(prefix)], c), fn)
+	}
+}
+
+// empty reports whether no prefix is subscribed to.
+func (t *subscriptions) empty() bool {
+	return t.count == 0 && len(t.children) == 0
+}
+
+// match reports whether msg starts with any of
+// the prefixes subscribed to.
+func (t *subscriptions) match(msg []byte) bool {
+	n := t
+	for i := 0; ; i++ {
+		if n.count > 0 {
+			return true
+		}
+		if i == len(msg) {
+			return false
+		}
+		if n = n.children[msg[i]]; n == nil {
+			return false
+		}
+	}
+}
+
+// PubSocket is a ZMQ_PUB socket type. It sends each message
+// to the peers subscribed to a prefix of its first frame,
+// and drops it if there are none. It cannot receive.
+// See: https://rfc.zeromq.org/spec:29
+type PubSocket struct {
+	*Socket
+	retention retention
+}
+
+// NewPub accepts a zmtp.SecurityMechanism and
+// returns a PubSocket.
+func NewPub(mechanism zmtp.SecurityMechanism) *PubSocket {
+	return newPub(zmtp.PubSocketType, mechanism)
+}
+
+// newPub returns a PubSocket of type t, PUB or XPUB.
+func newPub(t zmtp.SocketType, mechanism zmtp.SecurityMechanism) *PubSocket {
+	p := &PubSocket{
+		Socket: NewSocket(true, t, nil, mechanism),
+	}
+	p.onSubscribe = p.replay
+	go p.recvSubscriptions()
+	return p
+}
+
+// recvSubscriptions handles the messages received from peers
+// until the socket is closed. Peers speaking ZMTP 3.0 send
+// subscriptions as messages starting with 1, and cancel them
+// with messages starting with 0.
+func (p *PubSocket) recvSubscriptions() {
+	for {
+		var msg *zmtp.Message
+		select {
+		case msg = <-p.recvChannel:
+		case <-p.done:
+			return
+		}
+		if msg.Err != nil || len(msg.Body) == 0 || len(msg.Body[0]) == 0 {
+			continue
+		}
+
+		var dropped []DeadLetter
+		p.lock.Lock()
+		if conn := p.conns[msg.Peer]; conn != nil {
+			changed := false
+			switch body := msg.Body[0]; body[0] {
+			case 1:
+				conn.subscriptions.add(body[1:])
+				dropped = p.replay(conn, body[1:])
+				changed = true
+			case 0:
+				changed = conn.subscriptions.remove(body[1:])
+			}
+			if changed {
+				p.notifySubscriptionsChanged()
+			}
+		}
+		p.lock.Unlock()
+
+		for _, letter := range dropped {
+			p.deadLetter(letter)
+		}
+	}
+}
+
+// peerSubscriptions returns the prefixes the socket's peers
+// are subscribed to, counting each subscription, along with
+// channels closed once a peer subscribes or cancels, and once
+// a peer connects or disconnects.
+func (p *PubSocket) peerSubscriptions() (prefixes map[string]int, subscriptionsChanged, peersChanged <-chan struct{}) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	prefixes = make(map[string]int)
+	for _, conn := range p.conns {
+		conn.subscriptions.each(nil, func(prefix []byte, count int) {
+			prefixes[string(prefix)] += count
+		})
+	}
+	return prefixes, p.subsChanged, p.peersChanged
+}
+
+// WaitForSubscribers blocks until at least n peers have
+// subscribed to a prefix, so that publishing can wait for
+// subscribers to be attached instead of dropping the first
+// messages, the slow joiner problem. It returns ErrTimeout
+// if that has not happened within timeout, and ErrClosed if
+// the socket is closed while waiting.
+func (p *PubSocket) WaitForSubscribers(n int, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		p.lock.RLock()
+		count := 0
+		for _, conn := range p.conns {
+			if !conn.subscriptions.empty() {
+				count++
+			}
+		}
+		subscriptionsChanged, peersChanged := p.subsChanged, p.peersChanged
+		p.lock.RUnlock()
+
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-subscriptionsChanged:
+		case <-peersChanged:
+		case <-p.done:
+			return ErrClosed
+		case <-timer.C:
+			return ErrTimeout
+		}
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// pub socket to it, over any registered transport.
+func (p *PubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(p, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (p *PubSocket) ResumeListening(endpoint string) error {
+	return resumeListening(p, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// pub socket to it, over any registered transport.
+func (p *PubSocket) Connect(endpoint string) error {
+	return ConnectClient(p, endpoint)
+}
+
+// Send publishes a message.
+func (p *PubSocket) Send(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendWith is like Send. Publishing never blocks.
+func (p *PubSocket) SendWith(b []byte, mode SendMode) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// TrySend is like Send.
+func (p *PubSocket) TrySend(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// TrySendMultipart is like SendMultipart.
+func (p *PubSocket) TrySendMultipart(b [][]byte) error {
+	return p.SendMultipart(b)
+}
+
+// SendPriority is like Send.
+func (p *PubSocket) SendPriority(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendMultipartWith is like SendMultipart.
+func (p *PubSocket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return p.SendMultipart(b)
+}
+
+// SendContext is like Send.
+func (p *PubSocket) SendContext(ctx context.Context, b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendMultipartContext is like SendMultipart.
+func (p *PubSocket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return p.SendMultipart(b)
+}
+
+// SendMultipart publishes a message of one or more frames
+// to the peers subscribed to a prefix of its first frame,
+// retaining it for late subscribers, see SetRetention.
+func (p *PubSocket) SendMultipart(b [][]byte) error {
+	if len(b) == 0 {
+		return errNoFrames
+	}
+	if err := p.validate(b, true); err != nil {
+		return err
+	}
+
+	p.lock.RLock()
+	select {
+	case <-p.done:
+		p.lock.RUnlock()
+		return &SendError{Outcome: Dropped, Err: ErrClosed}
+	default:
+	}
+	p.retention.retain(b)
+
+	var dropped []*Connection
+	for _, id := range p.ids {
+		if conn := p.conns[id]; conn.subscriptions.match(b[0]) {
+			if _, full := conn.outbox.offer(&outgoing{frames: b}); full {
+				dropped = append(dropped, conn)
+			}
+		}
+	}
+	p.lock.RUnlock()
+
+	for _, conn := range dropped {
+		p.deadLetter(DeadLetter{Reason: DropHighWaterMark, PeerID: conn.id, Endpoint: conn.endpoint, Message: b, Err: ErrWouldBlock})
+	}
+	return nil
+}
+
+// Recv returns ErrNotSupported.
+func (p *PubSocket) Recv() ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// TryRecv returns ErrNotSupported.
+func (p *PubSocket) TryRecv() ([]byte, bool, error) {
+	return nil, false, ErrNotSupported
+}
+
+// TryRecvMultipart returns ErrNotSupported.
+func (p *PubSocket) TryRecvMultipart() ([][]byte, bool, error) {
+	return nil, false, ErrNotSupported
+}
+
+// RecvMultipart returns ErrNotSupported.
+func (p *PubSocket) RecvMultipart() ([][]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvContext returns ErrNotSupported.
+func (p *PubSocket) RecvContext(context.Context) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvMultipartContext returns ErrNotSupported.
+func (p *PubSocket) RecvMultipartContext(context.Context) ([][]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// SendTo returns ErrNotSupported, publishing
+// goes to the peers subscribed to a message.
+func (p *PubSocket) SendTo(string, []byte) error {
+	return ErrNotSupported
+}
+
+// RecvFrom returns ErrNotSupported.
+func (p *PubSocket) RecvFrom() (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// RecvFromContext returns ErrNotSupported.
+func (p *PubSocket) RecvFromContext(context.Context) (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// RecvMessage returns ErrNotSupported.
+func (p *PubSocket) RecvMessage() (*Message, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvMessageContext returns ErrNotSupported.
+func (p *PubSocket) RecvMessageContext(context.Context) (*Message, error) {
+	return nil, ErrNotSupported
+}
+
+var (
+	_ Client = (*PubSocket)(nil)
+	_ Server = (*PubSocket)(nil)
+)
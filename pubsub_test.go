@@ -0,0 +1,268 @@
+package gomq
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSubscriptions(t *testing.T) {
+	var subs subscriptions
+	if subs.match([]byte("weather")) {
+		t.Error("want no match without subscriptions")
+	}
+
+	subs.add([]byte("wea"))
+	subs.add([]byte("wea"))
+	subs.add([]byte("news"))
+	for msg, want := range map[string]bool{
+		"weather": true,
+		"wea":     true,
+		"we":      false,
+		"news":    true,
+		"new":     false,
+		"sports":  false,
+	} {
+		if got := subs.match([]byte(msg)); want != got {
+			t.Errorf("%q: want %v, got %v", msg, want, got)
+		}
+	}
+
+	subs.remove([]byte("wea"))
+	if !subs.match([]byte("weather")) {
+		t.Error("want a match while subscribed twice")
+	}
+	subs.remove([]byte("wea"))
+	if subs.match([]byte("weather")) {
+		t.Error("want no match once unsubscribed")
+	}
+	if subs.remove([]byte("wea")) {
+		t.Error("want false removing a missing subscription")
+	}
+
+	subs.add(nil)
+	if !subs.match([]byte("sports")) {
+		t.Error("want the empty prefix to match everything")
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	go func() {
+		if _, err := pub.Bind("tcp://127.0.0.1:19045"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	if err := sub.Subscribe([]byte("weather.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Connect("tcp://127.0.0.1:19045"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Send([]byte("nope")); err != ErrNotSupported {
+		t.Errorf("want %v, got %v", ErrNotSupported, err)
+	}
+	if err := pub.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// subscriptions arrive asynchronously, so keep
+	// publishing until one gets through
+	got := make(chan []byte, 1)
+	go func() {
+		msg, err := sub.Recv()
+		if err != nil {
+			t.Error(err)
+		}
+		got <- msg
+	}()
+	timeout := time.After(time.Second)
+	for {
+		if err := pub.Send([]byte("sports.results")); err != nil {
+			t.Fatal(err)
+		}
+		if err := pub.Send([]byte("weather.today")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case msg := <-got:
+			if want, got := "weather.today", string(msg); want != got {
+				t.Errorf("want %v, got %v", want, got)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no message received")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestWaitForSubscribers(t *testing.T) {
+	pub := NewXPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if _, err := pub.Bind("tcp://127.0.0.1:19089"); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	if err := sub.Connect("tcp://127.0.0.1:19089"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.WaitForPeers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ErrTimeout, pub.WaitForSubscribers(1, 50*time.Millisecond); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// once the subscription arrived, the first
+	// message published is received
+	if err := sub.Subscribe([]byte("weather.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.WaitForSubscribers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Send([]byte("weather.today")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := sub.Recv(); err != nil || string(msg) != "weather.today" {
+		t.Errorf("want %q, got %q, %v", "weather.today", msg, err)
+	}
+
+	pub.Close()
+	if want, got := ErrClosed, pub.WaitForSubscribers(2, 5*time.Second); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestPubRetention(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	pub.SetRetention(2)
+	if _, err := pub.Bind("inproc://retention"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"config.a 1", "config.b 1", "config.a 2", "config.a 3", "other 1"} {
+		topic, body, _ := strings.Cut(msg, " ")
+		if err := pub.SendMultipart([][]byte{[]byte(topic), []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	if err := sub.Subscribe([]byte("config.")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Connect("inproc://retention"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"config.b 1", "config.a 2", "config.a 3"} {
+		msg, err := sub.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg[0]) + " " + string(msg[1]); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+
+	pub.SetRetention(1)
+	if err := sub.Subscribe([]byte("config.a")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "config.a 3", string(msg[0])+" "+string(msg[1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestXPubXSub(t *testing.T) {
+	xpub := NewXPub(zmtp.NewSecurityNull())
+	defer xpub.Close()
+	xpub.SetWelcomeMessage([]byte("welcome"))
+	if _, err := xpub.Bind("inproc://xpub"); err != nil {
+		t.Fatal(err)
+	}
+
+	recv := func(want string) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		msg, err := xpub.RecvContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != string(msg) {
+			t.Errorf("want %q, got %q", want, msg)
+		}
+	}
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	sub.Subscribe([]byte("a"))
+	if err := sub.Connect("inproc://xpub"); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "welcome", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	recv("\x01a")
+
+	xsub := NewXSub(zmtp.NewSecurityNull())
+	defer xsub.Close()
+	if err := xsub.Connect("inproc://xpub"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xsub.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// a second subscription to a prefix is only
+	// received by verbose sockets
+	xsub.Send([]byte("\x01a"))
+	xsub.Send([]byte("\x01b"))
+	recv("\x01b")
+	xpub.SetVerbose(true)
+	xsub.Send([]byte("\x01b"))
+	recv("\x01b")
+
+	if err := xpub.Send([]byte("b.1")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := xsub.Recv(); err != nil || string(msg) != "b.1" {
+		t.Errorf("want %q, got %q, %v", "b.1", msg, err)
+	}
+
+	// prefixes are cancelled once no peer is subscribed to them
+	xsub.Send([]byte("\x00b"))
+	xsub.Send([]byte("\x00b"))
+	recv("\x00b")
+	xsub.Close()
+	sub.Close()
+	recv("\x00a")
+
+	if _, ok, err := xpub.TryRecv(); ok || err != nil {
+		t.Errorf("want no more subscriptions, got %v, %v", ok, err)
+	}
+}
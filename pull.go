@@ -21,17 +21,19 @@ func NewPull(mechanism zmtp.SecurityMechanism) *PullSocket {
 }
 
 // Bind accepts a zeromq endpoint and binds the
-// push socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// pull socket to it, over any registered transport.
 func (s *PullSocket) Bind(endpoint string) (net.Addr, error) {
 	return BindServer(s, endpoint)
 }
 
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (s *PullSocket) ResumeListening(endpoint string) error {
+	return resumeListening(s, endpoint)
+}
+
 // Connect accepts a zeromq endpoint and connects the
-// pull socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// pull socket to it, over any registered transport.
 func (c *PullSocket) Connect(endpoint string) error {
 	return ConnectClient(c, endpoint)
 }
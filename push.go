@@ -6,7 +6,9 @@ import (
 	"github.com/zeromq/gomq/zmtp"
 )
 
-// PushSocket is a ZMQ_PUSH socket type.
+// PushSocket is a ZMQ_PUSH socket type. It spreads the
+// messages it sends round-robin over its peers, and waits
+// for a peer by default when it has none.
 // See: http://rfc.zeromq.org/spec:41
 type PushSocket struct {
 	*Socket
@@ -15,23 +17,27 @@ type PushSocket struct {
 // NewPush accepts a zmtp.SecurityMechanism and returns
 // a PushSocket as a gomq.Push interface.
 func NewPush(mechanism zmtp.SecurityMechanism) *PushSocket {
-	return &PushSocket{
+	s := &PushSocket{
 		Socket: NewSocket(false, zmtp.PushSocketType, nil, mechanism),
 	}
+	s.SetSendMode(SendBlock)
+	return s
 }
 
 // Bind accepts a zeromq endpoint and binds the
-// push socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// push socket to it, over any registered transport.
 func (s *PushSocket) Bind(endpoint string) (net.Addr, error) {
 	return BindServer(s, endpoint)
 }
 
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (s *PushSocket) ResumeListening(endpoint string) error {
+	return resumeListening(s, endpoint)
+}
+
 // Connect accepts a zeromq endpoint and connects the
-// client socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// push socket to it, over any registered transport.
 func (s *PushSocket) Connect(endpoint string) error {
 	return ConnectClient(s, endpoint)
 }
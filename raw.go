@@ -0,0 +1,268 @@
+package gomq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// rawReadSize is the largest chunk of bytes a RawSocket
+// passes on in a single message.
+const rawReadSize = 64 << 10
+
+// RawSocket is a ZMQ_STREAM socket type, exchanging plain
+// bytes with peers that do not speak ZMTP, such as HTTP
+// clients or line oriented protocols. No handshake takes
+// place: messages received are made of the routing ID of
+// the connection the bytes came from, followed by a chunk
+// of them, and messages sent start with the routing ID of
+// the connection to write the rest to. As with libzmq, a
+// message with an empty chunk is received when a connection
+// is established or lost, and sending one closes the
+// connection.
+type RawSocket struct {
+	*Socket
+	raw map[string]*rawConn
+}
+
+// rawConn is a connection of a RawSocket.
+type rawConn struct {
+	id       []byte
+	endpoint string
+	net      net.Conn
+	lock     sync.Mutex
+}
+
+// NewRaw returns a RawSocket.
+func NewRaw() *RawSocket {
+	return &RawSocket{
+		Socket: NewSocket(true, zmtp.StreamSocketType, nil, zmtp.NewSecurityNull()),
+		raw:    make(map[string]*rawConn),
+	}
+}
+
+// Bind accepts an endpoint, such as "tcp://<address>:<port>",
+// listens on it and returns the address listened on, accepting
+// connections in the background until the socket is closed.
+func (r *RawSocket) Bind(endpoint string) (net.Addr, error) {
+	ln, err := bindListener(r, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	go r.accept(endpoint, ln)
+	return ln.Addr(), nil
+}
+
+// ResumeListening binds the socket to endpoint again
+// after StopListening.
+func (r *RawSocket) ResumeListening(endpoint string) error {
+	_, err := r.Bind(endpoint)
+	return err
+}
+
+// accept adds the connections accepted on ln, which
+// listens on endpoint, until ln is closed.
+func (r *RawSocket) accept(endpoint string, ln net.Listener) {
+	for {
+		netConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		emit(r, SocketEvent{Type: EventAccepted, Endpoint: endpoint, Addr: netConn.RemoteAddr().String()})
+		r.add(endpoint, netConn)
+	}
+}
+
+// Connect accepts an endpoint, such as "tcp://<address>:<port>",
+// and connects the socket to it. Unlike other socket types, it
+// makes a single attempt, and does not reconnect once the
+// connection is lost.
+func (r *RawSocket) Connect(endpoint string) error {
+	transport, address, err := splitEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+	setEndpointState(r, endpoint, Connecting, nil)
+	netConn, err := dialNet(r, transport, address)
+	if err != nil {
+		setEndpointState(r, endpoint, Connecting, err)
+		return fmt.Errorf("%w: %v", errDial, err)
+	}
+	emit(r, SocketEvent{Type: EventConnected, Endpoint: endpoint, Addr: netConn.RemoteAddr().String()})
+	r.add(endpoint, netConn)
+	return nil
+}
+
+// add adds netConn, established on endpoint, to the socket
+// and starts passing on the bytes read from it.
+func (r *RawSocket) add(endpoint string, netConn net.Conn) {
+	r.lock.Lock()
+	select {
+	case <-r.done:
+		r.lock.Unlock()
+		netConn.Close()
+		return
+	default:
+	}
+	conn := &rawConn{
+		id:       r.routingIDs.assign(nil),
+		endpoint: endpoint,
+		net:      netConn,
+	}
+	r.raw[string(conn.id)] = conn
+	r.lock.Unlock()
+
+	r.setEndpointState(endpoint, Ready, nil)
+	go r.read(conn)
+}
+
+// read passes on the bytes read from conn until it is
+// closed, preceded and followed by an empty message.
+func (r *RawSocket) read(conn *rawConn) {
+	r.deliver([][]byte{conn.id, {}})
+
+	buf := make([]byte, rawReadSize)
+	for {
+		n, err := conn.net.Read(buf)
+		if n > 0 {
+			msg := [][]byte{conn.id, append([]byte(nil), buf[:n]...)}
+			r.stats.received(msg[1:])
+			if !r.deliver(msg) {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	r.lock.Lock()
+	delete(r.raw, string(conn.id))
+	r.lock.Unlock()
+	conn.net.Close()
+	r.deliver([][]byte{conn.id, {}})
+}
+
+// deliver passes msg on to the socket's receive channel,
+// unless the socket is closed first. It returns whether
+// msg was passed on.
+func (r *RawSocket) deliver(msg [][]byte) bool {
+	select {
+	case r.recvChannel <- &zmtp.Message{Body: msg, MessageType: zmtp.UserMessage, Received: time.Now()}:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// Recv returns ErrNotSupported, as STREAM
+// messages have two frames.
+func (r *RawSocket) Recv() ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvContext returns ErrNotSupported.
+func (r *RawSocket) RecvContext(context.Context) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// TryRecv returns ErrNotSupported.
+func (r *RawSocket) TryRecv() ([]byte, bool, error) {
+	return nil, false, ErrNotSupported
+}
+
+// Send returns ErrNotSupported, as STREAM
+// messages have two frames.
+func (r *RawSocket) Send([]byte) error {
+	return ErrNotSupported
+}
+
+// SendWith returns ErrNotSupported.
+func (r *RawSocket) SendWith([]byte, SendMode) error {
+	return ErrNotSupported
+}
+
+// SendContext returns ErrNotSupported.
+func (r *RawSocket) SendContext(context.Context, []byte) error {
+	return ErrNotSupported
+}
+
+// SendPriority returns ErrNotSupported.
+func (r *RawSocket) SendPriority([]byte) error {
+	return ErrNotSupported
+}
+
+// TrySend returns ErrNotSupported.
+func (r *RawSocket) TrySend([]byte) error {
+	return ErrNotSupported
+}
+
+// SendMultipart writes the frames following the first to
+// the connection whose routing ID is the first, blocking
+// until they are written. If they are all empty, the
+// connection is closed instead. Messages to unknown
+// connections go to the dead letter handler.
+func (r *RawSocket) SendMultipart(b [][]byte) error {
+	if len(b) < 2 {
+		return errNoRoutingID
+	}
+
+	r.lock.RLock()
+	conn := r.raw[string(b[0])]
+	r.lock.RUnlock()
+	if conn == nil {
+		r.deadLetter(DeadLetter{Reason: DropUnroutable, Message: b[1:], Err: ErrUnknownPeer})
+		return nil
+	}
+
+	if messageSize(b[1:]) == 0 {
+		return conn.net.Close()
+	}
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	for _, frame := range b[1:] {
+		if _, err := conn.net.Write(frame); err != nil {
+			conn.net.Close()
+			return &SendError{PeerID: fmt.Sprintf("%x", conn.id), Endpoint: conn.endpoint, Outcome: Dropped, Err: err}
+		}
+	}
+	r.stats.sent(b[1:])
+	return nil
+}
+
+// SendMultipartWith is like SendMultipart, whatever the mode.
+func (r *RawSocket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return r.SendMultipart(b)
+}
+
+// SendMultipartContext is like SendMultipart.
+func (r *RawSocket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return r.SendMultipart(b)
+}
+
+// TrySendMultipart is like SendMultipart.
+func (r *RawSocket) TrySendMultipart(b [][]byte) error {
+	return r.SendMultipart(b)
+}
+
+// Close closes the socket and all of its connections.
+func (r *RawSocket) Close() error {
+	err := r.Socket.Close()
+
+	r.lock.Lock()
+	for id, conn := range r.raw {
+		conn.net.Close()
+		delete(r.raw, id)
+	}
+	r.lock.Unlock()
+	return err
+}
+
+var (
+	_ Client = (*RawSocket)(nil)
+	_ Server = (*RawSocket)(nil)
+)
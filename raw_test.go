@@ -0,0 +1,122 @@
+package gomq
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	server := NewRaw()
+	defer server.Close()
+	if _, err := server.Bind("tcp://127.0.0.1:19087"); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := net.Dial("tcp", "127.0.0.1:19087")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	connected, err := server.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(connected[1]); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	id := connected[0]
+
+	if _, err := io.WriteString(client, "GET / HTTP/1.0\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	var request []byte
+	for len(request) < 18 {
+		msg, err := server.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := string(id), string(msg[0]); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+		request = append(request, msg[1]...)
+	}
+	if want, got := "GET / HTTP/1.0\r\n\r\n", string(request); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := server.SendMultipart([][]byte{id, []byte("HTTP/1.0 200 OK\r\n\r\n"), []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SendMultipart([][]byte{id, nil}); err != nil {
+		t.Fatal(err)
+	}
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HTTP/1.0 200 OK\r\n\r\nhello", string(response); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	disconnected, err := server.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := string(id), string(disconnected[0]); want != got || len(disconnected[1]) != 0 {
+		t.Errorf("want an empty message from %q, got %q", want, disconnected)
+	}
+	if err := server.Send([]byte("x")); err != ErrNotSupported {
+		t.Errorf("want %v, got %v", ErrNotSupported, err)
+	}
+}
+
+func TestRawConnect(t *testing.T) {
+	server := NewRaw()
+	defer server.Close()
+	if _, err := server.Bind("inproc://raw"); err != nil {
+		t.Fatal(err)
+	}
+	client := NewRaw()
+	defer client.Close()
+	if err := client.Connect("inproc://raw"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := client.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendMultipart([][]byte{msg[0], []byte("line one\nline two\n")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.RecvMultipart(); err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		for {
+			msg, err := server.RecvMultipart()
+			if err != nil || len(msg[1]) == 0 {
+				pw.Close()
+				return
+			}
+			pw.Write(msg[1])
+		}
+	}()
+	lines := bufio.NewScanner(pr)
+	for _, want := range []string{"line one", "line two"} {
+		if !lines.Scan() {
+			t.Fatal(lines.Err())
+		}
+		if got := lines.Text(); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+	if want, got := uint64(1), client.Stats().MessagesSent; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,100 @@
+package gomq
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// pongCommand is the ZMTP 3.1 answer to a PING,
+// echoing the PING's context.
+const pongCommand = "PONG"
+
+// WaitReady blocks until one of the socket's peers completed
+// its handshake, so that service mains can wait for the services
+// they depend on to be reachable before serving. If ping is set,
+// the peer must also answer a ZMTP 3.1 PING, proving it still
+// reads from the connection. It returns ctx.Err() if ctx is
+// done first, and ErrClosed if the socket is closed.
+func (s *Socket) WaitReady(ctx context.Context, ping bool) error {
+	for {
+		s.lock.RLock()
+		conns := make([]*Connection, 0, len(s.ids))
+		for _, id := range s.ids {
+			conns = append(conns, s.conns[id])
+		}
+		changed := s.peersChanged
+		s.lock.RUnlock()
+
+		if len(conns) > 0 {
+			if !ping {
+				return nil
+			}
+			if s.pingAny(ctx, conns, changed) {
+				return nil
+			}
+		} else {
+			select {
+			case <-changed:
+			case <-ctx.Done():
+			case <-s.done:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return ErrClosed
+		default:
+		}
+	}
+}
+
+// pingAny pings conns and reports whether any of them
+// answered, before ctx or the socket is done, or the
+// socket's peers change, when changed is closed.
+func (s *Socket) pingAny(ctx context.Context, conns []*Connection, changed <-chan struct{}) bool {
+	pong := make(chan struct{})
+
+	s.lock.Lock()
+	s.pingSeq++
+	token := binary.BigEndian.AppendUint64(nil, s.pingSeq)
+	if s.pongWaiters == nil {
+		s.pongWaiters = make(map[string]chan struct{})
+	}
+	s.pongWaiters[string(token)] = pong
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.pongWaiters, string(token))
+		s.lock.Unlock()
+	}()
+
+	body := zmtp.PingBody(0, token)
+	for _, conn := range conns {
+		conn.outbox.push(&outgoing{frames: [][]byte{body}, command: pingCommand, priority: true})
+	}
+
+	select {
+	case <-pong:
+		return true
+	case <-changed:
+	case <-ctx.Done():
+	case <-s.done:
+	}
+	return false
+}
+
+// handlePong wakes up the WaitReady call
+// waiting for the PONG of msg, if any.
+func (s *Socket) handlePong(msg *zmtp.Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	token := string(firstFrame(msg))
+	if pong, ok := s.pongWaiters[token]; ok {
+		close(pong)
+		delete(s.pongWaiters, token)
+	}
+}
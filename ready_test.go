@@ -0,0 +1,82 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestWaitReady(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetAsyncConnect(true, 0)
+	client.SetBackoff(Backoff{Initial: 10 * time.Millisecond})
+	if err := client.Connect("tcp://127.0.0.1:19075"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if want, got := context.DeadlineExceeded, client.WaitReady(ctx, true); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("tcp://127.0.0.1:19075"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.WaitReady(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitReadySilentPeer(t *testing.T) {
+	ln, err := inprocTransport{}.Listen("ready-silent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the peer completes the handshake, then never reads
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		zmtp.NewConnection(conn).Prepare(zmtp.NewSecurityNull(), zmtp.ServerSocketType, nil, true, nil)
+		time.Sleep(time.Second)
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("inproc://ready-silent"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := client.WaitReady(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := context.DeadlineExceeded, client.WaitReady(ctx, true); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestWaitReadyClosed(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		client.Close()
+	}()
+	if want, got := ErrClosed, client.WaitReady(context.Background(), false); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
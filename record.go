@@ -0,0 +1,194 @@
+package gomq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// recordingMagic starts every recording.
+const recordingMagic = "GOMQREC\x01"
+
+// Record is a message received by a socket and
+// the time it was received, see Recorder.
+type Record struct {
+	Time    time.Time
+	Message [][]byte
+}
+
+// Recorder writes the messages received by a socket, with
+// the time they were received, to a recording that can be
+// replayed later with Replay. See Socket.SetRecorder.
+type Recorder struct {
+	lock sync.Mutex
+	w    *bufio.Writer
+	err  error
+}
+
+// NewRecorder returns a Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{w: bufio.NewWriter(w)}
+	_, r.err = r.w.WriteString(recordingMagic)
+	return r
+}
+
+// Record appends msg, received at t, to the recording.
+func (r *Recorder) Record(t time.Time, msg [][]byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(t.UnixNano()))
+	r.w.Write(buf[:])
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(msg)))
+	r.w.Write(buf[:4])
+	for _, frame := range msg {
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(frame)))
+		r.w.Write(buf[:4])
+		r.w.Write(frame)
+	}
+
+	// flush every record so that the recording
+	// is usable while it is still being written
+	r.err = r.w.Flush()
+	return r.err
+}
+
+// Err returns the first error that occurred while recording.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// SetRecorder makes the socket record every message it
+// receives to r, or stops recording if r is nil. Recording
+// errors are available from r.Err.
+func (s *Socket) SetRecorder(r *Recorder) {
+	s.lock.Lock()
+	s.recorder = r
+	s.lock.Unlock()
+}
+
+// record passes msg to the socket's recorder, if any.
+func (s *Socket) record(msg [][]byte) {
+	s.lock.RLock()
+	r := s.recorder
+	s.lock.RUnlock()
+
+	if r != nil {
+		r.Record(time.Now(), msg)
+	}
+}
+
+// RecordReader reads the records of a recording.
+type RecordReader struct {
+	r     *bufio.Reader
+	magic bool
+}
+
+// NewRecordReader returns a RecordReader reading from r.
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record. It returns io.EOF at the end
+// of the recording, including when the last record is cut
+// short because the recording was still being written.
+func (rr *RecordReader) Next() (Record, error) {
+	if !rr.magic {
+		var magic [len(recordingMagic)]byte
+		if _, err := io.ReadFull(rr.r, magic[:]); err != nil {
+			return Record{}, errors.New("gomq: not a recording")
+		}
+		if string(magic[:]) != recordingMagic {
+			return Record{}, errors.New("gomq: not a recording")
+		}
+		rr.magic = true
+	}
+
+	var buf [8]byte
+	if _, err := io.ReadFull(rr.r, buf[:]); err != nil {
+		return Record{}, io.EOF
+	}
+	rec := Record{Time: time.Unix(0, int64(binary.BigEndian.Uint64(buf[:])))}
+
+	if _, err := io.ReadFull(rr.r, buf[:4]); err != nil {
+		return Record{}, io.EOF
+	}
+	rec.Message = make([][]byte, binary.BigEndian.Uint32(buf[:4]))
+	for i := range rec.Message {
+		if _, err := io.ReadFull(rr.r, buf[:4]); err != nil {
+			return Record{}, io.EOF
+		}
+		rec.Message[i] = make([]byte, binary.BigEndian.Uint32(buf[:4]))
+		if _, err := io.ReadFull(rr.r, rec.Message[i]); err != nil {
+			return Record{}, io.EOF
+		}
+	}
+	return rec, nil
+}
+
+// ReplayOptions controls how Replay sends a recording.
+type ReplayOptions struct {
+	// Speed scales the pace of the recording: 1 replays
+	// it at its original pace, 2 twice as fast, and zero
+	// sends every message as fast as possible.
+	Speed float64
+
+	// Rewrite, if set, is applied to every message
+	// before it is sent.
+	Rewrite func(msg [][]byte) [][]byte
+}
+
+// Replay sends the messages of a recording through s,
+// keeping the intervals between them as set by opts.
+// Single frame messages are sent with Send, and others
+// with SendMultipart.
+func Replay(s ZeroMQSocket, rr *RecordReader, opts ReplayOptions) error {
+	var first time.Time
+	start := time.Now()
+
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if first.IsZero() {
+			first = rec.Time
+		}
+		if opts.Speed > 0 {
+			due := start.Add(time.Duration(float64(rec.Time.Sub(first)) / opts.Speed))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-baseOf(s).Done():
+				return ErrClosed
+			}
+		}
+
+		msg := rec.Message
+		if opts.Rewrite != nil {
+			msg = opts.Rewrite(msg)
+		}
+
+		if len(msg) == 1 {
+			err = s.Send(msg[0])
+		} else {
+			err = s.SendMultipart(msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
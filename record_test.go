@@ -0,0 +1,86 @@
+package gomq
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	var recording bytes.Buffer
+	recorder := NewRecorder(&recording)
+	server.SetRecorder(recorder)
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19030"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19030"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"HELLO", "WORLD"} {
+		if err := client.Send([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	server.SetRecorder(nil)
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := NewRecordReader(bytes.NewReader(recording.Bytes()))
+	first, err := rr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.Next(); err != io.EOF {
+		t.Errorf("want %v, got %v", io.EOF, err)
+	}
+	if gap := second.Time.Sub(first.Time); gap < 100*time.Millisecond {
+		t.Errorf("want at least 100ms between records, got %v", gap)
+	}
+
+	start := time.Now()
+	err = Replay(client, NewRecordReader(bytes.NewReader(recording.Bytes())), ReplayOptions{
+		Speed: 2,
+		Rewrite: func(msg [][]byte) [][]byte {
+			return [][]byte{bytes.ToLower(msg[0])}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("want replay at half the recorded pace, took %v", elapsed)
+	}
+
+	for _, want := range []string{"hello", "world"} {
+		msg, err := server.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
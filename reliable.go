@@ -0,0 +1,343 @@
+package gomq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// reliableAck is the command a ReliableSubscriber sends to
+// acknowledge the messages it received.
+const reliableAck = "ACK"
+
+// ErrMessagesLost is returned by ReliableSubscriber.RecvContext
+// when messages were missed that its ReliablePublisher no longer
+// keeps. The messages that follow are received as usual.
+var ErrMessagesLost = errors.New("gomq: messages lost")
+
+// ReliablePublisher publishes messages for ReliableSubscribers to
+// receive at least once. Each message is published on a PUB socket
+// followed by a frame holding its sequence number, and kept in a
+// bounded replay buffer. Subscribers acknowledge the messages they
+// received over a DEALER connected to a ROUTER socket, and those
+// they missed, such as dropped at a high water mark, are sent to
+// them again over it. Subscribers must be subscribed to every
+// message, and only become known to the publisher once they
+// acknowledged a first one.
+type ReliablePublisher struct {
+	pub      *PubSocket
+	acks     *RouterSocket
+	size     int
+	interval time.Duration
+
+	lock        sync.Mutex
+	seq         uint64
+	replay      []replayed
+	subscribers map[string]*reliablePeer
+}
+
+// replayed is a message kept for retransmission.
+type replayed struct {
+	seq uint64
+	at  time.Time
+	msg [][]byte
+}
+
+// reliablePeer is a subscriber known to a ReliablePublisher.
+type reliablePeer struct {
+	envelope [][]byte
+	acked    uint64
+	heard    time.Time
+}
+
+// NewReliablePublisher returns a ReliablePublisher publishing on
+// pub and receiving acknowledgements on acks, once Run is called.
+// It keeps the last size messages, and sends subscribers those
+// they did not acknowledge within interval. Both size and
+// interval must be positive.
+func NewReliablePublisher(pub *PubSocket, acks *RouterSocket, size int, interval time.Duration) (*ReliablePublisher, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("gomq: non-positive replay buffer size %v", size)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("gomq: non-positive acknowledgement interval %v", interval)
+	}
+	return &ReliablePublisher{
+		pub:         pub,
+		acks:        acks,
+		size:        size,
+		interval:    interval,
+		subscribers: make(map[string]*reliablePeer),
+	}, nil
+}
+
+// Send publishes b.
+func (p *ReliablePublisher) Send(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendMultipart publishes msg, which must not be
+// modified afterwards, as it is kept for retransmission.
+func (p *ReliablePublisher) SendMultipart(msg [][]byte) error {
+	if len(msg) == 0 {
+		return errNoFrames
+	}
+	return p.pub.SendMultipart(p.record(msg))
+}
+
+// record numbers msg and keeps it for retransmission,
+// dropping the oldest message kept if there are too many.
+// It returns msg followed by its sequence number.
+func (p *ReliablePublisher) record(msg [][]byte) [][]byte {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.seq++
+	numbered := append(append(make([][]byte, 0, len(msg)+1), msg...), reliableSeq(p.seq))
+	if len(p.replay) >= p.size {
+		p.replay = p.replay[1:]
+	}
+	p.replay = append(p.replay, replayed{seq: p.seq, at: time.Now(), msg: numbered})
+	return numbered
+}
+
+// Run receives acknowledgements and sends subscribers the messages
+// they missed until ctx is done or the ROUTER socket is closed, and
+// returns why. Subscribers not heard from for three intervals are
+// forgotten.
+func (p *ReliablePublisher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	acks := make(chan [][]byte)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := p.acks.RecvMultipartContext(ctx)
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case acks <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-acks:
+			p.ack(msg)
+		case now := <-ticker.C:
+			p.retransmit(now)
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+// ack records an acknowledgement, made of its envelope,
+// reliableAck and the sequence number of the last message
+// the subscriber received in order.
+func (p *ReliablePublisher) ack(msg [][]byte) {
+	n := len(msg) - 2
+	if n < 1 || string(msg[n]) != reliableAck || len(msg[n+1]) != 8 {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	peer := p.subscribers[string(msg[0])]
+	if peer == nil {
+		peer = &reliablePeer{envelope: msg[:n]}
+		p.subscribers[string(msg[0])] = peer
+	}
+	peer.acked = binary.BigEndian.Uint64(msg[n+1])
+	peer.heard = time.Now()
+}
+
+// retransmit sends each subscriber the messages published more
+// than an interval before now that it did not acknowledge. Those
+// no longer kept are reported with a message of the sequence
+// number of the oldest one kept alone.
+func (p *ReliablePublisher) retransmit(now time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for id, peer := range p.subscribers {
+		if now.Sub(peer.heard) > 3*p.interval {
+			delete(p.subscribers, id)
+			continue
+		}
+		if len(p.replay) > 0 && p.replay[0].seq > peer.acked+1 {
+			p.acks.SendMultipart(append(peer.envelope[:len(peer.envelope):len(peer.envelope)], reliableSeq(p.replay[0].seq)))
+		}
+		for _, r := range p.replay {
+			if r.seq > peer.acked && now.Sub(r.at) >= p.interval {
+				p.acks.SendMultipart(append(peer.envelope[:len(peer.envelope):len(peer.envelope)], r.msg...))
+			}
+		}
+	}
+}
+
+// reliableSeq encodes the sequence number of a message.
+func reliableSeq(seq uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	return b[:]
+}
+
+// delivery is a message, or an error, for
+// ReliableSubscriber.RecvContext to return.
+type delivery struct {
+	msg [][]byte
+	err error
+}
+
+// ReliableSubscriber receives the messages of a ReliablePublisher
+// at least once, in order, see ReliablePublisher. Messages sent
+// again are received only once, unless they were already returned
+// before a restart of the subscriber.
+type ReliableSubscriber struct {
+	sub      *SubSocket
+	acks     ZeroMQSocket
+	interval time.Duration
+
+	next       uint64
+	pending    map[uint64][][]byte
+	deliveries chan delivery
+}
+
+// NewReliableSubscriber returns a ReliableSubscriber receiving
+// messages on sub, which must be subscribed to every message,
+// and acknowledging them every interval on acks, a DEALER
+// connected to the publisher's ROUTER socket, once Run is called.
+// The interval must be positive.
+func NewReliableSubscriber(sub *SubSocket, acks ZeroMQSocket, interval time.Duration) (*ReliableSubscriber, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("gomq: non-positive acknowledgement interval %v", interval)
+	}
+	return &ReliableSubscriber{
+		sub:        sub,
+		acks:       acks,
+		interval:   interval,
+		pending:    make(map[uint64][][]byte),
+		deliveries: make(chan delivery),
+	}, nil
+}
+
+// RecvContext returns the next message, without its sequence
+// number, or ErrMessagesLost once if messages were lost before
+// it. It returns ctx.Err() if ctx is done first.
+func (s *ReliableSubscriber) RecvContext(ctx context.Context) ([][]byte, error) {
+	select {
+	case d := <-s.deliveries:
+		return d.msg, d.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Run receives messages, puts them back in order for RecvContext
+// and acknowledges those it returned until ctx is done or either
+// socket is closed, and returns why. A message is only
+// acknowledged once RecvContext returned it.
+func (s *ReliableSubscriber) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	received := make(chan [][]byte)
+	errc := make(chan error, 2)
+	for _, socket := range []ZeroMQSocket{s.sub, s.acks} {
+		go func(socket ZeroMQSocket) {
+			for {
+				msg, err := socket.RecvMultipartContext(ctx)
+				if err != nil {
+					errc <- err
+					return
+				}
+				select {
+				case received <- msg:
+				case <-ctx.Done():
+				}
+			}
+		}(socket)
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-received:
+			if err := s.receive(ctx, msg); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if s.next > 0 {
+				s.acks.SendMultipartContext(ctx, [][]byte{[]byte(reliableAck), reliableSeq(s.next - 1)})
+			}
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+// receive handles a message published or sent again, or a
+// report of lost messages, delivering those now in order.
+func (s *ReliableSubscriber) receive(ctx context.Context, msg [][]byte) error {
+	if len(msg) > 0 && len(msg[0]) == 0 {
+		msg = msg[1:] // the envelope delimiter
+	}
+	if len(msg) == 0 || len(msg[len(msg)-1]) != 8 {
+		return nil
+	}
+	seq := binary.BigEndian.Uint64(msg[len(msg)-1])
+
+	if len(msg) == 1 {
+		if seq <= s.next {
+			return nil
+		}
+		for lost := s.next; lost < seq; lost++ {
+			delete(s.pending, lost)
+		}
+		s.next = seq
+		if err := s.deliver(ctx, delivery{err: ErrMessagesLost}); err != nil {
+			return err
+		}
+	} else {
+		if s.next == 0 {
+			s.next = seq
+		}
+		if seq >= s.next {
+			s.pending[seq] = msg[:len(msg)-1]
+		}
+	}
+
+	for {
+		msg, ok := s.pending[s.next]
+		if !ok {
+			return nil
+		}
+		delete(s.pending, s.next)
+		if err := s.deliver(ctx, delivery{msg: msg}); err != nil {
+			return err
+		}
+		s.next++
+	}
+}
+
+// deliver waits for RecvContext to return d, or for ctx to be done.
+func (s *ReliableSubscriber) deliver(ctx context.Context, d delivery) error {
+	select {
+	case s.deliveries <- d:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
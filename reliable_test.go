@@ -0,0 +1,107 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestReliablePubSub(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if _, err := pub.Bind("inproc://reliable-pub"); err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+	if _, err := router.Bind("inproc://reliable-acks"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const interval = 10 * time.Millisecond
+	p, err := NewReliablePublisher(pub, router, 2, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Run(ctx)
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	sub.Subscribe(nil)
+	if err := sub.Connect("inproc://reliable-pub"); err != nil {
+		t.Fatal(err)
+	}
+	dealer := NewDealer(zmtp.NewSecurityNull(), "reliable")
+	defer dealer.Close()
+	if err := dealer.Connect("inproc://reliable-acks"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.WaitForSubscribers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewReliableSubscriber(sub, dealer, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run(ctx)
+
+	recv := func(want string) {
+		t.Helper()
+		msg, err := s.RecvContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(msg[0]); want != got || len(msg) != 1 {
+			t.Errorf("want %q, got %q", want, msg)
+		}
+	}
+
+	// a message lost on the way is sent again, in order
+	p.Send([]byte("1"))
+	recv("1")
+	p.record([][]byte{[]byte("2")})
+	p.Send([]byte("3"))
+	recv("2")
+	recv("3")
+
+	// messages no longer kept are reported lost
+	for _, b := range []string{"4", "5", "6"} {
+		p.record([][]byte{[]byte(b)})
+	}
+	p.Send([]byte("7"))
+	if _, err := s.RecvContext(ctx); err != ErrMessagesLost {
+		t.Errorf("want %v, got %v", ErrMessagesLost, err)
+	}
+	recv("6")
+	recv("7")
+
+	// messages sent again are received once
+	short, cancelShort := context.WithTimeout(ctx, 5*interval)
+	defer cancelShort()
+	if msg, err := s.RecvContext(short); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %q, %v", context.DeadlineExceeded, msg, err)
+	}
+}
+
+func TestReliableConfig(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	if _, err := NewReliablePublisher(pub, router, 0, time.Second); err == nil {
+		t.Error("want an error for an empty replay buffer")
+	}
+	if _, err := NewReliablePublisher(pub, router, 1, 0); err == nil {
+		t.Error("want an error for a zero interval")
+	}
+	if _, err := NewReliableSubscriber(sub, router, -time.Second); err == nil {
+		t.Error("want an error for a negative interval")
+	}
+}
@@ -0,0 +1,220 @@
+package gomq
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// RepSocket is a ZMQ_REP socket type. It alternates between
+// receiving a request and sending the reply to it, returning
+// ErrState when used out of turn. The envelope preceding a
+// request, up to its empty delimiter frame, is stripped and
+// sent back with the reply to the peer the request came from.
+// See: https://rfc.zeromq.org/spec:28
+type RepSocket struct {
+	*Socket
+	lock     sync.Mutex
+	replying bool
+	peer     string
+	envelope [][]byte
+}
+
+// NewRep accepts a zmtp.SecurityMechanism and
+// returns a RepSocket.
+func NewRep(mechanism zmtp.SecurityMechanism) *RepSocket {
+	return &RepSocket{
+		Socket: NewSocket(true, zmtp.RepSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// rep socket to it, over any registered transport.
+func (r *RepSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(r, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (r *RepSocket) ResumeListening(endpoint string) error {
+	return resumeListening(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// rep socket to it, over any registered transport.
+func (r *RepSocket) Connect(endpoint string) error {
+	return ConnectClient(r, endpoint)
+}
+
+// Recv receives a request.
+func (r *RepSocket) Recv() ([]byte, error) {
+	msg, _, err := r.recv(context.Background(), true)
+	if len(msg) == 0 {
+		return nil, err
+	}
+	return msg[0], err
+}
+
+// TryRecv is like Recv, but never blocks. It returns
+// ok == false if no request was available.
+func (r *RepSocket) TryRecv() ([]byte, bool, error) {
+	msg, ok, err := r.recv(context.Background(), false)
+	if len(msg) == 0 {
+		return nil, ok, err
+	}
+	return msg[0], ok, err
+}
+
+// TryRecvMultipart is like RecvMultipart, but never blocks.
+// It returns ok == false if no request was available.
+func (r *RepSocket) TryRecvMultipart() ([][]byte, bool, error) {
+	return r.recv(context.Background(), false)
+}
+
+// RecvMultipart receives a request with all of its frames.
+func (r *RepSocket) RecvMultipart() ([][]byte, error) {
+	msg, _, err := r.recv(context.Background(), true)
+	return msg, err
+}
+
+// RecvContext is like Recv, but gives up when ctx is done.
+func (r *RepSocket) RecvContext(ctx context.Context) ([]byte, error) {
+	msg, _, err := r.recv(ctx, true)
+	if len(msg) == 0 {
+		return nil, err
+	}
+	return msg[0], err
+}
+
+// RecvMultipartContext is like RecvMultipart, but gives
+// up when ctx is done.
+func (r *RepSocket) RecvMultipartContext(ctx context.Context) ([][]byte, error) {
+	msg, _, err := r.recv(ctx, true)
+	return msg, err
+}
+
+// recv receives a request, discarding messages without
+// a delimiter frame, and remembers where to reply.
+func (r *RepSocket) recv(ctx context.Context, block bool) ([][]byte, bool, error) {
+	r.lock.Lock()
+	replying := r.replying
+	r.lock.Unlock()
+	if replying {
+		return nil, false, ErrState
+	}
+
+	for {
+		msg, ok := r.next(ctx, block)
+		if !ok {
+			return nil, false, nil
+		}
+		if msg.Err != nil {
+			return nil, true, msg.Err
+		}
+
+		for i, frame := range msg.Body {
+			if len(frame) != 0 {
+				continue
+			}
+
+			r.lock.Lock()
+			r.replying = true
+			r.peer = msg.Peer
+			r.envelope = append([][]byte(nil), msg.Body[:i+1]...)
+			r.lock.Unlock()
+			return msg.Body[i+1:], true, nil
+		}
+	}
+}
+
+// Send sends the reply to the request received last.
+func (r *RepSocket) Send(b []byte) error {
+	return r.SendMultipart([][]byte{b})
+}
+
+// SendWith is like Send. Replies are always
+// queued right away, whatever the mode.
+func (r *RepSocket) SendWith(b []byte, mode SendMode) error {
+	return r.SendMultipart([][]byte{b})
+}
+
+// TrySend is like Send.
+func (r *RepSocket) TrySend(b []byte) error {
+	return r.SendMultipart([][]byte{b})
+}
+
+// TrySendMultipart is like SendMultipart.
+func (r *RepSocket) TrySendMultipart(b [][]byte) error {
+	return r.SendMultipart(b)
+}
+
+// SendMultipartWith is like SendMultipart.
+func (r *RepSocket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return r.SendMultipart(b)
+}
+
+// SendContext is like Send.
+func (r *RepSocket) SendContext(ctx context.Context, b []byte) error {
+	return r.SendMultipart([][]byte{b})
+}
+
+// SendMultipartContext is like SendMultipart.
+func (r *RepSocket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return r.SendMultipart(b)
+}
+
+// SendMultipart sends the reply to the request received last,
+// with one or more frames. It returns ErrState if no request
+// is waiting for a reply. Replies to peers that are gone go
+// to the dead letter handler.
+func (r *RepSocket) SendMultipart(b [][]byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.replying {
+		return ErrState
+	}
+	if err := r.validate(b, true); err != nil {
+		return err
+	}
+
+	r.sendTo(r.peer, append(r.envelope, b...))
+	r.replying = false
+	r.peer, r.envelope = "", nil
+	return nil
+}
+
+// SendTo returns ErrNotSupported, as it would
+// bypass the socket's send/receive lockstep.
+func (r *RepSocket) SendTo(string, []byte) error {
+	return ErrNotSupported
+}
+
+// RecvFrom returns ErrNotSupported, as it would
+// bypass the socket's send/receive lockstep.
+func (r *RepSocket) RecvFrom() (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// RecvFromContext returns ErrNotSupported.
+func (r *RepSocket) RecvFromContext(context.Context) (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// RecvMessage returns ErrNotSupported, as it would
+// bypass the socket's send/receive lockstep.
+func (r *RepSocket) RecvMessage() (*Message, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvMessageContext returns ErrNotSupported.
+func (r *RepSocket) RecvMessageContext(context.Context) (*Message, error) {
+	return nil, ErrNotSupported
+}
+
+var (
+	_ Client = (*RepSocket)(nil)
+	_ Server = (*RepSocket)(nil)
+)
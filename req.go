@@ -0,0 +1,225 @@
+package gomq
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// ReqSocket is a ZMQ_REQ socket type. It alternates between
+// sending a request and receiving its reply, returning
+// ErrState when used out of turn. Requests are preceded by
+// an empty delimiter frame, which is stripped from replies.
+// See: https://rfc.zeromq.org/spec:28
+type ReqSocket struct {
+	*Socket
+	lock     sync.Mutex
+	awaiting bool
+}
+
+// NewReq accepts a zmtp.SecurityMechanism and
+// returns a ReqSocket.
+func NewReq(mechanism zmtp.SecurityMechanism) *ReqSocket {
+	return &ReqSocket{
+		Socket: NewSocket(false, zmtp.ReqSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// req socket to it, over any registered transport.
+func (r *ReqSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(r, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (r *ReqSocket) ResumeListening(endpoint string) error {
+	return resumeListening(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// req socket to it, over any registered transport.
+func (r *ReqSocket) Connect(endpoint string) error {
+	return ConnectClient(r, endpoint)
+}
+
+// Send sends a request.
+func (r *ReqSocket) Send(b []byte) error {
+	return r.SendMultipartWith([][]byte{b}, SendDefault)
+}
+
+// SendWith is like Send, but uses mode instead of the
+// socket's send mode unless mode is SendDefault.
+func (r *ReqSocket) SendWith(b []byte, mode SendMode) error {
+	return r.SendMultipartWith([][]byte{b}, mode)
+}
+
+// TrySend is like Send, but never blocks. It returns
+// ErrWouldBlock if the request cannot be queued right away.
+func (r *ReqSocket) TrySend(b []byte) error {
+	return r.TrySendMultipart([][]byte{b})
+}
+
+// TrySendMultipart is like SendMultipart, but never blocks. It
+// returns ErrWouldBlock if the request cannot be queued right away.
+func (r *ReqSocket) TrySendMultipart(b [][]byte) error {
+	return wouldBlock(r.SendMultipartWith(b, SendDontWait))
+}
+
+// SendMultipart sends a request of one or more frames.
+func (r *ReqSocket) SendMultipart(b [][]byte) error {
+	return r.SendMultipartWith(b, SendDefault)
+}
+
+// SendMultipartWith is like SendMultipart, but uses mode instead
+// of the socket's send mode unless mode is SendDefault. It returns
+// ErrState if the reply to the previous request was not received.
+func (r *ReqSocket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return r.sendMultipart(context.Background(), b, mode)
+}
+
+// SendContext is like Send, but waits until the request
+// can be queued or ctx is done, whatever the send mode.
+func (r *ReqSocket) SendContext(ctx context.Context, b []byte) error {
+	return r.sendMultipart(ctx, [][]byte{b}, SendBlock)
+}
+
+// SendMultipartContext is like SendMultipart, but waits until
+// the request can be queued or ctx is done, whatever the send
+// mode.
+func (r *ReqSocket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return r.sendMultipart(ctx, b, SendBlock)
+}
+
+func (r *ReqSocket) sendMultipart(ctx context.Context, b [][]byte, mode SendMode) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.awaiting {
+		return ErrState
+	}
+	if err := r.Socket.sendMultipart(ctx, append([][]byte{nil}, b...), mode); err != nil {
+		return err
+	}
+	r.awaiting = true
+	return nil
+}
+
+// Recv receives the reply to the request sent last.
+func (r *ReqSocket) Recv() ([]byte, error) {
+	msg, _, err := r.recv(context.Background(), true)
+	if len(msg) == 0 {
+		return nil, err
+	}
+	return msg[0], err
+}
+
+// TryRecv is like Recv, but never blocks. It returns
+// ok == false if no reply was available.
+func (r *ReqSocket) TryRecv() ([]byte, bool, error) {
+	msg, ok, err := r.recv(context.Background(), false)
+	if len(msg) == 0 {
+		return nil, ok, err
+	}
+	return msg[0], ok, err
+}
+
+// TryRecvMultipart is like RecvMultipart, but never blocks.
+// It returns ok == false if no reply was available.
+func (r *ReqSocket) TryRecvMultipart() ([][]byte, bool, error) {
+	return r.recv(context.Background(), false)
+}
+
+// RecvMultipart receives the reply to the request sent
+// last with all of its frames.
+func (r *ReqSocket) RecvMultipart() ([][]byte, error) {
+	msg, _, err := r.recv(context.Background(), true)
+	return msg, err
+}
+
+// RecvContext is like Recv, but gives up when ctx is done.
+// The reply may still be received by calling it again.
+func (r *ReqSocket) RecvContext(ctx context.Context) ([]byte, error) {
+	msg, _, err := r.recv(ctx, true)
+	if len(msg) == 0 {
+		return nil, err
+	}
+	return msg[0], err
+}
+
+// RecvMultipartContext is like RecvMultipart, but gives
+// up when ctx is done, like RecvContext.
+func (r *ReqSocket) RecvMultipartContext(ctx context.Context) ([][]byte, error) {
+	msg, _, err := r.recv(ctx, true)
+	return msg, err
+}
+
+// recv receives a reply, discarding messages without
+// a leading delimiter frame. If receiving fails, such
+// as when the peer is lost, a new request may be sent,
+// unless it failed because ctx is done.
+func (r *ReqSocket) recv(ctx context.Context, block bool) ([][]byte, bool, error) {
+	r.lock.Lock()
+	awaiting := r.awaiting
+	r.lock.Unlock()
+	if !awaiting {
+		return nil, false, ErrState
+	}
+
+	for {
+		msg, ok := r.next(ctx, block)
+		if !ok {
+			return nil, false, nil
+		}
+		if msg.Err == nil && (len(msg.Body) == 0 || len(msg.Body[0]) != 0) {
+			continue
+		}
+		if err := ctx.Err(); err != nil && msg.Err == err {
+			return nil, true, err
+		}
+
+		r.lock.Lock()
+		r.awaiting = false
+		r.lock.Unlock()
+
+		if msg.Err != nil {
+			return nil, true, msg.Err
+		}
+		return msg.Body[1:], true, nil
+	}
+}
+
+// SendTo returns ErrNotSupported, as it would
+// bypass the socket's send/receive lockstep.
+func (r *ReqSocket) SendTo(string, []byte) error {
+	return ErrNotSupported
+}
+
+// RecvFrom returns ErrNotSupported, as it would
+// bypass the socket's send/receive lockstep.
+func (r *ReqSocket) RecvFrom() (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// RecvFromContext returns ErrNotSupported.
+func (r *ReqSocket) RecvFromContext(context.Context) (string, []byte, error) {
+	return "", nil, ErrNotSupported
+}
+
+// RecvMessage returns ErrNotSupported, as it would
+// bypass the socket's send/receive lockstep.
+func (r *ReqSocket) RecvMessage() (*Message, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvMessageContext returns ErrNotSupported.
+func (r *ReqSocket) RecvMessageContext(context.Context) (*Message, error) {
+	return nil, ErrNotSupported
+}
+
+var (
+	_ Client = (*ReqSocket)(nil)
+	_ Server = (*ReqSocket)(nil)
+)
@@ -0,0 +1,63 @@
+package gomq
+
+import (
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestReqRep(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+
+	go func() {
+		if _, err := rep.Bind("tcp://127.0.0.1:19044"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	if err := req.Connect("tcp://127.0.0.1:19044"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := req.Recv(); err != ErrState {
+		t.Errorf("want %v, got %v", ErrState, err)
+	}
+	if err := rep.Send([]byte("early")); err != ErrState {
+		t.Errorf("want %v, got %v", ErrState, err)
+	}
+
+	for _, request := range []string{"ping", "again"} {
+		if err := req.Send([]byte(request)); err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Send([]byte(request)); err != ErrState {
+			t.Errorf("want %v, got %v", ErrState, err)
+		}
+
+		msg, err := rep.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := request, string(msg); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+		if _, err := rep.Recv(); err != ErrState {
+			t.Errorf("want %v, got %v", ErrState, err)
+		}
+
+		if err := rep.Send([]byte(request + " reply")); err != nil {
+			t.Fatal(err)
+		}
+		msg, err = req.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := request+" reply", string(msg); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+}
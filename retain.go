@@ -0,0 +1,100 @@
+package gomq
+
+import (
+	"sort"
+	"sync"
+)
+
+// retention holds the last messages published
+// on each topic, see PubSocket.SetRetention.
+type retention struct {
+	lock   sync.Mutex
+	n      int
+	seq    uint64
+	topics map[string][]retained
+}
+
+// retained is a message retained on a topic, numbered
+// in the order messages were published.
+type retained struct {
+	seq    uint64
+	frames [][]byte
+}
+
+// SetRetention makes the socket keep the last n messages
+// published on each topic, the first frame of the messages,
+// and replay them, oldest first, to each peer subscribing to
+// a prefix of the topic, so that late subscribers catch up,
+// as for small control topics. A peer subscribing again, or
+// to overlapping prefixes, gets the messages again. Retention
+// costs memory for every topic ever published on. Zero, the
+// default, retains nothing.
+func (p *PubSocket) SetRetention(n int) {
+	p.retention.lock.Lock()
+	defer p.retention.lock.Unlock()
+
+	p.retention.n = n
+	for topic, msgs := range p.retention.topics {
+		if n <= 0 {
+			delete(p.retention.topics, topic)
+		} else if len(msgs) > n {
+			p.retention.topics[topic] = append([]retained(nil), msgs[len(msgs)-n:]...)
+		}
+	}
+}
+
+// retain keeps msg, dropping the oldest message
+// of its topic if it already has n of them.
+func (r *retention) retain(msg [][]byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.n <= 0 {
+		return
+	}
+	if r.topics == nil {
+		r.topics = make(map[string][]retained)
+	}
+
+	r.seq++
+	topic := string(msg[0])
+	msgs := r.topics[topic]
+	if len(msgs) >= r.n {
+		msgs = msgs[len(msgs)-r.n+1:]
+	}
+	r.topics[topic] = append(msgs, retained{seq: r.seq, frames: msg})
+}
+
+// matching returns the messages retained on the topics
+// starting with prefix, in the order they were published.
+func (r *retention) matching(prefix []byte) [][][]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var found []retained
+	for topic, msgs := range r.topics {
+		if len(topic) >= len(prefix) && topic[:len(prefix)] == string(prefix) {
+			found = append(found, msgs...)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].seq < found[j].seq })
+
+	frames := make([][][]byte, len(found))
+	for i, msg := range found {
+		frames[i] = msg.frames
+	}
+	return frames
+}
+
+// replay queues the messages retained on the topics starting
+// with prefix toward conn, which just subscribed to prefix, and
+// returns those dropped as conn's queue was full, for the dead
+// letter handler. The caller holds p.lock.
+func (p *PubSocket) replay(conn *Connection, prefix []byte) []DeadLetter {
+	var dropped []DeadLetter
+	for _, msg := range p.retention.matching(prefix) {
+		if _, full := conn.outbox.offer(&outgoing{frames: msg}); full {
+			dropped = append(dropped, DeadLetter{Reason: DropHighWaterMark, PeerID: conn.id, Endpoint: conn.endpoint, Message: msg, Err: ErrWouldBlock})
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,182 @@
+package gomq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// errNoRoutingID is returned when sending a ROUTER message
+// without the routing ID frame it must start with.
+var errNoRoutingID = errors.New("gomq: ROUTER messages start with a routing ID frame")
+
+// RouterSocket is a ZMQ_ROUTER socket type. Messages received
+// are preceded by a frame holding the routing ID of the peer
+// they came from, see PeerInfo.RoutingID, and messages sent
+// start with the routing ID of the peer to send them to, which
+// is stripped. As with libzmq, messages to unknown peers are
+// dropped, and reported to the dead letter handler.
+// See: https://rfc.zeromq.org/spec:28
+type RouterSocket struct {
+	*Socket
+}
+
+// NewRouter accepts a zmtp.SecurityMechanism and
+// returns a RouterSocket.
+func NewRouter(mechanism zmtp.SecurityMechanism) *RouterSocket {
+	return &RouterSocket{
+		Socket: NewSocket(true, zmtp.RouterSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// router socket to it, over any registered transport.
+func (r *RouterSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(r, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (r *RouterSocket) ResumeListening(endpoint string) error {
+	return resumeListening(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// router socket to it, over any registered transport.
+func (r *RouterSocket) Connect(endpoint string) error {
+	return ConnectClient(r, endpoint)
+}
+
+// Recv returns ErrNotSupported, as ROUTER
+// messages have at least two frames.
+func (r *RouterSocket) Recv() ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// RecvContext returns ErrNotSupported.
+func (r *RouterSocket) RecvContext(context.Context) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// TryRecv returns ErrNotSupported.
+func (r *RouterSocket) TryRecv() ([]byte, bool, error) {
+	return nil, false, ErrNotSupported
+}
+
+// RecvMultipart receives a message, preceded by the
+// routing ID of the peer it came from.
+func (r *RouterSocket) RecvMultipart() ([][]byte, error) {
+	msg, _, err := r.recv(context.Background(), true)
+	return msg, err
+}
+
+// RecvMultipartContext is like RecvMultipart, but gives
+// up when ctx is done.
+func (r *RouterSocket) RecvMultipartContext(ctx context.Context) ([][]byte, error) {
+	msg, _, err := r.recv(ctx, true)
+	return msg, err
+}
+
+// TryRecvMultipart is like RecvMultipart, but never blocks.
+// It returns ok == false if no message was available.
+func (r *RouterSocket) TryRecvMultipart() ([][]byte, bool, error) {
+	return r.recv(context.Background(), false)
+}
+
+// recv receives a message and prepends the routing ID of its
+// peer, skipping messages whose peer is already gone.
+func (r *RouterSocket) recv(ctx context.Context, block bool) ([][]byte, bool, error) {
+	for {
+		msg, ok := r.next(ctx, block)
+		if !ok {
+			return nil, false, nil
+		}
+		if msg.Err != nil {
+			return nil, true, msg.Err
+		}
+
+		r.lock.RLock()
+		conn := r.conns[msg.Peer]
+		r.lock.RUnlock()
+		if conn == nil {
+			continue
+		}
+		return append([][]byte{conn.routingID}, msg.Body...), true, nil
+	}
+}
+
+// Send returns ErrNotSupported, as ROUTER
+// messages have at least two frames.
+func (r *RouterSocket) Send([]byte) error {
+	return ErrNotSupported
+}
+
+// SendWith returns ErrNotSupported.
+func (r *RouterSocket) SendWith([]byte, SendMode) error {
+	return ErrNotSupported
+}
+
+// SendContext returns ErrNotSupported.
+func (r *RouterSocket) SendContext(context.Context, []byte) error {
+	return ErrNotSupported
+}
+
+// SendPriority returns ErrNotSupported.
+func (r *RouterSocket) SendPriority([]byte) error {
+	return ErrNotSupported
+}
+
+// TrySend returns ErrNotSupported.
+func (r *RouterSocket) TrySend([]byte) error {
+	return ErrNotSupported
+}
+
+// SendMultipart sends the frames following the first to the
+// peer whose routing ID is the first. It never blocks: messages
+// to unknown peers, or to peers whose outbox is full, go to the
+// dead letter handler.
+func (r *RouterSocket) SendMultipart(b [][]byte) error {
+	if len(b) < 2 {
+		return errNoRoutingID
+	}
+	if err := r.validate(b[1:], true); err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	id := ""
+	for _, conn := range r.conns {
+		if bytes.Equal(conn.routingID, b[0]) {
+			id = conn.id
+			break
+		}
+	}
+	r.lock.RUnlock()
+
+	r.sendTo(id, b[1:])
+	return nil
+}
+
+// SendMultipartWith is like SendMultipart. Messages
+// are always queued right away, whatever the mode.
+func (r *RouterSocket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return r.SendMultipart(b)
+}
+
+// SendMultipartContext is like SendMultipart.
+func (r *RouterSocket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return r.SendMultipart(b)
+}
+
+// TrySendMultipart is like SendMultipart.
+func (r *RouterSocket) TrySendMultipart(b [][]byte) error {
+	return r.SendMultipart(b)
+}
+
+var (
+	_ Client = (*RouterSocket)(nil)
+	_ Server = (*RouterSocket)(nil)
+)
@@ -0,0 +1,110 @@
+package gomq
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+	if _, err := router.Bind("inproc://router"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+	if err := req.Connect("inproc://router"); err != nil {
+		t.Fatal(err)
+	}
+	dealer := NewDealer(zmtp.NewSecurityNull(), "alice")
+	defer dealer.Close()
+	if err := dealer.Connect("inproc://router"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := req.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// routing ID, delimiter, body
+	if want, got := 3, len(msg); want != got {
+		t.Fatalf("want %v frames, got %v", want, got)
+	}
+	if want, got := "HELLO", string(msg[2]); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if err := router.SendMultipart([][]byte{msg[0], msg[1], []byte("WORLD")}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := req.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "WORLD", string(reply); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// peers announcing an identity are routed by it
+	if err := router.SendMultipart([][]byte{[]byte("alice"), []byte("HI")}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err = dealer.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HI", string(reply); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if err := router.Send([]byte("HI")); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("want %v, got %v", ErrNotSupported, err)
+	}
+	if err := router.SendMultipart([][]byte{[]byte("alice")}); err == nil {
+		t.Error("want an error for a message without body")
+	}
+}
+
+func TestIncompatibleSocketType(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+
+	failed := make(chan error, 1)
+	rep.SetEventHandler(func(ev SocketEvent) {
+		if ev.Type == EventHandshakeFailed {
+			select {
+			case failed <- ev.Err:
+			default:
+			}
+		}
+	})
+	if _, err := rep.Bind("inproc://incompatible"); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	pub.SetAsyncConnect(true, 0)
+	if err := pub.Connect("inproc://incompatible"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, zmtp.ErrIncompatibleSocketType) {
+			t.Errorf("want %v, got %v", zmtp.ErrIncompatibleSocketType, err)
+		}
+		if !strings.Contains(err.Error(), "REP sockets cannot talk to PUB sockets") {
+			t.Errorf("want the socket types in %q", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("PUB peer of a REP socket not rejected")
+	}
+}
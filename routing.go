@@ -0,0 +1,53 @@
+package gomq
+
+import (
+	"context"
+	"fmt"
+)
+
+// RecvFrom is like Recv, but also returns the ID of the
+// peer the message came from, as in PeerInfo.ID, so that
+// servers with many clients can reply with SendTo.
+func (s *Socket) RecvFrom() (peer string, b []byte, err error) {
+	return s.RecvFromContext(context.Background())
+}
+
+// RecvFromContext is like RecvFrom, but returns ctx.Err()
+// if ctx is done before a message arrives.
+func (s *Socket) RecvFromContext(ctx context.Context) (peer string, b []byte, err error) {
+	msg, _ := s.next(ctx, true)
+	return msg.Peer, firstFrame(msg), msg.Err
+}
+
+// SendTo queues a message to the peer with the given ID only,
+// as returned by RecvFrom, like ZMQ_SERVER sockets reply to
+// the routing ID of a request. It never blocks, and fails
+// with a *SendError wrapping ErrUnknownPeer if the socket
+// has no such peer, or ErrWouldBlock if the peer's outbox is
+// full, see SetSendHWM.
+func (s *Socket) SendTo(peer string, b []byte) error {
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	select {
+	case <-s.done:
+		return &SendError{Outcome: Dropped, Err: ErrClosed}
+	default:
+	}
+
+	conn := s.conns[peer]
+	if conn == nil {
+		return &SendError{Outcome: Dropped, Err: fmt.Errorf("%w: %q", ErrUnknownPeer, peer)}
+	}
+	switch ok, full := conn.outbox.offer(&outgoing{frames: [][]byte{b}}); {
+	case full:
+		return &SendError{Outcome: Dropped, Err: ErrWouldBlock}
+	case !ok:
+		return &SendError{Outcome: Dropped, Err: fmt.Errorf("%w: %q", ErrUnknownPeer, peer)}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSendTo(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://sendto"); err != nil {
+		t.Fatal(err)
+	}
+
+	clients := make(map[string]Client)
+	for _, name := range []string{"a", "b", "c"} {
+		client := NewClient(zmtp.NewSecurityNull())
+		defer client.Close()
+		if err := client.Connect("inproc://sendto"); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Send([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+		clients[name] = client
+	}
+
+	for range clients {
+		peer, msg, err := server.RecvFrom()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.SendTo(peer, append([]byte("re: "), msg...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, client := range clients {
+		msg, err := client.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := "re: "+name, string(msg); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+
+	if err := server.SendTo("nobody", []byte("x")); !errors.Is(err, ErrUnknownPeer) {
+		t.Errorf("want %v, got %v", ErrUnknownPeer, err)
+	}
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if want, got := ErrNotSupported, pub.SendTo("nobody", nil); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
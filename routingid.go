@@ -0,0 +1,38 @@
+package gomq
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
+
+// routingIDs hands out the routing IDs of peers the way
+// libzmq ROUTER sockets do, so that envelopes built by gomq
+// and libzmq brokers can be mixed: a peer announcing an
+// identity is routed by it, and an anonymous peer, announcing
+// an empty one, gets a zero byte followed by a 32-bit
+// big-endian counter starting at a random value. libzmq
+// reserves identities starting with a zero byte for these.
+type routingIDs struct {
+	next uint32
+}
+
+// newRoutingIDs returns routingIDs starting at a random value.
+func newRoutingIDs() *routingIDs {
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return &routingIDs{next: binary.BigEndian.Uint32(buf[:])}
+}
+
+// assign returns the routing ID of a peer announcing
+// identity. The caller holds the socket's lock.
+func (r *routingIDs) assign(identity []byte) []byte {
+	if len(identity) > 0 {
+		return append([]byte(nil), identity...)
+	}
+	id := make([]byte, 5)
+	binary.BigEndian.PutUint32(id[1:], r.next)
+	r.next++
+	return id
+}
@@ -0,0 +1,348 @@
+package gomq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rpcMagic starts the header frame of RPC messages.
+const rpcMagic = "\xffRPC"
+
+// Properties of RPC header frames.
+const (
+	rpcDeadline       = "Deadline"
+	rpcCorrelationID  = "Correlation-Id"
+	rpcIdempotencyKey = "Idempotency-Key"
+	rpcError          = "Error"
+)
+
+var errRPCHeader = errors.New("gomq: invalid RPC header")
+
+// RPCHeader is carried by the first frame of the requests and
+// replies of RPC over REQ, DEALER and REP sockets, following
+// the message's envelope. The frame starts with "\xffRPC",
+// followed by properties encoded as in the ZMTP handshake
+// metadata: a one byte name length, the name, a four byte
+// value length and the value. Unknown properties are ignored.
+type RPCHeader struct {
+	// Deadline is the time after which the caller no longer
+	// waits for the reply, sent as Unix milliseconds. It
+	// assumes the peers' clocks are reasonably in sync.
+	Deadline time.Time
+
+	// CorrelationID ties a reply to its request.
+	CorrelationID string
+
+	// IdempotencyKey is shared by the attempts of the same
+	// request, so that retries are only processed once.
+	IdempotencyKey string
+
+	// Error is set in the reply to a request that failed.
+	Error string
+}
+
+// NewRPCHeader returns the header of a request made within
+// ctx: its deadline is ctx's, and its correlation id new.
+func NewRPCHeader(ctx context.Context) (RPCHeader, error) {
+	id, err := newUUID()
+	if err != nil {
+		return RPCHeader{}, err
+	}
+	deadline, _ := ctx.Deadline()
+	return RPCHeader{Deadline: deadline, CorrelationID: id}, nil
+}
+
+// Expired reports whether the header's deadline,
+// if any, is before now.
+func (h RPCHeader) Expired(now time.Time) bool {
+	return !h.Deadline.IsZero() && h.Deadline.Before(now)
+}
+
+// Wrap returns a new message made of the header's frame and body.
+func (h RPCHeader) Wrap(body [][]byte) [][]byte {
+	frame := []byte(rpcMagic)
+	if !h.Deadline.IsZero() {
+		frame = appendRPCProperty(frame, rpcDeadline, strconv.FormatInt(h.Deadline.UnixMilli(), 10))
+	}
+	frame = appendRPCProperty(frame, rpcCorrelationID, h.CorrelationID)
+	frame = appendRPCProperty(frame, rpcIdempotencyKey, h.IdempotencyKey)
+	frame = appendRPCProperty(frame, rpcError, h.Error)
+
+	msg := make([][]byte, 0, 1+len(body))
+	msg = append(msg, frame)
+	return append(msg, body...)
+}
+
+func appendRPCProperty(frame []byte, name, value string) []byte {
+	if value == "" {
+		return frame
+	}
+	frame = append(frame, byte(len(name)))
+	frame = append(frame, name...)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(value)))
+	return append(frame, value...)
+}
+
+// ParseRPC splits msg, without its envelope, into its RPC
+// header and its body. A message without a header frame has
+// an empty header, and the whole of msg is the body.
+func ParseRPC(msg [][]byte) (RPCHeader, [][]byte, error) {
+	var h RPCHeader
+	if len(msg) == 0 || !bytes.HasPrefix(msg[0], []byte(rpcMagic)) {
+		return h, msg, nil
+	}
+
+	b := msg[0][len(rpcMagic):]
+	for len(b) > 0 {
+		n := int(b[0])
+		if len(b) < 1+n+4 {
+			return h, nil, errRPCHeader
+		}
+		name := string(b[1 : 1+n])
+		b = b[1+n:]
+		size := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint64(len(b)) < uint64(size) {
+			return h, nil, errRPCHeader
+		}
+		value := string(b[:size])
+		b = b[size:]
+
+		switch name {
+		case rpcDeadline:
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return h, nil, errRPCHeader
+			}
+			h.Deadline = time.UnixMilli(ms)
+		case rpcCorrelationID:
+			h.CorrelationID = value
+		case rpcIdempotencyKey:
+			h.IdempotencyKey = value
+		case rpcError:
+			h.Error = value
+		}
+	}
+	return h, msg[1:], nil
+}
+
+// RPCHandler processes a request, within a ctx that is done
+// at the request's deadline, and returns the reply.
+type RPCHandler func(ctx context.Context, h RPCHeader, request [][]byte) ([][]byte, error)
+
+// RPCServer serves the requests received on a REP socket.
+// Requests whose deadline passed are dropped unanswered
+// before being processed, and go to the socket's dead letter
+// handler, so that an overloaded server does not spend its
+// time on requests nobody waits for anymore.
+type RPCServer struct {
+	Handler RPCHandler
+
+	// Replays is the number of replies kept by idempotency
+	// key, so that retried requests get the reply to their
+	// first attempt without being processed again.
+	Replays int
+
+	// Workers is the number of requests handled concurrently,
+	// one if zero. The handler must be safe for concurrent
+	// use if there are more.
+	Workers int
+
+	// Admission, if set, sheds requests when
+	// the server is overloaded.
+	Admission *AdmissionPolicy
+
+	// Priorities, if set, sorts requests into classes, each
+	// queued separately and served in proportion to its weight,
+	// so that bulk traffic saturating the workers does not hold
+	// up control requests. A request is in the first class it
+	// matches, or else in a class of weight one. Each class
+	// queues up to the admission policy's MaxQueue requests,
+	// or as many as there are workers if it has none, in which
+	// case receiving waits while the request's class is full.
+	Priorities []PriorityClass
+
+	served, expired, shed uint64
+	latency               int64 // moving average, in nanoseconds
+	busy                  int32 // workers handling a request
+
+	lock    sync.Mutex
+	replies map[string][][]byte
+	keys    []string
+}
+
+// rpcCall is a request received by an RPCServer.
+type rpcCall struct {
+	peer     string
+	envelope [][]byte
+	msg      [][]byte
+}
+
+// Serve answers the requests received on r until ctx is done
+// or r is closed, then waits for the requests being handled.
+// Each reply carries the correlation id and the idempotency
+// key of its request, along with the handler's error, if any.
+// Serve receives from and replies on r on its own, so r must
+// not otherwise be used while it is served.
+func (srv *RPCServer) Serve(ctx context.Context, r *RepSocket) error {
+	workers := srv.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queueSize := 0
+	if srv.Admission != nil {
+		queueSize = srv.Admission.MaxQueue
+	}
+	queue := make(chan rpcCall, queueSize)
+	next := func() (rpcCall, bool) {
+		call, ok := <-queue
+		return call, ok
+	}
+	var sched *rpcScheduler
+	if len(srv.Priorities) > 0 {
+		if queueSize == 0 {
+			queueSize = workers
+		}
+		sched = newRPCScheduler(srv.Priorities, queueSize)
+		next = sched.pop
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for call, ok := next(); ok; call, ok = next() {
+				if ctx.Err() == nil {
+					atomic.AddInt32(&srv.busy, 1)
+					srv.serve(ctx, r, call)
+					atomic.AddInt32(&srv.busy, -1)
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	if sched != nil {
+		defer sched.close()
+		stop := context.AfterFunc(ctx, sched.close)
+		defer stop()
+	} else {
+		defer close(queue)
+	}
+
+	for {
+		msg, _ := r.next(ctx, true)
+		if msg.Err == ErrClosed || msg.Err != nil && msg.Err == ctx.Err() {
+			return msg.Err
+		}
+		if msg.Err != nil {
+			continue
+		}
+
+		i := 0
+		for i < len(msg.Body) && len(msg.Body[i]) != 0 {
+			i++
+		}
+		if i == len(msg.Body) {
+			continue
+		}
+		call := rpcCall{
+			peer:     msg.Peer,
+			envelope: msg.Body[: i+1 : i+1],
+			msg:      msg.Body[i+1:],
+		}
+		var err error
+		if sched != nil {
+			err = srv.schedule(ctx, r, call, sched, workers)
+		} else {
+			err = srv.enqueue(ctx, r, call, queue, workers)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// serve handles call, received on r, and replies to it.
+func (srv *RPCServer) serve(ctx context.Context, r *RepSocket, call rpcCall) {
+	h, request, err := ParseRPC(call.msg)
+	var reply [][]byte
+	switch {
+	case err != nil:
+		reply = RPCHeader{Error: err.Error()}.Wrap(nil)
+	case h.Expired(time.Now()):
+		atomic.AddUint64(&srv.expired, 1)
+		r.deadLetter(DeadLetter{Reason: DropExpired, PeerID: call.peer, Message: call.msg})
+		return
+	default:
+		var ok bool
+		if reply, ok = srv.replay(h.IdempotencyKey); !ok {
+			reply = srv.handle(ctx, h, request)
+			srv.keep(h.IdempotencyKey, reply)
+		}
+	}
+
+	atomic.AddUint64(&srv.served, 1)
+	r.sendTo(call.peer, append(call.envelope, reply...))
+}
+
+// replay returns the reply kept for key, if any.
+func (srv *RPCServer) replay(key string) ([][]byte, bool) {
+	if key == "" {
+		return nil, false
+	}
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	reply, ok := srv.replies[key]
+	return reply, ok
+}
+
+// keep keeps reply for key, forgetting the oldest reply
+// kept once there are more than Replays of them.
+func (srv *RPCServer) keep(key string, reply [][]byte) {
+	if key == "" || srv.Replays <= 0 {
+		return
+	}
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.replies == nil {
+		srv.replies = make(map[string][][]byte)
+	}
+	if _, ok := srv.replies[key]; ok {
+		return
+	}
+	if len(srv.keys) == srv.Replays {
+		delete(srv.replies, srv.keys[0])
+		srv.keys = srv.keys[1:]
+	}
+	srv.replies[key] = reply
+	srv.keys = append(srv.keys, key)
+}
+
+// handle passes the request with header h to the handler
+// and returns the reply, header included.
+func (srv *RPCServer) handle(ctx context.Context, h RPCHeader, request [][]byte) [][]byte {
+	if !h.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, h.Deadline)
+		defer cancel()
+	}
+
+	start := time.Now()
+	body, err := srv.Handler(ctx, h, request)
+	srv.observeLatency(time.Since(start))
+
+	rh := RPCHeader{CorrelationID: h.CorrelationID, IdempotencyKey: h.IdempotencyKey}
+	if err != nil {
+		rh.Error = err.Error()
+		body = nil
+	}
+	return rh.Wrap(body)
+}
@@ -0,0 +1,143 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestRPCHeader(t *testing.T) {
+	h := RPCHeader{
+		Deadline:       time.UnixMilli(1700000000123),
+		CorrelationID:  "42",
+		IdempotencyKey: "order-7",
+	}
+	parsed, body, err := ParseRPC(h.Wrap([][]byte{[]byte("body")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Deadline.Equal(h.Deadline) {
+		t.Errorf("want %v, got %v", h.Deadline, parsed.Deadline)
+	}
+	parsed.Deadline = h.Deadline
+	if want, got := h, parsed; want != got {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+	if want, got := [][]byte{[]byte("body")}, body; !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	plain := [][]byte{[]byte("no header")}
+	if parsed, body, err := ParseRPC(plain); err != nil || parsed != (RPCHeader{}) || len(body) != 1 {
+		t.Errorf("want the whole message as body, got %+v, %q, %v", parsed, body, err)
+	}
+	if _, _, err := ParseRPC([][]byte{[]byte(rpcMagic + "\x08Deadl")}); err != errRPCHeader {
+		t.Errorf("want %v, got %v", errRPCHeader, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	h, err = NewRPCHeader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.CorrelationID == "" || h.Expired(time.Now()) || !h.Expired(time.Now().Add(2*time.Minute)) {
+		t.Errorf("want a correlation id and the context's deadline, got %+v", h)
+	}
+}
+
+func TestRPCServer(t *testing.T) {
+	endpoint := "inproc://test-rpc"
+
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	if _, err := rep.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	expired := make(chan DeadLetter, 1)
+	rep.SetDeadLetterHandler(func(letter DeadLetter) {
+		expired <- letter
+	})
+
+	calls := 0
+	srv := &RPCServer{
+		Handler: func(ctx context.Context, h RPCHeader, request [][]byte) ([][]byte, error) {
+			calls++
+			if string(request[0]) == "fail" {
+				return nil, errors.New("failed")
+			}
+			return [][]byte{[]byte("re: " + string(request[0]))}, nil
+		},
+		Replays: 4,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, rep)
+
+	dealer := NewDealer(zmtp.NewSecurityNull(), "")
+	defer dealer.Close()
+	if err := dealer.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(h RPCHeader, request string) (RPCHeader, string) {
+		t.Helper()
+		if err := dealer.SendMultipart(h.Wrap([][]byte{[]byte(request)})); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := dealer.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, msg = Unwrap(msg)
+		rh, body, err := ParseRPC(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) == 0 {
+			return rh, ""
+		}
+		return rh, string(body[0])
+	}
+
+	// The expired request is dropped, so the first reply
+	// is the one to the second request.
+	late := RPCHeader{Deadline: time.Now().Add(-time.Second), CorrelationID: "1"}
+	if err := dealer.SendMultipart(late.Wrap([][]byte{[]byte("late")})); err != nil {
+		t.Fatal(err)
+	}
+	rh, reply := call(RPCHeader{CorrelationID: "2"}, "ping")
+	if want, got := "2", rh.CorrelationID; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "re: ping", reply; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	select {
+	case letter := <-expired:
+		if want, got := DropExpired, letter.Reason; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Error("expired request not reported")
+	}
+
+	for i := 0; i < 2; i++ {
+		rh, reply = call(RPCHeader{CorrelationID: "3", IdempotencyKey: "once"}, "pay")
+		if want, got := "re: pay", reply; want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+	if want, got := 2, calls; want != got {
+		t.Errorf("want %d calls, got %d", want, got)
+	}
+
+	rh, _ = call(RPCHeader{CorrelationID: "4"}, "fail")
+	if want, got := "failed", rh.Error; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,96 @@
+package gomq
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SchemaValidator checks message payloads against a schema,
+// such as protobuf descriptors or a JSON Schema fetched from
+// a schema registry. Validate should return nil for valid
+// messages.
+type SchemaValidator interface {
+	Validate(msg [][]byte) error
+}
+
+// SchemaValidatorFunc adapts a function to a SchemaValidator.
+type SchemaValidatorFunc func(msg [][]byte) error
+
+// Validate returns f(msg).
+func (f SchemaValidatorFunc) Validate(msg [][]byte) error {
+	return f(msg)
+}
+
+// ValidationPolicy selects what a socket does with
+// messages its schema validator finds invalid.
+type ValidationPolicy int
+
+const (
+	// ValidationReject fails sending invalid messages with a
+	// *ValidationError, and discards invalid messages received.
+	ValidationReject ValidationPolicy = iota
+
+	// ValidationReport lets invalid messages through, only
+	// counting them, see InvalidMessages.
+	ValidationReport
+)
+
+// ValidationError is returned when sending a message
+// rejected by the socket's schema validator.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("gomq: invalid message: %v", e.Err)
+}
+
+// Unwrap returns the validator's error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SetSchemaValidator sets the validator applied to messages
+// sent and received by the socket, and the policy applied to
+// invalid ones. A nil validator disables validation.
+func (s *Socket) SetSchemaValidator(v SchemaValidator, policy ValidationPolicy) {
+	s.lock.Lock()
+	s.validator = v
+	s.validationPolicy = policy
+	s.lock.Unlock()
+}
+
+// InvalidMessages returns how many messages sent and received
+// by the socket its schema validator found invalid, whether
+// they were rejected or not.
+func (s *Socket) InvalidMessages() (sent, received uint64) {
+	return atomic.LoadUint64(&s.invalidSent), atomic.LoadUint64(&s.invalidReceived)
+}
+
+// validate checks msg with the socket's validator, if any. It
+// returns a *ValidationError if the message must be rejected.
+func (s *Socket) validate(msg [][]byte, sending bool) error {
+	s.lock.RLock()
+	v, policy := s.validator, s.validationPolicy
+	s.lock.RUnlock()
+
+	if v == nil {
+		return nil
+	}
+
+	err := v.Validate(msg)
+	if err == nil {
+		return nil
+	}
+
+	if sending {
+		atomic.AddUint64(&s.invalidSent, 1)
+	} else {
+		atomic.AddUint64(&s.invalidReceived, 1)
+	}
+
+	if policy == ValidationReport {
+		return nil
+	}
+	return &ValidationError{Err: err}
+}
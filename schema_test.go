@@ -0,0 +1,66 @@
+package gomq
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+var jsonValidator = SchemaValidatorFunc(func(msg [][]byte) error {
+	for _, frame := range msg {
+		if !json.Valid(frame) {
+			return errors.New("not JSON")
+		}
+	}
+	return nil
+})
+
+func TestSchemaValidator(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetSchemaValidator(jsonValidator, ValidationReject)
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19017"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetSchemaValidator(jsonValidator, ValidationReport)
+
+	if err := client.Connect("tcp://127.0.0.1:19017"); err != nil {
+		t.Fatal(err)
+	}
+
+	// reported by the client, rejected by the server
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send([]byte(`"HELLO"`)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := `"HELLO"`, string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if sent, _ := client.InvalidMessages(); sent != 1 {
+		t.Errorf("want 1 invalid message sent, got %v", sent)
+	}
+	if _, received := server.InvalidMessages(); received != 1 {
+		t.Errorf("want 1 invalid message received, got %v", received)
+	}
+
+	var validationErr *ValidationError
+	if err := server.Send([]byte("WORLD")); !errors.As(err, &validationErr) {
+		t.Errorf("want ValidationError, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package gomq
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// Case is a single case of a Select. Exactly one of
+// Socket and Timer should be set.
+type Case struct {
+	// Socket makes the case ready when a message
+	// can be received from the socket.
+	Socket ZeroMQSocket
+
+	// Timer makes the case ready when a value can be
+	// received from it, such as a time.Ticker's C.
+	Timer <-chan time.Time
+}
+
+// selectable is implemented by sockets embedding *Socket,
+// which Select receives from like their TryRecvMultipart.
+type selectable interface {
+	pollable
+	TryRecvMultipart() ([][]byte, bool, error)
+}
+
+// Select waits until one of the cases is ready, or until
+// timeout has passed. It returns the index of the ready case
+// and, for socket cases, the message received from the socket
+// along with its error. Messages are received as the socket's
+// own receive calls do, so that REQ and REP sockets strip
+// their delimiters, schema validators reject messages and so
+// on. A negative timeout waits forever. ErrTimeout is returned,
+// with an index of -1, on timeout.
+func Select(cases []Case, timeout time.Duration) (int, [][]byte, error) {
+	selectCases := make([]reflect.SelectCase, 0, len(cases)+1)
+	for _, c := range cases {
+		var ch reflect.Value
+		switch {
+		case c.Socket != nil:
+			if _, ok := c.Socket.(selectable); !ok {
+				return -1, nil, errNotPollable
+			}
+			ch = reflect.ValueOf(c.Socket.RecvChannel())
+		case c.Timer != nil:
+			ch = reflect.ValueOf(c.Timer)
+		default:
+			return -1, nil, errors.New("gomq: select case has neither a socket nor a timer")
+		}
+		selectCases = append(selectCases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: ch})
+	}
+
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		selectCases = append(selectCases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	}
+
+	for {
+		// a message a Poller kept is received first
+		for i, c := range cases {
+			if s, ok := c.Socket.(selectable); ok && s.readable() {
+				if msg, ok, err := s.TryRecvMultipart(); ok || err != nil {
+					return i, msg, err
+				}
+			}
+		}
+
+		i, v, _ := reflect.Select(selectCases)
+		if i == len(cases) {
+			return -1, nil, ErrTimeout
+		}
+		s, ok := cases[i].Socket.(selectable)
+		if !ok {
+			return i, nil, nil
+		}
+		// the message is handed back to the socket's receive
+		// path, which may skip it, such as when it is invalid
+		s.unread(v.Interface().(*zmtp.Message))
+		if msg, ok, err := s.TryRecvMultipart(); ok || err != nil {
+			return i, msg, err
+		}
+	}
+}
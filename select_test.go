@@ -0,0 +1,100 @@
+package gomq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSelect(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19011"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19011"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []Case{{Socket: client}, {Socket: server}}
+	if i, _, err := Select(cases, 10*time.Millisecond); i != -1 || err != ErrTimeout {
+		t.Fatalf("want timeout, got case %v and %v", i, err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+
+	i, msg, err := Select(cases, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, i; want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := "HELLO", string(msg[0]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	i, _, err = Select(append(cases, Case{Timer: ticker.C}), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, i; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestSelectReceivePath(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	if _, err := rep.Bind("inproc://select-rep"); err != nil {
+		t.Fatal(err)
+	}
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+	if err := req.Connect("inproc://select-rep"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the REP socket strips the envelope, then takes its turn
+	if err := req.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := Select([]Case{{Socket: rep}}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "[HELLO]", fmt.Sprintf("%s", msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if err := rep.Send([]byte("WORLD")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a message a Poller kept is selected
+	var poller Poller
+	poller.Add(req, PollIn)
+	if _, err := poller.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err = Select([]Case{{Socket: req}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "[WORLD]", fmt.Sprintf("%s", msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
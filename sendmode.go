@@ -0,0 +1,64 @@
+package gomq
+
+import "fmt"
+
+// SendMode selects what sending a message does when the
+// message cannot be queued to a peer right away, such as
+// when the socket has no connected peers.
+type SendMode int
+
+const (
+	// SendDefault uses the socket's send mode. It is
+	// only meaningful when passed to SendWith.
+	SendDefault SendMode = iota
+
+	// SendBlock waits until the message can be queued,
+	// or the socket is closed.
+	SendBlock
+
+	// SendDrop silently discards the message.
+	SendDrop
+
+	// SendDontWait returns a *SendError right away,
+	// like ZMQ_DONTWAIT. This is the default.
+	SendDontWait
+)
+
+func (m SendMode) String() string {
+	switch m {
+	case SendDefault:
+		return "default"
+	case SendBlock:
+		return "block"
+	case SendDrop:
+		return "drop"
+	case SendDontWait:
+		return "dontwait"
+	}
+	return fmt.Sprintf("SendMode(%d)", int(m))
+}
+
+// modalSender is implemented by sockets whose
+// sends can be made with a given SendMode.
+type modalSender interface {
+	SendWith([]byte, SendMode) error
+	SendMultipartWith([][]byte, SendMode) error
+}
+
+// sendWith sends b on s with mode, or
+// with Send if s does not take a mode.
+func sendWith(s ZeroMQSocket, b []byte, mode SendMode) error {
+	if m, ok := s.(modalSender); ok {
+		return m.SendWith(b, mode)
+	}
+	return s.Send(b)
+}
+
+// sendMultipartWith sends msg on s with mode, or
+// with SendMultipart if s does not take a mode.
+func sendMultipartWith(s ZeroMQSocket, msg [][]byte, mode SendMode) error {
+	if m, ok := s.(modalSender); ok {
+		return m.SendMultipartWith(msg, mode)
+	}
+	return s.SendMultipart(msg)
+}
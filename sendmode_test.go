@@ -0,0 +1,162 @@
+package gomq
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSendMode(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	var sendErr *SendError
+	if err := client.Send([]byte("HELLO")); !errors.As(err, &sendErr) || sendErr.Err != ErrNoPeers {
+		t.Fatalf("want ErrNoPeers, got %v", err)
+	}
+
+	client.SetSendMode(SendDrop)
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatalf("want message dropped silently, got %v", err)
+	}
+
+	if err := client.SendWith([]byte("HELLO"), SendDontWait); !errors.As(err, &sendErr) || sendErr.Err != ErrNoPeers {
+		t.Fatalf("want ErrNoPeers, got %v", err)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	sent := make(chan error)
+	go func() {
+		sent <- client.SendWith([]byte("HELLO"), SendBlock)
+	}()
+
+	select {
+	case err := <-sent:
+		t.Fatalf("blocking send returned before a peer connected: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19009"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := client.Connect("tcp://127.0.0.1:19009"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestTrySendTryRecv(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if want, got := ErrWouldBlock, client.TrySend([]byte("HELLO")); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	if _, ok, err := client.TryRecv(); ok || err != nil {
+		t.Fatalf("want nothing received, got ok=%v err=%v", ok, err)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19010"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := client.Connect("tcp://127.0.0.1:19010"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.TrySend([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; ; i++ {
+		msg, ok, err := server.TryRecv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			if want, got := "HELLO", string(msg); want != got {
+				t.Errorf("want %q, got %q", want, got)
+			}
+			break
+		}
+		if i == 100 {
+			t.Fatal("no message received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTryMultipart(t *testing.T) {
+	endpoint := "inproc://test-try-multipart"
+
+	dealer := NewDealer(zmtp.NewSecurityNull(), "")
+	defer dealer.Close()
+	request := [][]byte{[]byte("A"), []byte("B")}
+	if want, got := ErrWouldBlock, dealer.TrySendMultipart(request); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	if _, err := rep.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := rep.TryRecvMultipart(); ok || err != nil {
+		t.Fatalf("want nothing received, got ok=%v err=%v", ok, err)
+	}
+
+	if err := dealer.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	dealer.SetSendHWM(1)
+	dealer.SetFrozen(true)
+	if err := dealer.TrySendMultipart(request); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ErrWouldBlock, dealer.TrySendMultipart(request); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	dealer.SetFrozen(false)
+
+	for i := 0; ; i++ {
+		msg, ok, err := rep.TryRecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			if want, got := "A B", string(bytes.Join(msg, []byte(" "))); want != got {
+				t.Errorf("want %q, got %q", want, got)
+			}
+			break
+		}
+		if i == 100 {
+			t.Fatal("no message received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
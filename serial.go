@@ -0,0 +1,252 @@
+//go:build linux
+
+package gomq
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// serialBauds maps the baud rates serial:// links
+// support to their termios speeds.
+var serialBauds = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+	460800: syscall.B460800,
+	921600: syscall.B921600,
+}
+
+// serialBaudMask covers the speed bits of a termios Cflag,
+// all of which are set for the highest speed.
+const serialBaudMask = syscall.B4000000
+
+func init() {
+	RegisterTransport(serialTransport{})
+}
+
+// serialTransport carries ZMTP over serial links, such as UARTs
+// bridging field devices. Its address is the path of the serial
+// device, optionally followed by query parameters configuring
+// the line: baud (default 115200), parity (none, even or odd,
+// default none) and stopbits (1 or 2, default 1), as in
+// "serial:///dev/ttyUSB0?baud=9600&parity=even". Frames are
+// sent as 8 bit bytes without flow control.
+//
+// A serial link joins exactly two peers, so either end may
+// Connect or Bind. A bound device yields one connection at a
+// time, reopened once the previous connection is closed.
+type serialTransport struct{}
+
+func (serialTransport) Scheme() string { return "serial" }
+
+func (serialTransport) ValidateAddress(address string) error {
+	_, _, err := parseSerialAddress(address)
+	return err
+}
+
+func (serialTransport) Dial(address string) (net.Conn, error) {
+	path, config, err := parseSerialAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return openSerial(path, config, nil)
+}
+
+func (serialTransport) Listen(address string) (net.Listener, error) {
+	path, config, err := parseSerialAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	l := &serialListener{
+		path:   path,
+		config: config,
+		free:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	l.free <- struct{}{}
+	return l, nil
+}
+
+// serialConfig is the line configuration of a serial link.
+type serialConfig struct {
+	baud     int
+	parity   string
+	stopBits int
+}
+
+// parseSerialAddress splits a serial:// address into
+// the device path and the line configuration.
+func parseSerialAddress(address string) (string, serialConfig, error) {
+	config := serialConfig{baud: 115200, parity: "none", stopBits: 1}
+
+	path, query, _ := strings.Cut(address, "?")
+	if path == "" {
+		return "", config, fmt.Errorf("gomq: serial address %q has no device", address)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", config, fmt.Errorf("gomq: invalid serial address %q: %v", address, err)
+	}
+
+	for name, values := range params {
+		value := values[len(values)-1]
+		switch name {
+		case "baud":
+			config.baud, err = strconv.Atoi(value)
+			if _, ok := serialBauds[config.baud]; err != nil || !ok {
+				return "", config, fmt.Errorf("gomq: unsupported serial baud rate %q", value)
+			}
+		case "parity":
+			if value != "none" && value != "even" && value != "odd" {
+				return "", config, fmt.Errorf("gomq: unsupported serial parity %q", value)
+			}
+			config.parity = value
+		case "stopbits":
+			if value != "1" && value != "2" {
+				return "", config, fmt.Errorf("gomq: unsupported serial stop bits %q", value)
+			}
+			config.stopBits, _ = strconv.Atoi(value)
+		default:
+			return "", config, fmt.Errorf("gomq: unknown serial parameter %q", name)
+		}
+	}
+	return path, config, nil
+}
+
+// openSerial opens the device at path in raw mode, configured
+// with config. Closing the connection calls release, if set.
+func openSerial(path string, config serialConfig, release func()) (net.Conn, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := configureSerial(f, config); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("gomq: configuring serial device %v: %v", path, err)
+	}
+	return &serialConn{File: f, addr: serialAddr(path), release: release}, nil
+}
+
+// configureSerial puts the line of f in raw mode with
+// the speed, parity and stop bits of config.
+func configureSerial(f *os.File, config serialConfig) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		var t syscall.Termios
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+		if errno != 0 {
+			return
+		}
+
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+			syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF | syscall.INPCK
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		t.Cflag &^= serialBaudMask | syscall.CSIZE | syscall.PARENB | syscall.PARODD | syscall.CSTOPB
+		t.Cflag |= serialBauds[config.baud] | syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+
+		switch config.parity {
+		case "even":
+			t.Cflag |= syscall.PARENB
+			t.Iflag |= syscall.INPCK
+		case "odd":
+			t.Cflag |= syscall.PARENB | syscall.PARODD
+			t.Iflag |= syscall.INPCK
+		}
+		if config.stopBits == 2 {
+			t.Cflag |= syscall.CSTOPB
+		}
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// serialAddr is the address of either end of a serial link.
+type serialAddr string
+
+func (a serialAddr) Network() string { return "serial" }
+func (a serialAddr) String() string  { return string(a) }
+
+// serialConn is a serial link as a net.Conn. Deadlines are
+// those of the device file, which the runtime poller handles.
+type serialConn struct {
+	*os.File
+	addr    serialAddr
+	release func()
+	once    sync.Once
+}
+
+func (c *serialConn) Close() error {
+	err := c.File.Close()
+	c.once.Do(func() {
+		if c.release != nil {
+			c.release()
+		}
+	})
+	return err
+}
+
+func (c *serialConn) LocalAddr() net.Addr  { return c.addr }
+func (c *serialConn) RemoteAddr() net.Addr { return c.addr }
+
+// serialListener opens its device for each Accept, once
+// the connection it previously returned is closed.
+type serialListener struct {
+	path   string
+	config serialConfig
+	free   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (l *serialListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.free:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+
+	release := func() { l.free <- struct{}{} }
+	conn, err := openSerial(l.path, l.config, release)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (l *serialListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *serialListener) Addr() net.Addr {
+	return serialAddr(l.path)
+}
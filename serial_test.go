@@ -0,0 +1,115 @@
+//go:build linux
+
+package gomq
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPty returns the master of a new pseudo terminal
+// and the path of its slave, which stands in for a
+// serial device.
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var unlock, n int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		master.Close()
+		t.Skip(errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		master.Close()
+		t.Skip(errno)
+	}
+	return master, "/dev/pts/" + strconv.Itoa(int(n))
+}
+
+func TestParseSerialAddress(t *testing.T) {
+	path, config, err := parseSerialAddress("/dev/ttyUSB0?baud=9600&parity=even&stopbits=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "/dev/ttyUSB0", path; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := (serialConfig{baud: 9600, parity: "even", stopBits: 2}), config; want != got {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	_, config, err = parseSerialAddress("/dev/ttyS0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := (serialConfig{baud: 115200, parity: "none", stopBits: 1}), config; want != got {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	for _, address := range []string{"", "?baud=9600", "/dev/ttyS0?baud=1234", "/dev/ttyS0?parity=mark", "/dev/ttyS0?flow=rtscts"} {
+		if _, _, err := parseSerialAddress(address); err == nil {
+			t.Errorf("want an error for %q", address)
+		}
+	}
+}
+
+func TestSerialConn(t *testing.T) {
+	master, path := openPty(t)
+	defer master.Close()
+
+	ln, err := serialTransport{}.Listen(path + "?baud=9600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Raw mode passes bytes through untouched, such as
+	// the carriage returns and newlines of frame headers.
+	data := []byte("\x00\x05\r\nHI")
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(master, buf); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := string(data), string(buf); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if _, err := master.Write([]byte("\x03OK")); err != nil {
+		t.Fatal(err)
+	}
+	buf = buf[:3]
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "\x03OK", string(buf); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// The device is reopened once the connection is closed.
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+	conn.Close()
+	if err := <-accepted; err != nil {
+		t.Fatal(err)
+	}
+}
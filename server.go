@@ -13,17 +13,21 @@ type ServerSocket struct {
 }
 
 // NewServer accepts a zmtp.SecurityMechanism and returns
-// a ServerSocket as a gomq.Server interface.
-func NewServer(mechanism zmtp.SecurityMechanism) Server {
+// a ServerSocket, which implements gomq.Server.
+func NewServer(mechanism zmtp.SecurityMechanism) *ServerSocket {
 	return &ServerSocket{
 		Socket: NewSocket(true, zmtp.ServerSocketType, nil, mechanism),
 	}
 }
 
 // Bind accepts a zeromq endpoint and binds the
-// server socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// server socket to it, over any registered transport.
 func (s *ServerSocket) Bind(endpoint string) (net.Addr, error) {
 	return BindServer(s, endpoint)
 }
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (s *ServerSocket) ResumeListening(endpoint string) error {
+	return resumeListening(s, endpoint)
+}
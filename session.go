@@ -0,0 +1,158 @@
+package gomq
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// streamOpen is the kind of the message opening
+// a stream of a session.
+const streamOpen = 'o'
+
+// sessionRemote is set in the IDs of the streams of
+// a session opened by the other end of the session.
+const sessionRemote = 1 << 31
+
+// Session multiplexes independent streams, each with its
+// own flow control, over a socket connected to a single
+// peer, so that two hosts need no more than one connection
+// between them. Both ends must use a Session.
+type Session struct {
+	s       ZeroMQSocket
+	lock    sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	accept  chan *Stream
+	done    chan time.Time
+	err     error
+}
+
+// NewSession returns a Session over s. The session receives
+// every message sent to s from then on.
+func NewSession(s ZeroMQSocket) *Session {
+	ss := &Session{
+		s:       s,
+		streams: make(map[uint32]*Stream),
+		accept:  make(chan *Stream, 16),
+		done:    make(chan time.Time),
+	}
+	go ss.recv()
+	return ss
+}
+
+// recv passes the messages received on the session's
+// socket to their streams until the session fails or
+// is closed.
+func (ss *Session) recv() {
+	for {
+		i, msg, err := Select([]Case{{Socket: ss.s}, {Timer: ss.done}}, -1)
+		if i == 1 {
+			return
+		}
+		if err != nil {
+			ss.shutdown(err)
+			return
+		}
+		if len(msg) == 0 || len(msg[0]) < 5 {
+			continue
+		}
+
+		b := msg[0]
+		id := binary.BigEndian.Uint32(b) ^ sessionRemote
+		if b[4] == streamOpen {
+			select {
+			case ss.accept <- ss.stream(id):
+			case <-ss.done:
+				return
+			}
+			continue
+		}
+
+		ss.lock.Lock()
+		st := ss.streams[id]
+		ss.lock.Unlock()
+		if st != nil {
+			st.deliver(b[4:])
+		}
+	}
+}
+
+// stream returns a new stream of the session with the given ID.
+func (ss *Session) stream(id uint32) *Stream {
+	st := newStream(func(b []byte) error {
+		msg := make([]byte, 4+len(b))
+		binary.BigEndian.PutUint32(msg, id)
+		copy(msg[4:], b)
+		return sendWith(ss.s, msg, SendBlock)
+	})
+	st.onClose = func() {
+		ss.lock.Lock()
+		delete(ss.streams, id)
+		ss.lock.Unlock()
+	}
+
+	ss.lock.Lock()
+	if ss.err != nil {
+		st.fail(ss.err)
+	} else {
+		ss.streams[id] = st
+	}
+	ss.lock.Unlock()
+	return st
+}
+
+// Open opens a new stream, which the other end of the
+// session receives from Accept.
+func (ss *Session) Open() (*Stream, error) {
+	ss.lock.Lock()
+	if ss.err != nil {
+		err := ss.err
+		ss.lock.Unlock()
+		return nil, err
+	}
+	id := ss.nextID
+	ss.nextID = (ss.nextID + 1) &^ sessionRemote
+	ss.lock.Unlock()
+
+	st := ss.stream(id)
+	if err := st.send([]byte{streamOpen}); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for the other end of the session to open
+// a stream and returns it.
+func (ss *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-ss.accept:
+		return st, nil
+	case <-ss.done:
+		ss.lock.Lock()
+		defer ss.lock.Unlock()
+		return nil, ss.err
+	}
+}
+
+// Close closes the session and fails its streams.
+// The socket is left open.
+func (ss *Session) Close() error {
+	ss.shutdown(ErrClosed)
+	return nil
+}
+
+// shutdown fails the session and its streams with err.
+func (ss *Session) shutdown(err error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.err != nil {
+		return
+	}
+	ss.err = err
+	close(ss.done)
+	for _, st := range ss.streams {
+		st.abort(err)
+	}
+}
@@ -0,0 +1,82 @@
+package gomq
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestSession(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19032"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19032"); err != nil {
+		t.Fatal(err)
+	}
+
+	local := NewSession(client)
+	defer local.Close()
+	remote := NewSession(server)
+	defer remote.Close()
+
+	// echo every stream opened by the client
+	go func() {
+		for {
+			st, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(st, st)
+				st.Close()
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		st, err := local.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := bytes.Repeat([]byte{byte('a' + i)}, streamWindow*2)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := st.Write(data); err != nil {
+				t.Error(err)
+			}
+			st.CloseWrite()
+		}()
+		go func() {
+			defer wg.Done()
+			got, err := ioutil.ReadAll(st)
+			if err != nil {
+				t.Error(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("want %d bytes of %q, got %d", len(data), data[0], len(got))
+			}
+		}()
+	}
+	wg.Wait()
+
+	local.Close()
+	if _, err := local.Open(); err != ErrClosed {
+		t.Errorf("want %v, got %v", ErrClosed, err)
+	}
+}
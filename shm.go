@@ -0,0 +1,495 @@
+//go:build unix
+
+package gomq
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// shmRingSize is the number of bytes each direction
+	// of a shm:// connection buffers in shared memory.
+	shmRingSize = 1 << 20
+
+	// shmHeaderSize is the size of the header preceding a
+	// ring's data, which holds its positions and wait flags.
+	shmHeaderSize = 64
+
+	// shmSetupTimeout bounds setting up a shm:// connection.
+	shmSetupTimeout = 5 * time.Second
+
+	shmFilePrefix = "gomq-shm-"
+)
+
+// Doorbells rung over a shm:// connection's Unix socket.
+const (
+	shmData = 'd' // data was written for a waiting reader
+	shmRoom = 'r' // data was read for a waiting writer
+)
+
+var errShmSetup = errors.New("gomq: invalid shm setup")
+
+func init() {
+	RegisterTransport(shmTransport{})
+}
+
+// shmTransport is the experimental shm:// transport for peers
+// on the same host. Its address is the path of a Unix socket
+// the peers meet on. Each connection then moves its data
+// through a pair of ring buffers in shared memory, using the
+// Unix socket only to wake a peer waiting for data or room.
+// If the shared memory cannot be set up, the connection falls
+// back to carrying its data over the Unix socket.
+type shmTransport struct{}
+
+func (shmTransport) Scheme() string { return "shm" }
+
+func (shmTransport) Dial(address string) (net.Conn, error) {
+	conn, err := net.Dial("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	c, err := dialShm(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (shmTransport) Listen(address string) (net.Listener, error) {
+	ln, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	return shmListener{ln}, nil
+}
+
+// shmAddr is the address of a shm:// listener.
+type shmAddr string
+
+func (a shmAddr) Network() string { return "shm" }
+func (a shmAddr) String() string  { return string(a) }
+
+// shmListener sets up the connections it accepts on its
+// Unix socket. Connections that fail to set up are closed
+// and skipped.
+type shmListener struct {
+	net.Listener
+}
+
+func (l shmListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		c, err := acceptShm(conn)
+		if err == nil {
+			return c, nil
+		}
+		conn.Close()
+	}
+}
+
+func (l shmListener) Addr() net.Addr {
+	return shmAddr(l.Listener.Addr().String())
+}
+
+// dialShm sets up a connection dialed on conn. It creates the
+// rings, sends their paths and removes them once the listener
+// has mapped them, or falls back to conn if either side
+// cannot map them.
+func dialShm(conn net.Conn) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(shmSetupTimeout))
+
+	tx, txPath, err := createRing()
+	var rx *shmRing
+	var rxPath string
+	if err == nil {
+		defer os.Remove(txPath)
+		rx, rxPath, err = createRing()
+		if err == nil {
+			defer os.Remove(rxPath)
+		} else {
+			tx.unmap()
+		}
+	}
+
+	setup := "unix\n"
+	if err == nil {
+		setup = "shm\n" + txPath + "\n" + rxPath + "\n"
+	}
+	if _, err := io.WriteString(conn, setup); err != nil {
+		return nil, err
+	}
+	var reply [1]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	if setup == "unix\n" {
+		return conn, nil
+	}
+	if reply[0] != 's' {
+		tx.unmap()
+		rx.unmap()
+		return conn, nil
+	}
+	return newShmConn(conn, conn, rx, tx), nil
+}
+
+// acceptShm sets up a connection accepted on conn, mapping
+// the rings the dialer created, or falling back to conn.
+func acceptShm(conn net.Conn) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(shmSetupTimeout))
+
+	r := bufio.NewReader(conn)
+	mode, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var rx, tx *shmRing
+	switch mode {
+	case "unix\n":
+	case "shm\n":
+		var paths [2]string
+		for i := range paths {
+			if paths[i], err = r.ReadString('\n'); err != nil {
+				return nil, err
+			}
+			paths[i] = strings.TrimSuffix(paths[i], "\n")
+		}
+		if rx, err = openRing(paths[0]); err == nil {
+			if tx, err = openRing(paths[1]); err != nil {
+				rx.unmap()
+				rx = nil
+			}
+		}
+	default:
+		return nil, errShmSetup
+	}
+
+	reply := "u"
+	if rx != nil {
+		reply = "s"
+	}
+	if _, err := io.WriteString(conn, reply); err != nil {
+		if rx != nil {
+			rx.unmap()
+			tx.unmap()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	if rx == nil {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return newShmConn(conn, r, rx, tx), nil
+}
+
+// shmDir returns the directory rings are created in,
+// preferring the tmpfs most Linux systems mount on
+// /dev/shm.
+func shmDir() string {
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// shmRing is a single producer, single consumer ring buffer
+// mapped in the memory of both peers. Its header holds the
+// total number of bytes written and read, and whether its
+// reader or writer is waiting for a doorbell.
+type shmRing struct {
+	mem  []byte
+	data []byte
+}
+
+func createRing() (*shmRing, string, error) {
+	f, err := os.CreateTemp(shmDir(), shmFilePrefix+"*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	r, err := mapRing(f)
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return r, f.Name(), nil
+}
+
+// openRing maps the ring at path, which must have been
+// created by createRing.
+func openRing(path string) (*shmRing, error) {
+	if filepath.Dir(path) != shmDir() || !strings.HasPrefix(filepath.Base(path), shmFilePrefix) {
+		return nil, errShmSetup
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err != nil || fi.Size() != shmHeaderSize+shmRingSize {
+		return nil, errShmSetup
+	}
+	return mapRing(f)
+}
+
+func mapRing(f *os.File) (*shmRing, error) {
+	if err := f.Truncate(shmHeaderSize + shmRingSize); err != nil {
+		return nil, err
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, shmHeaderSize+shmRingSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &shmRing{mem: mem, data: mem[shmHeaderSize:]}, nil
+}
+
+func (r *shmRing) unmap() {
+	syscall.Munmap(r.mem)
+}
+
+func (r *shmRing) head() *uint64          { return (*uint64)(unsafe.Pointer(&r.mem[0])) }
+func (r *shmRing) tail() *uint64          { return (*uint64)(unsafe.Pointer(&r.mem[8])) }
+func (r *shmRing) readerWaiting() *uint32 { return (*uint32)(unsafe.Pointer(&r.mem[16])) }
+func (r *shmRing) writerWaiting() *uint32 { return (*uint32)(unsafe.Pointer(&r.mem[20])) }
+
+func (r *shmRing) used() uint64 {
+	return atomic.LoadUint64(r.head()) - atomic.LoadUint64(r.tail())
+}
+
+// read moves as much of the ring's data as fits into b.
+func (r *shmRing) read(b []byte) int {
+	tail := atomic.LoadUint64(r.tail())
+	n := atomic.LoadUint64(r.head()) - tail
+	if n > uint64(len(b)) {
+		n = uint64(len(b))
+	}
+	m := copy(b[:n], r.data[tail%uint64(len(r.data)):])
+	copy(b[m:n], r.data)
+	atomic.StoreUint64(r.tail(), tail+n)
+	return int(n)
+}
+
+// write moves as much of b as there is room for into the ring.
+func (r *shmRing) write(b []byte) int {
+	head := atomic.LoadUint64(r.head())
+	n := uint64(len(r.data)) - (head - atomic.LoadUint64(r.tail()))
+	if n > uint64(len(b)) {
+		n = uint64(len(b))
+	}
+	m := copy(r.data[head%uint64(len(r.data)):], b[:n])
+	copy(r.data, b[m:n])
+	atomic.StoreUint64(r.head(), head+n)
+	return int(n)
+}
+
+// shmConn is a connection whose data flows through rings in
+// shared memory, rx written by the peer and tx read by it.
+type shmConn struct {
+	net.Conn
+	rx, tx *shmRing
+
+	data, room chan struct{}
+	gone       chan struct{}
+	closed     chan struct{}
+	closeOnce  sync.Once
+
+	readLock, writeLock         sync.Mutex
+	readDeadline, writeDeadline pipeDeadline
+}
+
+// newShmConn returns a connection using rx and tx, listening
+// for doorbells on doorbells, which reads conn.
+func newShmConn(conn net.Conn, doorbells io.Reader, rx, tx *shmRing) *shmConn {
+	c := &shmConn{
+		Conn:   conn,
+		rx:     rx,
+		tx:     tx,
+		data:   make(chan struct{}, 1),
+		room:   make(chan struct{}, 1),
+		gone:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go c.listen(doorbells)
+	return c
+}
+
+// listen passes the doorbells rung by the peer on to the
+// reader and writer, until the peer goes away.
+func (c *shmConn) listen(doorbells io.Reader) {
+	defer close(c.gone)
+
+	var buf [64]byte
+	for {
+		n, err := doorbells.Read(buf[:])
+		for _, b := range buf[:n] {
+			switch b {
+			case shmData:
+				pipeNotify(c.data)
+			case shmRoom:
+				pipeNotify(c.room)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *shmConn) ring(doorbell byte) {
+	c.Conn.Write([]byte{doorbell})
+}
+
+// wait waits for a doorbell on ch, the peer going away, c
+// being closed, or d passing or changing.
+func (c *shmConn) wait(ch <-chan struct{}, d *pipeDeadline) error {
+	t, changed := d.get()
+	var expired <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-ch:
+	case <-changed:
+	case <-c.gone:
+	case <-c.closed:
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+func (c *shmConn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for {
+		select {
+		case <-c.closed:
+			return 0, net.ErrClosed
+		default:
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		if n := c.rx.read(b); n > 0 {
+			if atomic.LoadUint32(c.rx.writerWaiting()) != 0 {
+				c.ring(shmRoom)
+			}
+			return n, nil
+		}
+
+		select {
+		case <-c.gone:
+			if c.rx.used() == 0 {
+				return 0, io.EOF
+			}
+			continue
+		default:
+		}
+
+		var err error
+		atomic.StoreUint32(c.rx.readerWaiting(), 1)
+		if c.rx.used() == 0 {
+			err = c.wait(c.data, &c.readDeadline)
+		}
+		atomic.StoreUint32(c.rx.readerWaiting(), 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *shmConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	var n int
+	for n < len(b) {
+		select {
+		case <-c.closed:
+			return n, net.ErrClosed
+		case <-c.gone:
+			return n, syscall.EPIPE
+		default:
+		}
+
+		if m := c.tx.write(b[n:]); m > 0 {
+			n += m
+			if atomic.LoadUint32(c.tx.readerWaiting()) != 0 {
+				c.ring(shmData)
+			}
+			continue
+		}
+
+		var err error
+		atomic.StoreUint32(c.tx.writerWaiting(), 1)
+		if c.tx.used() == uint64(len(c.tx.data)) {
+			err = c.wait(c.room, &c.writeDeadline)
+		}
+		atomic.StoreUint32(c.tx.writerWaiting(), 0)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Close closes the Unix socket, which tells the peer, and
+// unmaps the rings once pending reads and writes return.
+func (c *shmConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.Conn.Close()
+
+		c.readLock.Lock()
+		c.writeLock.Lock()
+		c.rx.unmap()
+		c.tx.unmap()
+		c.writeLock.Unlock()
+		c.readLock.Unlock()
+	})
+	return err
+}
+
+func (c *shmConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *shmConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *shmConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
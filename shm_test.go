@@ -0,0 +1,126 @@
+//go:build unix
+
+package gomq
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestShmConn(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "shm.sock")
+	ln, err := shmTransport{}.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+
+	client, err := shmTransport{}.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	if _, ok := client.(*shmConn); !ok {
+		t.Fatalf("want a shared memory connection, got %T", client)
+	}
+
+	// more than a ring holds, so that the writer waits for room
+	want := bytes.Repeat([]byte("0123456789abcdef"), 3*shmRingSize/16+7)
+	go func() {
+		client.Write(want)
+		client.Close()
+	}()
+
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("want %d bytes, got %d different bytes", len(want), len(got))
+	}
+
+	server.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("want %v, got %v", io.EOF, err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(shmDir(), shmFilePrefix+"*")); len(files) != 0 {
+		t.Errorf("want ring files removed, got %v", files)
+	}
+}
+
+func TestShmDeadline(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "shm.sock")
+	ln, err := shmTransport{}.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	client, err := shmTransport{}.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := client.Read(make([]byte, 1)); !os.IsTimeout(err) {
+		t.Errorf("want timeout, got %v", err)
+	}
+}
+
+func TestShmSockets(t *testing.T) {
+	endpoint := "shm://" + filepath.Join(t.TempDir(), "shm.sock")
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := endpoint, server.LastEndpoint(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
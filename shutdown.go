@@ -0,0 +1,174 @@
+package gomq
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Topology closes a set of named sockets in an order that
+// respects the dependencies declared between them, such as
+// closing a frontend before the backend it forwards to, so
+// that no message is accepted that can no longer be passed
+// on. Sockets created by a Context are shut down by its
+// own Topology, see Context.CloseBefore.
+type Topology struct {
+	lock    sync.Mutex
+	names   []string
+	sockets map[string]ZeroMQSocket
+	after   map[string][]string
+}
+
+// NewTopology returns an empty Topology.
+func NewTopology() *Topology {
+	return &Topology{
+		sockets: make(map[string]ZeroMQSocket),
+		after:   make(map[string][]string),
+	}
+}
+
+// Add adds socket to the topology under name,
+// replacing any socket previously added under it.
+func (t *Topology) Add(name string, socket ZeroMQSocket) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.sockets[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.sockets[name] = socket
+}
+
+// has reports whether a socket was added under name.
+func (t *Topology) has(name string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.sockets[name]
+	return ok
+}
+
+// CloseBefore makes Shutdown close the socket named first
+// before the one named then. It fails if either was not
+// added, or if then is already closed before first.
+func (t *Topology) CloseBefore(first, then string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, name := range []string{first, then} {
+		if _, ok := t.sockets[name]; !ok {
+			return fmt.Errorf("gomq: unknown socket %q", name)
+		}
+	}
+	if first == then || t.precedes(then, first) {
+		return fmt.Errorf("gomq: %q is closed before %q", then, first)
+	}
+	t.after[then] = append(t.after[then], first)
+	return nil
+}
+
+// precedes reports whether a is closed before b.
+// The caller holds t.lock.
+func (t *Topology) precedes(a, b string) bool {
+	for _, name := range t.after[b] {
+		if name == a || t.precedes(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Shutdown closes the topology's sockets, in waves of sockets
+// whose predecessors are all closed, closing the sockets of
+// a wave concurrently since each may linger, see SetLinger.
+// Sockets already closed are skipped. It returns a
+// *ShutdownError if any socket failed to close cleanly.
+func (t *Topology) Shutdown() error {
+	t.lock.Lock()
+	names := append([]string(nil), t.names...)
+	sockets := make(map[string]ZeroMQSocket, len(t.sockets))
+	waiting := make(map[string]int, len(names))
+	for _, name := range names {
+		sockets[name] = t.sockets[name]
+		waiting[name] = len(t.after[name])
+	}
+	next := make(map[string][]string)
+	for then, firsts := range t.after {
+		for _, first := range firsts {
+			next[first] = append(next[first], then)
+		}
+	}
+	t.lock.Unlock()
+
+	var failed []*CloseError
+	for len(waiting) > 0 {
+		var wave []string
+		for _, name := range names {
+			if n, ok := waiting[name]; ok && n == 0 {
+				wave = append(wave, name)
+				delete(waiting, name)
+			}
+		}
+
+		errs := make([]error, len(wave))
+		var wg sync.WaitGroup
+		for i, name := range wave {
+			wg.Add(1)
+			go func(i int, socket ZeroMQSocket) {
+				defer wg.Done()
+				errs[i] = socket.Close()
+			}(i, sockets[name])
+		}
+		wg.Wait()
+
+		for i, name := range wave {
+			if err := errs[i]; err != nil && err != ErrClosed {
+				failed = append(failed, &CloseError{Name: name, Err: err})
+			}
+			for _, then := range next[name] {
+				waiting[then]--
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return &ShutdownError{Errors: failed}
+	}
+	return nil
+}
+
+// CloseError is the error closing the socket
+// added to a Topology under Name.
+type CloseError struct {
+	Name string
+	Err  error
+}
+
+func (e *CloseError) Error() string {
+	return "gomq: closing " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// ShutdownError is returned by Topology.Shutdown for the
+// sockets that failed to close cleanly, in closing order.
+type ShutdownError struct {
+	Errors []*CloseError
+}
+
+func (e *ShutdownError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the sockets, so that
+// errors.Is and errors.As match any of them.
+func (e *ShutdownError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
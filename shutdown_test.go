@@ -0,0 +1,101 @@
+package gomq
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// closeRecorder records the order its sockets are closed in.
+type closeRecorder struct {
+	lock   sync.Mutex
+	closed []string
+}
+
+type recordedSocket struct {
+	ZeroMQSocket
+	name string
+	rec  *closeRecorder
+	err  error
+}
+
+func (s recordedSocket) Close() error {
+	s.rec.lock.Lock()
+	s.rec.closed = append(s.rec.closed, s.name)
+	s.rec.lock.Unlock()
+	return s.err
+}
+
+func TestTopologyShutdown(t *testing.T) {
+	rec := &closeRecorder{}
+	errFailed := errors.New("failed")
+	topology := NewTopology()
+	for _, name := range []string{"backend", "worker", "frontend"} {
+		var err error
+		if name == "worker" {
+			err = errFailed
+		}
+		topology.Add(name, recordedSocket{name: name, rec: rec, err: err})
+	}
+	topology.Add("closed", recordedSocket{name: "closed", rec: rec, err: ErrClosed})
+
+	if err := topology.CloseBefore("frontend", "worker"); err != nil {
+		t.Fatal(err)
+	}
+	if err := topology.CloseBefore("worker", "backend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := topology.CloseBefore("backend", "frontend"); err == nil {
+		t.Error("want an error for a cycle")
+	}
+	if err := topology.CloseBefore("frontend", "missing"); err == nil {
+		t.Error("want an error for an unknown socket")
+	}
+
+	err := topology.Shutdown()
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("want a *ShutdownError, got %v", err)
+	}
+	if want, got := 1, len(shutdownErr.Errors); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := "worker", shutdownErr.Errors[0].Name; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Errorf("want %v, got %v", errFailed, err)
+	}
+
+	index := make(map[string]int)
+	for i, name := range rec.closed {
+		index[name] = i
+	}
+	if want, got := 4, len(index); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if !(index["frontend"] < index["worker"] && index["worker"] < index["backend"]) {
+		t.Errorf("want frontend, worker, backend, got %v", rec.closed)
+	}
+}
+
+func TestTopologySockets(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	client := NewClient(zmtp.NewSecurityNull())
+	topology := NewTopology()
+	topology.Add("server", server)
+	topology.Add("client", client)
+	if err := topology.CloseBefore("client", "server"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	if err := topology.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := ErrClosed, server.Close(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
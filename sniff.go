@@ -0,0 +1,75 @@
+package gomq
+
+import (
+	"bufio"
+	"net"
+	"time"
+)
+
+// zmtpSignature is the first byte of every ZMTP 3
+// greeting, telling ZMTP peers from other clients.
+const zmtpSignature = 0xFF
+
+// SetForeignHandler makes the socket peek at the first byte
+// of the connections it accepts from then on, and hand those
+// that do not start a ZMTP greeting to fn instead of failing
+// their handshake, so that other protocols, such as the HTTP
+// health checks of a load balancer, can share the socket's
+// port. fn owns the connection, which still holds the bytes
+// peeked, and must close it; it is closed for fn if the socket
+// is closed first. Nil, the default, disables sniffing.
+// WebSocket endpoints are not sniffed.
+func (s *Socket) SetForeignHandler(fn func(net.Conn)) {
+	s.lock.Lock()
+	s.onForeign = fn
+	s.lock.Unlock()
+}
+
+// foreignHandled is implemented by sockets that
+// may hand non-ZMTP connections to a handler.
+type foreignHandled interface {
+	foreignHandler() func(net.Conn)
+}
+
+// foreignHandler returns the handler of s for non-ZMTP
+// connections, or nil if it does not sniff them.
+func foreignHandler(s ZeroMQSocket) func(net.Conn) {
+	if f, ok := s.(foreignHandled); ok {
+		return f.foreignHandler()
+	}
+	return nil
+}
+
+func (s *Socket) foreignHandler() func(net.Conn) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.onForeign
+}
+
+// sniffZMTP peeks at the first byte of conn, waiting for it
+// for no longer than timeout unless it is zero, and reports
+// whether it starts a ZMTP greeting. The connection returned
+// replays the byte peeked.
+func sniffZMTP(conn net.Conn, timeout time.Duration) (net.Conn, bool, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	buffered, ok := conn.(*bufferedConn)
+	if !ok {
+		buffered = &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}
+	}
+	b, err := buffered.r.Peek(1)
+	if err != nil {
+		return nil, false, err
+	}
+	return buffered, b[0] == zmtpSignature, nil
+}
+
+// isWS reports whether conn is a WebSocket connection,
+// whose handshake is HTTP.
+func isWS(conn net.Conn) bool {
+	_, ok := conn.(*wsConn)
+	return ok
+}
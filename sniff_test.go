@@ -0,0 +1,73 @@
+package gomq
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestForeignHandler(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	events := make(chan SocketEvent, 10)
+	server.SetEventHandler(func(ev SocketEvent) {
+		if ev.Type == EventForeign || ev.Type == EventHandshakeFailed {
+			events <- ev
+		}
+	})
+	server.SetForeignHandler(func(conn net.Conn) {
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, Request: req}
+		resp.Write(conn)
+	})
+
+	if _, err := server.Bind("tcp://127.0.0.1:19077"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://127.0.0.1:19077/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, got := http.StatusOK, resp.StatusCode; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := EventForeign, (<-events).Type; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19077"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := Ready, server.Endpoints()[0].State; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %v", ev.Type)
+	default:
+	}
+}
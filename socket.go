@@ -1,7 +1,15 @@
 package gomq
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zeromq/gomq/zmtp"
@@ -11,79 +19,458 @@ import (
 // not be used directly. Specifically typed sockets such
 // as ClientSocket, ServerSocket, etc embed this type.
 type Socket struct {
-	sockType      zmtp.SocketType
-	sockID        zmtp.SocketIdentity
-	asServer      bool
-	conns         map[string]*Connection
-	ids           []string
-	retryInterval time.Duration
-	lock          *sync.RWMutex
-	mechanism     zmtp.SecurityMechanism
-	recvChannel   chan *zmtp.Message
+	sockType        zmtp.SocketType
+	sockID          zmtp.SocketIdentity
+	asServer        bool
+	conns           map[string]*Connection
+	ids             []string
+	retryInterval   time.Duration
+	backoff         Backoff
+	greetingTimeout time.Duration
+	handshakeLimit  time.Duration
+	maxMessageSize  int64
+	lock            *sync.RWMutex
+	mechanism       zmtp.SecurityMechanism
+	recvChannel     chan *zmtp.Message
+	done            chan struct{}
+	peersChanged    chan struct{}
+	subsChanged     chan struct{}
+	authenticator   Authenticator
+	onSendError     func(*SendError)
+	autoIdentity    bool
+	sendMode        SendMode
+	rotation        uint32
+
+	endpoints       map[string]*EndpointStatus
+	endpointOrder   []string
+	onEndpointState func(EndpointStatus)
+	breaker         *CircuitBreaker
+	breakers        map[string]*endpointBreaker
+	onDeadLetter    func(DeadLetter)
+	journal         *Journal
+	metadata        map[string]string
+	namespace       Namespace
+	listeners       []boundListener
+	dialers         []*dialer
+	lastEndpoint    string
+	draining        bool
+	onGoodbye       func(PeerInfo, string)
+	onCommand       func(PeerInfo, string, []byte)
+	memoryLimit     *MemoryLimit
+	labels          map[string]Labels
+	frozen          bool
+	recorder        *Recorder
+	keepalive       Keepalive
+	heartbeat       Heartbeat
+	linger          time.Duration
+	async           bool
+	queueEarly      bool
+	asyncQueue      int
+	pending         []*outgoing
+	pendingLock     sync.Mutex
+	sendHWM         int
+	sendBuffer      int
+	recvHWM         int
+	sendRoom        *roomSignal
+	strict          bool
+	strictSecurity  bool
+	polled          *zmtp.Message
+	proxyProtocol   bool
+	httpProxy       *url.URL
+	stamper         Stamper
+	profiler        *profiler
+	routingIDs      *routingIDs
+	tlsConfig       *tls.Config
+	tcpKeepalive    time.Duration
+	tcpNoDelay      bool
+	ipFamily        IPFamily
+	onTune          func(OptionChange)
+	onEvent         func(SocketEvent)
+	onForeign       func(net.Conn)
+	onSubscribe     func(*Connection, []byte) []DeadLetter
+	pingSeq         uint64
+	pongWaiters     map[string]chan struct{}
+
+	validator        SchemaValidator
+	validationPolicy ValidationPolicy
+	invalidSent      uint64
+	invalidReceived  uint64
+
+	largeFrameThreshold int64
+	onFrameProgress     func(read, total uint64)
+	bufferPool          bool
+
+	stats       *counters
+	statsConfig StatsConfig
+
+	// scope is the inproc:// namespace of the
+	// socket's Context, see inprocName.
+	scope string
+
+	logger   Logger
+	logLevel LogLevel
+	clock    Clock
 }
 
 // NewSocket accepts an asServer boolean, zmtp.SocketType, a socket identity and a zmtp.SecurityMechanism
 // and returns a *Socket.
 func NewSocket(asServer bool, sockType zmtp.SocketType, sockID zmtp.SocketIdentity, mechanism zmtp.SecurityMechanism) *Socket {
 	return &Socket{
-		lock:          &sync.RWMutex{},
-		asServer:      asServer,
-		sockType:      sockType,
-		sockID:        sockID,
-		retryInterval: defaultRetry,
-		mechanism:     mechanism,
-		conns:         make(map[string]*Connection),
-		ids:           make([]string, 0),
-		recvChannel:   make(chan *zmtp.Message),
+		lock:            &sync.RWMutex{},
+		asServer:        asServer,
+		sockType:        sockType,
+		sockID:          sockID,
+		retryInterval:   defaultRetry,
+		greetingTimeout: defaultGreetingTimeout,
+		handshakeLimit:  defaultHandshakeTimeout,
+		linger:          defaultLinger,
+		sendBuffer:      defaultSendBuffer,
+		tcpNoDelay:      true,
+		mechanism:       mechanism,
+		conns:           make(map[string]*Connection),
+		ids:             make([]string, 0),
+		recvChannel:     make(chan *zmtp.Message),
+		done:            make(chan struct{}),
+		peersChanged:    make(chan struct{}),
+		subsChanged:     make(chan struct{}),
+		sendMode:        SendDontWait,
+		endpoints:       make(map[string]*EndpointStatus),
+		breakers:        make(map[string]*endpointBreaker),
+		metadata:        make(map[string]string),
+		labels:          make(map[string]Labels),
+		sendRoom:        newRoomSignal(),
+		routingIDs:      newRoutingIDs(),
+		stats:           &counters{},
+		logLevel:        LogInfo,
 	}
 }
 
 // AddConnection adds a gomq.Connection to the socket.
-// It is goroutine safe.
+// If the socket is already closed or draining, the
+// connection is closed instead. It is goroutine safe.
 func (s *Socket) AddConnection(conn *Connection) {
 	s.lock.Lock()
+	select {
+	case <-s.done:
+		s.draining = true
+	default:
+	}
+	if s.draining {
+		s.lock.Unlock()
+		conn.outbox.close()
+		conn.net.Close()
+		return
+	}
+
 	uuid, err := newUUID()
 	if err != nil {
 		panic(err)
 	}
 
+	conn.id = uuid
+	conn.routingID = s.routingIDs.assign(conn.zmtp.PeerIdentity())
+	conn.socketDone = s.done
+	conn.onCommand = s.handleCommand
+	conn.socketStats = s.stats
+	conn.labels = s.labels[conn.endpoint]
+	conn.outbox.pause(s.frozen)
+	conn.outbox.setLimit(s.memoryLimit)
+	conn.outbox.setHWM(s.sendHWM, s.sendRoom)
+	conn.recvHWM = s.recvHWM
+	conn.zmtp.SetWriteBuffer(s.sendBuffer)
+	setTCPOptions(conn.net, s.tcpKeepalive, s.tcpNoDelay)
+	if s.profiler != nil {
+		conn.zmtp.SetTiming(int(s.profiler.every))
+		conn.outbox.setProfiler(s.profiler)
+	}
+	if multipartAllowed(s.sockType) {
+		conn.stamper = s.stamper
+	}
+	if s.strict {
+		conn.checkEnvelope = envelopeCheck(s.sockType)
+	}
+	if s.clock != nil {
+		conn.clock = s.clock
+		now := conn.now().UnixNano()
+		atomic.StoreInt64(&conn.lastSent, now)
+		atomic.StoreInt64(&conn.lastRecv, now)
+	}
 	s.conns[uuid] = conn
 	s.ids = append(s.ids, uuid)
+	for _, msg := range s.pending {
+		conn.outbox.push(msg)
+	}
+	s.pending = nil
+	keepalive := s.keepalive
+	heartbeat := s.heartbeat
+	s.notifyPeersChanged()
 	s.lock.Unlock()
+
+	s.setEndpointState(conn.endpoint, Ready, nil)
+	s.emit(SocketEvent{Type: EventHandshakeSucceeded, Endpoint: conn.endpoint, PeerID: uuid})
+	go s.write(conn)
+	go s.watch(conn)
+	if keepalive.Interval > 0 || keepalive.IdleTimeout > 0 {
+		go s.keepAlive(conn, keepalive)
+	}
+	if heartbeat.Interval > 0 {
+		go s.sendHeartbeats(conn, heartbeat)
+	}
 }
 
 // RemoveConnection accepts the uuid of a connection
 // and removes that gomq.Connection from the socket
-// if it exists. FIXME will bomb if uuid does not
-// exist in map
+// if it exists.
 func (s *Socket) RemoveConnection(uuid string) {
+	s.removeConnection(uuid)
+}
+
+// removeConnection removes the connection with the given
+// uuid like RemoveConnection, reporting whether it existed.
+func (s *Socket) removeConnection(uuid string) bool {
 	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	conn, ok := s.conns[uuid]
+	if !ok {
+		return false
+	}
+
 	for k, v := range s.ids {
 		if v == uuid {
 			s.ids = append(s.ids[:k], s.ids[k+1:]...)
+			break
 		}
 	}
-	s.conns[uuid].net.Close()
+	conn.outbox.close()
+	conn.net.Close()
 	delete(s.conns, uuid)
-	s.lock.Unlock()
+	s.notifyPeersChanged()
+	return true
+}
+
+// disconnected removes conn, lost because of err,
+// reporting it unless it was already removed.
+func (s *Socket) disconnected(conn *Connection, err error) {
+	if s.removeConnection(conn.id) {
+		s.emit(SocketEvent{Type: EventDisconnected, Endpoint: conn.endpoint, PeerID: conn.id, Err: err})
+	}
+}
+
+// notifyPeersChanged wakes up everyone waiting on a change
+// in the socket's connections. The caller must hold the lock.
+func (s *Socket) notifyPeersChanged() {
+	close(s.peersChanged)
+	s.peersChanged = make(chan struct{})
+}
+
+// WaitForPeers blocks until at least n peers have completed
+// their handshake with the socket. It returns ErrTimeout
+// if that has not happened within timeout, and ErrClosed
+// if the socket is closed while waiting.
+func (s *Socket) WaitForPeers(n int, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.lock.RLock()
+		count, changed := len(s.ids), s.peersChanged
+		s.lock.RUnlock()
+
+		if count >= n {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-s.done:
+			return ErrClosed
+		case <-timer.C:
+			return ErrTimeout
+		}
+	}
+}
+
+// Peers returns a PeerInfo for each of the socket's
+// connections, in the order they were added. Peer
+// identities are stripped of the socket's namespace.
+// It is goroutine safe.
+func (s *Socket) Peers() []PeerInfo {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	peers := make([]PeerInfo, 0, len(s.ids))
+	for _, id := range s.ids {
+		info := s.conns[id].Info()
+		info.SocketIdentity, _ = s.namespace.Strip(info.SocketIdentity)
+		peers = append(peers, info)
+	}
+	return peers
 }
 
 // RetryInterval returns the retry interval used
 // for asyncronous bind / connect.
 func (s *Socket) RetryInterval() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	return s.retryInterval
 }
 
+// GreetingTimeout returns how long the socket waits for
+// each part of a peer's ZMTP greeting before giving up on
+// the connection.
+func (s *Socket) GreetingTimeout() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.greetingTimeout
+}
+
+// SetGreetingTimeout sets how long the socket waits for each
+// part of a peer's ZMTP greeting, so that connections that
+// stall mid-greeting, such as port scans, are dropped early.
+// Zero means waiting forever.
+func (s *Socket) SetGreetingTimeout(timeout time.Duration) {
+	s.lock.Lock()
+	s.greetingTimeout = timeout
+	s.lock.Unlock()
+}
+
+// HandshakeTimeout returns how long the socket gives peers
+// to complete the ZMTP handshake.
+func (s *Socket) HandshakeTimeout() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.handshakeLimit
+}
+
+// SetHandshakeTimeout sets how long the socket gives peers
+// to complete the whole ZMTP handshake, from the greeting to
+// the exchange of metadata, on future connections, so that
+// peers that connect but never finish it, or trickle it byte
+// by byte, are dropped instead of tying up the connection.
+// Such peers are reported by EventHandshakeFailed, with an
+// error wrapping zmtp.ErrHandshakeTimeout. It defaults to 30
+// seconds, and zero means waiting forever.
+func (s *Socket) SetHandshakeTimeout(timeout time.Duration) {
+	s.lock.Lock()
+	s.handshakeLimit = timeout
+	s.lock.Unlock()
+}
+
+// minHandshakeSize is the smallest limit on the size of
+// the commands of the ZMTP handshake, which carry metadata,
+// whatever the socket's maximum message size.
+const minHandshakeSize = 64 << 10
+
+// handshakeSizeLimit returns the limit on the size of the
+// handshake's commands for a maximum message size of max.
+func handshakeSizeLimit(max int64) int64 {
+	if max > 0 && max < minHandshakeSize {
+		return minHandshakeSize
+	}
+	return max
+}
+
+// MaxMessageSize returns the largest message, in bytes,
+// the socket accepts from peers. Zero means no limit.
+func (s *Socket) MaxMessageSize() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.maxMessageSize
+}
+
+// SetMaxMessageSize sets the largest message, in bytes, the
+// socket accepts from peers, on existing and future connections.
+// Since each connection hands received messages to the socket
+// one at a time, this bounds the memory a single peer can make
+// the socket hold, whatever the size of the frames it announces.
+// Frames are checked against it before being read, so a peer
+// exceeding it is disconnected, with an error wrapping
+// zmtp.ErrMessageTooLarge, before any memory is allocated for
+// the message. The commands of the ZMTP handshake are held to
+// it as well, or to 64 KiB if it is smaller. Zero means no limit.
+func (s *Socket) SetMaxMessageSize(size int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.maxMessageSize = size
+	for _, conn := range s.conns {
+		conn.zmtp.SetMaxMessageSize(size)
+	}
+}
+
 // SocketType returns the Socket's zmtp.SocketType.
 func (s *Socket) SocketType() zmtp.SocketType {
 	return s.sockType
 }
 
 // SocketIdentity returns the Socket's zmtp.SocketIdentity.
+// If the socket has no identity and automatic identities
+// are enabled, a printable identity is generated first.
 func (s *Socket) SocketIdentity() zmtp.SocketIdentity {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.sockID) == 0 && s.autoIdentity {
+		id, err := NewPrintableIdentity()
+		if err != nil {
+			panic(err)
+		}
+		s.sockID = id
+	}
 	return s.sockID
 }
 
+// SetSocketIdentity sets the identity the socket sends
+// to peers in the handshake of future connections. Without
+// one, the socket is anonymous, and peers route it by a
+// generated ID, see PeerInfo.RoutingID. As with libzmq,
+// identities should not start with a zero byte, which is
+// reserved for generated IDs.
+func (s *Socket) SetSocketIdentity(id zmtp.SocketIdentity) {
+	s.lock.Lock()
+	s.sockID = id
+	s.lock.Unlock()
+}
+
+// SetAutoIdentity enables or disables generating a printable
+// identity for the socket, see NewPrintableIdentity, when it
+// connects without one having been set.
+func (s *Socket) SetAutoIdentity(enabled bool) {
+	s.lock.Lock()
+	s.autoIdentity = enabled
+	s.lock.Unlock()
+}
+
+// Metadata returns a copy of the application metadata the
+// socket sends to peers during the ZMTP handshake.
+func (s *Socket) Metadata() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	metadata := make(map[string]string, len(s.metadata))
+	for k, v := range s.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// SetMetadata sets an application metadata property sent to
+// peers during the handshake of future connections. Names are
+// case insensitive, and an empty value removes the property.
+// Peers' properties are available from PeerInfo.Metadata.
+func (s *Socket) SetMetadata(name, value string) {
+	name = strings.ToLower(name)
+
+	s.lock.Lock()
+	if value == "" {
+		delete(s.metadata, name)
+	} else {
+		s.metadata[name] = value
+	}
+	s.lock.Unlock()
+}
+
 // SecurityMechanism returns the Socket's zmtp.SecurityMechanism.
 func (s *Socket) SecurityMechanism() zmtp.SecurityMechanism {
 	return s.mechanism
@@ -95,41 +482,664 @@ func (s *Socket) RecvChannel() chan *zmtp.Message {
 	return s.recvChannel
 }
 
-// Close closes all underlying transport connections
-// for the socket.
-func (s *Socket) Close() {
+// Close stops the socket from accepting connections and
+// messages, gives the messages still queued up to the linger
+// period, see SetLinger, to be written out, then closes all
+// underlying transport connections and waits for their
+// writers to stop. Readers stop passing messages on right
+// away. It returns an ErrLinger error if messages were
+// dropped, and ErrClosed if the socket was already closed.
+func (s *Socket) Close() error {
 	s.lock.Lock()
-	for k, v := range s.ids {
-		s.conns[v].net.Close()
-		s.ids = append(s.ids[:k], s.ids[k+1:]...)
+	select {
+	case <-s.done:
+		s.lock.Unlock()
+		return ErrClosed
+	default:
+		close(s.done)
 	}
+
+	conns := make([]*Connection, 0, len(s.ids))
+	for _, v := range s.ids {
+		conns = append(conns, s.conns[v])
+		delete(s.conns, v)
+	}
+	s.ids = s.ids[:0]
+	pending := s.pending
+	s.pending = nil
+	linger := s.linger
+	endpoints := append([]string(nil), s.endpointOrder...)
+	listeners := s.listeners
+	for _, b := range s.breakers {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+	}
+	s.listeners = nil
 	s.lock.Unlock()
+
+	for _, l := range listeners {
+		l.ln.Close()
+	}
+	dropped := len(pending)
+	for _, msg := range pending {
+		s.settle(msg)
+		s.deadLetter(DeadLetter{Reason: DropLinger, Message: msg.frames})
+	}
+	for _, endpoint := range endpoints {
+		s.setEndpointState(endpoint, Closed, nil)
+	}
+
+	for _, conn := range conns {
+		conn.outbox.close()
+	}
+
+	ctx := context.Background()
+	if linger >= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, linger)
+		defer cancel()
+	}
+	for _, conn := range conns {
+		select {
+		case <-conn.outbox.drained:
+		case <-ctx.Done():
+			dropped += s.discard(conn, DropLinger)
+		}
+		conn.net.Close()
+		<-conn.outbox.drained
+	}
+
+	if dropped > 0 {
+		return fmt.Errorf("%w: %d messages dropped", ErrLinger, dropped)
+	}
+	return nil
+}
+
+// discard removes the messages queued toward conn, passes
+// them to the dead letter handler for reason and returns
+// how many there were.
+func (s *Socket) discard(conn *Connection, reason DropReason) int {
+	n := 0
+	for _, msg := range conn.outbox.take() {
+		if msg.command != "" {
+			continue
+		}
+		n++
+		s.deadLetter(DeadLetter{
+			Reason:   reason,
+			PeerID:   conn.id,
+			Endpoint: conn.endpoint,
+			Message:  msg.frames,
+		})
+	}
+	return n
+}
+
+// Done returns a channel that is closed when
+// the socket is closed.
+func (s *Socket) Done() <-chan struct{} {
+	return s.done
 }
 
 // Recv receives a message from the Socket's
 // message channel and returns it.
 func (s *Socket) Recv() ([]byte, error) {
-	msg := <-s.recvChannel
-	if msg.MessageType == zmtp.CommandMessage {
+	msg, _ := s.next(context.Background(), true)
+	return firstFrame(msg), msg.Err
+}
+
+// TryRecv is like Recv, but never blocks. If no message
+// is ready it returns immediately with ok set to false.
+func (s *Socket) TryRecv() (b []byte, ok bool, err error) {
+	msg, ok := s.next(context.Background(), false)
+	if !ok {
+		return nil, false, nil
 	}
-	return msg.Body[0], msg.Err
+	return firstFrame(msg), true, msg.Err
 }
 
-// Send sends a message. FIXME should use a channel.
+// TryRecvMultipart is like RecvMultipart, but never blocks. If
+// no message is ready it returns immediately with ok set to false.
+func (s *Socket) TryRecvMultipart() (b [][]byte, ok bool, err error) {
+	msg, ok := s.next(context.Background(), false)
+	if !ok {
+		return nil, false, nil
+	}
+	return msg.Body, true, msg.Err
+}
+
+// next returns the next message from the socket's receive
+// channel, skipping messages rejected by the socket's schema
+// validator and recording the others. If block is false and
+// no message is ready, it returns false instead of waiting.
+// Otherwise it waits until a message arrives, ctx is done or
+// the socket is closed and has no messages left, in which
+// cases the message returned holds ctx.Err() or ErrClosed.
+func (s *Socket) next(ctx context.Context, block bool) (*zmtp.Message, bool) {
+	for {
+		s.lock.Lock()
+		msg := s.polled
+		s.polled = nil
+		p := s.profiler
+		s.lock.Unlock()
+
+		switch {
+		case msg != nil:
+		case block:
+			select {
+			case msg = <-s.recvChannel:
+			case <-ctx.Done():
+				return &zmtp.Message{Err: ctx.Err()}, true
+			case <-s.done:
+				select {
+				case msg = <-s.recvChannel:
+				default:
+					return &zmtp.Message{Err: ErrClosed}, true
+				}
+			}
+		default:
+			select {
+			case msg = <-s.recvChannel:
+			default:
+				return nil, false
+			}
+		}
+
+		if msg.Err == nil && msg.MessageType == zmtp.UserMessage {
+			if err := s.validate(msg.Body, false); err != nil {
+				continue
+			}
+			s.record(msg.Body)
+		}
+		if t := msg.Timing; t != nil && p != nil {
+			handoff := time.Since(t.Done)
+			p.record(func(profile *Profile) {
+				profile.Read.add(t.Read)
+				profile.Parse.add(t.Parse)
+				profile.Handoff.add(handoff)
+			})
+		}
+		return msg, true
+	}
+}
+
+func firstFrame(msg *zmtp.Message) []byte {
+	if len(msg.Body) == 0 {
+		return nil
+	}
+	return msg.Body[0]
+}
+
+// Send queues a message to be sent to one of the socket's
+// peers, taking turns between them, using the socket's
+// send mode.
 func (s *Socket) Send(b []byte) error {
-	return s.conns[s.ids[0]].zmtp.SendFrame(b)
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+	return s.deliver(context.Background(), [][]byte{b}, SendDefault)
 }
 
+// SendPriority is like Send, but the message skips ahead
+// of the regular messages already queued toward the peer,
+// so that control messages are not stuck behind bulk data.
+// Priority messages are not journaled.
+func (s *Socket) SendPriority(b []byte) error {
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+	return s.deliverOutgoing(context.Background(), &outgoing{frames: [][]byte{b}, priority: true}, SendDefault)
+}
+
+// SendMultipart queues a message of one or more frames to be
+// sent to one of the socket's peers, like Send, using the
+// socket's send mode. DEALER sockets precede the frames with
+// an empty delimiter frame. CLIENT and SERVER sockets only
+// send single frame messages, and return ErrMultipart
+// otherwise.
 func (s *Socket) SendMultipart(b [][]byte) error {
+	return s.SendMultipartWith(b, SendDefault)
+}
+
+// TrySend is like Send, but never blocks. It returns
+// ErrWouldBlock if the message cannot be queued right away.
+func (s *Socket) TrySend(b []byte) error {
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+
+	return wouldBlock(s.deliver(context.Background(), [][]byte{b}, SendDontWait))
+}
+
+// TrySendMultipart is like SendMultipart, but never blocks. It
+// returns ErrWouldBlock if the message cannot be queued right away.
+func (s *Socket) TrySendMultipart(b [][]byte) error {
+	return wouldBlock(s.sendMultipart(context.Background(), b, SendDontWait))
+}
+
+// wouldBlock turns the errors of sending without waiting
+// that waiting could have avoided into ErrWouldBlock.
+func wouldBlock(err error) error {
+	if errors.Is(err, ErrNoPeers) || errors.Is(err, ErrMemoryLimit) || errors.Is(err, ErrWouldBlock) {
+		return ErrWouldBlock
+	}
+	return err
+}
+
+// SendWith is like Send, but uses mode instead of the
+// socket's send mode unless mode is SendDefault.
+func (s *Socket) SendWith(b []byte, mode SendMode) error {
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+	return s.deliver(context.Background(), [][]byte{b}, mode)
+}
+
+// errNoFrames is returned when sending a message without
+// frames, which ZMTP cannot carry. Messages made of empty
+// frames are fine.
+var errNoFrames = errors.New("gomq: message has no frames")
+
+// SendMultipartWith is like SendMultipart, but uses mode instead
+// of the socket's send mode unless mode is SendDefault.
+func (s *Socket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return s.sendMultipart(context.Background(), b, mode)
+}
+
+// sendMultipart checks and queues a message of one or more
+// frames using mode, waiting no longer than ctx allows.
+func (s *Socket) sendMultipart(ctx context.Context, b [][]byte, mode SendMode) error {
+	if len(b) == 0 {
+		return errNoFrames
+	}
+	if len(b) != 1 && !multipartAllowed(s.sockType) {
+		return ErrMultipart
+	}
+	if err := s.validate(b, true); err != nil {
+		return err
+	}
+	if s.sockType != zmtp.DealerSocketType {
+		return s.deliver(ctx, b, mode)
+	}
+
 	d := make([][]byte, len(b)+1) // FIXME(sbinet): allocates
 	d[0] = nil                    // Socket-Identity
 	copy(d[1:], b)
-	return s.conns[s.ids[0]].zmtp.SendMultipart(d)
+	return s.deliver(ctx, d, mode)
 }
 
-func (s *Socket) RecvMultipart() ([][]byte, error) {
-	msg := <-s.recvChannel
-	if msg.MessageType == zmtp.CommandMessage {
+// SendAll queues a copy of the message to every one
+// of the socket's peers. Messages sent with SendAll
+// are not journaled.
+func (s *Socket) SendAll(b []byte) error {
+	return s.SendToLabel("", b)
+}
+
+// SendToLabel is like SendAll, but only queues the message
+// to the peers whose labels match selector, see Labels.Match.
+// It fails with ErrNoPeers if no peer matches.
+func (s *Socket) SendToLabel(selector string, b []byte) error {
+	if err := s.validate([][]byte{b}, true); err != nil {
+		return err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	select {
+	case <-s.done:
+		return &SendError{Outcome: Dropped, Err: ErrClosed}
+	default:
+	}
+
+	sent, full := 0, false
+	for _, id := range s.ids {
+		if !s.conns[id].labels.Match(selector) {
+			continue
+		}
+		ok, outboxFull := s.conns[id].outbox.offer(&outgoing{frames: [][]byte{b}})
+		if ok {
+			sent++
+		}
+		full = full || outboxFull
+	}
+
+	if sent == 0 && full {
+		return &SendError{Outcome: Dropped, Err: ErrWouldBlock}
+	}
+	if sent == 0 {
+		return &SendError{Outcome: Dropped, Err: ErrNoPeers}
+	}
+	return nil
+}
+
+// SetSendMode sets what sending does by default when
+// a message cannot be queued right away.
+func (s *Socket) SetSendMode(mode SendMode) {
+	s.lock.Lock()
+	s.sendMode = mode
+	s.lock.Unlock()
+}
+
+// deliver journals msg, if the socket has a journal,
+// and queues it using mode.
+func (s *Socket) deliver(ctx context.Context, frames [][]byte, mode SendMode) error {
+	msg := &outgoing{frames: frames}
+
+	s.lock.RLock()
+	journal := s.journal
+	s.lock.RUnlock()
+
+	if journal != nil {
+		seq, err := journal.append(frames)
+		if err != nil {
+			return &SendError{Outcome: Dropped, Err: err}
+		}
+		msg.seq = seq
 	}
+
+	return s.deliverOutgoing(ctx, msg, mode)
+}
+
+// deliverOutgoing queues msg, blocking, dropping it or
+// failing according to mode when no peer can take it.
+// Blocking ends with ctx.Err() if ctx is done first.
+func (s *Socket) deliverOutgoing(ctx context.Context, msg *outgoing, mode SendMode) error {
+	if mode == SendDefault {
+		s.lock.RLock()
+		mode = s.sendMode
+		s.lock.RUnlock()
+	}
+
+	if ok, err := s.admit(ctx, msg, mode); !ok {
+		return err
+	}
+
+	for {
+		room := s.sendRoom.wait()
+		changed, err := s.enqueue(msg)
+		if err != ErrNoPeers && err != ErrWouldBlock {
+			if err != nil {
+				s.settle(msg)
+				return &SendError{Outcome: Dropped, Err: err}
+			}
+			return nil
+		}
+
+		switch mode {
+		case SendBlock:
+			select {
+			case <-changed:
+			case <-room:
+			case <-ctx.Done():
+				s.settle(msg)
+				return &SendError{Outcome: Dropped, Err: ctx.Err()}
+			case <-s.done:
+				s.settle(msg)
+				return &SendError{Outcome: Dropped, Err: ErrClosed}
+			}
+		case SendDrop:
+			s.settle(msg)
+			reason := DropUnroutable
+			if err == ErrWouldBlock {
+				reason = DropHighWaterMark
+			}
+			s.deadLetter(DeadLetter{Reason: reason, Message: msg.frames, Err: err})
+			return nil
+		default:
+			s.settle(msg)
+			return &SendError{Outcome: Dropped, Err: err}
+		}
+	}
+}
+
+// enqueue pushes a message onto the outbox of the first peer
+// that accepts it, starting from the peer after the one the
+// previous message started from, so that messages are spread
+// round-robin. It also returns a channel that is closed the
+// next time the socket's peers change.
+func (s *Socket) enqueue(msg *outgoing) (<-chan struct{}, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	select {
+	case <-s.done:
+		return s.peersChanged, ErrClosed
+	default:
+	}
+
+	full := false
+	start := atomic.AddUint32(&s.rotation, 1)
+	for i := range s.ids {
+		conn := s.conns[s.ids[(start+uint32(i))%uint32(len(s.ids))]]
+		if conn.goingAway {
+			continue
+		}
+		ok, probe := s.routable(conn)
+		if !ok {
+			continue
+		}
+		ok, outboxFull := conn.outbox.offer(msg)
+		if ok {
+			return s.peersChanged, nil
+		}
+		full = full || outboxFull
+		if probe {
+			s.releaseProbe(conn)
+		}
+	}
+	if len(s.ids) == 0 {
+		held, pendingFull := s.hold(msg)
+		if held {
+			return s.peersChanged, nil
+		}
+		full = pendingFull
+	}
+	if full {
+		return s.peersChanged, ErrWouldBlock
+	}
+	return s.peersChanged, ErrNoPeers
+}
+
+// sendTo queues frames toward the peer with the given ID.
+// If the peer is gone, the message goes to the dead letter
+// handler instead.
+func (s *Socket) sendTo(id string, frames [][]byte) {
+	s.lock.RLock()
+	conn := s.conns[id]
+	s.lock.RUnlock()
+
+	if conn == nil {
+		s.deadLetter(DeadLetter{Reason: DropUnroutable, PeerID: id, Message: frames, Err: ErrUnknownPeer})
+		return
+	}
+	switch ok, full := conn.outbox.offer(&outgoing{frames: frames}); {
+	case full:
+		s.deadLetter(DeadLetter{Reason: DropHighWaterMark, PeerID: id, Endpoint: conn.endpoint, Message: frames, Err: ErrWouldBlock})
+	case !ok:
+		s.deadLetter(DeadLetter{Reason: DropUnroutable, PeerID: id, Message: frames, Err: ErrUnknownPeer})
+	}
+}
+
+// settle removes msg from the socket's journal, once
+// the message has been written or deliberately dropped.
+func (s *Socket) settle(msg *outgoing) {
+	if msg.seq == 0 {
+		return
+	}
+
+	s.lock.RLock()
+	journal := s.journal
+	s.lock.RUnlock()
+
+	if journal != nil {
+		journal.ack(msg.seq)
+	}
+}
+
+// maxBatch is the number of messages the write buffer
+// of a connection holds at most before being flushed.
+const maxBatch = 256
+
+// write writes the messages queued in the connection's
+// outbox until it is closed and empty. Messages are batched
+// in the connection's write buffer, and only settled once
+// flushed. If writing fails, the connection is removed and
+// the messages not written out and those left in its outbox
+// are redirected to the remaining peers.
+func (s *Socket) write(conn *Connection) {
+	defer close(conn.outbox.drained)
+
+	var batch []*outgoing
+	fail := func(err error) {
+		s.disconnected(conn, err)
+		s.setEndpointState(conn.endpoint, Degraded, err)
+		s.redirect(conn, append(batch, conn.outbox.take()...), err)
+	}
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		if err := conn.zmtp.Flush(); err != nil {
+			fail(err)
+			return false
+		}
+		for _, msg := range batch {
+			s.settle(msg)
+			if msg.command == "" {
+				s.recordOutcome(conn.endpoint, false)
+			}
+		}
+		batch = batch[:0]
+		return true
+	}
+
+	for {
+		if (len(batch) >= maxBatch || conn.outbox.idle()) && !flush() {
+			return
+		}
+		msg, ok := conn.outbox.pop()
+		if !ok {
+			flush()
+			return
+		}
+
+		var err error
+		var written time.Time
+		if !msg.queued.IsZero() {
+			written = time.Now()
+		}
+		switch {
+		case msg.command != "":
+			err = conn.zmtp.SendCommand(msg.command, msg.frames[0])
+		default:
+			frames := msg.frames
+			if conn.stamper != nil {
+				frames = appendStamp(frames, conn.stamper)
+			}
+			if conn.checksum {
+				frames = appendChecksum(frames)
+			}
+			err = conn.zmtp.SendMultipart(frames)
+		}
+		batch = append(batch, msg)
+		if err != nil {
+			fail(err)
+			return
+		}
+		if msg.command == "" {
+			conn.sent(msg.frames)
+		}
+		atomic.StoreInt64(&conn.lastSent, conn.now().UnixNano())
+		if !written.IsZero() {
+			conn.outbox.recordWrite(msg.queued, written)
+		}
+	}
+}
+
+// redirect requeues messages that could not be written to
+// conn, reporting the outcome for each of them to the send
+// error handler. Messages that are dropped stay in the
+// socket's journal, if any.
+func (s *Socket) redirect(conn *Connection, msgs []*outgoing, err error) {
+	s.lock.RLock()
+	onSendError := s.onSendError
+	s.lock.RUnlock()
+
+	for _, msg := range msgs {
+		if msg.command != "" {
+			continue
+		}
+
+		outcome := Redirected
+		if _, err := s.enqueue(msg); err != nil {
+			outcome = Dropped
+		}
+
+		if outcome == Dropped {
+			s.deadLetter(DeadLetter{
+				Reason:   DropPeerLost,
+				PeerID:   conn.id,
+				Endpoint: conn.endpoint,
+				Message:  msg.frames,
+				Err:      err,
+			})
+		}
+
+		if onSendError != nil {
+			onSendError(&SendError{
+				PeerID:   conn.id,
+				Endpoint: conn.endpoint,
+				Outcome:  outcome,
+				Err:      err,
+			})
+		}
+	}
+}
+
+// PurgeQueue discards every message queued toward the
+// peer with the given id and returns how many were
+// discarded. Discarded messages go to the dead letter
+// handler, if any.
+func (s *Socket) PurgeQueue(id string) (int, error) {
+	s.lock.RLock()
+	conn, ok := s.conns[id]
+	s.lock.RUnlock()
+
+	if !ok {
+		return 0, ErrUnknownPeer
+	}
+
+	n := 0
+	for _, msg := range conn.outbox.purge() {
+		if msg.command != "" {
+			continue
+		}
+		n++
+		s.settle(msg)
+		s.deadLetter(DeadLetter{
+			Reason:   DropPurged,
+			PeerID:   conn.id,
+			Endpoint: conn.endpoint,
+			Message:  msg.frames,
+		})
+	}
+	return n, nil
+}
+
+// SetSendErrorHandler registers a function that is called,
+// without any of the socket's locks held, each time writing
+// a message to a peer fails.
+func (s *Socket) SetSendErrorHandler(fn func(*SendError)) {
+	s.lock.Lock()
+	s.onSendError = fn
+	s.lock.Unlock()
+}
+
+// RecvMultipart receives a message with all of its frames,
+// waiting until one is available.
+func (s *Socket) RecvMultipart() ([][]byte, error) {
+	msg, _ := s.next(context.Background(), true)
 	return msg.Body, msg.Err
 }
@@ -2,8 +2,12 @@ package gomq
 
 import (
 	"bytes"
+	"errors"
 	"net"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/zeromq/gomq/internal/test"
 	"github.com/zeromq/gomq/zmtp"
@@ -211,7 +215,7 @@ func TestPullPush(t *testing.T) {
 		t.Fatalf("want %q, got %q", want, got)
 	}
 
-	if err != nil {
+	if err := pull.WaitForPeers(1, time.Second); err != nil {
 		t.Fatal(err)
 	}
 
@@ -259,3 +263,477 @@ func TestDealerExtRouter(t *testing.T) {
 
 	dealer.Close()
 }
+
+func TestPeers(t *testing.T) {
+	go func() {
+		client := NewClient(zmtp.NewSecurityNull())
+		if err := client.Connect("tcp://127.0.0.1:19002"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	if _, err := server.Bind("tcp://127.0.0.1:19002"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	peers := server.Peers()
+	if want, got := 1, len(peers); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	peer := peers[0]
+	if want, got := "3.0", peer.Version; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if want, got := zmtp.ClientSocketType, peer.SocketType; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if want, got := zmtp.NullSecurityMechanismType, peer.Security.Mechanism; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if peer.Security.Encrypted {
+		t.Errorf("NULL mechanism reported as encrypted")
+	}
+}
+
+func TestWaitForPeers(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19005"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if want, got := ErrTimeout, client.WaitForPeers(1, 10*time.Millisecond); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	go func() {
+		if err := client.Connect("tcp://127.0.0.1:19005"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	if want, got := ErrClosed, server.WaitForPeers(2, time.Second); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestSendAll(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	if err := server.SendAll([]byte("HELLO")); err == nil {
+		t.Fatal("want error sending without peers")
+	}
+
+	clients := make([]Client, 2)
+	for i := range clients {
+		go func() {
+			if _, err := server.Bind("tcp://127.0.0.1:" + strconv.Itoa(19012+i)); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		clients[i] = NewClient(zmtp.NewSecurityNull())
+		defer clients[i].Close()
+
+		if err := clients[i].Connect("tcp://127.0.0.1:" + strconv.Itoa(19012+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := server.WaitForPeers(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.SendAll([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, client := range clients {
+		msg, err := client.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := "HELLO", string(msg); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestGreetingTimeout(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetGreetingTimeout(100 * time.Millisecond)
+
+	if _, err := server.Bind("tcp://127.0.0.1:19022"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19022")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// a partial greeting, then nothing
+	if _, err := conn.Write([]byte{0xFF}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Error("stalled greeting not timed out")
+			}
+			break
+		}
+	}
+
+	if want, got := Degraded, server.Endpoints()[0].State; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetHandshakeTimeout(200 * time.Millisecond)
+
+	failed := make(chan error, 1)
+	server.SetEventHandler(func(ev SocketEvent) {
+		if ev.Type == EventHandshakeFailed {
+			failed <- ev.Err
+		}
+	})
+
+	if _, err := server.Bind("tcp://127.0.0.1:19078"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19078")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// a whole greeting, then no READY
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9], greeting[10] = 0xFF, 0x7F, 3
+	copy(greeting[12:], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, zmtp.ErrHandshakeTimeout) {
+			t.Errorf("want %v, got %v", zmtp.ErrHandshakeTimeout, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stalled handshake not timed out")
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+
+	failed := make(chan error, 1)
+	pull.SetEventHandler(func(ev SocketEvent) {
+		if ev.Type == EventHandshakeFailed {
+			failed <- ev.Err
+		}
+	})
+
+	if _, err := pull.Bind("tcp://127.0.0.1:19085"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19085")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the greeting of a ZMTP 2.0 PUSH socket, with an empty identity
+	greeting := []byte{0xFF, 0, 0, 0, 0, 0, 0, 0, 1, 0x7F, 0x01, 0x08, 0x00, 0x00}
+	if _, err := conn.Write(greeting); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, zmtp.ErrUnsupportedVersion) {
+			t.Errorf("want %v, got %v", zmtp.ErrUnsupportedVersion, err)
+		}
+		if !strings.Contains(err.Error(), "unsupported peer version 2.0") {
+			t.Errorf("want the peer's version in %q", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ZMTP 2.0 peer not rejected")
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetMaxMessageSize(16)
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19024"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19024"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(bytes.Repeat([]byte("HELLO"), 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if _, err := server.Recv(); !errors.Is(err, zmtp.ErrMessageTooLarge) {
+		t.Errorf("want %v, got %v", zmtp.ErrMessageTooLarge, err)
+	}
+}
+
+func TestMaxMessageSizeHandshake(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetMaxMessageSize(16)
+
+	failed := make(chan error, 1)
+	server.SetEventHandler(func(ev SocketEvent) {
+		if ev.Type == EventHandshakeFailed {
+			failed <- ev.Err
+		}
+	})
+
+	if _, err := server.Bind("tcp://127.0.0.1:19079"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19079")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// a greeting, then a READY command announcing a terabyte
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9], greeting[10] = 0xFF, 0x7F, 3
+	copy(greeting[12:], "NULL")
+	ready := []byte{0x06, 0, 0, 1, 0, 0, 0, 0, 0}
+	if _, err := conn.Write(append(greeting, ready...)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-failed:
+		if !errors.Is(err, zmtp.ErrMessageTooLarge) {
+			t.Errorf("want %v, got %v", zmtp.ErrMessageTooLarge, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("oversized handshake command not rejected")
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+
+	go func() {
+		if _, err := pull.Bind("tcp://127.0.0.1:19042"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+
+	if err := push.Connect("tcp://127.0.0.1:19042"); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := [][]byte{[]byte("key"), nil, []byte("value")}
+	if err := push.SendMultipart(frames); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := pull.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := len(frames), len(msg); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range frames {
+		if want, got := frames[i], msg[i]; !bytes.Equal(want, got) {
+			t.Errorf("frame %d: want %q, got %q", i, want, got)
+		}
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if want, got := ErrMultipart, client.SendMultipart(frames); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestEmptyFrames(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+
+	go func() {
+		if _, err := pull.Bind("tcp://127.0.0.1:19043"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+
+	if err := push.Connect("tcp://127.0.0.1:19043"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, frames := range [][][]byte{
+		{nil},
+		{{}},
+		{nil, nil, nil},
+		{nil, []byte("body"), nil},
+	} {
+		if err := push.SendMultipart(frames); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := pull.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := len(frames), len(msg); want != got {
+			t.Fatalf("want %v frames, got %v", want, got)
+		}
+		for i := range frames {
+			if want, got := frames[i], msg[i]; !bytes.Equal(want, got) {
+				t.Errorf("frame %d: want %q, got %q", i, want, got)
+			}
+		}
+	}
+
+	if err := push.SendMultipart(nil); err == nil {
+		t.Error("want an error sending a message without frames")
+	}
+}
+
+func TestPushRoundRobin(t *testing.T) {
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+
+	pulls := make([]*PullSocket, 2)
+	for i := range pulls {
+		go func() {
+			if _, err := push.Bind("tcp://127.0.0.1:" + strconv.Itoa(19047+i)); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		pulls[i] = NewPull(zmtp.NewSecurityNull())
+		defer pulls[i].Close()
+
+		if err := pulls[i].Connect("tcp://127.0.0.1:" + strconv.Itoa(19047+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := push.WaitForPeers(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := push.Send([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pull := range pulls {
+		for i := 0; i < 2; i++ {
+			if _, err := pull.Recv(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// plainClient is a Client implemented outside of the
+// package, with no more methods than the interface.
+type plainClient struct {
+	ZeroMQSocket
+}
+
+func (c plainClient) Connect(endpoint string) error {
+	return ConnectClient(c, endpoint)
+}
+
+func TestPlainSocket(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("inproc://plain-socket"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := plainClient{NewClient(zmtp.NewSecurityNull())}
+	defer client.Close()
+	if want, got := defaultGreetingTimeout, baseOf(client).GreetingTimeout(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if err := client.Connect("inproc://plain-socket"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendWith(client, []byte("HELLO"), SendBlock); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
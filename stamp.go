@@ -0,0 +1,96 @@
+package gomq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// stampMagic starts the frames holding a Stamp, followed by
+// the stamp's time, in nanoseconds since the epoch, as 8
+// big-endian bytes, and by its id.
+const stampMagic = "\x00gomq-stamp\x00"
+
+// Stamp identifies a message and records when it was
+// first sent, for tracing messages across hops and
+// measuring their latency.
+type Stamp struct {
+	ID   []byte
+	Time time.Time
+}
+
+// Stamper generates the stamps of the messages a socket
+// sends, see SetStamper. It must be goroutine safe.
+type Stamper interface {
+	Stamp() Stamp
+}
+
+// StamperFunc is a function used as a Stamper.
+type StamperFunc func() Stamp
+
+// Stamp calls f.
+func (f StamperFunc) Stamp() Stamp {
+	return f()
+}
+
+// UUIDStamper stamps messages with a random
+// UUID and the current time.
+type UUIDStamper struct{}
+
+// Stamp returns a new stamp.
+func (UUIDStamper) Stamp() Stamp {
+	id, err := newUUID()
+	if err != nil {
+		panic(err)
+	}
+	return Stamp{ID: []byte(id), Time: time.Now()}
+}
+
+// SetStamper makes the socket end each message it sends on
+// connections established from then on with a frame holding
+// a stamp from stamper, which receivers get back with
+// SplitStamp. Messages already ending with a stamp, such as
+// those forwarded by a proxy, keep theirs, so that stamps
+// identify messages and time them from their first hop.
+// Commands and the messages of CLIENT and SERVER sockets,
+// which only have one frame, are not stamped. A nil stamper
+// stamps nothing, the default.
+func (s *Socket) SetStamper(stamper Stamper) {
+	s.lock.Lock()
+	s.stamper = stamper
+	s.lock.Unlock()
+}
+
+// SplitStamp returns the stamp ending msg and msg without it.
+// It returns false, and msg, if msg does not end with a stamp.
+func SplitStamp(msg [][]byte) (Stamp, [][]byte, bool) {
+	if len(msg) < 2 || !isStamp(msg[len(msg)-1]) {
+		return Stamp{}, msg, false
+	}
+	frame := msg[len(msg)-1][len(stampMagic):]
+	nanos := int64(binary.BigEndian.Uint64(frame))
+	return Stamp{ID: frame[8:], Time: time.Unix(0, nanos)}, msg[:len(msg)-1], true
+}
+
+// isStamp reports whether frame holds a stamp.
+func isStamp(frame []byte) bool {
+	return len(frame) >= len(stampMagic)+8 && bytes.HasPrefix(frame, []byte(stampMagic))
+}
+
+// appendStamp returns frames followed by a stamp from stamper,
+// leaving frames untouched, unless they already end with one.
+func appendStamp(frames [][]byte, stamper Stamper) [][]byte {
+	if len(frames) > 0 && isStamp(frames[len(frames)-1]) {
+		return frames
+	}
+
+	stamp := stamper.Stamp()
+	frame := make([]byte, 0, len(stampMagic)+8+len(stamp.ID))
+	frame = append(frame, stampMagic...)
+	frame = binary.BigEndian.AppendUint64(frame, uint64(stamp.Time.UnixNano()))
+	frame = append(frame, stamp.ID...)
+
+	stamped := make([][]byte, len(frames), len(frames)+1)
+	copy(stamped, frames)
+	return append(stamped, frame)
+}
@@ -0,0 +1,61 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestStamp(t *testing.T) {
+	sent := time.Unix(1700000000, 42)
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("inproc://stamp"); err != nil {
+		t.Fatal(err)
+	}
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	push.SetStamper(StamperFunc(func() Stamp {
+		return Stamp{ID: []byte("msg-1"), Time: sent}
+	}))
+	if err := push.Connect("inproc://stamp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := push.SendMultipart([][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := pull.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp, body, ok := SplitStamp(msg)
+	if !ok {
+		t.Fatalf("want a stamp, got %q", msg)
+	}
+	if want, got := "msg-1", string(stamp.ID); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if !stamp.Time.Equal(sent) {
+		t.Errorf("want %v, got %v", sent, stamp.Time)
+	}
+	if want, got := 2, len(body); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// forwarded messages keep their first stamp
+	forwarded := appendStamp(msg, UUIDStamper{})
+	if want, got := len(msg), len(forwarded); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	restamped := appendStamp(body, UUIDStamper{})
+	if stamp, _, ok := SplitStamp(restamped); !ok || len(stamp.ID) != 36 {
+		t.Errorf("want a UUID stamp, got %q", stamp.ID)
+	}
+
+	if _, body, ok := SplitStamp(body); ok || len(body) != 2 {
+		t.Errorf("want no stamp, got %v", ok)
+	}
+}
@@ -0,0 +1,206 @@
+package gomq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// stateSnapshotCommand is the request a StateReplica sends
+// to the snapshot socket of a StatePublisher.
+const stateSnapshotCommand = "SNAPSHOT"
+
+// ErrStateGap is returned by StateReplica.Apply when updates
+// were missed, such as dropped at a high water mark. The
+// replica must be loaded again.
+var ErrStateGap = errors.New("gomq: state updates missed")
+
+// StatePublisher publishes a keyed state, as in the Clone
+// pattern: each change is published on a PUB socket as an
+// update numbered in sequence, and the whole state is served
+// on a ROUTER socket to the StateReplica asking for it, so that
+// late joiners start from a snapshot and then apply updates.
+//
+// Updates are published as messages of the key, the sequence
+// number as 8 big-endian bytes and the value, without it for
+// deletions, so that subscribers can subscribe to key prefixes.
+// Snapshots are sent as a single message of the sequence number
+// followed by pairs of key and value frames.
+type StatePublisher struct {
+	pub       *PubSocket
+	snapshots *RouterSocket
+
+	lock  sync.Mutex
+	seq   uint64
+	state map[string][]byte
+}
+
+// NewStatePublisher returns a StatePublisher publishing updates
+// on pub and serving snapshots on snapshots, once Run is called.
+func NewStatePublisher(pub *PubSocket, snapshots *RouterSocket) *StatePublisher {
+	return &StatePublisher{pub: pub, snapshots: snapshots, state: make(map[string][]byte)}
+}
+
+// Set sets key to value and publishes the update.
+func (p *StatePublisher) Set(key string, value []byte) error {
+	value = append([]byte{}, value...)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.seq++
+	p.state[key] = value
+	return p.pub.SendMultipart([][]byte{[]byte(key), stateSeq(p.seq), value})
+}
+
+// Delete deletes key and publishes the update.
+func (p *StatePublisher) Delete(key string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.seq++
+	delete(p.state, key)
+	return p.pub.SendMultipart([][]byte{[]byte(key), stateSeq(p.seq)})
+}
+
+// Seq returns the sequence number of the last update.
+func (p *StatePublisher) Seq() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.seq
+}
+
+// Run serves snapshots until ctx is done or the snapshot
+// socket is closed, and returns why.
+func (p *StatePublisher) Run(ctx context.Context) error {
+	for {
+		msg, err := p.snapshots.RecvMultipartContext(ctx)
+		if err != nil {
+			return err
+		}
+		// the request is preceded by its envelope, which
+		// the snapshot is sent back with
+		n := len(msg) - 1
+		if n < 1 || string(msg[n]) != stateSnapshotCommand {
+			continue
+		}
+
+		p.lock.Lock()
+		snapshot := make([][]byte, 0, n+1+2*len(p.state))
+		snapshot = append(append(snapshot, msg[:n]...), stateSeq(p.seq))
+		for key, value := range p.state {
+			snapshot = append(snapshot, []byte(key), value)
+		}
+		p.lock.Unlock()
+
+		if err := p.snapshots.SendMultipartContext(ctx, snapshot); err != nil {
+			return err
+		}
+	}
+}
+
+// stateSeq encodes the sequence number of an update.
+func stateSeq(seq uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], seq)
+	return b[:]
+}
+
+// StateReplica is a copy of the state of a StatePublisher, loaded
+// from a snapshot and kept up to date by applying the updates
+// received on a SUB socket. Its methods are safe for concurrent
+// use.
+type StateReplica struct {
+	lock  sync.RWMutex
+	seq   uint64
+	state map[string][]byte
+}
+
+// NewStateReplica returns an empty StateReplica.
+func NewStateReplica() *StateReplica {
+	return &StateReplica{state: make(map[string][]byte)}
+}
+
+// Load replaces the state of the replica with a snapshot asked
+// for on snapshots, a DEALER connected to the snapshot socket of
+// a StatePublisher. The SUB socket receiving the updates should
+// be subscribed before, so that no update falls between the
+// snapshot and the first one received.
+func (r *StateReplica) Load(ctx context.Context, snapshots ZeroMQSocket) error {
+	if err := snapshots.SendMultipartContext(ctx, [][]byte{[]byte(stateSnapshotCommand)}); err != nil {
+		return err
+	}
+	msg, err := snapshots.RecvMultipartContext(ctx)
+	if err != nil {
+		return err
+	}
+	if len(msg) > 0 && len(msg[0]) == 0 {
+		msg = msg[1:] // the envelope delimiter
+	}
+	if len(msg)%2 != 1 || len(msg[0]) != 8 {
+		return fmt.Errorf("gomq: malformed state snapshot of %d frames", len(msg))
+	}
+
+	state := make(map[string][]byte, len(msg)/2)
+	for i := 1; i < len(msg); i += 2 {
+		state[string(msg[i])] = msg[i+1]
+	}
+
+	r.lock.Lock()
+	r.seq = binary.BigEndian.Uint64(msg[0])
+	r.state = state
+	r.lock.Unlock()
+	return nil
+}
+
+// Apply applies an update received from the StatePublisher.
+// Updates already part of the state, such as those published
+// before the snapshot was taken, are skipped. It returns
+// ErrStateGap without applying msg if updates are missing
+// before it. The SUB socket receiving updates must therefore
+// be subscribed to every key, or the updates to the others
+// would look missing.
+func (r *StateReplica) Apply(msg [][]byte) error {
+	if len(msg) < 2 || len(msg) > 3 || len(msg[1]) != 8 {
+		return fmt.Errorf("gomq: malformed state update of %d frames", len(msg))
+	}
+	seq := binary.BigEndian.Uint64(msg[1])
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch {
+	case seq <= r.seq:
+		return nil
+	case seq > r.seq+1:
+		return ErrStateGap
+	}
+	r.seq = seq
+	if len(msg) == 3 {
+		r.state[string(msg[0])] = msg[2]
+	} else {
+		delete(r.state, string(msg[0]))
+	}
+	return nil
+}
+
+// Get returns the value of key, and whether it is set.
+func (r *StateReplica) Get(key string) ([]byte, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	value, ok := r.state[key]
+	return value, ok
+}
+
+// Len returns the number of keys set.
+func (r *StateReplica) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.state)
+}
+
+// Seq returns the sequence number of the last update applied.
+func (r *StateReplica) Seq() uint64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.seq
+}
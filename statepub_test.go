@@ -0,0 +1,91 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestStatePublisher(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if _, err := pub.Bind("inproc://state-updates"); err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+	if _, err := router.Bind("inproc://state-snapshots"); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewStatePublisher(pub, router)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	p.Set("a", []byte("1"))
+	p.Set("b", []byte("2"))
+	p.Delete("a")
+
+	// a late joiner subscribes, then loads a snapshot
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	sub.Subscribe(nil)
+	if err := sub.Connect("inproc://state-updates"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.WaitForSubscribers(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	p.Set("c", []byte("3"))
+
+	dealer := NewDealer(zmtp.NewSecurityNull(), "replica")
+	defer dealer.Close()
+	if err := dealer.Connect("inproc://state-snapshots"); err != nil {
+		t.Fatal(err)
+	}
+	r := NewStateReplica()
+	if err := r.Load(ctx, dealer); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(4), r.Seq(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 2, r.Len(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// the update already in the snapshot is skipped
+	p.Set("b", []byte("4"))
+	for _, want := range []uint64{4, 5} {
+		msg, err := sub.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Apply(msg); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Seq(); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+	if value, ok := r.Get("b"); !ok || string(value) != "4" {
+		t.Errorf("want %q, got %q, %v", "4", value, ok)
+	}
+	if _, ok := r.Get("a"); ok {
+		t.Error("want a deleted")
+	}
+
+	// a missed update is reported, and not applied
+	if want, got := ErrStateGap, r.Apply([][]byte{[]byte("d"), stateSeq(7), []byte("5")}); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if _, ok := r.Get("d"); ok {
+		t.Error("want d not applied")
+	}
+	if err := r.Apply([][]byte{[]byte("d")}); err == nil {
+		t.Error("want an error applying a malformed update")
+	}
+}
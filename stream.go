@@ -0,0 +1,248 @@
+package gomq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Kinds of the messages exchanged by streams, found in
+// their first byte.
+const (
+	streamData   = 'd'
+	streamCredit = 'c'
+	streamFin    = 'f'
+)
+
+var (
+	// streamWindow is the number of bytes a stream may send
+	// before the other end grants it more by reading them.
+	streamWindow = 256 << 10
+
+	// streamChunk is the largest payload of a data message.
+	streamChunk = 32 << 10
+)
+
+// Stream is an io.ReadWriteCloser carrying an octet stream
+// over the messages of a socket connected to a single peer,
+// such as a CLIENT socket, so that stream oriented libraries
+// can be used over ZMTP. Both ends must use a Stream, or
+// streams of a Session to share one connection. Flow
+// control keeps each end from sending more than a window of
+// bytes that the other end has not read yet.
+type Stream struct {
+	send        func([]byte) error
+	lock        sync.Mutex
+	cond        *sync.Cond
+	buf         bytes.Buffer
+	credit      int
+	consumed    int
+	err         error
+	closed      bool
+	writeClosed bool
+
+	// onClose, if set, is called once the stream is closed.
+	onClose func()
+}
+
+// NewStream returns a Stream over s. The stream receives
+// every message sent to s from then on.
+func NewStream(s ZeroMQSocket) *Stream {
+	done := make(chan time.Time)
+	st := newStream(func(b []byte) error {
+		return sendWith(s, b, SendBlock)
+	})
+	st.onClose = func() { close(done) }
+
+	go func() {
+		for {
+			i, msg, err := Select([]Case{{Socket: s}, {Timer: done}}, -1)
+			if i == 1 {
+				return
+			}
+			if err == nil && len(msg) == 0 {
+				err = errInvalidStreamMessage
+			}
+			if err != nil {
+				st.abort(err)
+				return
+			}
+			st.deliver(msg[0])
+		}
+	}()
+	return st
+}
+
+var errInvalidStreamMessage = errors.New("gomq: invalid stream message")
+
+// newStream returns a stream sending its messages with send.
+// Messages received for the stream are passed to deliver.
+func newStream(send func([]byte) error) *Stream {
+	st := &Stream{
+		send:   send,
+		credit: streamWindow,
+	}
+	st.cond = sync.NewCond(&st.lock)
+	return st
+}
+
+// deliver handles a message received for the stream.
+func (st *Stream) deliver(b []byte) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if len(b) == 0 {
+		st.fail(errInvalidStreamMessage)
+		return
+	}
+	switch b[0] {
+	case streamData:
+		st.buf.Write(b[1:])
+	case streamCredit:
+		if len(b) == 5 {
+			st.credit += int(binary.BigEndian.Uint32(b[1:]))
+		}
+	case streamFin:
+		st.fail(io.EOF)
+	}
+	st.cond.Broadcast()
+}
+
+// abort fails the stream with err, such as when the
+// underlying connection is lost.
+func (st *Stream) abort(err error) {
+	st.lock.Lock()
+	st.fail(err)
+	st.lock.Unlock()
+}
+
+// fail records the error Read returns once the
+// buffered data is consumed. The caller must hold
+// the lock.
+func (st *Stream) fail(err error) {
+	if st.err == nil {
+		st.err = err
+	}
+	st.cond.Broadcast()
+}
+
+// Read reads data sent by the other end of the stream.
+// It returns io.EOF once the other end closed the stream.
+func (st *Stream) Read(p []byte) (int, error) {
+	st.lock.Lock()
+	for st.buf.Len() == 0 && st.err == nil && !st.closed {
+		st.cond.Wait()
+	}
+	if st.closed {
+		st.lock.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if st.buf.Len() == 0 {
+		err := st.err
+		st.lock.Unlock()
+		return 0, err
+	}
+
+	n, _ := st.buf.Read(p)
+	st.consumed += n
+	grant := 0
+	if st.consumed >= streamWindow/2 {
+		grant, st.consumed = st.consumed, 0
+	}
+	st.lock.Unlock()
+
+	if grant > 0 {
+		msg := make([]byte, 5)
+		msg[0] = streamCredit
+		binary.BigEndian.PutUint32(msg[1:], uint32(grant))
+		if err := st.send(msg); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Write sends p to the other end of the stream, blocking
+// while the other end has a full window of unread data.
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		st.lock.Lock()
+		// the other end closing its side of the stream
+		// does not stop this side from writing
+		for st.credit == 0 && (st.err == nil || st.err == io.EOF) && !st.closed {
+			st.cond.Wait()
+		}
+		if st.closed || st.writeClosed {
+			st.lock.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		if st.err != nil && st.err != io.EOF {
+			err := st.err
+			st.lock.Unlock()
+			return written, err
+		}
+
+		n := len(p)
+		if n > st.credit {
+			n = st.credit
+		}
+		if n > streamChunk {
+			n = streamChunk
+		}
+		st.credit -= n
+		st.lock.Unlock()
+
+		msg := make([]byte, 1+n)
+		msg[0] = streamData
+		copy(msg[1:], p[:n])
+		if err := st.send(msg); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite tells the other end that no more data will
+// be written, which it reads as io.EOF, while data can still
+// be read from the stream.
+func (st *Stream) CloseWrite() error {
+	st.lock.Lock()
+	if st.closed || st.writeClosed {
+		st.lock.Unlock()
+		return nil
+	}
+	st.writeClosed = true
+	st.cond.Broadcast()
+	st.lock.Unlock()
+
+	return st.send([]byte{streamFin})
+}
+
+// Close tells the other end that no more data will be
+// written, then closes the stream. The socket is left
+// open.
+func (st *Stream) Close() error {
+	st.lock.Lock()
+	if st.closed {
+		st.lock.Unlock()
+		return nil
+	}
+	writeClosed := st.writeClosed
+	st.closed = true
+	st.cond.Broadcast()
+	st.lock.Unlock()
+
+	if st.onClose != nil {
+		st.onClose()
+	}
+	if writeClosed {
+		return nil
+	}
+	return st.send([]byte{streamFin})
+}
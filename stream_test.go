@@ -0,0 +1,55 @@
+package gomq
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestStream(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	go func() {
+		if _, err := server.Bind("tcp://127.0.0.1:19031"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	if err := client.Connect("tcp://127.0.0.1:19031"); err != nil {
+		t.Fatal(err)
+	}
+
+	// larger than the window, so that the writer
+	// depends on credit granted by the reader
+	data := bytes.Repeat([]byte("0123456789abcdef"), streamWindow/4)
+
+	w := NewStream(client)
+	r := NewStream(server)
+	defer r.Close()
+
+	go func() {
+		if n, err := w.Write(data); err != nil || n != len(data) {
+			t.Errorf("write: %d, %v", n, err)
+		}
+		w.Close()
+	}()
+
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("want %d bytes, got %d", len(data), len(got))
+	}
+
+	if want, got := io.EOF, func() error { _, err := r.Read(make([]byte, 1)); return err }(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
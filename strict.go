@@ -0,0 +1,66 @@
+package gomq
+
+import (
+	"fmt"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// SetStrict makes the socket check its peers against the letter
+// of ZMTP, RFC 23, see zmtp.Connection.SetStrict. REQ and REP
+// sockets also check that the messages they receive carry the
+// empty delimiter frame RFC 28 requires, rather than discarding
+// those that do not. A violation fails the connection with a
+// *zmtp.Violation telling which rule the peer broke, which is
+// reported to the endpoint state handler. It applies to the
+// connections made after the change.
+func (s *Socket) SetStrict(strict bool) {
+	s.lock.Lock()
+	s.strict = strict
+	s.lock.Unlock()
+}
+
+// Strict reports whether the socket checks
+// its peers strictly, see SetStrict.
+func (s *Socket) Strict() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.strict
+}
+
+// envelopeCheck returns the RFC 28 check of the messages
+// received by sockets of type t, or nil if there is none:
+// replies to REQ sockets start with the delimiter, and
+// requests to REP sockets have one after their envelope.
+func envelopeCheck(t zmtp.SocketType) func([][]byte) error {
+	var first bool
+	switch t {
+	case zmtp.ReqSocketType:
+		first = true
+	case zmtp.RepSocketType:
+	default:
+		return nil
+	}
+
+	return func(msg [][]byte) error {
+		for i, frame := range msg {
+			if len(frame) == 0 {
+				return nil
+			}
+			if first || i == len(msg)-1 {
+				return &zmtp.Violation{
+					Rule:     "RFC 28 envelope",
+					Field:    fmt.Sprintf("frame %d", i),
+					Expected: "an empty delimiter frame",
+					Got:      fmt.Sprintf("%d bytes", len(frame)),
+				}
+			}
+		}
+		return &zmtp.Violation{
+			Rule:     "RFC 28 envelope",
+			Field:    "message",
+			Expected: "an empty delimiter frame",
+			Got:      "no frames",
+		}
+	}
+}
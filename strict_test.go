@@ -0,0 +1,61 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestStrictEnvelope(t *testing.T) {
+	endpoint := "tcp://127.0.0.1:19067"
+
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+	rep.SetStrict(true)
+	violations := make(chan error, 1)
+	rep.SetEndpointStateHandler(func(status EndpointStatus) {
+		var v *zmtp.Violation
+		if status.State == Degraded && errors.As(status.LastError, &v) {
+			violations <- v
+		}
+	})
+	if _, err := rep.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:19067")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	dealer := zmtp.NewConnection(conn)
+	if _, err := dealer.Prepare(zmtp.NewSecurityNull(), zmtp.DealerSocketType, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dealer.SendMultipart([][]byte{[]byte("no"), []byte("delimiter")}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-violations:
+		if want, got := "RFC 28 envelope", err.(*zmtp.Violation).Rule; want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Error("violation not reported")
+	}
+
+	check := envelopeCheck(zmtp.ReqSocketType)
+	if err := check([][]byte{{}, []byte("reply")}); err != nil {
+		t.Error(err)
+	}
+	if err := check([][]byte{[]byte("id"), {}, []byte("reply")}); err == nil {
+		t.Error("want replies to REQ sockets to start with the delimiter")
+	}
+	if envelopeCheck(zmtp.DealerSocketType) != nil {
+		t.Error("want no envelope check for DEALER sockets")
+	}
+}
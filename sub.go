@@ -0,0 +1,151 @@
+package gomq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// SubSocket is a ZMQ_SUB socket type. It receives the
+// messages its peers publish starting with one of the
+// prefixes it subscribed to. It cannot send.
+// See: https://rfc.zeromq.org/spec:29
+type SubSocket struct {
+	*Socket
+	subLock       sync.Mutex
+	subscriptions [][]byte
+}
+
+// NewSub accepts a zmtp.SecurityMechanism and
+// returns a SubSocket.
+func NewSub(mechanism zmtp.SecurityMechanism) *SubSocket {
+	return &SubSocket{
+		Socket: NewSocket(false, zmtp.SubSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// sub socket to it, over any registered transport.
+func (s *SubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(s, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (s *SubSocket) ResumeListening(endpoint string) error {
+	return resumeListening(s, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// sub socket to it, over any registered transport.
+func (s *SubSocket) Connect(endpoint string) error {
+	return ConnectClient(s, endpoint)
+}
+
+// AddConnection adds a gomq.Connection to the socket and
+// sends the socket's subscriptions to the peer.
+func (s *SubSocket) AddConnection(conn *Connection) {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+
+	s.Socket.AddConnection(conn)
+	for _, prefix := range s.subscriptions {
+		conn.outbox.push(&outgoing{frames: [][]byte{prefix}, command: subscribeCommand})
+	}
+}
+
+// Subscribe subscribes the socket to the messages starting
+// with prefix. An empty prefix subscribes to every message.
+func (s *SubSocket) Subscribe(prefix []byte) error {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+
+	prefix = append([]byte(nil), prefix...)
+	s.subscriptions = append(s.subscriptions, prefix)
+	s.command(subscribeCommand, prefix)
+	return nil
+}
+
+// Unsubscribe cancels one subscription to prefix.
+func (s *SubSocket) Unsubscribe(prefix []byte) error {
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+
+	for i, p := range s.subscriptions {
+		if bytes.Equal(p, prefix) {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			s.command(cancelCommand, p)
+			return nil
+		}
+	}
+	return fmt.Errorf("gomq: not subscribed to %q", prefix)
+}
+
+// command sends a command to every peer of the socket.
+func (s *SubSocket) command(name string, body []byte) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, id := range s.ids {
+		s.conns[id].outbox.push(&outgoing{frames: [][]byte{body}, command: name})
+	}
+}
+
+// Send returns ErrNotSupported.
+func (s *SubSocket) Send([]byte) error {
+	return ErrNotSupported
+}
+
+// SendWith returns ErrNotSupported.
+func (s *SubSocket) SendWith([]byte, SendMode) error {
+	return ErrNotSupported
+}
+
+// TrySend returns ErrNotSupported.
+func (s *SubSocket) TrySend([]byte) error {
+	return ErrNotSupported
+}
+
+// TrySendMultipart returns ErrNotSupported.
+func (s *SubSocket) TrySendMultipart([][]byte) error {
+	return ErrNotSupported
+}
+
+// SendPriority returns ErrNotSupported.
+func (s *SubSocket) SendPriority([]byte) error {
+	return ErrNotSupported
+}
+
+// SendMultipart returns ErrNotSupported.
+func (s *SubSocket) SendMultipart([][]byte) error {
+	return ErrNotSupported
+}
+
+// SendMultipartWith returns ErrNotSupported.
+func (s *SubSocket) SendMultipartWith([][]byte, SendMode) error {
+	return ErrNotSupported
+}
+
+// SendContext returns ErrNotSupported.
+func (s *SubSocket) SendContext(context.Context, []byte) error {
+	return ErrNotSupported
+}
+
+// SendMultipartContext returns ErrNotSupported.
+func (s *SubSocket) SendMultipartContext(context.Context, [][]byte) error {
+	return ErrNotSupported
+}
+
+// SendTo returns ErrNotSupported.
+func (s *SubSocket) SendTo(string, []byte) error {
+	return ErrNotSupported
+}
+
+var (
+	_ Client = (*SubSocket)(nil)
+	_ Server = (*SubSocket)(nil)
+)
@@ -0,0 +1,63 @@
+package gomq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// subprotocolsProperty is the handshake metadata property
+// listing the application subprotocols a socket speaks,
+// most preferred first, separated by commas.
+const subprotocolsProperty = "subprotocols"
+
+// SubprotocolError is the error a handshake fails with
+// when the two ends have no application subprotocol in
+// common. It is also reported to the endpoint state
+// handler, along with the endpoint's Degraded state.
+type SubprotocolError struct {
+	Local, Remote string
+}
+
+func (e *SubprotocolError) Error() string {
+	return fmt.Sprintf("gomq: no common subprotocol, local %q, remote %q", e.Local, e.Remote)
+}
+
+// SetSubprotocols advertises the application subprotocols
+// the socket speaks, most preferred first, to peers connecting
+// from then on, typically as "name/version" strings such as
+// "orders/2". Peers that do not speak any of them fail the
+// handshake with a *SubprotocolError, catching version skew
+// at connect time. The subprotocol agreed with each peer is
+// reported in PeerInfo.Subprotocol.
+func (s *Socket) SetSubprotocols(protocols ...string) {
+	s.SetMetadata(subprotocolsProperty, strings.Join(protocols, ","))
+}
+
+// negotiateSubprotocol returns the first of the connecting
+// side's subprotocols that the binding side also speaks, local
+// being the connecting side if connecting is true. It returns
+// an error if either side advertised subprotocols and they
+// have none in common.
+func negotiateSubprotocol(local, remote string, connecting bool) (string, error) {
+	if local == "" && remote == "" {
+		return "", nil
+	}
+
+	preferred, other := local, remote
+	if !connecting {
+		preferred, other = remote, local
+	}
+
+	supported := make(map[string]bool)
+	for _, protocol := range strings.Split(other, ",") {
+		supported[strings.TrimSpace(protocol)] = true
+	}
+
+	for _, protocol := range strings.Split(preferred, ",") {
+		protocol = strings.TrimSpace(protocol)
+		if protocol != "" && supported[protocol] {
+			return protocol, nil
+		}
+	}
+	return "", &SubprotocolError{Local: local, Remote: remote}
+}
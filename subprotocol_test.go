@@ -0,0 +1,62 @@
+package gomq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestNegotiateSubprotocol(t *testing.T) {
+	for _, test := range []struct {
+		local, remote string
+		connecting    bool
+		want          string
+		fails         bool
+	}{
+		{"orders/2,orders/1", "orders/1,orders/2", true, "orders/2", false},
+		{"orders/2,orders/1", "orders/1,orders/2", false, "orders/1", false},
+		{"orders/2", "orders/1", true, "", true},
+		{"orders/2", "", false, "", true},
+		{"", "", true, "", false},
+	} {
+		got, err := negotiateSubprotocol(test.local, test.remote, test.connecting)
+		if test.want != got || test.fails != (err != nil) {
+			t.Errorf("negotiateSubprotocol(%q, %q, %v): want %q, got %q, %v", test.local, test.remote, test.connecting, test.want, got, err)
+		}
+	}
+}
+
+func TestSubprotocolMismatch(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetSubprotocols("orders/1")
+
+	go server.Bind("tcp://127.0.0.1:19025")
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetSubprotocols("orders/2")
+
+	changes := make(chan EndpointStatus, 64)
+	client.SetEndpointStateHandler(func(status EndpointStatus) {
+		changes <- status
+	})
+
+	var subErr *SubprotocolError
+	if err := client.Connect("tcp://127.0.0.1:19025"); !errors.As(err, &subErr) {
+		t.Fatalf("want SubprotocolError, got %v", err)
+	}
+	if want, got := "orders/1", subErr.Remote; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	for status := range changes {
+		if status.State == Degraded {
+			if !errors.As(status.LastError, &subErr) {
+				t.Errorf("want SubprotocolError, got %v", status.LastError)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !js
+
+package gomq
+
+import "net"
+
+func init() {
+	RegisterTransport(netTransport("tcp"))
+}
+
+func (t netTransport) Dial(address string) (net.Conn, error) {
+	return t.dial(IPAny, address)
+}
+
+func (t netTransport) Listen(address string) (net.Listener, error) {
+	return t.listen(IPAny, address)
+}
+
+// dial connects to address over IP of family, see dialHappyEyeballs.
+func (t netTransport) dial(family IPFamily, address string) (net.Conn, error) {
+	return dialHappyEyeballs(string(t), family, address)
+}
+
+// listen listens on address over IP of family.
+func (t netTransport) listen(family IPFamily, address string) (net.Listener, error) {
+	return listen(family.network(string(t)), address)
+}
@@ -0,0 +1,33 @@
+//go:build js
+
+package gomq
+
+import (
+	"errors"
+	"net"
+)
+
+func init() {
+	RegisterTransport(netTransport("tcp"))
+}
+
+var errTCPNotSupported = errors.New("gomq: tcp:// is not supported in the browser, use ws:// or wss://")
+
+// netTransport cannot reach the network in the browser, where
+// package net only offers a simulated one, so tcp:// and the
+// transports built on it, tls+tcp:// and HTTP proxies, fail.
+func (t netTransport) Dial(address string) (net.Conn, error) {
+	return nil, errTCPNotSupported
+}
+
+func (t netTransport) Listen(address string) (net.Listener, error) {
+	return nil, errTCPNotSupported
+}
+
+func (t netTransport) dial(IPFamily, string) (net.Conn, error) {
+	return nil, errTCPNotSupported
+}
+
+func (t netTransport) listen(IPFamily, string) (net.Listener, error) {
+	return nil, errTCPNotSupported
+}
@@ -0,0 +1,136 @@
+package gomq
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+var errNoTLSConfig = errors.New("gomq: tls+tcp endpoints need a TLS config, see SetTLSConfig")
+
+func init() {
+	RegisterTransport(tlsTransport{})
+}
+
+// tlsTransport is the tls+tcp:// transport, running ZMTP over
+// TLS over TCP, with addresses as for tcp://. The TLS config
+// comes from the socket, see SetTLSConfig, so dialNet and
+// listenNet handle the transport, and its own Dial and Listen
+// methods fail.
+type tlsTransport struct{}
+
+func (tlsTransport) Scheme() string { return "tls+tcp" }
+
+func (tlsTransport) SplitAddress(address string) (hostport, rest string) {
+	return address, ""
+}
+
+func (tlsTransport) Dial(address string) (net.Conn, error) {
+	return nil, errNoTLSConfig
+}
+
+func (tlsTransport) Listen(address string) (net.Listener, error) {
+	return nil, errNoTLSConfig
+}
+
+// SetTLSConfig sets the TLS config the socket uses for
+// tls+tcp endpoints, both when connecting and binding. When
+// connecting, the server name defaults to the endpoint's
+// host. The socket keeps its own copy of config.
+func (s *Socket) SetTLSConfig(config *tls.Config) {
+	if config != nil {
+		config = config.Clone()
+	}
+
+	s.lock.Lock()
+	s.tlsConfig = config
+	s.lock.Unlock()
+}
+
+// TLSConfig returns the TLS config the socket uses
+// for tls+tcp endpoints, or nil if it has none.
+func (s *Socket) TLSConfig() *tls.Config {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.tlsConfig
+}
+
+// dialTLS connects to address over TLS with s's config,
+// through s's HTTP proxy if it has one. The TLS handshake
+// takes no longer than the greeting timeout.
+func dialTLS(s ZeroMQSocket, address string) (net.Conn, error) {
+	o := baseOf(s)
+	config := o.TLSConfig()
+	if config == nil {
+		return nil, errNoTLSConfig
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	conn, err := dialNet(s, netTransport("tcp"), address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if timeout := o.GreetingTimeout(); timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// listenNet listens on address with transport for s,
+// using the socket's TLS config for tls+tcp and wss and
+// its IP family for the transports over TCP.
+func listenNet(s ZeroMQSocket, transport Transport, address string) (net.Listener, error) {
+	if t, ok := transport.(inprocTransport); ok {
+		return t.Listen(inprocName(s, address))
+	}
+	if t, ok := transport.(wsTransport); ok {
+		return listenWS(s, t, address)
+	}
+	o := baseOf(s)
+	if t, ok := transport.(netTransport); ok {
+		return t.listen(o.IPFamily(), address)
+	}
+	if _, ok := transport.(tlsTransport); !ok {
+		return transport.Listen(address)
+	}
+
+	config := o.TLSConfig()
+	if config == nil {
+		return nil, errNoTLSConfig
+	}
+	ln, err := netTransport("tcp").listen(o.IPFamily(), address)
+	if err != nil {
+		return nil, err
+	}
+	return tlsListener{tls.NewListener(ln, config)}, nil
+}
+
+// tlsAddr is the address of a tls+tcp:// listener.
+type tlsAddr string
+
+func (a tlsAddr) Network() string { return "tls+tcp" }
+func (a tlsAddr) String() string  { return string(a) }
+
+// tlsListener is a TLS listener reporting
+// its address as a tls+tcp:// one.
+type tlsListener struct {
+	net.Listener
+}
+
+func (l tlsListener) Addr() net.Addr {
+	return tlsAddr(l.Listener.Addr().String())
+}
@@ -0,0 +1,85 @@
+package gomq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// selfSignedCert returns a certificate for 127.0.0.1
+// and a pool trusting it.
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestTLS(t *testing.T) {
+	endpoint := "tls+tcp://127.0.0.1:19061"
+	cert, pool := selfSignedCert(t)
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind(endpoint); err != errNoTLSConfig {
+		t.Errorf("want %v, got %v", errNoTLSConfig, err)
+	}
+	server.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}})
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := endpoint, server.LastEndpoint(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect(endpoint); err != errNoTLSConfig {
+		t.Errorf("want %v, got %v", errNoTLSConfig, err)
+	}
+	client.SetTLSConfig(&tls.Config{RootCAs: pool})
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Send([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ping", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := 1, len(server.Peers()); want != got {
+		t.Fatalf("want %d peers, got %d", want, got)
+	}
+}
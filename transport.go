@@ -0,0 +1,213 @@
+package gomq
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Transport carries ZMTP connections for the endpoints
+// of one scheme, such as "tcp" for "tcp://host:port".
+// Packages adding transports register them with
+// RegisterTransport, usually from an init function.
+type Transport interface {
+	// Scheme returns the endpoint scheme the
+	// transport handles, without "://".
+	Scheme() string
+
+	// Dial connects to address, the part of
+	// the endpoint following "://".
+	Dial(address string) (net.Conn, error)
+
+	// Listen listens for connections on address,
+	// the part of the endpoint following "://".
+	Listen(address string) (net.Listener, error)
+}
+
+var transports = struct {
+	sync.RWMutex
+	m map[string]Transport
+}{m: make(map[string]Transport)}
+
+// RegisterTransport makes t available to Connect and Bind
+// for endpoints of its scheme. It panics if t is nil or a
+// transport is already registered for the scheme.
+func RegisterTransport(t Transport) {
+	if t == nil {
+		panic("gomq: RegisterTransport transport is nil")
+	}
+	scheme := t.Scheme()
+
+	transports.Lock()
+	defer transports.Unlock()
+	if _, dup := transports.m[scheme]; dup {
+		panic("gomq: RegisterTransport called twice for scheme " + scheme)
+	}
+	transports.m[scheme] = t
+}
+
+// Transports returns the sorted schemes of the
+// registered transports.
+func Transports() []string {
+	transports.RLock()
+	defer transports.RUnlock()
+
+	schemes := make([]string, 0, len(transports.m))
+	for scheme := range transports.m {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// HostTransport is implemented by transports whose addresses
+// name a host and a port, as "host:port" or "[::1]:port", which
+// ParseEndpoint checks and splits. The host may be "*", and
+// the port "*" or a range, such as "[6000-6100]", when binding.
+type HostTransport interface {
+	Transport
+
+	// SplitAddress splits address into its "host:port"
+	// part and the rest, such as a URL path.
+	SplitAddress(address string) (hostport, rest string)
+}
+
+// AddressValidator is implemented by transports that check
+// the addresses of their endpoints, so that ParseEndpoint,
+// and with it Connect and Bind, reject malformed ones upfront.
+type AddressValidator interface {
+	ValidateAddress(address string) error
+}
+
+// Endpoint is a parsed endpoint, such as "tcp://[::1]:5555"
+// or "serial:///dev/ttyUSB0?baud=9600".
+type Endpoint struct {
+	// Scheme names the endpoint's transport, such as "tcp".
+	Scheme string
+
+	// Address is the part of the endpoint following "://",
+	// which is passed as is to the transport.
+	Address string
+
+	// Host and Port are set for the transports implementing
+	// HostTransport, with IPv6 hosts unbracketed.
+	Host string
+	Port string
+
+	// Path is the rest of the address, without its query:
+	// a URL path for ws://, a file for ipc://, a name for
+	// inproc:// and a device for serial://.
+	Path string
+
+	// Options holds the scheme-specific options of the
+	// address's query, such as serial://'s baud rate.
+	Options url.Values
+
+	transport Transport
+}
+
+// ParseEndpoint parses endpoint, in the format
+// <scheme>://<address>, checking that a transport is
+// registered for its scheme and that its address is valid.
+func ParseEndpoint(endpoint string) (*Endpoint, error) {
+	scheme, address, ok := strings.Cut(endpoint, "://")
+	if !ok || scheme == "" || address == "" {
+		return nil, fmt.Errorf("gomq: invalid endpoint %q", endpoint)
+	}
+
+	transports.RLock()
+	t, ok := transports.m[scheme]
+	transports.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("gomq: unknown transport %q", scheme)
+	}
+
+	e := &Endpoint{Scheme: scheme, Address: address, Path: address, transport: t}
+	if ht, ok := t.(HostTransport); ok {
+		var hostport string
+		hostport, e.Path = ht.SplitAddress(address)
+		var err error
+		if e.Host, e.Port, err = splitHostPort(hostport); err != nil {
+			return nil, fmt.Errorf("gomq: invalid endpoint %q: %v", endpoint, err)
+		}
+	}
+	if path, query, ok := strings.Cut(e.Path, "?"); ok {
+		options, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("gomq: invalid endpoint %q: %v", endpoint, err)
+		}
+		e.Path, e.Options = path, options
+	}
+	if v, ok := t.(AddressValidator); ok {
+		if err := v.ValidateAddress(address); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *Endpoint) String() string {
+	return e.Scheme + "://" + e.Address
+}
+
+// splitHostPort splits hostport into its host, which must be
+// bracketed if it is an IPv6 address, and its port, which must
+// be a number, "*" or a port range.
+func splitHostPort(hostport string) (host, port string, err error) {
+	if strings.HasPrefix(hostport, "[") {
+		end := strings.IndexByte(hostport, ']')
+		if end < 0 || !strings.HasPrefix(hostport[end+1:], ":") {
+			return "", "", fmt.Errorf("malformed address %q", hostport)
+		}
+		host, port = hostport[1:end], hostport[end+2:]
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return "", "", fmt.Errorf("invalid IPv6 address %q", host)
+		}
+	} else {
+		i := strings.LastIndexByte(hostport, ':')
+		if i < 0 {
+			return "", "", fmt.Errorf("missing port in address %q", hostport)
+		}
+		host, port = hostport[:i], hostport[i+1:]
+		if strings.Contains(host, ":") {
+			return "", "", fmt.Errorf("IPv6 address %q must be bracketed", host)
+		}
+	}
+
+	switch {
+	case port == "*":
+	case strings.HasPrefix(port, "["):
+		if _, _, err := parsePortRange(port); err != nil {
+			return "", "", err
+		}
+	default:
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return "", "", fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return host, port, nil
+}
+
+// splitEndpoint splits endpoint into the transport
+// registered for its scheme and its address.
+func splitEndpoint(endpoint string) (Transport, string, error) {
+	e, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, "", err
+	}
+	return e.transport, e.Address, nil
+}
+
+// netTransport is a transport provided by package net,
+// named after its network.
+type netTransport string
+
+func (t netTransport) Scheme() string { return string(t) }
+
+func (t netTransport) SplitAddress(address string) (hostport, rest string) {
+	return address, ""
+}
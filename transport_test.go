@@ -0,0 +1,140 @@
+package gomq
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// countedSchemes numbers the schemes of the counting
+// transports, as the registry outlives each test run.
+var countedSchemes int32
+
+// countingTransport is a tcp transport registered under
+// another scheme that counts its dials and listens.
+type countingTransport struct {
+	scheme         string
+	dials, listens int32
+}
+
+func (t *countingTransport) Scheme() string { return t.scheme }
+
+func (t *countingTransport) Dial(address string) (net.Conn, error) {
+	atomic.AddInt32(&t.dials, 1)
+	return net.Dial("tcp", address)
+}
+
+func (t *countingTransport) Listen(address string) (net.Listener, error) {
+	atomic.AddInt32(&t.listens, 1)
+	return net.Listen("tcp", address)
+}
+
+func TestRegisterTransport(t *testing.T) {
+	scheme := "counted" + strconv.Itoa(int(atomic.AddInt32(&countedSchemes, 1)))
+	transport := &countingTransport{scheme: scheme}
+	RegisterTransport(transport)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("want panic registering a scheme twice")
+			}
+		}()
+		RegisterTransport(transport)
+	}()
+
+	registered := false
+	for _, s := range Transports() {
+		registered = registered || s == scheme
+	}
+	if !registered {
+		t.Errorf("want %s among %v", scheme, Transports())
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	go func() {
+		if _, err := server.Bind(scheme + "://127.0.0.1:19048"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect(scheme + "://127.0.0.1:19048"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForPeers(1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt32(&transport.dials); got < 1 {
+		t.Errorf("want dials, got %v", got)
+	}
+	if want, got := int32(1), atomic.LoadInt32(&transport.listens); want != got {
+		t.Errorf("want %v listens, got %v", want, got)
+	}
+
+	if err := client.Connect("serial:///dev/ttyS0"); err == nil {
+		t.Error("want error connecting with an unknown transport")
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint         string
+		host, port, path string
+	}{
+		{"tcp://127.0.0.1:5555", "127.0.0.1", "5555", ""},
+		{"tcp://[::1]:5555", "::1", "5555", ""},
+		{"tcp://*:*", "*", "*", ""},
+		{"tcp://:[6000-6100]", "", "[6000-6100]", ""},
+		{"ws://example.com:80/zmq?v=1", "example.com", "80", "/zmq"},
+		{"wss://[fe80::1]:443", "fe80::1", "443", "/"},
+		{"ipc:///tmp/gomq.sock", "", "", "/tmp/gomq.sock"},
+		{"inproc://name", "", "", "name"},
+	}
+	for _, tt := range tests {
+		e, err := ParseEndpoint(tt.endpoint)
+		if err != nil {
+			t.Errorf("%s: %v", tt.endpoint, err)
+			continue
+		}
+		if want, got := tt.host+" "+tt.port+" "+tt.path, e.Host+" "+e.Port+" "+e.Path; want != got {
+			t.Errorf("%s: want %q, got %q", tt.endpoint, want, got)
+		}
+		if want, got := tt.endpoint, e.String(); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+
+	e, err := ParseEndpoint("ws://example.com:80/zmq?v=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "1", e.Options.Get("v"); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	for _, endpoint := range []string{
+		"tcp//127.0.0.1:5555",
+		"tcp://",
+		"nope://127.0.0.1:5555",
+		"tcp://127.0.0.1",
+		"tcp://::1:5555",
+		"tcp://[127.0.0.1]:5555",
+		"tcp://[::1:5555",
+		"tcp://127.0.0.1:http",
+		"tcp://127.0.0.1:70000",
+		"tcp://127.0.0.1:[6100-6000]",
+		"ws://example.com/zmq",
+	} {
+		if _, err := ParseEndpoint(endpoint); err == nil {
+			t.Errorf("%s: want an error", endpoint)
+		}
+	}
+}
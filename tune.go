@@ -0,0 +1,214 @@
+package gomq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// OptionChange describes an option of a live socket
+// changed with Tune.
+type OptionChange struct {
+	Name string
+	Old  string
+	New  string
+
+	// Reconnect is set for options that only apply
+	// to connections made after the change.
+	Reconnect bool
+}
+
+// tunable is an option that can be changed with Tune.
+type tunable struct {
+	reconnect bool
+	get       func(s *Socket) string
+	set       func(s *Socket, value string) error
+}
+
+var tunables = map[string]tunable{
+	"send-mode": {
+		get: func(s *Socket) string {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.sendMode.String()
+		},
+		set: func(s *Socket, value string) error {
+			for _, mode := range []SendMode{SendBlock, SendDrop, SendDontWait} {
+				if value == mode.String() {
+					s.SetSendMode(mode)
+					return nil
+				}
+			}
+			return fmt.Errorf("gomq: invalid send mode %q", value)
+		},
+	},
+	"retry-interval": {
+		get: func(s *Socket) string { return s.RetryInterval().String() },
+		set: func(s *Socket, value string) error {
+			d, err := parsePositiveDuration(value)
+			if err == nil {
+				s.lock.Lock()
+				s.retryInterval = d
+				s.lock.Unlock()
+			}
+			return err
+		},
+	},
+	"frozen": {
+		get: func(s *Socket) string { return strconv.FormatBool(s.Frozen()) },
+		set: func(s *Socket, value string) error {
+			frozen, err := strconv.ParseBool(value)
+			if err == nil {
+				s.SetFrozen(frozen)
+			}
+			return err
+		},
+	},
+	"greeting-timeout": {
+		reconnect: true,
+		get:       func(s *Socket) string { return s.GreetingTimeout().String() },
+		set: func(s *Socket, value string) error {
+			d, err := parseNonNegativeDuration(value)
+			if err == nil {
+				s.SetGreetingTimeout(d)
+			}
+			return err
+		},
+	},
+	"handshake-timeout": {
+		reconnect: true,
+		get:       func(s *Socket) string { return s.HandshakeTimeout().String() },
+		set: func(s *Socket, value string) error {
+			d, err := parseNonNegativeDuration(value)
+			if err == nil {
+				s.SetHandshakeTimeout(d)
+			}
+			return err
+		},
+	},
+	"max-message-size": {
+		get: func(s *Socket) string { return strconv.FormatInt(s.MaxMessageSize(), 10) },
+		set: func(s *Socket, value string) error {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err == nil && size < 0 {
+				err = fmt.Errorf("gomq: negative size %q", value)
+			}
+			if err == nil {
+				s.SetMaxMessageSize(size)
+			}
+			return err
+		},
+	},
+	"keepalive-interval": {
+		reconnect: true,
+		get: func(s *Socket) string {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.keepalive.Interval.String()
+		},
+		set: func(s *Socket, value string) error {
+			d, err := parseNonNegativeDuration(value)
+			if err == nil {
+				s.lock.Lock()
+				s.keepalive.Interval = d
+				s.lock.Unlock()
+			}
+			return err
+		},
+	},
+	"heartbeat-interval": {
+		reconnect: true,
+		get: func(s *Socket) string {
+			s.lock.RLock()
+			defer s.lock.RUnlock()
+			return s.heartbeat.Interval.String()
+		},
+		set: func(s *Socket, value string) error {
+			d, err := parseNonNegativeDuration(value)
+			if err == nil {
+				s.lock.Lock()
+				s.heartbeat.Interval = d
+				s.lock.Unlock()
+			}
+			return err
+		},
+	},
+}
+
+// fixedOptions are options peers rely on, which Tune
+// refuses to change on a live socket.
+var fixedOptions = map[string]bool{
+	"identity":     true,
+	"namespace":    true,
+	"codecs":       true,
+	"subprotocols": true,
+}
+
+// TunableOptions returns the names of the options
+// that can be changed with Tune.
+func TunableOptions() []string {
+	names := make([]string, 0, len(tunables))
+	for name := range tunables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tune changes the named option of a live socket, such as
+// "send-mode" or "retry-interval", parsing value the way an
+// operator would write it, such as "block" or "500ms". The
+// change is reported to the tune handler. It returns whether
+// the option only applies to connections made from then on,
+// in which case existing connections must be reestablished
+// for it to take full effect. Options peers rely on, such
+// as the socket's identity, cannot be changed.
+func (s *Socket) Tune(name, value string) (reconnect bool, err error) {
+	if fixedOptions[name] {
+		return false, fmt.Errorf("gomq: option %q cannot be changed on a live socket", name)
+	}
+	t, ok := tunables[name]
+	if !ok {
+		return false, fmt.Errorf("gomq: unknown option %q", name)
+	}
+
+	old := t.get(s)
+	if err := t.set(s, value); err != nil {
+		return false, err
+	}
+
+	s.lock.RLock()
+	onTune := s.onTune
+	s.lock.RUnlock()
+	if onTune != nil {
+		onTune(OptionChange{Name: name, Old: old, New: t.get(s), Reconnect: t.reconnect})
+	}
+	return t.reconnect, nil
+}
+
+// SetTuneHandler registers a function that is called
+// with every option changed with Tune.
+func (s *Socket) SetTuneHandler(fn func(OptionChange)) {
+	s.lock.Lock()
+	s.onTune = fn
+	s.lock.Unlock()
+}
+
+// parsePositiveDuration parses a duration greater than zero.
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("gomq: duration %q is not positive", value)
+	}
+	return d, err
+}
+
+// parseNonNegativeDuration parses a duration of zero or more.
+func parseNonNegativeDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("gomq: duration %q is negative", value)
+	}
+	return d, err
+}
@@ -0,0 +1,57 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestTune(t *testing.T) {
+	s := NewClient(zmtp.NewSecurityNull())
+	defer s.Close()
+
+	var changes []OptionChange
+	s.SetTuneHandler(func(c OptionChange) { changes = append(changes, c) })
+
+	reconnect, err := s.Tune("retry-interval", "1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconnect {
+		t.Error("retry-interval should apply without reconnecting")
+	}
+	if want, got := time.Second, s.RetryInterval(); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if reconnect, err = s.Tune("greeting-timeout", "5s"); err != nil {
+		t.Fatal(err)
+	}
+	if !reconnect {
+		t.Error("greeting-timeout should require reconnecting")
+	}
+
+	if want, got := 2, len(changes); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	want := OptionChange{Name: "retry-interval", Old: defaultRetry.String(), New: "1s"}
+	if got := changes[0]; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	for _, tc := range []struct{ name, value string }{
+		{"retry-interval", "0s"},
+		{"send-mode", "sometimes"},
+		{"max-message-size", "-1"},
+		{"identity", "alice"},
+		{"no-such-option", "1"},
+	} {
+		if _, err := s.Tune(tc.name, tc.value); err == nil {
+			t.Errorf("%s=%s: want an error", tc.name, tc.value)
+		}
+	}
+	if want, got := 2, len(changes); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -4,8 +4,16 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+
+	"github.com/zeromq/gomq/zmtp"
 )
 
+const identityAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// printableIdentityLength is the length of identities returned by
+// NewPrintableIdentity, giving 36^10 (a little over 2^51) possibilities.
+const printableIdentityLength = 10
+
 func newUUID() (string, error) {
 	uuid := make([]byte, 16)
 
@@ -18,3 +26,37 @@ func newUUID() (string, error) {
 	uuid[6] = uuid[6]&^0xf0 | 0x40
 	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
 }
+
+// NewUUIDIdentity returns a socket identity holding
+// a random (version 4) UUID in its textual form.
+func NewUUIDIdentity() (zmtp.SocketIdentity, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	return zmtp.SocketIdentity(uuid), nil
+}
+
+// NewPrintableIdentity returns a short random socket identity
+// made only of lowercase letters and digits, which reads well
+// in logs and debugging output.
+func NewPrintableIdentity() (zmtp.SocketIdentity, error) {
+	id := make([]byte, printableIdentityLength)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return nil, err
+	}
+
+	for i, b := range id {
+		// 252 is the largest multiple of 36 that fits a byte,
+		// rejecting above it avoids biasing the alphabet.
+		for b >= 252 {
+			var buf [1]byte
+			if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+				return nil, err
+			}
+			b = buf[0]
+		}
+		id[i] = identityAlphabet[int(b)%len(identityAlphabet)]
+	}
+	return zmtp.SocketIdentity(id), nil
+}
@@ -0,0 +1,110 @@
+package gomq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestNewPrintableIdentity(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := NewPrintableIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := printableIdentityLength, len(id); want != got {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z') {
+				t.Fatalf("identity %q is not printable", id)
+			}
+		}
+
+		if seen[id.String()] {
+			t.Fatalf("identity %q generated twice", id)
+		}
+		seen[id.String()] = true
+	}
+}
+
+func TestNewUUIDIdentity(t *testing.T) {
+	id, err := NewUUIDIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 36, len(id); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestAutoIdentity(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityNull())
+
+	if id := client.SocketIdentity(); len(id) != 0 {
+		t.Fatalf("want no identity, got %q", id)
+	}
+
+	client.SetAutoIdentity(true)
+	id := client.SocketIdentity()
+	if want, got := printableIdentityLength, len(id); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	if want, got := id.String(), client.SocketIdentity().String(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	client.SetSocketIdentity(zmtp.SocketIdentity("client-1"))
+	if want, got := "client-1", client.SocketIdentity().String(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestRoutingIDs(t *testing.T) {
+	r := &routingIDs{next: 0xfffffffe}
+	for _, want := range []string{"\x00\xff\xff\xff\xfe", "\x00\xff\xff\xff\xff", "\x00\x00\x00\x00\x00"} {
+		if got := string(r.assign(nil)); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+	if want, got := "alice", string(r.assign([]byte("alice"))); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("inproc://routing-ids"); err != nil {
+		t.Fatal(err)
+	}
+	named := NewPush(zmtp.NewSecurityNull())
+	defer named.Close()
+	named.SetSocketIdentity(zmtp.SocketIdentity("alice"))
+	anonymous := NewPush(zmtp.NewSecurityNull())
+	defer anonymous.Close()
+	for _, push := range []*PushSocket{named, anonymous} {
+		if err := push.Connect("inproc://routing-ids"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pull.WaitForPeers(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]bool)
+	for _, peer := range pull.Peers() {
+		id := peer.RoutingID
+		if len(peer.SocketIdentity) == 0 && (len(id) != 5 || id[0] != 0) {
+			t.Errorf("want a generated routing ID, got %q", id)
+		}
+		ids[string(id)] = true
+	}
+	if !ids["alice"] {
+		t.Errorf("want alice among %v", ids)
+	}
+}
@@ -0,0 +1,271 @@
+// Package gomq is version 2 of the gomq API, imported as
+// github.com/zeromq/gomq/v2.
+//
+// The socket interface of version 1, gomq.ZeroMQSocket, grew a
+// method for every feature, so that adding one broke every
+// implementation of it, until its features moved to the socket
+// types. Version 2 keeps the Socket interface to
+// what every socket does: binding, connecting, sending and
+// receiving messages of one or more frames within a context,
+// options, peers, events and closing. Socket type specific
+// operations are on narrower interfaces, such as Subscriber,
+// and features are reached through options.
+//
+// Version 2 sockets wrap version 1 sockets, so both versions
+// can be used side by side while migrating: Wrap turns a
+// version 1 socket into a version 2 one, and V1 returns the
+// version 1 socket under a version 2 one, for the features
+// version 2 has no counterpart for yet.
+package gomq
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	v1 "github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// Socket is a ZeroMQ socket. Sockets are safe for concurrent use.
+type Socket interface {
+	// Bind listens on endpoint, returning the address bound.
+	// It fails for socket types that only connect, such
+	// as CLIENT and DEALER.
+	Bind(endpoint string) (net.Addr, error)
+
+	// Connect connects to endpoint.
+	Connect(endpoint string) error
+
+	// Send queues a message of the given frames to be sent,
+	// waiting for room until ctx is done. CLIENT and SERVER
+	// sockets only send messages of one frame.
+	Send(ctx context.Context, frames ...[]byte) error
+
+	// Recv returns the frames of the next message,
+	// waiting for one until ctx is done.
+	Recv(ctx context.Context) ([][]byte, error)
+
+	// GetOption returns the value of opt.
+	GetOption(opt Option) (interface{}, error)
+
+	// SetOption changes the value of opt.
+	SetOption(opt Option, value interface{}) error
+
+	// Peers describes the socket's connections.
+	Peers() []PeerInfo
+
+	// SetEventHandler registers a function called with
+	// each event in the lifecycle of the connections.
+	SetEventHandler(fn func(SocketEvent))
+
+	// Close closes the socket and its connections.
+	Close() error
+}
+
+// Subscriber is a socket receiving the messages published
+// to the topics it subscribes to, such as a SUB socket.
+type Subscriber interface {
+	Socket
+
+	// Subscribe subscribes to the messages starting with
+	// prefix. An empty prefix subscribes to every message.
+	Subscribe(prefix []byte) error
+
+	// Unsubscribe cancels a subscription to prefix.
+	Unsubscribe(prefix []byte) error
+}
+
+// Types shared with version 1.
+type (
+	Option      = v1.Option
+	PeerInfo    = v1.PeerInfo
+	SocketEvent = v1.SocketEvent
+	EventType   = v1.EventType
+	IPFamily    = v1.IPFamily
+)
+
+// IP families, the values of OptionIPFamily.
+const (
+	IPAny    = v1.IPAny
+	IPv4Only = v1.IPv4Only
+	IPv6Only = v1.IPv6Only
+)
+
+// Socket options, see version 1 for their types.
+const (
+	OptionIdentity             = v1.OptionIdentity
+	OptionSendHWM              = v1.OptionSendHWM
+	OptionRecvHWM              = v1.OptionRecvHWM
+	OptionLinger               = v1.OptionLinger
+	OptionReconnectInterval    = v1.OptionReconnectInterval
+	OptionReconnectIntervalMax = v1.OptionReconnectIntervalMax
+	OptionTCPKeepalive         = v1.OptionTCPKeepalive
+	OptionTCPNoDelay           = v1.OptionTCPNoDelay
+	OptionHandshakeTimeout     = v1.OptionHandshakeTimeout
+	OptionMaxMessageSize       = v1.OptionMaxMessageSize
+	OptionSendBuffer           = v1.OptionSendBuffer
+	OptionBufferPool           = v1.OptionBufferPool
+	OptionIPFamily             = v1.OptionIPFamily
+)
+
+// Errors shared with version 1.
+var (
+	ErrClosed     = v1.ErrClosed
+	ErrNoPeers    = v1.ErrNoPeers
+	ErrWouldBlock = v1.ErrWouldBlock
+	ErrState      = v1.ErrState
+)
+
+// socket is a version 2 socket wrapping a version 1 one.
+type socket struct {
+	s v1.ZeroMQSocket
+}
+
+// subscriber is a version 2 Subscriber wrapping
+// a version 1 socket with subscriptions.
+type subscriber struct {
+	socket
+	subscriptions
+}
+
+type subscriptions interface {
+	Subscribe(prefix []byte) error
+	Unsubscribe(prefix []byte) error
+}
+
+// configurable is implemented by the version 1 sockets
+// of that package, which embed its Socket type.
+type configurable interface {
+	GetOption(Option) (interface{}, error)
+	SetOption(Option, interface{}) error
+	Peers() []PeerInfo
+	SetEventHandler(func(SocketEvent))
+}
+
+// Wrap returns the version 2 socket for s. It returns a
+// Subscriber if s has subscriptions, such as SUB sockets.
+func Wrap(s v1.ZeroMQSocket) Socket {
+	if sub, ok := s.(subscriptions); ok {
+		return &subscriber{socket: socket{s}, subscriptions: sub}
+	}
+	return &socket{s}
+}
+
+// V1 returns the version 1 socket s wraps, or nil
+// if s was not made by this package.
+func V1(s Socket) v1.ZeroMQSocket {
+	switch s := s.(type) {
+	case *socket:
+		return s.s
+	case *subscriber:
+		return s.s
+	}
+	return nil
+}
+
+func (s *socket) Bind(endpoint string) (net.Addr, error) {
+	if b, ok := s.s.(interface {
+		Bind(string) (net.Addr, error)
+	}); ok {
+		return b.Bind(endpoint)
+	}
+	return nil, fmt.Errorf("gomq: %v sockets cannot bind", s.s.SocketType())
+}
+
+func (s *socket) Connect(endpoint string) error {
+	if c, ok := s.s.(interface{ Connect(string) error }); ok {
+		return c.Connect(endpoint)
+	}
+	return fmt.Errorf("gomq: %v sockets cannot connect", s.s.SocketType())
+}
+
+func (s *socket) Send(ctx context.Context, frames ...[]byte) error {
+	if len(frames) == 1 {
+		return s.s.SendContext(ctx, frames[0])
+	}
+	return s.s.SendMultipartContext(ctx, frames)
+}
+
+func (s *socket) Recv(ctx context.Context) ([][]byte, error) {
+	return s.s.RecvMultipartContext(ctx)
+}
+
+func (s *socket) GetOption(opt Option) (interface{}, error) {
+	if c, ok := s.s.(configurable); ok {
+		return c.GetOption(opt)
+	}
+	return nil, fmt.Errorf("gomq: %T has no options", s.s)
+}
+
+func (s *socket) SetOption(opt Option, value interface{}) error {
+	if c, ok := s.s.(configurable); ok {
+		return c.SetOption(opt, value)
+	}
+	return fmt.Errorf("gomq: %T has no options", s.s)
+}
+
+func (s *socket) Peers() []PeerInfo {
+	if c, ok := s.s.(configurable); ok {
+		return c.Peers()
+	}
+	return nil
+}
+
+func (s *socket) SetEventHandler(fn func(SocketEvent)) {
+	if c, ok := s.s.(configurable); ok {
+		c.SetEventHandler(fn)
+	}
+}
+
+func (s *socket) Close() error {
+	return s.s.Close()
+}
+
+// NewPair returns a PAIR socket.
+func NewPair(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewPair(mechanism)) }
+
+// NewPub returns a PUB socket.
+func NewPub(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewPub(mechanism)) }
+
+// NewSub returns a SUB socket.
+func NewSub(mechanism zmtp.SecurityMechanism) Subscriber {
+	return Wrap(v1.NewSub(mechanism)).(Subscriber)
+}
+
+// NewXPub returns an XPUB socket.
+func NewXPub(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewXPub(mechanism)) }
+
+// NewXSub returns an XSUB socket.
+func NewXSub(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewXSub(mechanism)) }
+
+// NewPush returns a PUSH socket.
+func NewPush(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewPush(mechanism)) }
+
+// NewPull returns a PULL socket.
+func NewPull(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewPull(mechanism)) }
+
+// NewReq returns a REQ socket.
+func NewReq(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewReq(mechanism)) }
+
+// NewRep returns a REP socket.
+func NewRep(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewRep(mechanism)) }
+
+// NewDealer returns a DEALER socket. Its identity
+// is set with OptionIdentity.
+func NewDealer(mechanism zmtp.SecurityMechanism) Socket {
+	return Wrap(v1.NewDealer(mechanism, ""))
+}
+
+// NewRouter returns a ROUTER socket.
+func NewRouter(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewRouter(mechanism)) }
+
+// NewRaw returns a STREAM socket, exchanging plain
+// bytes with peers that do not speak ZMTP.
+func NewRaw() Socket { return Wrap(v1.NewRaw()) }
+
+// NewClient returns a CLIENT socket.
+func NewClient(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewClient(mechanism)) }
+
+// NewServer returns a SERVER socket.
+func NewServer(mechanism zmtp.SecurityMechanism) Socket { return Wrap(v1.NewServer(mechanism)) }
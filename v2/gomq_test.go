@@ -0,0 +1,93 @@
+package gomq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/zeromq/gomq"
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestPushPull(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+	if _, err := pull.Bind("inproc://v2-pipeline"); err != nil {
+		t.Fatal(err)
+	}
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+	if err := push.SetOption(OptionSendHWM, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := push.Connect("inproc://v2-pipeline"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := push.Send(ctx, []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := pull.Recv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "a b", string(msg[0])+" "+string(msg[1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+	if _, err := pub.Bind("inproc://v2-pubsub"); err != nil {
+		t.Fatal(err)
+	}
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+	if err := sub.Subscribe([]byte("news")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Connect("inproc://v2-pubsub"); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			pub.Send(ctx, []byte("weather"))
+			pub.Send(ctx, []byte("news"))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	msg, err := sub.Recv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "news", string(msg[0]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	client := v1.NewClient(zmtp.NewSecurityNull())
+	s := Wrap(client)
+	defer s.Close()
+
+	if V1(s) != client {
+		t.Error("want the version 1 socket back")
+	}
+	if _, ok := s.(Subscriber); ok {
+		t.Error("want no Subscriber for a CLIENT socket")
+	}
+	if _, err := s.Bind("inproc://v2-client"); err == nil {
+		t.Error("want an error binding a CLIENT socket")
+	}
+	if _, ok := Wrap(v1.NewSub(zmtp.NewSecurityNull())).(Subscriber); !ok {
+		t.Error("want a Subscriber for a SUB socket")
+	}
+}
@@ -0,0 +1,181 @@
+package gomq
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// WarningCode identifies the kind of a ConfigWarning.
+type WarningCode string
+
+// Dangerous configurations reported by Validate.
+const (
+	// WarnNullExposed is a socket using NULL security bound on
+	// an interface other hosts can reach, with neither an
+	// authenticator nor TLS client certificates to check peers.
+	WarnNullExposed WarningCode = "null-exposed"
+
+	// WarnPlainCleartext is a socket using PLAIN security over
+	// a transport without TLS to another host, which sends the
+	// credentials in clear text.
+	WarnPlainCleartext WarningCode = "plain-cleartext"
+
+	// WarnNoAuthenticator is a PLAIN or CURVE server bound on an
+	// interface other hosts can reach without an authenticator,
+	// which accepts every client, see zmtp.AcceptsAnyClient.
+	WarnNoAuthenticator WarningCode = "no-authenticator"
+)
+
+// ConfigWarning is a dangerous configuration of an endpoint
+// a socket is bound or connected to.
+type ConfigWarning struct {
+	Code     WarningCode
+	Endpoint string
+	Message  string
+}
+
+func (w ConfigWarning) String() string {
+	return w.Endpoint + ": " + w.Message
+}
+
+// ConfigError is returned by Bind and Connect on sockets
+// with strict security, see SetStrictSecurity, for endpoints
+// Validate would warn about.
+type ConfigError struct {
+	Warnings []ConfigWarning
+}
+
+func (e *ConfigError) Error() string {
+	msg := "gomq: refusing insecure configuration: " + e.Warnings[0].String()
+	if n := len(e.Warnings) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more)", n)
+	}
+	return msg
+}
+
+// SetStrictSecurity makes Bind and Connect fail with a
+// *ConfigError instead of using an endpoint Validate would
+// warn about. It applies to the endpoints used after the change.
+func (s *Socket) SetStrictSecurity(strict bool) {
+	s.lock.Lock()
+	s.strictSecurity = strict
+	s.lock.Unlock()
+}
+
+// StrictSecurity reports whether the socket refuses insecure
+// endpoints, see SetStrictSecurity.
+func (s *Socket) StrictSecurity() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.strictSecurity
+}
+
+// Validate returns the dangerous configurations of the
+// endpoints the socket is bound and connected to, given its
+// security mechanism, authenticator and TLS config, or nil
+// if it found none.
+func (s *Socket) Validate() []ConfigWarning {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var warnings []ConfigWarning
+	bound := make(map[string]bool)
+	for _, l := range s.listeners {
+		if !bound[l.endpoint] {
+			bound[l.endpoint] = true
+			warnings = append(warnings, s.endpointWarnings(l.endpoint, true)...)
+		}
+	}
+	for _, endpoint := range s.endpointOrder {
+		if !bound[endpoint] {
+			warnings = append(warnings, s.endpointWarnings(endpoint, false)...)
+		}
+	}
+	return warnings
+}
+
+// endpointWarnings returns the dangerous configurations of
+// endpoint, bound if bind is true and connected otherwise.
+// The caller holds s.lock.
+func (s *Socket) endpointWarnings(endpoint string, bind bool) []ConfigWarning {
+	e, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil
+	}
+	if _, ok := e.transport.(HostTransport); !ok || !exposed(e.Host) {
+		return nil
+	}
+	encrypted := e.Scheme == "tls+tcp" || e.Scheme == "wss"
+
+	var warnings []ConfigWarning
+	warn := func(code WarningCode, msg string) {
+		warnings = append(warnings, ConfigWarning{Code: code, Endpoint: endpoint, Message: msg})
+	}
+
+	switch s.mechanism.Type() {
+	case zmtp.NullSecurityMechanismType:
+		if bind && s.authenticator == nil && !(encrypted && verifiesClients(s.tlsConfig)) {
+			warn(WarnNullExposed, "NULL security lets any peer connect, use CURVE, an authenticator or TLS client certificates")
+		}
+	case zmtp.PlainSecurityMechanismType:
+		if !encrypted {
+			warn(WarnPlainCleartext, "PLAIN credentials are sent in clear text, use tls+tcp:// or wss://")
+		}
+	}
+	if bind && s.authenticator == nil && zmtp.AcceptsAnyClient(s.mechanism) {
+		warn(WarnNoAuthenticator, fmt.Sprintf("%s server without an authenticator accepts every client, see SetAuthenticator", s.mechanism.Type()))
+	}
+	return warnings
+}
+
+// exposed reports whether host may be reached from other
+// hosts: any name but localhost, and any address but the
+// loopback ones.
+func exposed(host string) bool {
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !ip.IsLoopback()
+}
+
+// verifiesClients reports whether TLS servers with config
+// require certificates from clients and verify them.
+func verifiesClients(config *tls.Config) bool {
+	return config != nil && config.ClientAuth == tls.RequireAndVerifyClientCert
+}
+
+// securityChecker is implemented by sockets that may
+// refuse insecure endpoints.
+type securityChecker interface {
+	checkSecurity(endpoints []string, bind bool) error
+}
+
+// checkSecurity returns a *ConfigError if s has strict
+// security and any of endpoints is insecure.
+func checkSecurity(s ZeroMQSocket, endpoints []string, bind bool) error {
+	if c, ok := s.(securityChecker); ok {
+		return c.checkSecurity(endpoints, bind)
+	}
+	return nil
+}
+
+func (s *Socket) checkSecurity(endpoints []string, bind bool) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if !s.strictSecurity {
+		return nil
+	}
+
+	var warnings []ConfigWarning
+	for _, endpoint := range endpoints {
+		warnings = append(warnings, s.endpointWarnings(endpoint, bind)...)
+	}
+	if len(warnings) > 0 {
+		return &ConfigError{Warnings: warnings}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package gomq
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestValidate(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind("tcp://127.0.0.1:19069"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0, len(server.Validate()); want != got {
+		t.Errorf("want %v warnings on loopback, got %v", want, got)
+	}
+
+	server.SetStrictSecurity(true)
+	_, err := server.Bind("tcp://*:19070")
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("want a *ConfigError, got %v", err)
+	}
+	if want, got := WarnNullExposed, cerr.Warnings[0].Code; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if want, got := 0, len(server.Validate()); want != got {
+		t.Errorf("want %v warnings after refusing to bind, got %v", want, got)
+	}
+
+	server.SetAuthenticator(&IPAuthenticator{Allow: []string{"10.0.0.0/8"}})
+	if _, err := server.Bind("tcp://*:19070"); err != nil {
+		t.Errorf("want no error with an authenticator, got %v", err)
+	}
+	if want, got := 0, len(server.Validate()); want != got {
+		t.Errorf("want %v warnings, got %v", want, got)
+	}
+}
+
+func TestEndpointWarnings(t *testing.T) {
+	curvePublic, curveSecret, err := zmtp.NewCurveKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	curveServer, err := zmtp.NewSecurityCurveServer(curvePublic, curveSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkedPlain := zmtp.NewSecurityPlainServer()
+	checkedPlain.SetAuthenticator(func(username, password string) bool { return username == "admin" })
+
+	verifying := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
+
+	tests := []struct {
+		mechanism zmtp.SecurityMechanism
+		tlsConfig *tls.Config
+		endpoint  string
+		bind      bool
+		want      []WarningCode
+	}{
+		{zmtp.NewSecurityNull(), nil, "tcp://0.0.0.0:5555", true, []WarningCode{WarnNullExposed}},
+		{zmtp.NewSecurityNull(), nil, "ws://example.com:80/zmq", true, []WarningCode{WarnNullExposed}},
+		{zmtp.NewSecurityNull(), nil, "tcp://[::1]:5555", true, nil},
+		{zmtp.NewSecurityNull(), nil, "inproc://local", true, nil},
+		{zmtp.NewSecurityNull(), nil, "tcp://example.com:5555", false, nil},
+		{zmtp.NewSecurityNull(), nil, "tls+tcp://*:5555", true, []WarningCode{WarnNullExposed}},
+		{zmtp.NewSecurityNull(), verifying, "tls+tcp://*:5555", true, nil},
+		{zmtp.NewSecurityPlainClient("admin", "secret"), nil, "tcp://example.com:5555", false, []WarningCode{WarnPlainCleartext}},
+		{zmtp.NewSecurityPlainClient("admin", "secret"), nil, "wss://example.com:443/zmq", false, nil},
+		{zmtp.NewSecurityPlainClient("admin", "secret"), nil, "tcp://localhost:5555", false, nil},
+		{zmtp.NewSecurityPlainServer(), nil, "tcp://*:5555", true, []WarningCode{WarnPlainCleartext, WarnNoAuthenticator}},
+		{zmtp.NewSecurityPlainServer(), nil, "tls+tcp://*:5555", true, []WarningCode{WarnNoAuthenticator}},
+		{checkedPlain, nil, "tls+tcp://*:5555", true, nil},
+		{curveServer, nil, "tcp://*:5555", true, []WarningCode{WarnNoAuthenticator}},
+	}
+	for _, tt := range tests {
+		s := NewSocket(true, zmtp.ServerSocketType, nil, tt.mechanism)
+		s.tlsConfig = tt.tlsConfig
+		var got []WarningCode
+		for _, w := range s.endpointWarnings(tt.endpoint, tt.bind) {
+			got = append(got, w.Code)
+		}
+		if want, got := fmt.Sprint(tt.want), fmt.Sprint(got); want != got {
+			t.Errorf("%s %s: want %v, got %v", tt.mechanism.Type(), tt.endpoint, want, got)
+		}
+	}
+}
+
+func TestStrictSecurityConnect(t *testing.T) {
+	client := NewClient(zmtp.NewSecurityPlainClient("admin", "secret"))
+	defer client.Close()
+	client.SetStrictSecurity(true)
+
+	var cerr *ConfigError
+	if err := client.Connect("tcp://example.com:5555"); !errors.As(err, &cerr) {
+		t.Fatalf("want a *ConfigError, got %v", err)
+	}
+	if want, got := WarnPlainCleartext, cerr.Warnings[0].Code; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,500 @@
+//go:build !js
+
+package gomq
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxFrame bounds the WebSocket frames read, so that
+	// a bogus length cannot exhaust memory.
+	wsMaxFrame = 1 << 31
+)
+
+// WebSocket opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+func (t wsTransport) Dial(address string) (net.Conn, error) {
+	if t == "wss" {
+		return nil, errNoTLSConfig
+	}
+	hostport, path := splitWSAddress(address)
+	conn, err := net.Dial("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+	return newWSConn(conn, false, hostport, path), nil
+}
+
+func (t wsTransport) Listen(address string) (net.Listener, error) {
+	if t == "wss" {
+		return nil, errNoTLSConfig
+	}
+	hostport, path := splitWSAddress(address)
+	ln, err := listen("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+	return &wsListener{Listener: ln, scheme: string(t), path: path}, nil
+}
+
+// dialWS connects to the ws:// or wss:// address for s,
+// through the socket's HTTP proxy if it has one.
+func dialWS(s ZeroMQSocket, t wsTransport, address string) (net.Conn, error) {
+	hostport, path := splitWSAddress(address)
+	var conn net.Conn
+	var err error
+	if t == "wss" {
+		conn, err = dialTLS(s, hostport)
+	} else {
+		conn, err = dialNet(s, netTransport("tcp"), hostport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newWSConn(conn, false, hostport, path), nil
+}
+
+// listenWS listens on the ws:// or wss:// address for s,
+// using the socket's TLS config for wss.
+func listenWS(s ZeroMQSocket, t wsTransport, address string) (net.Listener, error) {
+	o := baseOf(s)
+	var config *tls.Config
+	if t == "wss" {
+		if config = o.TLSConfig(); config == nil {
+			return nil, errNoTLSConfig
+		}
+	}
+	hostport, path := splitWSAddress(address)
+	ln, err := listen(o.IPFamily().network("tcp"), hostport)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		ln = tls.NewListener(ln, config)
+	}
+	return &wsListener{Listener: ln, scheme: string(t), path: path}, nil
+}
+
+// wsListener accepts ZWS connections on path. Their WebSocket
+// handshake happens along with the ZMTP one, so that a slow
+// client does not hold up the others.
+type wsListener struct {
+	net.Listener
+	scheme string
+	path   string
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newWSConn(conn, true, "", l.path), nil
+}
+
+func (l *wsListener) Addr() net.Addr {
+	return wsAddr{l.scheme, l.Listener.Addr().String() + l.path}
+}
+
+// wsConn is a ZWS connection, translating between the ZMTP
+// stream read and written by package zmtp and WebSocket
+// messages. The WebSocket handshake happens once the ZMTP
+// greeting has been written, as it tells the mechanism and
+// role of this end; reading waits for it. The peer's greeting
+// is made up from the handshake.
+type wsConn struct {
+	net.Conn
+	br     *bufio.Reader
+	server bool
+	host   string
+	path   string
+
+	ready        chan struct{}
+	handshakeErr error
+	done         chan struct{}
+
+	readLock sync.Mutex
+	rbuf     []byte
+
+	writeLock sync.Mutex
+	greeting  []byte
+	wbuf      []byte
+
+	frameLock sync.Mutex
+	closeOnce sync.Once
+	doneOnce  sync.Once
+}
+
+func newWSConn(conn net.Conn, server bool, host, path string) *wsConn {
+	return &wsConn{
+		Conn:   conn,
+		br:     bufio.NewReader(conn),
+		server: server,
+		host:   host,
+		path:   path,
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// handshake runs the WebSocket handshake for mechanism, then
+// makes up the peer's greeting, the peer being a ZMTP server
+// if this end is not.
+// NetConn returns the connection the WebSocket runs over.
+func (c *wsConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *wsConn) handshake(mechanism string, asServer bool) error {
+	c.Conn.SetDeadline(time.Now().Add(defaultGreetingTimeout))
+	defer c.Conn.SetDeadline(time.Time{})
+
+	var err error
+	if c.server {
+		err = c.acceptHandshake(mechanism)
+	} else {
+		err = c.dialHandshake(mechanism)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.rbuf = zwsGreeting(mechanism, asServer)
+	return nil
+}
+
+func (c *wsConn) dialHandshake(mechanism string) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	protocols := zwsProtocols(mechanism)
+
+	req := "GET " + c.path + " HTTP/1.1\r\n" +
+		"Host: " + c.host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Protocol: " + strings.Join(protocols, ", ") + "\r\n\r\n"
+	if _, err := io.WriteString(c.Conn, req); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(c.br, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("gomq: WebSocket handshake refused: %s", resp.Status)
+	}
+	if !headerHasToken(resp.Header, "Upgrade", "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return errWSHandshake
+	}
+	protocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	for _, p := range protocols {
+		if p == protocol {
+			return nil
+		}
+	}
+	return fmt.Errorf("gomq: WebSocket subprotocol %q does not match %s", protocol, mechanism)
+}
+
+func (c *wsConn) acceptHandshake(mechanism string) error {
+	req, err := http.ReadRequest(c.br)
+	if err != nil {
+		return err
+	}
+	req.Body.Close()
+
+	fail := func(status int, err error) error {
+		fmt.Fprintf(c.Conn, "HTTP/1.1 %d %s\r\nConnection: close\r\n\r\n", status, http.StatusText(status))
+		return err
+	}
+	if req.Method != http.MethodGet || req.URL.Path != c.path {
+		return fail(http.StatusNotFound, errWSHandshake)
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if !headerHasToken(req.Header, "Upgrade", "websocket") ||
+		!headerHasToken(req.Header, "Connection", "upgrade") ||
+		req.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		return fail(http.StatusBadRequest, errWSHandshake)
+	}
+
+	protocol := ""
+	offered := headerTokens(req.Header, "Sec-WebSocket-Protocol")
+	for _, p := range zwsProtocols(mechanism) {
+		for _, o := range offered {
+			if protocol == "" && o == p {
+				protocol = p
+			}
+		}
+	}
+	if protocol == "" {
+		return fail(http.StatusBadRequest, fmt.Errorf("gomq: no WebSocket subprotocol offered for %s", mechanism))
+	}
+
+	_, err = io.WriteString(c.Conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+wsAccept(key)+"\r\n"+
+		"Sec-WebSocket-Protocol: "+protocol+"\r\n\r\n")
+	return err
+}
+
+// headerTokens returns the comma separated
+// values of the header name.
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// headerHasToken reports whether the header name
+// has token among its values, ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, t := range headerTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Read reads the ZMTP stream made of the peer's messages.
+func (c *wsConn) Read(b []byte) (int, error) {
+	select {
+	case <-c.ready:
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+	if c.handshakeErr != nil {
+		return 0, c.handshakeErr
+	}
+
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.rbuf) == 0 {
+		msg, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if c.rbuf, err = appendZMTPFrame(c.rbuf[:0], msg); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// readMessage reads the next data message,
+// answering the control frames met on the way.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.closeOnce.Do(func() {
+				c.writeFrame(wsClose, payload)
+			})
+			return nil, io.EOF
+		case wsBinary:
+			msg = payload
+		case wsContinuation:
+			msg = append(msg, payload...)
+		default:
+			return nil, fmt.Errorf("gomq: unexpected WebSocket opcode %#x", op)
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [14]byte
+	if _, err := io.ReadFull(c.br, header[:2]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = header[0]&0x80 != 0, header[0]&0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.br, header[2:4]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(header[2:4]))
+	case 127:
+		if _, err := io.ReadFull(c.br, header[2:10]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(header[2:10])
+	}
+	if length > wsMaxFrame {
+		return false, 0, nil, fmt.Errorf("gomq: WebSocket frame of %d bytes is too large", length)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// Write writes to the ZMTP stream, sending a message to
+// the peer for each complete frame. The greeting is held
+// back to run the WebSocket handshake instead.
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	n := len(b)
+	if len(c.greeting) < wsGreetingSize {
+		m := min(wsGreetingSize-len(c.greeting), len(b))
+		c.greeting = append(c.greeting, b[:m]...)
+		b = b[m:]
+		if len(c.greeting) < wsGreetingSize {
+			return n, nil
+		}
+
+		mechanism, asServer := parseGreeting(c.greeting)
+		c.handshakeErr = c.handshake(mechanism, asServer)
+		close(c.ready)
+	}
+	if c.handshakeErr != nil {
+		return 0, c.handshakeErr
+	}
+
+	c.wbuf = append(c.wbuf, b...)
+	for {
+		var msg []byte
+		if msg, c.wbuf = nextZWSMessage(c.wbuf); msg == nil {
+			return n, nil
+		}
+		if err := c.writeFrame(wsBinary, msg); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// writeFrame writes a single frame, masked
+// if this end is the WebSocket client.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|op)
+
+	var maskBit byte
+	if !c.server {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, maskBit|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, maskBit|127), uint64(n))
+	}
+
+	if c.server {
+		frame = append(frame, payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	}
+
+	c.frameLock.Lock()
+	defer c.frameLock.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame if the handshake
+// completed, and closes the connection.
+func (c *wsConn) Close() error {
+	select {
+	case <-c.ready:
+		if c.handshakeErr == nil {
+			c.closeOnce.Do(func() {
+				c.Conn.SetWriteDeadline(time.Now().Add(defaultLinger))
+				c.writeFrame(wsClose, []byte{0x03, 0xE8})
+			})
+		}
+	default:
+	}
+	c.doneOnce.Do(func() {
+		close(c.done)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,357 @@
+//go:build js
+
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+var errWSListen = errors.New("gomq: ws:// and wss:// cannot be bound to in the browser")
+
+func (t wsTransport) Dial(address string) (net.Conn, error) {
+	return newWSConn(string(t), address), nil
+}
+
+func (t wsTransport) Listen(address string) (net.Listener, error) {
+	return nil, errWSListen
+}
+
+// dialWS connects to the ws:// or wss:// address through the
+// browser's WebSocket API, which takes care of TLS and proxies.
+func dialWS(s ZeroMQSocket, t wsTransport, address string) (net.Conn, error) {
+	return t.Dial(address)
+}
+
+// listenWS fails, as browsers cannot accept connections.
+func listenWS(s ZeroMQSocket, t wsTransport, address string) (net.Listener, error) {
+	return nil, errWSListen
+}
+
+// wsConn is a ZWS connection made through the browser's
+// WebSocket API, translating between the ZMTP stream read and
+// written by package zmtp and WebSocket messages. The WebSocket
+// is opened once the ZMTP greeting has been written, as it
+// tells the mechanism and role of this end; reading waits for
+// it. The peer's greeting is made up from the handshake.
+type wsConn struct {
+	scheme string
+	url    string
+
+	ready        chan struct{}
+	handshakeErr error
+	done         chan struct{}
+
+	// ws is the WebSocket once opened, and funcs its event
+	// handlers. msgs are the messages received and not yet
+	// read, and closeErr why the WebSocket closed. All are
+	// guarded by lock, and received is signaled when msgs,
+	// closeErr or the read deadline change.
+	lock     sync.Mutex
+	ws       js.Value
+	funcs    []js.Func
+	msgs     [][]byte
+	closeErr error
+	received chan struct{}
+	deadline time.Time
+
+	readLock sync.Mutex
+	rbuf     []byte
+
+	writeLock sync.Mutex
+	greeting  []byte
+	wbuf      []byte
+
+	doneOnce sync.Once
+}
+
+func newWSConn(scheme, address string) *wsConn {
+	return &wsConn{
+		scheme:   scheme,
+		url:      scheme + "://" + address,
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+		received: make(chan struct{}, 1),
+	}
+}
+
+// handshake opens the WebSocket offering the subprotocols
+// for mechanism and waits for it to open, then makes up the
+// peer's greeting, the peer being a ZMTP server if this end
+// is not.
+func (c *wsConn) handshake(mechanism string, asServer bool) error {
+	// Browsers only offer subprotocols that are HTTP tokens,
+	// which rules out the "ZWS2.0/<mechanism>" forms, leaving
+	// "ZWS2.0" for NULL and nothing for other mechanisms.
+	var protocols []string
+	var offered []any
+	for _, p := range zwsProtocols(mechanism) {
+		if !strings.Contains(p, "/") {
+			protocols = append(protocols, p)
+			offered = append(offered, p)
+		}
+	}
+	if len(protocols) == 0 {
+		return fmt.Errorf("gomq: %s cannot be used over WebSocket in the browser", mechanism)
+	}
+
+	opened := make(chan struct{}, 1)
+	if err := c.open(offered, opened); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(defaultGreetingTimeout)
+	defer timer.Stop()
+	select {
+	case <-opened:
+	case <-c.received:
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.closeErr
+	case <-timer.C:
+		return os.ErrDeadlineExceeded
+	case <-c.done:
+		return net.ErrClosed
+	}
+
+	protocol := c.ws.Get("protocol").String()
+	for _, p := range protocols {
+		if p == protocol {
+			c.rbuf = zwsGreeting(mechanism, asServer)
+			return nil
+		}
+	}
+	return fmt.Errorf("gomq: WebSocket subprotocol %q does not match %s", protocol, mechanism)
+}
+
+// open creates the WebSocket offering protocols, unless the
+// connection is closed, and sets up its event handlers.
+// opened is signaled once the WebSocket is open.
+func (c *wsConn) open(protocols []any, opened chan<- struct{}) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	select {
+	case <-c.done:
+		return net.ErrClosed
+	default:
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gomq: could not open WebSocket: %v", r)
+		}
+	}()
+	c.ws = js.Global().Get("WebSocket").New(c.url, protocols)
+	c.ws.Set("binaryType", "arraybuffer")
+
+	c.on("open", func(js.Value) {
+		opened <- struct{}{}
+	})
+	c.on("message", func(ev js.Value) {
+		data := js.Global().Get("Uint8Array").New(ev.Get("data"))
+		msg := make([]byte, data.Length())
+		js.CopyBytesToGo(msg, data)
+		c.push(msg, nil)
+	})
+	c.on("close", func(ev js.Value) {
+		err := io.EOF
+		if code := ev.Get("code").Int(); code != 1000 {
+			err = fmt.Errorf("gomq: WebSocket closed with code %d", code)
+		}
+		c.push(nil, err)
+	})
+	return nil
+}
+
+// on registers fn as the WebSocket's handler for
+// event. The caller must hold the lock.
+func (c *wsConn) on(event string, fn func(js.Value)) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) any {
+		fn(args[0])
+		return nil
+	})
+	c.funcs = append(c.funcs, f)
+	c.ws.Set("on"+event, f)
+}
+
+// push queues msg, or records err as the reason the
+// WebSocket closed, without blocking the event loop.
+func (c *wsConn) push(msg []byte, err error) {
+	c.lock.Lock()
+	if err != nil {
+		c.closeErr = err
+	} else {
+		c.msgs = append(c.msgs, msg)
+	}
+	c.lock.Unlock()
+
+	select {
+	case c.received <- struct{}{}:
+	default:
+	}
+}
+
+// readMessage waits for the next message,
+// until the read deadline if there is one.
+func (c *wsConn) readMessage() ([]byte, error) {
+	for {
+		c.lock.Lock()
+		if len(c.msgs) > 0 {
+			msg := c.msgs[0]
+			c.msgs = c.msgs[1:]
+			c.lock.Unlock()
+			return msg, nil
+		}
+		closeErr, deadline := c.closeErr, c.deadline
+		c.lock.Unlock()
+		if closeErr != nil {
+			return nil, closeErr
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case <-c.received:
+		case <-timeout:
+			return nil, os.ErrDeadlineExceeded
+		case <-c.done:
+			return nil, net.ErrClosed
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Read reads the ZMTP stream made of the peer's messages.
+func (c *wsConn) Read(b []byte) (int, error) {
+	select {
+	case <-c.ready:
+	case <-c.done:
+		return 0, net.ErrClosed
+	}
+	if c.handshakeErr != nil {
+		return 0, c.handshakeErr
+	}
+
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+
+	for len(c.rbuf) == 0 {
+		msg, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if c.rbuf, err = appendZMTPFrame(c.rbuf[:0], msg); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// Write writes to the ZMTP stream, sending a message to
+// the peer for each complete frame. The greeting is held
+// back to open the WebSocket instead.
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	n := len(b)
+	if len(c.greeting) < wsGreetingSize {
+		m := min(wsGreetingSize-len(c.greeting), len(b))
+		c.greeting = append(c.greeting, b[:m]...)
+		b = b[m:]
+		if len(c.greeting) < wsGreetingSize {
+			return n, nil
+		}
+
+		mechanism, asServer := parseGreeting(c.greeting)
+		c.handshakeErr = c.handshake(mechanism, asServer)
+		close(c.ready)
+	}
+	if c.handshakeErr != nil {
+		return 0, c.handshakeErr
+	}
+
+	c.wbuf = append(c.wbuf, b...)
+	for {
+		var msg []byte
+		if msg, c.wbuf = nextZWSMessage(c.wbuf); msg == nil {
+			return n, nil
+		}
+
+		c.lock.Lock()
+		closeErr := c.closeErr
+		c.lock.Unlock()
+		if closeErr != nil {
+			return 0, closeErr
+		}
+		select {
+		case <-c.done:
+			return 0, net.ErrClosed
+		default:
+		}
+		data := js.Global().Get("Uint8Array").New(len(msg))
+		js.CopyBytesToJS(data, msg)
+		c.ws.Call("send", data)
+	}
+}
+
+// Close closes the WebSocket, if it was opened, and
+// releases its event handlers.
+func (c *wsConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.doneOnce.Do(func() {
+		close(c.done)
+		if c.ws.IsUndefined() {
+			return
+		}
+		for _, event := range []string{"open", "message", "close"} {
+			c.ws.Set("on"+event, js.Null())
+		}
+		c.ws.Call("close", 1000)
+		for _, f := range c.funcs {
+			f.Release()
+		}
+	})
+	return nil
+}
+
+func (c *wsConn) LocalAddr() net.Addr  { return wsAddr{c.scheme, ""} }
+func (c *wsConn) RemoteAddr() net.Addr { return wsAddr{c.scheme, c.url} }
+
+// SetDeadline sets the read deadline. Writes
+// are buffered by the browser and never block.
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.deadline = t
+	c.lock.Unlock()
+
+	select {
+	case c.received <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,121 @@
+//go:build !js
+
+package gomq
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// testExchange checks that client and server,
+// connected, exchange messages both ways.
+func testExchange(t *testing.T, client Client, server Server) {
+	t.Helper()
+	if err := client.Send([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "ping", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := server.Send([]byte("pong")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = client.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "pong", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestWS(t *testing.T) {
+	endpoint := "ws://127.0.0.1:19062/zmq"
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := endpoint, server.LastEndpoint(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	testExchange(t, client, server)
+
+	// A plain WebSocket client gets the server's READY
+	// command as a ZWS message.
+	conn, err := net.Dial("tcp", "127.0.0.1:19062")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /zmq HTTP/1.1\r\nHost: 127.0.0.1\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Protocol: ZWS2.0\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := http.StatusSwitchingProtocols, resp.StatusCode; want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if want, got := "ZWS2.0", resp.Header.Get("Sec-WebSocket-Protocol"); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := byte(0x80|wsBinary), header[0]; want != got {
+		t.Errorf("want %#x, got %#x", want, got)
+	}
+	payload := make([]byte, header[1]&0x7F)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "\x02\x05READY", string(payload[:7]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestWSS(t *testing.T) {
+	endpoint := "wss://127.0.0.1:19063"
+	cert, pool := selfSignedCert(t)
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}})
+	if _, err := server.Bind(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	client.SetTLSConfig(&tls.Config{RootCAs: pool})
+	if err := client.Connect(endpoint); err != nil {
+		t.Fatal(err)
+	}
+	testExchange(t, client, server)
+}
@@ -0,0 +1,247 @@
+package gomq
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// xpubQueue is the number of subscription messages an
+// XPubSocket holds until they are received.
+const xpubQueue = 1000
+
+// XPubSocket is a ZMQ_XPUB socket type. It publishes like a
+// PubSocket, and also receives the subscriptions of its peers,
+// as messages made of a byte, 1 for a subscription and 0 for a
+// cancellation, followed by the prefix. By default, only the
+// first subscription to a prefix is received, and its
+// cancellation once no peer is subscribed to it anymore,
+// including because the peers subscribed to it went away.
+// This is what forwarders pass on to the publishers they
+// connect to, see XSubSocket.
+// See: https://rfc.zeromq.org/spec:29
+type XPubSocket struct {
+	*PubSocket
+	notes   chan [][]byte
+	verbose bool
+	welcome []byte
+}
+
+// NewXPub accepts a zmtp.SecurityMechanism and
+// returns an XPubSocket.
+func NewXPub(mechanism zmtp.SecurityMechanism) *XPubSocket {
+	x := &XPubSocket{
+		PubSocket: newPub(zmtp.XPubSocketType, mechanism),
+		notes:     make(chan [][]byte, xpubQueue),
+	}
+	go x.notifySubscriptions()
+	return x
+}
+
+// SetVerbose makes the socket receive every subscription of
+// its peers, not only the first to each prefix, like
+// ZMQ_XPUB_VERBOSE. Cancellations are still received once no
+// peer is subscribed to the prefix anymore.
+func (x *XPubSocket) SetVerbose(verbose bool) {
+	x.lock.Lock()
+	x.verbose = verbose
+	x.lock.Unlock()
+}
+
+// SetWelcomeMessage makes the socket send msg to each peer
+// connecting from then on, like ZMQ_XPUB_WELCOME_MSG, so that
+// subscribers know when they are connected. A nil msg sends
+// none, the default.
+func (x *XPubSocket) SetWelcomeMessage(msg []byte) {
+	if msg != nil {
+		msg = append([]byte{}, msg...)
+	}
+
+	x.lock.Lock()
+	x.welcome = msg
+	x.lock.Unlock()
+}
+
+// AddConnection adds a gomq.Connection to the socket and
+// sends the peer the socket's welcome message, if any.
+func (x *XPubSocket) AddConnection(conn *Connection) {
+	x.lock.RLock()
+	welcome := x.welcome
+	x.lock.RUnlock()
+
+	x.Socket.AddConnection(conn)
+	if welcome != nil {
+		conn.outbox.push(&outgoing{frames: [][]byte{welcome}})
+	}
+}
+
+// notifySubscriptions queues the subscriptions and
+// cancellations of the socket's peers, as their
+// subscriptions change, until the socket is closed.
+func (x *XPubSocket) notifySubscriptions() {
+	known := make(map[string]int)
+	for {
+		prefixes, subscriptionsChanged, peersChanged := x.peerSubscriptions()
+		x.lock.RLock()
+		verbose := x.verbose
+		x.lock.RUnlock()
+
+		var notes [][]byte
+		for _, prefix := range sortedPrefixes(prefixes) {
+			n, k := prefixes[prefix], known[prefix]
+			if k == 0 || verbose {
+				for ; k < n; k++ {
+					notes = append(notes, append([]byte{1}, prefix...))
+					if !verbose {
+						break
+					}
+				}
+			}
+		}
+		for _, prefix := range sortedPrefixes(known) {
+			if prefixes[prefix] == 0 {
+				notes = append(notes, append([]byte{0}, prefix...))
+			}
+		}
+		known = prefixes
+
+		for _, note := range notes {
+			select {
+			case x.notes <- [][]byte{note}:
+			case <-x.done:
+				return
+			}
+		}
+		select {
+		case <-subscriptionsChanged:
+		case <-peersChanged:
+		case <-x.done:
+			return
+		}
+	}
+}
+
+// sortedPrefixes returns the keys of prefixes, sorted.
+func sortedPrefixes(prefixes map[string]int) []string {
+	sorted := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		sorted = append(sorted, prefix)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// nextNote returns the next subscription message, waiting for
+// one until ctx is done if block is set. It returns false if
+// none is ready and block is not set.
+func (x *XPubSocket) nextNote(ctx context.Context, block bool) ([][]byte, bool, error) {
+	select {
+	case note := <-x.notes:
+		return note, true, nil
+	default:
+	}
+	if !block {
+		select {
+		case <-x.done:
+			return nil, true, ErrClosed
+		default:
+			return nil, false, nil
+		}
+	}
+
+	select {
+	case note := <-x.notes:
+		return note, true, nil
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	case <-x.done:
+		return nil, true, ErrClosed
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// xpub socket to it, over any registered transport.
+func (x *XPubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(x, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (x *XPubSocket) ResumeListening(endpoint string) error {
+	return resumeListening(x, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// xpub socket to it, over any registered transport.
+func (x *XPubSocket) Connect(endpoint string) error {
+	return ConnectClient(x, endpoint)
+}
+
+// Recv returns the next subscription message of the peers.
+func (x *XPubSocket) Recv() ([]byte, error) {
+	note, _, err := x.nextNote(context.Background(), true)
+	return firstFrameOf(note), err
+}
+
+// RecvMultipart is like Recv. Subscription
+// messages are made of a single frame.
+func (x *XPubSocket) RecvMultipart() ([][]byte, error) {
+	note, _, err := x.nextNote(context.Background(), true)
+	return note, err
+}
+
+// TryRecv is like Recv, but never blocks.
+func (x *XPubSocket) TryRecv() ([]byte, bool, error) {
+	note, ok, err := x.nextNote(context.Background(), false)
+	return firstFrameOf(note), ok, err
+}
+
+// TryRecvMultipart is like RecvMultipart, but never blocks.
+func (x *XPubSocket) TryRecvMultipart() ([][]byte, bool, error) {
+	return x.nextNote(context.Background(), false)
+}
+
+// RecvContext is like Recv, but returns ctx.Err()
+// if ctx is done before a subscription arrives.
+func (x *XPubSocket) RecvContext(ctx context.Context) ([]byte, error) {
+	note, _, err := x.nextNote(ctx, true)
+	return firstFrameOf(note), err
+}
+
+// RecvMultipartContext is like RecvMultipart, but returns
+// ctx.Err() if ctx is done before a subscription arrives.
+func (x *XPubSocket) RecvMultipartContext(ctx context.Context) ([][]byte, error) {
+	note, _, err := x.nextNote(ctx, true)
+	return note, err
+}
+
+// RecvMessage is like RecvMultipart. Subscription
+// messages come from no particular peer.
+func (x *XPubSocket) RecvMessage() (*Message, error) {
+	return x.RecvMessageContext(context.Background())
+}
+
+// RecvMessageContext is like RecvMultipartContext.
+func (x *XPubSocket) RecvMessageContext(ctx context.Context) (*Message, error) {
+	note, _, err := x.nextNote(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Frames: note, Received: time.Now(), Properties: make(map[string]string)}, nil
+}
+
+// firstFrameOf returns the first of frames, or nil.
+func firstFrameOf(frames [][]byte) []byte {
+	if len(frames) == 0 {
+		return nil
+	}
+	return frames[0]
+}
+
+var (
+	_ Client = (*XPubSocket)(nil)
+	_ Server = (*XPubSocket)(nil)
+)
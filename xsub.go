@@ -0,0 +1,124 @@
+package gomq
+
+import (
+	"context"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// XSubSocket is a ZMQ_XSUB socket type. It receives like a
+// SubSocket, and subscribes by sending messages made of a
+// byte, 1 to subscribe and 0 to cancel a subscription,
+// followed by the prefix, as received from an XPubSocket.
+// Other messages are sent to every peer as they are.
+// See: https://rfc.zeromq.org/spec:29
+type XSubSocket struct {
+	*SubSocket
+}
+
+// NewXSub accepts a zmtp.SecurityMechanism and
+// returns an XSubSocket.
+func NewXSub(mechanism zmtp.SecurityMechanism) *XSubSocket {
+	return &XSubSocket{
+		SubSocket: &SubSocket{
+			Socket: NewSocket(false, zmtp.XSubSocketType, nil, mechanism),
+		},
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// xsub socket to it, over any registered transport.
+func (x *XSubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(x, endpoint)
+}
+
+// ResumeListening binds the socket to endpoint again after
+// StopListening, accepting a connection in the background.
+func (x *XSubSocket) ResumeListening(endpoint string) error {
+	return resumeListening(x, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// xsub socket to it, over any registered transport.
+func (x *XSubSocket) Connect(endpoint string) error {
+	return ConnectClient(x, endpoint)
+}
+
+// Send sends a subscription message, see SendMultipart.
+func (x *XSubSocket) Send(b []byte) error {
+	return x.SendMultipart([][]byte{b})
+}
+
+// SendWith is like Send.
+func (x *XSubSocket) SendWith(b []byte, mode SendMode) error {
+	return x.SendMultipart([][]byte{b})
+}
+
+// TrySend is like Send.
+func (x *XSubSocket) TrySend(b []byte) error {
+	return x.SendMultipart([][]byte{b})
+}
+
+// TrySendMultipart is like SendMultipart.
+func (x *XSubSocket) TrySendMultipart(b [][]byte) error {
+	return x.SendMultipart(b)
+}
+
+// SendPriority is like Send.
+func (x *XSubSocket) SendPriority(b []byte) error {
+	return x.SendMultipart([][]byte{b})
+}
+
+// SendMultipartWith is like SendMultipart.
+func (x *XSubSocket) SendMultipartWith(b [][]byte, mode SendMode) error {
+	return x.SendMultipart(b)
+}
+
+// SendContext is like Send.
+func (x *XSubSocket) SendContext(ctx context.Context, b []byte) error {
+	return x.SendMultipart([][]byte{b})
+}
+
+// SendMultipartContext is like SendMultipart.
+func (x *XSubSocket) SendMultipartContext(ctx context.Context, b [][]byte) error {
+	return x.SendMultipart(b)
+}
+
+// SendMultipart subscribes the socket to the prefix following
+// the first byte of b's first frame if it is 1, and cancels
+// a subscription to it if it is 0, see Subscribe and
+// Unsubscribe. It sends any other message to every peer.
+func (x *XSubSocket) SendMultipart(b [][]byte) error {
+	if len(b) == 0 {
+		return errNoFrames
+	}
+	if len(b) == 1 && len(b[0]) > 0 {
+		switch b[0][0] {
+		case 1:
+			return x.Subscribe(b[0][1:])
+		case 0:
+			return x.Unsubscribe(b[0][1:])
+		}
+	}
+	if err := x.validate(b, true); err != nil {
+		return err
+	}
+
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	select {
+	case <-x.done:
+		return &SendError{Outcome: Dropped, Err: ErrClosed}
+	default:
+	}
+	for _, id := range x.ids {
+		x.conns[id].outbox.push(&outgoing{frames: b})
+	}
+	return nil
+}
+
+var (
+	_ Client = (*XSubSocket)(nil)
+	_ Server = (*XSubSocket)(nil)
+)
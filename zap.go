@@ -0,0 +1,303 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// ZAPEndpoint is the endpoint ZAP handlers bind to, following
+// the ZeroMQ Authentication Protocol, RFC 27.
+const ZAPEndpoint = "inproc://zeromq.zap.01"
+
+const zapVersion = "1.0"
+
+var errZAPReply = errors.New("gomq: invalid ZAP reply")
+
+// ZAPRequest describes a client authenticating with a server.
+type ZAPRequest struct {
+	// Domain is the ZAP domain of the request, which is
+	// only set for requests received by ServeZAP.
+	Domain string
+
+	// Address is the client's address, without its port
+	// for TCP connections.
+	Address string
+
+	// Identity is the identity of the server's socket.
+	Identity []byte
+
+	// Mechanism and Credentials are the security mechanism
+	// the client uses and the credentials it presented:
+	// none for NULL, the username and password for PLAIN,
+	// and the long-term public key for CURVE.
+	Mechanism   zmtp.SecurityMechanismType
+	Credentials [][]byte
+
+	// UserID may be set by authenticators accepting the
+	// client to the user the client authenticated as. It
+	// is reported in PeerInfo.UserID, and sent back to
+	// libzmq sockets in ZAP replies.
+	UserID string
+}
+
+// Authenticator decides whether the clients connecting to
+// a server may complete their handshake.
+type Authenticator interface {
+	// Authenticate returns an error if the client making
+	// r is refused. The error's text is sent to the client.
+	Authenticate(r *ZAPRequest) error
+}
+
+// AuthenticatorFunc is a function used as an Authenticator.
+type AuthenticatorFunc func(r *ZAPRequest) error
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *ZAPRequest) error {
+	return f(r)
+}
+
+// Authenticators accepts the clients all of its
+// authenticators accept, checked in order.
+type Authenticators []Authenticator
+
+// Authenticate returns the first error of the authenticators.
+func (as Authenticators) Authenticate(r *ZAPRequest) error {
+	for _, a := range as {
+		if err := a.Authenticate(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IPAuthenticator accepts clients by their IP address, given
+// as single addresses or CIDR ranges. Denied addresses are
+// refused. If Allow is not empty, only the addresses it
+// lists are accepted, which excludes clients on transports
+// without IP addresses.
+type IPAuthenticator struct {
+	Allow []string
+	Deny  []string
+}
+
+// Authenticate checks r's address against the lists.
+func (a IPAuthenticator) Authenticate(r *ZAPRequest) error {
+	ip := net.ParseIP(r.Address)
+	if ipListed(a.Deny, ip) {
+		return errors.New("gomq: address denied")
+	}
+	if len(a.Allow) > 0 && !ipListed(a.Allow, ip) {
+		return errors.New("gomq: address not allowed")
+	}
+	return nil
+}
+
+// ipListed reports whether ip is among addresses.
+func ipListed(addresses []string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, address := range addresses {
+		if _, network, err := net.ParseCIDR(address); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(address)) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlainAuthenticator accepts PLAIN clients presenting one of
+// its usernames, mapped to their password. It accepts the
+// clients of other mechanisms.
+type PlainAuthenticator map[string]string
+
+// Authenticate checks r's username and password.
+func (a PlainAuthenticator) Authenticate(r *ZAPRequest) error {
+	if r.Mechanism != zmtp.PlainSecurityMechanismType {
+		return nil
+	}
+	if len(r.Credentials) != 2 {
+		return errors.New("gomq: invalid PLAIN credentials")
+	}
+	password, ok := a[string(r.Credentials[0])]
+	if !ok || password != string(r.Credentials[1]) {
+		return errors.New("gomq: invalid username or password")
+	}
+	r.UserID = string(r.Credentials[0])
+	return nil
+}
+
+// CurveAuthenticator accepts CURVE clients whose long-term
+// public key, Z85 encoded, it lists. It accepts the clients
+// of other mechanisms.
+type CurveAuthenticator []string
+
+// Authenticate checks r's public key.
+func (a CurveAuthenticator) Authenticate(r *ZAPRequest) error {
+	if r.Mechanism != zmtp.CurveSecurityMechanismType {
+		return nil
+	}
+	if len(r.Credentials) == 1 {
+		key, err := zmtp.Z85Encode(r.Credentials[0])
+		for _, allowed := range a {
+			if err == nil && key == allowed {
+				return nil
+			}
+		}
+	}
+	return errors.New("gomq: CURVE key not allowed")
+}
+
+// SetAuthenticator makes the socket consult a during the
+// handshake of each connection it accepts from then on,
+// refusing the clients a returns an error for. Use
+// NewZAPAuthenticator to consult a ZAP handler.
+func (s *Socket) SetAuthenticator(a Authenticator) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.authenticator = a
+}
+
+// authenticatingSocket is implemented by sockets
+// that may authenticate the clients they accept.
+type authenticatingSocket interface {
+	currentAuthenticator() Authenticator
+}
+
+func (s *Socket) currentAuthenticator() Authenticator {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.authenticator
+}
+
+// setAuthenticator makes c, accepted by s from addr,
+// consult s's authenticator during its handshake. It
+// returns a function returning the user ID the client
+// authenticated as, once the handshake is done.
+func setAuthenticator(s Server, c *zmtp.Connection, addr net.Addr) func() string {
+	var userID string
+	user := func() string { return userID }
+	as, ok := s.(authenticatingSocket)
+	if !ok {
+		return user
+	}
+	a := as.currentAuthenticator()
+	if a == nil {
+		return user
+	}
+
+	address := addr.String()
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	identity := s.SocketIdentity()
+	c.SetAuthenticator(func(mechanism zmtp.SecurityMechanismType, credentials [][]byte) error {
+		r := &ZAPRequest{
+			Address:     address,
+			Identity:    identity,
+			Mechanism:   mechanism,
+			Credentials: credentials,
+		}
+		err := a.Authenticate(r)
+		userID = r.UserID
+		return err
+	})
+	return user
+}
+
+// ServeZAP answers the ZAP requests received on s, a REP
+// socket usually bound to ZAPEndpoint, with a, until ctx is
+// done or s fails. This lets libzmq sockets configured with
+// a ZAP domain authenticate their clients with a.
+func ServeZAP(ctx context.Context, s ZeroMQSocket, a Authenticator) error {
+	for {
+		request, err := s.RecvMultipartContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		status, text, userID := "200", "OK", ""
+		if len(request) < 6 || string(request[0]) != zapVersion {
+			status, text = "500", "Invalid request"
+		} else {
+			r := &ZAPRequest{
+				Domain:      string(request[2]),
+				Address:     string(request[3]),
+				Identity:    request[4],
+				Mechanism:   zmtp.SecurityMechanismType(request[5]),
+				Credentials: request[6:],
+			}
+			if err := a.Authenticate(r); err != nil {
+				status, text = "400", err.Error()
+			}
+			userID = r.UserID
+		}
+
+		var requestID []byte
+		if len(request) > 1 {
+			requestID = request[1]
+		}
+		reply := [][]byte{[]byte(zapVersion), requestID, []byte(status), []byte(text), []byte(userID), {}}
+		if err := s.SendMultipartContext(ctx, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// zapClient authenticates clients by asking a ZAP handler.
+type zapClient struct {
+	s      ZeroMQSocket
+	domain string
+	lock   sync.Mutex
+	nextID uint64
+}
+
+// NewZAPAuthenticator returns an Authenticator asking the ZAP
+// handler s is connected to, such as a REQ socket connected
+// to ZAPEndpoint, with requests for domain. Requests are made
+// one at a time.
+func NewZAPAuthenticator(s ZeroMQSocket, domain string) Authenticator {
+	return &zapClient{s: s, domain: domain}
+}
+
+func (c *zapClient) Authenticate(r *ZAPRequest) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nextID++
+	requestID := []byte(strconv.FormatUint(c.nextID, 10))
+	request := [][]byte{
+		[]byte(zapVersion),
+		requestID,
+		[]byte(c.domain),
+		[]byte(r.Address),
+		r.Identity,
+		[]byte(r.Mechanism),
+	}
+	if err := c.s.SendMultipart(append(request, r.Credentials...)); err != nil {
+		return err
+	}
+
+	reply, err := c.s.RecvMultipart()
+	if err != nil {
+		return err
+	}
+	if len(reply) < 4 || string(reply[0]) != zapVersion || string(reply[1]) != string(requestID) {
+		return errZAPReply
+	}
+	if string(reply[2]) != "200" {
+		return errors.New(string(reply[3]))
+	}
+	if len(reply) > 4 {
+		r.UserID = string(reply[4])
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package gomq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+func TestAuthenticators(t *testing.T) {
+	ip := IPAuthenticator{Allow: []string{"10.0.0.0/8", "192.0.2.1"}, Deny: []string{"10.0.0.66"}}
+	plain := PlainAuthenticator{"admin": "secret"}
+	key, _, _ := zmtp.NewCurveKeypair()
+	keyBytes, _ := zmtp.Z85Decode(key)
+	other, _, _ := zmtp.NewCurveKeypair()
+	otherBytes, _ := zmtp.Z85Decode(other)
+	a := Authenticators{ip, plain, CurveAuthenticator{key}}
+
+	for _, tc := range []struct {
+		r  ZAPRequest
+		ok bool
+	}{
+		{ZAPRequest{Address: "10.1.2.3", Mechanism: zmtp.NullSecurityMechanismType}, true},
+		{ZAPRequest{Address: "192.0.2.1", Mechanism: zmtp.NullSecurityMechanismType}, true},
+		{ZAPRequest{Address: "10.0.0.66", Mechanism: zmtp.NullSecurityMechanismType}, false},
+		{ZAPRequest{Address: "192.0.2.2", Mechanism: zmtp.NullSecurityMechanismType}, false},
+		{ZAPRequest{Address: "/tmp/shm.sock", Mechanism: zmtp.NullSecurityMechanismType}, false},
+		{ZAPRequest{Address: "10.1.2.3", Mechanism: zmtp.PlainSecurityMechanismType, Credentials: [][]byte{[]byte("admin"), []byte("secret")}}, true},
+		{ZAPRequest{Address: "10.1.2.3", Mechanism: zmtp.PlainSecurityMechanismType, Credentials: [][]byte{[]byte("admin"), []byte("guess")}}, false},
+		{ZAPRequest{Address: "10.1.2.3", Mechanism: zmtp.CurveSecurityMechanismType, Credentials: [][]byte{keyBytes}}, true},
+		{ZAPRequest{Address: "10.1.2.3", Mechanism: zmtp.CurveSecurityMechanismType, Credentials: [][]byte{otherBytes}}, false},
+	} {
+		if want, got := tc.ok, a.Authenticate(&tc.r) == nil; want != got {
+			t.Errorf("%+v: want %v, got %v", tc.r, want, got)
+		}
+	}
+}
+
+func TestSetAuthenticator(t *testing.T) {
+	server := NewServer(zmtp.NewSecurityPlainServer())
+	defer server.Close()
+	server.SetAuthenticator(PlainAuthenticator{"admin": "secret"})
+	if _, err := server.Bind("tcp://127.0.0.1:19056"); err != nil {
+		t.Fatal(err)
+	}
+
+	refused := NewClient(zmtp.NewSecurityPlainClient("admin", "guess"))
+	defer refused.Close()
+	if err := refused.Connect("tcp://127.0.0.1:19056"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("want %v connecting with a wrong password, got %v", ErrAuthFailed, err)
+	}
+
+	client := NewClient(zmtp.NewSecurityPlainClient("admin", "secret"))
+	defer client.Close()
+	if err := client.Connect("tcp://127.0.0.1:19056"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send([]byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(msg); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestServeZAP(t *testing.T) {
+	handler := NewRep(zmtp.NewSecurityNull())
+	defer handler.Close()
+	if _, err := handler.Bind("tcp://127.0.0.1:19057"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var domain string
+	go ServeZAP(ctx, handler, AuthenticatorFunc(func(r *ZAPRequest) error {
+		domain = r.Domain
+		return IPAuthenticator{Deny: []string{"127.0.0.1"}}.Authenticate(r)
+	}))
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+	if err := req.Connect("tcp://127.0.0.1:19057"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(zmtp.NewSecurityNull())
+	defer server.Close()
+	server.SetAuthenticator(NewZAPAuthenticator(req, "global"))
+	if _, err := server.Bind("tcp://127.0.0.1:19058"); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(zmtp.NewSecurityNull())
+	defer client.Close()
+	if err := client.Connect("tcp://127.0.0.1:19058"); err == nil {
+		t.Error("want an error connecting from a denied address")
+	}
+	if want, got := "global", domain; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
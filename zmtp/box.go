@@ -0,0 +1,268 @@
+package zmtp
+
+import (
+	"crypto/ecdh"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// This file implements the parts of NaCl's crypto_box that
+// CurveZMQ uses: Curve25519 key agreement and authenticated
+// encryption with XSalsa20 and Poly1305. Boxes are laid out
+// like libsodium's crypto_box_easy, the 16 byte tag followed
+// by the ciphertext, which is how CurveZMQ sends them.
+
+const boxOverhead = 16
+
+var errBoxOpen = errors.New("gomq/zmtp: message authentication failed")
+
+// sigma is the Salsa20 constant for 32 byte keys.
+var sigma = [16]byte{'e', 'x', 'p', 'a', 'n', 'd', ' ', '3', '2', '-', 'b', 'y', 't', 'e', ' ', 'k'}
+
+// salsaRounds runs the 20 rounds of Salsa20 on the
+// state made of key k, input in and constant c.
+func salsaRounds(k *[32]byte, in *[16]byte, c *[16]byte) (x, j [16]uint32) {
+	le := binary.LittleEndian
+	j = [16]uint32{
+		le.Uint32(c[0:]), le.Uint32(k[0:]), le.Uint32(k[4:]), le.Uint32(k[8:]),
+		le.Uint32(k[12:]), le.Uint32(c[4:]), le.Uint32(in[0:]), le.Uint32(in[4:]),
+		le.Uint32(in[8:]), le.Uint32(in[12:]), le.Uint32(c[8:]), le.Uint32(k[16:]),
+		le.Uint32(k[20:]), le.Uint32(k[24:]), le.Uint32(k[28:]), le.Uint32(c[12:]),
+	}
+	x = j
+
+	r := bits.RotateLeft32
+	for i := 0; i < 20; i += 2 {
+		x[4] ^= r(x[0]+x[12], 7)
+		x[8] ^= r(x[4]+x[0], 9)
+		x[12] ^= r(x[8]+x[4], 13)
+		x[0] ^= r(x[12]+x[8], 18)
+		x[9] ^= r(x[5]+x[1], 7)
+		x[13] ^= r(x[9]+x[5], 9)
+		x[1] ^= r(x[13]+x[9], 13)
+		x[5] ^= r(x[1]+x[13], 18)
+		x[14] ^= r(x[10]+x[6], 7)
+		x[2] ^= r(x[14]+x[10], 9)
+		x[6] ^= r(x[2]+x[14], 13)
+		x[10] ^= r(x[6]+x[2], 18)
+		x[3] ^= r(x[15]+x[11], 7)
+		x[7] ^= r(x[3]+x[15], 9)
+		x[11] ^= r(x[7]+x[3], 13)
+		x[15] ^= r(x[11]+x[7], 18)
+
+		x[1] ^= r(x[0]+x[3], 7)
+		x[2] ^= r(x[1]+x[0], 9)
+		x[3] ^= r(x[2]+x[1], 13)
+		x[0] ^= r(x[3]+x[2], 18)
+		x[6] ^= r(x[5]+x[4], 7)
+		x[7] ^= r(x[6]+x[5], 9)
+		x[4] ^= r(x[7]+x[6], 13)
+		x[5] ^= r(x[4]+x[7], 18)
+		x[11] ^= r(x[10]+x[9], 7)
+		x[8] ^= r(x[11]+x[10], 9)
+		x[9] ^= r(x[8]+x[11], 13)
+		x[10] ^= r(x[9]+x[8], 18)
+		x[12] ^= r(x[15]+x[14], 7)
+		x[13] ^= r(x[12]+x[15], 9)
+		x[14] ^= r(x[13]+x[12], 13)
+		x[15] ^= r(x[14]+x[13], 18)
+	}
+	return x, j
+}
+
+// hsalsa20 derives a key from key k and input in.
+func hsalsa20(k *[32]byte, in *[16]byte) [32]byte {
+	x, _ := salsaRounds(k, in, &sigma)
+	var out [32]byte
+	for i, w := range [8]uint32{x[0], x[5], x[10], x[15], x[6], x[7], x[8], x[9]} {
+		binary.LittleEndian.PutUint32(out[4*i:], w)
+	}
+	return out
+}
+
+// xsalsa20 XORs src into dst with the XSalsa20 key stream
+// for key k and nonce n, skipping the first skip bytes of
+// the stream, which must be less than 64.
+func xsalsa20(dst, src []byte, n *[24]byte, k *[32]byte, skip int) {
+	var in [16]byte
+	copy(in[:], n[:16])
+	subkey := hsalsa20(k, &in)
+	copy(in[:8], n[16:])
+
+	var block [64]byte
+	for counter := uint64(0); len(src) > 0; counter++ {
+		binary.LittleEndian.PutUint64(in[8:], counter)
+		x, j := salsaRounds(&subkey, &in, &sigma)
+		for i := range x {
+			binary.LittleEndian.PutUint32(block[4*i:], x[i]+j[i])
+		}
+		m := subtle.XORBytes(dst, src, block[skip:])
+		dst, src, skip = dst[m:], src[m:], 0
+	}
+}
+
+// poly1305 returns the Poly1305 tag of m with the one-time key.
+func poly1305(m []byte, key *[32]byte) [16]byte {
+	le := binary.LittleEndian
+	r0 := uint64(le.Uint32(key[0:])) & 0x3ffffff
+	r1 := uint64(le.Uint32(key[3:])>>2) & 0x3ffff03
+	r2 := uint64(le.Uint32(key[6:])>>4) & 0x3ffc0ff
+	r3 := uint64(le.Uint32(key[9:])>>6) & 0x3f03fff
+	r4 := uint64(le.Uint32(key[12:])>>8) & 0x00fffff
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+
+	var h0, h1, h2, h3, h4 uint64
+	for len(m) > 0 {
+		var block [16]byte
+		hibit := uint64(1 << 24)
+		if len(m) >= 16 {
+			copy(block[:], m)
+			m = m[16:]
+		} else {
+			block[copy(block[:], m)] = 1
+			hibit = 0
+			m = nil
+		}
+
+		h0 += uint64(le.Uint32(block[0:])) & 0x3ffffff
+		h1 += uint64(le.Uint32(block[3:])>>2) & 0x3ffffff
+		h2 += uint64(le.Uint32(block[6:])>>4) & 0x3ffffff
+		h3 += uint64(le.Uint32(block[9:])>>6) & 0x3ffffff
+		h4 += uint64(le.Uint32(block[12:])>>8) | hibit
+
+		d0 := h0*r0 + h1*s4 + h2*s3 + h3*s2 + h4*s1
+		d1 := h0*r1 + h1*r0 + h2*s4 + h3*s3 + h4*s2
+		d2 := h0*r2 + h1*r1 + h2*r0 + h3*s4 + h4*s3
+		d3 := h0*r3 + h1*r2 + h2*r1 + h3*r0 + h4*s4
+		d4 := h0*r4 + h1*r3 + h2*r2 + h3*r1 + h4*r0
+
+		h0 = d0 & 0x3ffffff
+		d1 += d0 >> 26
+		h1 = d1 & 0x3ffffff
+		d2 += d1 >> 26
+		h2 = d2 & 0x3ffffff
+		d3 += d2 >> 26
+		h3 = d3 & 0x3ffffff
+		d4 += d3 >> 26
+		h4 = d4 & 0x3ffffff
+		h0 += (d4 >> 26) * 5
+		h1 += h0 >> 26
+		h0 &= 0x3ffffff
+	}
+
+	c := h1 >> 26
+	h1 &= 0x3ffffff
+	h2 += c
+	c = h2 >> 26
+	h2 &= 0x3ffffff
+	h3 += c
+	c = h3 >> 26
+	h3 &= 0x3ffffff
+	h4 += c
+	c = h4 >> 26
+	h4 &= 0x3ffffff
+	h0 += c * 5
+	c = h0 >> 26
+	h0 &= 0x3ffffff
+	h1 += c
+
+	// h - p, selected in constant time if h >= p
+	g0 := h0 + 5
+	c = g0 >> 26
+	g0 &= 0x3ffffff
+	g1 := h1 + c
+	c = g1 >> 26
+	g1 &= 0x3ffffff
+	g2 := h2 + c
+	c = g2 >> 26
+	g2 &= 0x3ffffff
+	g3 := h3 + c
+	c = g3 >> 26
+	g3 &= 0x3ffffff
+	g4 := h4 + c - 1<<26
+
+	mask := (g4 >> 63) - 1
+	h0 = h0&^mask | g0&mask
+	h1 = h1&^mask | g1&mask
+	h2 = h2&^mask | g2&mask
+	h3 = h3&^mask | g3&mask
+	h4 = h4&^mask | g4&mask
+
+	f := uint64(uint32(h0|h1<<26)) + uint64(le.Uint32(key[16:]))
+	var tag [16]byte
+	le.PutUint32(tag[0:], uint32(f))
+	f = uint64(uint32(h1>>6|h2<<20)) + uint64(le.Uint32(key[20:])) + f>>32
+	le.PutUint32(tag[4:], uint32(f))
+	f = uint64(uint32(h2>>12|h3<<14)) + uint64(le.Uint32(key[24:])) + f>>32
+	le.PutUint32(tag[8:], uint32(f))
+	f = uint64(uint32(h3>>18|h4<<8)) + uint64(le.Uint32(key[28:])) + f>>32
+	le.PutUint32(tag[12:], uint32(f))
+	return tag
+}
+
+// sealSecretBox appends to out the box of m under
+// key k with nonce n, like crypto_secretbox_easy.
+func sealSecretBox(out, m []byte, n *[24]byte, k *[32]byte) []byte {
+	var polyKey [32]byte
+	xsalsa20(polyKey[:], polyKey[:], n, k, 0)
+
+	out = append(out, make([]byte, boxOverhead+len(m))...)
+	box := out[len(out)-boxOverhead-len(m):]
+	xsalsa20(box[boxOverhead:], m, n, k, 32)
+	tag := poly1305(box[boxOverhead:], &polyKey)
+	copy(box, tag[:])
+	return out
+}
+
+// openSecretBox appends to out the contents of box, sealed
+// under key k with nonce n, if it authenticates.
+func openSecretBox(out, box []byte, n *[24]byte, k *[32]byte) ([]byte, error) {
+	if len(box) < boxOverhead {
+		return nil, errBoxOpen
+	}
+	var polyKey [32]byte
+	xsalsa20(polyKey[:], polyKey[:], n, k, 0)
+
+	tag := poly1305(box[boxOverhead:], &polyKey)
+	if subtle.ConstantTimeCompare(tag[:], box[:boxOverhead]) != 1 {
+		return nil, errBoxOpen
+	}
+
+	out = append(out, make([]byte, len(box)-boxOverhead)...)
+	m := out[len(out)-len(box)+boxOverhead:]
+	xsalsa20(m, box[boxOverhead:], n, k, 32)
+	return out, nil
+}
+
+// boxKey returns the key shared by the owners of secret key
+// sk and public key pk, like crypto_box_beforenm.
+func boxKey(pk, sk *[32]byte) ([32]byte, error) {
+	var k [32]byte
+	priv, err := ecdh.X25519().NewPrivateKey(sk[:])
+	if err != nil {
+		return k, err
+	}
+	pub, err := ecdh.X25519().NewPublicKey(pk[:])
+	if err != nil {
+		return k, err
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return k, err
+	}
+	copy(k[:], shared)
+	return hsalsa20(&k, new([16]byte)), nil
+}
+
+// derivePublicKey returns the Curve25519 public key of secret key sk.
+func derivePublicKey(sk *[32]byte) ([32]byte, error) {
+	var pk [32]byte
+	priv, err := ecdh.X25519().NewPrivateKey(sk[:])
+	if err != nil {
+		return pk, err
+	}
+	copy(pk[:], priv.PublicKey().Bytes())
+	return pk, nil
+}
@@ -1,11 +1,16 @@
 package zmtp
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Connection is a ZMTP level connection
@@ -15,6 +20,28 @@ type Connection struct {
 	socket                     Socket
 	isPrepared                 bool
 	asServer, otherEndAsServer bool
+	otherEndVersion            [2]uint8
+	otherEndMetadata           map[string]string
+	greetingTimeout            time.Duration
+	handshakeTimeout           time.Duration
+	handshakeDeadline          time.Time
+	largeFrameThreshold        int64
+	onFrameProgress            func(read, total uint64)
+	pooled                     bool
+	session                    securitySession
+	sendLock                   sync.Mutex
+	wbuf                       *bufio.Writer
+	authenticate               func(SecurityMechanismType, [][]byte) error
+	strict                     bool
+	trace                      atomic.Value // tracer
+
+	// maxMessageSize and timingEvery are accessed atomically,
+	// timingCount and timing only by the goroutine receiving
+	// messages.
+	maxMessageSize int64
+	timingEvery    int64
+	timingCount    int64
+	timing         *Timing
 }
 
 // SocketType is a ZMTP socket type
@@ -22,7 +49,8 @@ type SocketType string
 
 // SocketIdentity is the ZMTP metadata socket identity.
 // See:
-//  https://rfc.zeromq.org/spec:23/ZMTP/.
+//
+//	https://rfc.zeromq.org/spec:23/ZMTP/.
 type SocketIdentity []byte
 
 func (id SocketIdentity) String() string {
@@ -46,6 +74,8 @@ const (
 	SubSocketType    SocketType = "SUB"    // a ZMQ_SUB socket
 	XPubSocketType   SocketType = "XPUB"   // a ZMQ_XPUB socket
 	XSubSocketType   SocketType = "XSUB"   // a ZMQ_XSUB socket
+	PairSocketType   SocketType = "PAIR"   // a ZMQ_PAIR socket
+	StreamSocketType SocketType = "STREAM" // a ZMQ_STREAM socket, which does not speak ZMTP
 )
 
 // NewConnection accepts an io.ReadWriter and creates a new ZMTP connection
@@ -60,82 +90,227 @@ func (c *Connection) Prepare(mechanism SecurityMechanism, socketType SocketType,
 	}
 
 	c.isPrepared = true
+	if d, ok := c.rw.(deadliner); ok && c.handshakeTimeout > 0 {
+		c.handshakeDeadline = time.Now().Add(c.handshakeTimeout)
+		d.SetDeadline(c.handshakeDeadline)
+		defer d.SetDeadline(time.Time{})
+	}
+
+	metadata, err := c.prepare(mechanism, socketType, socketID, asServer, applicationMetadata)
+	if err != nil && !c.handshakeDeadline.IsZero() && !time.Now().Before(c.handshakeDeadline) {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeTimeout, err)
+	}
+	return metadata, err
+}
+
+func (c *Connection) prepare(mechanism SecurityMechanism, socketType SocketType, socketID SocketIdentity, asServer bool, applicationMetadata map[string]string) (map[string]string, error) {
 	c.securityMechanism = mechanism
 
 	var err error
 	if c.socket, err = NewSocket(socketType); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while creating socket: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while creating socket: %w", err)
+	}
+
+	sm, hasSession := mechanism.(sessionMechanism)
+	if hasSession {
+		asServer = sm.isServer()
 	}
 
 	// Send/recv greeting
 	if err := c.sendGreeting(asServer); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while sending greeting: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while sending greeting: %w", err)
 	}
 	if err := c.recvGreeting(asServer); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %w", err)
+	}
+
+	if hasSession {
+		return c.prepareSession(sm, socketType, socketID, applicationMetadata)
 	}
 
 	// Do security handshake
 	if err := mechanism.Handshake(); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while running the security handshake: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while running the security handshake: %w", err)
+	}
+
+	if asServer {
+		if err := c.authenticateClient(NullSecurityMechanismType, nil); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while running the security handshake: %w", err)
+		}
 	}
 
 	// Send/recv metadata
 	if err := c.sendMetadata(socketType, socketID, applicationMetadata); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while sending metadata: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while sending metadata: %w", err)
 	}
 
 	otherEndApplicationMetaData, err := c.recvMetadata()
 	if err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving metadata: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving metadata: %w", err)
 	}
 
 	return otherEndApplicationMetaData, nil
 }
 
+// prepareSession runs the handshake of a mechanism protecting
+// the connection with a session, which exchanges the metadata.
+func (c *Connection) prepareSession(mechanism sessionMechanism, socketType SocketType, socketID SocketIdentity, applicationMetadata map[string]string) (map[string]string, error) {
+	metadata, err := c.metadata(socketType, socketID, applicationMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("gomq/zmtp: Got error while sending metadata: %w", err)
+	}
+
+	session, otherEndMetadata, err := mechanism.handshake(c, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("gomq/zmtp: Got error while running the security handshake: %w", err)
+	}
+	c.session = session
+
+	otherEndApplicationMetaData, err := c.parseMetadata(otherEndMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving metadata: %w", err)
+	}
+	return otherEndApplicationMetaData, nil
+}
+
 func (c *Connection) sendGreeting(asServer bool) error {
 	greeting := greeting{
 		SignaturePrefix: signaturePrefix,
 		SignatureSuffix: signatureSuffix,
 		Version:         version,
+		ServerFlag:      toByteBool(asServer),
 	}
 	toNullPaddedString(string(c.securityMechanism.Type()), greeting.Mechanism[:])
 
-	if err := greeting.marshal(c.rw); err != nil {
+	w := io.Writer(c.rw)
+	var sent bytes.Buffer
+	if c.tracing() {
+		w = io.MultiWriter(&sent, c.rw)
+	}
+	if err := greeting.marshal(w); err != nil {
 		return err
 	}
+	c.tracef("send greeting: % x", sent.Bytes())
 
 	return nil
 }
 
-func (c *Connection) recvGreeting(asServer bool) error {
-	var greeting greeting
+// SetAuthenticator registers a function the server end of
+// the connection calls during the handshake with the type of
+// security mechanism and the credentials the client presented:
+// none for NULL, the username and password for PLAIN, and the
+// long-term public key for CURVE. If it returns an error, the
+// client is sent an ERROR command with the error's text and
+// Prepare fails. It must be set before Prepare.
+func (c *Connection) SetAuthenticator(fn func(mechanism SecurityMechanismType, credentials [][]byte) error) {
+	c.authenticate = fn
+}
 
-	if err := greeting.unmarshal(c.rw); err != nil {
-		return fmt.Errorf("Error while reading: %v", err)
+// authenticateClient checks credentials with the connection's
+// authenticator, if any, sending an ERROR command on failure.
+func (c *Connection) authenticateClient(mechanism SecurityMechanismType, credentials [][]byte) error {
+	if c.authenticate == nil {
+		return nil
+	}
+	err := c.authenticate(mechanism, credentials)
+	if err != nil {
+		reason := err.Error()
+		if len(reason) > 255 {
+			reason = reason[:255]
+		}
+		c.sendError(reason)
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
 	}
+	return nil
+}
+
+// SetGreetingTimeout sets how long Prepare waits for each
+// part of the other end's greeting before giving up. It
+// only applies to transports with read deadlines, such as
+// net.Conn. Zero, the default, means waiting forever.
+func (c *Connection) SetGreetingTimeout(timeout time.Duration) {
+	c.greetingTimeout = timeout
+}
+
+// SetHandshakeTimeout sets how long Prepare may take as a
+// whole, from the greeting to the exchange of metadata, so
+// that peers trickling the handshake cannot hold the connection
+// forever. Prepare then fails with an error wrapping
+// ErrHandshakeTimeout. It only applies to transports with
+// deadlines, such as net.Conn. Zero, the default, means no limit.
+func (c *Connection) SetHandshakeTimeout(timeout time.Duration) {
+	c.handshakeTimeout = timeout
+}
 
-	if greeting.SignaturePrefix != signaturePrefix {
-		return fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", greeting.SignaturePrefix, signaturePrefix)
+// SetMaxMessageSize sets the largest message, in bytes, that
+// may be received on the connection. Messages are checked
+// against it before being read, so a peer announcing huge
+// frames fails the connection instead of exhausting memory.
+// It applies to the handshake as well if set before Prepare,
+// and may be changed while messages are being received.
+// Zero, the default, means no limit.
+func (c *Connection) SetMaxMessageSize(size int64) {
+	atomic.StoreInt64(&c.maxMessageSize, size)
+}
+
+// checkMessageSize returns an error if a message
+// of size bytes exceeds the connection's limit.
+func (c *Connection) checkMessageSize(size uint64) error {
+	if max := atomic.LoadInt64(&c.maxMessageSize); max > 0 && size > uint64(max) {
+		return fmt.Errorf("%w: %v bytes exceeds limit of %v", ErrMessageTooLarge, size, max)
 	}
+	return nil
+}
 
-	if greeting.SignatureSuffix != signatureSuffix {
-		return fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", greeting.SignatureSuffix, signatureSuffix)
+func (c *Connection) recvGreeting(asServer bool) error {
+	var greeting greeting
+
+	var r io.Reader = timeoutReader{r: c.rw, timeout: c.greetingTimeout, deadline: c.handshakeDeadline}
+	if c.tracing() {
+		t := &traceReader{r: r}
+		defer func() { c.tracef("recv greeting: % x", t.read) }()
+		r = t
+	}
+	err := greeting.unmarshal(r, c.strict)
+	if d, ok := c.rw.(readDeadliner); ok && c.greetingTimeout > 0 {
+		d.SetReadDeadline(c.handshakeDeadline)
+	}
+	if v, ok := err.(*Violation); ok {
+		return v
+	}
+	if err != nil {
+		return fmt.Errorf("Error while reading: %w", err)
 	}
 
 	if greeting.Version != version {
-		return fmt.Errorf("Version %v.%v received does match expected version %v.%v", int(greeting.Version[0]), int(greeting.Version[1]), int(majorVersion), int(minorVersion))
+		return c.violation(fmt.Errorf("Version %v.%v received does match expected version %v.%v", int(greeting.Version[0]), int(greeting.Version[1]), int(majorVersion), int(minorVersion)), &Violation{
+			Rule:     "RFC 23 version negotiation",
+			Field:    "version",
+			Expected: fmt.Sprintf("%v.%v", majorVersion, minorVersion),
+			Got:      fmt.Sprintf("%v.%v", greeting.Version[0], greeting.Version[1]),
+		})
 	}
+	c.otherEndVersion = greeting.Version
 
 	var otherMechanism = fromNullPaddedString(greeting.Mechanism[:])
 	var thisMechanism = string(c.securityMechanism.Type())
 	if thisMechanism != otherMechanism {
-		return fmt.Errorf("Encryption mechanism on other side %q does not match this side's %q", otherMechanism, thisMechanism)
+		return c.violation(fmt.Errorf("Encryption mechanism on other side %q does not match this side's %q", otherMechanism, thisMechanism), &Violation{
+			Rule:     "RFC 23 security mechanism",
+			Field:    "mechanism",
+			Expected: fmt.Sprintf("%q", thisMechanism),
+			Got:      fmt.Sprintf("%q", otherMechanism),
+		})
 	}
 
 	otherEndAsServer, err := fromByteBool(greeting.ServerFlag)
 	if err != nil {
-		return err
+		return c.violation(err, &Violation{
+			Rule:     "RFC 23 greeting",
+			Field:    "as-server",
+			Expected: "0x00 or 0x01",
+			Got:      fmt.Sprintf("%#02x", greeting.ServerFlag),
+		})
 	}
 	c.otherEndAsServer = otherEndAsServer
 
@@ -143,27 +318,37 @@ func (c *Connection) recvGreeting(asServer bool) error {
 }
 
 func (c *Connection) sendMetadata(socketType SocketType, socketID SocketIdentity, applicationMetadata map[string]string) error {
+	body, err := c.metadata(socketType, socketID, applicationMetadata)
+	if err != nil {
+		return err
+	}
+	return c.SendCommand("READY", body)
+}
+
+// metadata returns the body of a READY command
+// holding the metadata of this end.
+func (c *Connection) metadata(socketType SocketType, socketID SocketIdentity, applicationMetadata map[string]string) ([]byte, error) {
 	buffer := new(bytes.Buffer)
-	var usedKeys map[string]struct{}
+	usedKeys := make(map[string]struct{})
 
 	for k, v := range applicationMetadata {
 		if len(k) == 0 {
-			return errors.New("Cannot send empty application metadata key")
+			return nil, errors.New("Cannot send empty application metadata key")
 		}
 
 		lowerCaseKey := strings.ToLower(k)
 		if _, alreadyPresent := usedKeys[lowerCaseKey]; alreadyPresent {
-			return fmt.Errorf("Key %q is specified multiple times with different casing", lowerCaseKey)
+			return nil, fmt.Errorf("Key %q is specified multiple times with different casing", lowerCaseKey)
 		}
 
 		usedKeys[lowerCaseKey] = struct{}{}
 		c.writeMetadata(buffer, "x-"+lowerCaseKey, v)
 	}
 
-	c.writeMetadata(buffer, "socket-type", string(socketType))
+	c.writeMetadata(buffer, "Socket-Type", string(socketType))
 	c.writeMetadata(buffer, "Identity", socketID.String())
 
-	return c.SendCommand("READY", buffer.Bytes())
+	return buffer.Bytes(), nil
 }
 
 func (c *Connection) writeMetadata(buffer *bytes.Buffer, name string, value string) {
@@ -187,54 +372,47 @@ func (c *Connection) writeMetadata(buffer *bytes.Buffer, name string, value stri
 }
 
 func (c *Connection) recvMetadata() (map[string]string, error) {
-	isCommand, body, err := c.read()
+	body, err := c.readHandshakeCommand("READY")
 	if err != nil {
 		return nil, err
 	}
+	return c.parseMetadata(body)
+}
 
-	if !isCommand {
-		return nil, errors.New("Got a message frame for metadata, expected a command frame")
-	}
-
-	command, err := c.parseCommand(body)
-	if err != nil {
-		return nil, err
-	}
-
-	if command.Name != "READY" {
-		return nil, fmt.Errorf("Got a %v command for metadata instead of the expected READY command frame", command.Name)
-	}
-
+// parseMetadata parses the body of the other end's READY
+// command and returns its application metadata.
+func (c *Connection) parseMetadata(body []byte) (map[string]string, error) {
 	metadata := make(map[string]string)
 	applicationMetadata := make(map[string]string)
 	i := 0
-	for i < len(command.Body) {
+	for i < len(body) {
 		// Key length
-		keyLength := int(command.Body[i])
-		if i+keyLength >= len(command.Body) {
-			return nil, fmt.Errorf("metadata key of length %v overflows body of length %v at position %v", keyLength, len(command.Body), i)
+		keyLength := int(body[i])
+		if i+keyLength >= len(body) {
+			return nil, truncatedMetadata("property name", uint64(keyLength), len(body)-i-1)
 		}
 		i++
 
 		// Key
-		key := strings.ToLower(string(command.Body[i : i+keyLength]))
+		if err := c.checkPropertyName(string(body[i : i+keyLength])); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(string(body[i : i+keyLength]))
 		i += keyLength
 
 		// Value length
-		rawValueLength := byteOrder.Uint32(command.Body[i : i+4])
-
-		if uint64(rawValueLength) > uint64(maxInt) {
-			return nil, fmt.Errorf("Length of value %v overflows integer max length %v on this platform", rawValueLength, maxInt)
-		}
-
-		valueLength := int(rawValueLength)
-		if i+valueLength >= len(command.Body) {
-			return nil, fmt.Errorf("metadata value of length %v overflows body of length %v at position %v", valueLength, len(command.Body), i)
+		if i+4 > len(body) {
+			return nil, truncatedMetadata("property value length", 4, len(body)-i)
 		}
+		rawValueLength := byteOrder.Uint32(body[i : i+4])
 		i += 4
+		if uint64(rawValueLength) > uint64(len(body)-i) {
+			return nil, truncatedMetadata("property value", uint64(rawValueLength), len(body)-i)
+		}
+		valueLength := int(rawValueLength)
 
 		// Value
-		value := string(command.Body[i : i+valueLength])
+		value := string(body[i : i+valueLength])
 		i += valueLength
 
 		if strings.HasPrefix(key, "x-") {
@@ -244,14 +422,96 @@ func (c *Connection) recvMetadata() (map[string]string, error) {
 		}
 	}
 
-	socketType := metadata["socket-type"]
+	socketType, ok := metadata["socket-type"]
+	if !ok && c.strict {
+		return nil, &Violation{
+			Rule:     "RFC 23 metadata",
+			Field:    "Socket-Type property",
+			Expected: "present",
+			Got:      "missing",
+		}
+	}
 	if !c.socket.IsSocketTypeCompatible(SocketType(socketType)) {
-		return nil, fmt.Errorf("Socket type %v is not compatible with %v", c.socket.Type(), socketType)
+		return nil, c.violation(fmt.Errorf("%w: %v sockets cannot talk to %s sockets", ErrIncompatibleSocketType, c.socket.Type(), peerSocketType(socketType)), &Violation{
+			Rule:     "RFC 23 socket type compatibility",
+			Field:    "Socket-Type property",
+			Expected: fmt.Sprintf("a socket type compatible with %v", c.socket.Type()),
+			Got:      fmt.Sprintf("%q", socketType),
+		})
 	}
+	c.otherEndMetadata = metadata
 
 	return applicationMetadata, nil
 }
 
+// readHandshakeCommand reads the command named name during
+// a security handshake and returns its body. An ERROR command
+// sent instead fails the handshake with its reason.
+func (c *Connection) readHandshakeCommand(name string) ([]byte, error) {
+	isCommand, body, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if !isCommand {
+		return nil, errors.New("Got a message frame during the security handshake, expected a command frame")
+	}
+	command, err := c.parseCommand(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if command.Name == "ERROR" && len(command.Body) > 0 && int(command.Body[0]) < len(command.Body) {
+		return nil, fmt.Errorf("%w: handshake refused: %s", ErrAuthFailed, command.Body[1:1+int(command.Body[0])])
+	}
+	if command.Name != name {
+		return nil, fmt.Errorf("Got a %v command during the security handshake instead of %v", command.Name, name)
+	}
+	return command.Body, nil
+}
+
+// sendError sends an ERROR command with reason, telling
+// the other end why its handshake failed.
+func (c *Connection) sendError(reason string) error {
+	return c.SendCommand("ERROR", append([]byte{byte(len(reason))}, reason...))
+}
+
+// Version returns the ZMTP version negotiated with the other end
+// of the connection, as a "major.minor" string.
+func (c *Connection) Version() string {
+	return fmt.Sprintf("%d.%d", c.otherEndVersion[0], c.otherEndVersion[1])
+}
+
+// Security returns the details of the security mechanism
+// negotiated for the connection, or zero details before
+// the handshake.
+func (c *Connection) Security() SecurityDetails {
+	if c.securityMechanism == nil {
+		return SecurityDetails{}
+	}
+	if d, ok := c.session.(SecurityDetailer); ok {
+		return d.Details()
+	}
+	if d, ok := c.securityMechanism.(SecurityDetailer); ok {
+		return d.Details()
+	}
+	return SecurityDetails{
+		Mechanism: c.securityMechanism.Type(),
+		Encrypted: c.securityMechanism.Type().IsEncrypted(),
+	}
+}
+
+// PeerSocketType returns the Socket-Type property sent by
+// the other end of the connection during the handshake.
+func (c *Connection) PeerSocketType() SocketType {
+	return SocketType(c.otherEndMetadata["socket-type"])
+}
+
+// PeerIdentity returns the Identity property sent by
+// the other end of the connection during the handshake.
+func (c *Connection) PeerIdentity() SocketIdentity {
+	return SocketIdentity(c.otherEndMetadata["identity"])
+}
+
 // SendCommand sends a ZMTP command over a Connection
 func (c *Connection) SendCommand(commandName string, body []byte) error {
 	cmdLen := len(commandName)
@@ -260,12 +520,13 @@ func (c *Connection) SendCommand(commandName string, body []byte) error {
 	}
 
 	bodyLen := len(body)
+	c.traceCommand("send", commandName, body)
 
 	buf := make([]byte, 1+cmdLen+bodyLen) // FIXME(sbinet): maybe use a pool of []byte ?
 	buf[0] = byte(cmdLen)
 	copy(buf[1:], []byte(commandName))
 	copy(buf[1+cmdLen:], body)
-  
+
 	return c.send(true, buf)
 }
 
@@ -275,48 +536,98 @@ func (c *Connection) SendFrame(body []byte) error {
 }
 
 func (c *Connection) send(isCommand bool, body []byte) error {
-	// Compute total body length
-	length := len(body)
-
-	var bitFlags byte
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
 
-	// More flag: Unused, we don't support multiframe messages
-
-	// Long flag
-	isLong := length > 255
-	if isLong {
-		bitFlags ^= isLongBitFlag
+	if c.session != nil {
+		frame, err := c.session.encode(false, isCommand, body)
+		if err != nil {
+			return err
+		}
+		return c.sendFrame(0, frame)
 	}
 
-	// Command flag
+	var flags byte
 	if isCommand {
-		bitFlags ^= isCommandBitFlag
+		flags |= isCommandBitFlag
 	}
 
-	// Write out the message itself
-	if _, err := c.rw.Write([]byte{bitFlags}); err != nil {
-		return err
+	// More flag: Unused, we don't support multiframe messages
+
+	header := appendFrameHeader(nil, flags, uint64(len(body)))
+	c.tracef("send frame header: % x", header)
+	return c.write(header, c.encrypt(body))
+}
+
+// sendFrame writes a frame of body with flags as is.
+func (c *Connection) sendFrame(flags byte, body []byte) error {
+	header := appendFrameHeader(nil, flags, uint64(len(body)))
+	c.tracef("send frame header: % x", header)
+	return c.write(header, body)
+}
+
+// encrypt encrypts body with the connection's security
+// mechanism. Connections not prepared send it as is.
+func (c *Connection) encrypt(body []byte) []byte {
+	if c.securityMechanism == nil {
+		return body
 	}
+	return c.securityMechanism.Encrypt(body)
+}
 
-	if isLong {
-		var buf [8]byte
-		byteOrder.PutUint64(buf[:], uint64(len(body)))
-		if _, err := c.rw.Write(buf[:]); err != nil {
-			return err
+// write writes bufs out, into the write buffer if the
+// connection has one, and otherwise at once, in a single
+// vectored write on transports supporting them. The caller
+// holds c.sendLock.
+func (c *Connection) write(bufs ...[]byte) error {
+	if c.wbuf != nil {
+		for _, b := range bufs {
+			if _, err := c.wbuf.Write(b); err != nil {
+				return err
+			}
 		}
-	} else {
-		if _, err := c.rw.Write([]byte{uint8(len(body))}); err != nil {
+		return nil
+	}
+	buffers := net.Buffers(bufs)
+	_, err := buffers.WriteTo(c.rw)
+	return err
+}
+
+// SetWriteBuffer makes the connection write frames through
+// a buffer of size bytes, so that the frames of small messages
+// sent in a row go out together in few writes. Frames are then
+// only written out once the buffer is full or Flush is called.
+// Frames written before the change are flushed first. Zero, the
+// default, writes each message out as it is sent. It should be
+// set after Prepare.
+func (c *Connection) SetWriteBuffer(size int) error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+
+	if c.wbuf != nil {
+		if err := c.wbuf.Flush(); err != nil {
 			return err
 		}
 	}
-
-	if _, err := c.rw.Write(c.securityMechanism.Encrypt(body)); err != nil {
-		return err
+	c.wbuf = nil
+	if size > 0 {
+		c.wbuf = bufio.NewWriterSize(c.rw, size)
 	}
-
 	return nil
 }
 
+// Flush writes out the frames held in the write
+// buffer, if the connection has one.
+func (c *Connection) Flush() error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+
+	if c.wbuf == nil {
+		return nil
+	}
+	return c.wbuf.Flush()
+}
+
 // Recv starts listening to the ReadWriter and passes *Message to a channel
 func (c *Connection) Recv(messageOut chan<- *Message) {
 	go func() {
@@ -331,9 +642,11 @@ func (c *Connection) Recv(messageOut chan<- *Message) {
 			if !isCommand {
 				// Data frame
 				frames := [][]byte{body}
-				messageOut <- &Message{Body: frames, MessageType: UserMessage}
+				messageOut <- &Message{Body: frames, MessageType: UserMessage, Pooled: c.pooled, Timing: c.timing.done()}
 			} else {
+				start := c.timing.now()
 				command, err := c.parseCommand(body)
+				c.timing.parse(start)
 				if err != nil {
 					messageOut <- &Message{Err: err, MessageType: ErrorMessage}
 					return
@@ -342,15 +655,14 @@ func (c *Connection) Recv(messageOut chan<- *Message) {
 				// Check what type of command we got
 				// Certain commands we deal with directly, the rest we send over to the application
 				switch command.Name {
-				case "PING":
-					// When we get a ping, we want to send back a pong, we don't really care about the contents right now
-					if err := c.SendCommand("PONG", nil); err != nil {
+				case pingCommand:
+					if err := c.handlePing(command.Body); err != nil {
 						messageOut <- &Message{Err: err, MessageType: ErrorMessage}
 						return
 					}
 				default:
 					frames := [][]byte{command.Body}
-					messageOut <- &Message{Name: command.Name, Body: frames, MessageType: ErrorMessage}
+					messageOut <- &Message{Name: command.Name, Body: frames, MessageType: CommandMessage, Timing: c.timing.done()}
 				}
 
 			}
@@ -360,54 +672,39 @@ func (c *Connection) Recv(messageOut chan<- *Message) {
 
 // read returns the isCommand flag, the body of the message, and optionally an error
 func (c *Connection) read() (bool, []byte, error) {
-	var header [2]byte
-	var longLength [8]byte
-
-	// Read out the header
-	_, err := io.ReadFull(c.rw, header[:])
+	c.timing = c.sampleTiming()
+	bitFlags, bodyLength, err := c.readFrameHeader()
 	if err != nil {
 		return false, nil, err
 	}
-
-	bitFlags := header[0]
+	start := c.timing.now()
 
 	// Read all the flags
 	hasMore := bitFlags&hasMoreBitFlag == hasMoreBitFlag
-	isLong := bitFlags&isLongBitFlag == isLongBitFlag
 	isCommand := bitFlags&isCommandBitFlag == isCommandBitFlag
 
-	// Error out in case get a more flag set to true
-	if hasMore {
-		return false, nil, errors.New("Received a packet with the MORE flag set to true, we don't support more")
+	if err := c.checkMessageSize(bodyLength); err != nil {
+		return false, nil, err
 	}
 
-	// Determine the actual length of the body
-	bodyLength := uint64(0)
-	if isLong {
-		// We read 2 bytes of the header already
-		// In case of a long message, the length is bytes 2-8 of the header
-		// We already have the first byte, so assign it, and then read the rest
-		longLength[0] = header[1]
-
-		_, err := io.ReadFull(c.rw, longLength[1:])
-		if err != nil {
+	buf, err := c.readBody(bodyLength)
+	if err != nil {
+		return false, nil, err
+	}
+	c.timing.read(start)
+	if c.session != nil {
+		start = c.timing.now()
+		sealed := buf
+		if hasMore, isCommand, buf, err = c.session.decode(buf); err != nil {
 			return false, nil, err
 		}
-
-		bodyLength = byteOrder.Uint64(longLength[:])
-	} else {
-		// Short message length is just 1 byte, read it
-		bodyLength = uint64(header[1])
+		c.release(sealed)
+		c.timing.parse(start)
 	}
 
-	if bodyLength > uint64(maxInt64) {
-		return false, nil, fmt.Errorf("Body length %v overflows max int64 value %v", bodyLength, maxInt64)
-	}
-
-	buf := make([]byte, bodyLength)
-	_, err = io.ReadFull(c.rw, buf)
-	if err != nil {
-		return false, nil, err
+	// Error out in case get a more flag set to true
+	if hasMore {
+		return false, nil, errors.New("Received a packet with the MORE flag set to true, we don't support more")
 	}
 	return isCommand, buf, nil
 }
@@ -428,6 +725,10 @@ func (c *Connection) parseCommand(body []byte) (*Command, error) {
 		Name: string(body[1 : commandNameLength+1]),
 		Body: body[1+commandNameLength:],
 	}
+	c.traceCommand("recv", command.Name, command.Body)
+	if err := c.checkCommandName(command.Name); err != nil {
+		return nil, err
+	}
 
 	return command, nil
 }
@@ -438,50 +739,36 @@ func (c *Connection) SendMultipart(bs [][]byte) error {
 }
 
 func (c *Connection) sendMultipart(isCommand bool, bs [][]byte) error {
-	for i, part := range bs {
-		// Compute total body length
-		length := len(part)
-
-		var bitFlags byte
-
-		// More flag:
-		if i < len(bs)-1 {
-			bitFlags ^= hasMoreBitFlag
-		}
-
-		// Long flag
-		isLong := length > 255
-		if isLong {
-			bitFlags ^= isLongBitFlag
-		}
-
-		// Command flag
-		if isCommand {
-			bitFlags ^= isCommandBitFlag
-		}
-
-		// Write out the message itself
-		if _, err := c.rw.Write([]byte{bitFlags}); err != nil {
-			return err
-		}
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
 
-		if isLong {
-			var buf [8]byte
-			byteOrder.PutUint64(buf[:], uint64(len(part)))
-			if _, err := c.rw.Write(buf[:]); err != nil {
+	if c.session != nil {
+		for i, part := range bs {
+			frame, err := c.session.encode(i < len(bs)-1, isCommand, part)
+			if err != nil {
 				return err
 			}
-		} else {
-			if _, err := c.rw.Write([]byte{uint8(len(part))}); err != nil {
+			if err := c.sendFrame(0, frame); err != nil {
 				return err
 			}
 		}
+		return nil
+	}
 
-		if _, err := c.rw.Write(c.securityMechanism.Encrypt(part)); err != nil {
-			return err
+	bufs := make([][]byte, 0, 2*len(bs))
+	for i, part := range bs {
+		var flags byte
+		if i < len(bs)-1 {
+			flags |= hasMoreBitFlag
+		}
+		if isCommand {
+			flags |= isCommandBitFlag
 		}
+		header := appendFrameHeader(nil, flags, uint64(len(part)))
+		c.tracef("send frame header: % x", header)
+		bufs = append(bufs, header, c.encrypt(part))
 	}
-	return nil
+	return c.write(bufs...)
 }
 
 // RecvMultipart starts listening to the ReadWriter and passes *Message to a channel
@@ -497,9 +784,11 @@ func (c *Connection) RecvMultipart(messageOut chan<- *Message) {
 
 			if !isCommand {
 				// Data frame
-				messageOut <- &Message{Body: body, MessageType: UserMessage}
+				messageOut <- &Message{Body: body, MessageType: UserMessage, Pooled: c.pooled, Timing: c.timing.done()}
 			} else {
+				start := c.timing.now()
 				command, err := c.parseCommand(body[0])
+				c.timing.parse(start)
 				if err != nil {
 					messageOut <- &Message{Err: err, MessageType: ErrorMessage}
 					return
@@ -508,15 +797,14 @@ func (c *Connection) RecvMultipart(messageOut chan<- *Message) {
 				// Check what type of command we got
 				// Certain commands we deal with directly, the rest we send over to the application
 				switch command.Name {
-				case "PING":
-					// When we get a ping, we want to send back a pong, we don't really care about the contents right now
-					if err := c.SendCommand("PONG", nil); err != nil {
+				case pingCommand:
+					if err := c.handlePing(command.Body); err != nil {
 						messageOut <- &Message{Err: err, MessageType: ErrorMessage}
 						return
 					}
 				default:
 					frames := [][]byte{command.Body}
-					messageOut <- &Message{Name: command.Name, Body: frames, MessageType: ErrorMessage}
+					messageOut <- &Message{Name: command.Name, Body: frames, MessageType: CommandMessage, Timing: c.timing.done()}
 				}
 
 			}
@@ -527,56 +815,49 @@ func (c *Connection) RecvMultipart(messageOut chan<- *Message) {
 // readMultipart returns the isCommand flag, the body of the message, and optionally an error
 func (c *Connection) readMultipart() (bool, [][]byte, error) {
 	var (
-		header     [2]byte
-		longLength [8]byte
-		frames     [][]byte
+		frames [][]byte
+		size   uint64
 
 		hasMore   = true
 		isCommand = false
+		start     time.Time
 	)
 
+	c.timing = c.sampleTiming()
 	for hasMore {
-		// Read out the header
-		_, err := io.ReadFull(c.rw, header[:])
+		bitFlags, bodyLength, err := c.readFrameHeader()
 		if err != nil {
 			return false, nil, err
 		}
-
-		bitFlags := header[0]
+		if start.IsZero() {
+			start = c.timing.now()
+		}
 
 		// Read all the flags
 		hasMore = bitFlags&hasMoreBitFlag == hasMoreBitFlag
-		isLong := bitFlags&isLongBitFlag == isLongBitFlag
-		isCommand = isCommand || (bitFlags&isCommandBitFlag == isCommandBitFlag)
-
-		// Determine the actual length of the body
-		bodyLength := uint64(0)
-		if isLong {
-			// We read 2 bytes of the header already
-			// In case of a long message, the length is bytes 2-8 of the header
-			// We already have the first byte, so assign it, and then read the rest
-			longLength[0] = header[1]
-
-			_, err := io.ReadFull(c.rw, longLength[1:])
-			if err != nil {
-				return false, nil, err
-			}
+		command := bitFlags&isCommandBitFlag == isCommandBitFlag
 
-			bodyLength = byteOrder.Uint64(longLength[:])
-		} else {
-			// Short message length is just 1 byte, read it
-			bodyLength = uint64(header[1])
-		}
-
-		if bodyLength > uint64(maxInt64) {
-			return false, nil, fmt.Errorf("Body length %v overflows max int64 value %v", bodyLength, maxInt64)
+		size += bodyLength
+		if err := c.checkMessageSize(size); err != nil {
+			return false, nil, err
 		}
 
-		buf := make([]byte, bodyLength)
-		_, err = io.ReadFull(c.rw, buf)
+		buf, err := c.readBody(bodyLength)
 		if err != nil {
 			return false, nil, err
 		}
+		c.timing.read(start)
+		if c.session != nil {
+			start = c.timing.now()
+			sealed := buf
+			if hasMore, command, buf, err = c.session.decode(buf); err != nil {
+				return false, nil, err
+			}
+			c.release(sealed)
+			c.timing.parse(start)
+		}
+		start = c.timing.now()
+		isCommand = isCommand || command
 		frames = append(frames, buf)
 	}
 
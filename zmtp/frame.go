@@ -0,0 +1,109 @@
+package zmtp
+
+import (
+	"fmt"
+	"io"
+)
+
+// frameSegment is the most bytes of a large frame
+// read at a time, see SetLargeFrames.
+const frameSegment = 64 << 10
+
+// appendFrameHeader appends to b the header of a frame with
+// the given flags and body length. The long flag is set, with
+// an 8 byte length, for bodies of more than 255 bytes.
+func appendFrameHeader(b []byte, flags byte, length uint64) []byte {
+	if length <= 255 {
+		return append(b, flags&^isLongBitFlag, byte(length))
+	}
+
+	var buf [8]byte
+	byteOrder.PutUint64(buf[:], length)
+	return append(append(b, flags|isLongBitFlag), buf[:]...)
+}
+
+// readFrameHeader reads the header of a frame from r, and
+// returns the frame's flags and the length of its body.
+func readFrameHeader(r io.Reader) (byte, uint64, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return 0, 0, err
+	}
+
+	flags := header[0]
+	if flags&reservedBitFlags != 0 {
+		return flags, 0, errReservedFlags
+	}
+	if flags&isLongBitFlag == 0 {
+		return flags, uint64(header[1]), nil
+	}
+
+	if _, err := io.ReadFull(r, header[2:]); err != nil {
+		return 0, 0, err
+	}
+	length := byteOrder.Uint64(header[1:])
+	if length > uint64(maxInt) {
+		return 0, 0, fmt.Errorf("Body length %v overflows max int value %v", length, maxInt)
+	}
+	return flags, length, nil
+}
+
+// SetLargeFrames makes frames of more than threshold bytes be
+// read in segments as they arrive, into a buffer grown with the
+// data received instead of allocated up front for the length
+// the peer announced, so that memory is only committed for data
+// actually received. Frames are still handed out contiguous, so
+// a frame that does arrive in full takes its whole length, plus
+// the copies made growing it; the protection is against lying
+// length headers, not against large frames.
+// If progress is not nil, it is called after each segment
+// with the number of bytes of the frame read so far, which
+// helps tracking transfers over slow links. Zero, the
+// default, reads every frame at once.
+func (c *Connection) SetLargeFrames(threshold int64, progress func(read, total uint64)) {
+	c.largeFrameThreshold = threshold
+	c.onFrameProgress = progress
+}
+
+// readBody reads a frame body of length bytes.
+func (c *Connection) readBody(length uint64) ([]byte, error) {
+	if c.largeFrameThreshold <= 0 || length <= uint64(c.largeFrameThreshold) {
+		var buf []byte
+		if c.pooled {
+			buf = getBuffer(int(length))
+		} else {
+			buf = make([]byte, length)
+		}
+		_, err := io.ReadFull(c.rw, buf)
+		return buf, err
+	}
+
+	// the buffer grows with the data received, up to length and
+	// never past it, so that a lying header costs no more than
+	// the bytes the peer actually sent
+	buf := make([]byte, 0, c.largeFrameThreshold)
+	for uint64(len(buf)) < length {
+		if len(buf) == cap(buf) {
+			size := 2 * uint64(cap(buf))
+			if size > length {
+				size = length
+			}
+			grown := make([]byte, len(buf), size)
+			copy(grown, buf)
+			buf = grown
+		}
+		n := cap(buf) - len(buf)
+		if n > frameSegment {
+			n = frameSegment
+		}
+		if _, err := io.ReadFull(c.rw, buf[len(buf):len(buf)+n]); err != nil {
+			return nil, err
+		}
+		buf = buf[:len(buf)+n]
+
+		if c.onFrameProgress != nil {
+			c.onFrameProgress(uint64(len(buf)), length)
+		}
+	}
+	return buf, nil
+}
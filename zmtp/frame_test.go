@@ -0,0 +1,147 @@
+package zmtp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestFrameHeader(t *testing.T) {
+	for _, tc := range []struct {
+		length uint64
+		size   int
+	}{
+		{0, 2},
+		{255, 2},
+		{256, 9},
+		{1 << 31, 9},
+		{1<<31 + 1, 9},
+		{1 << 32, 9},
+		{1<<32 + 1, 9},
+	} {
+		header := appendFrameHeader(nil, hasMoreBitFlag, tc.length)
+		if want, got := tc.size, len(header); want != got {
+			t.Errorf("%d: want %v header bytes, got %v", tc.length, want, got)
+		}
+		if want, got := tc.length > 255, header[0]&isLongBitFlag != 0; want != got {
+			t.Errorf("%d: want long flag %v, got %v", tc.length, want, got)
+		}
+
+		flags, length, err := readFrameHeader(bytes.NewReader(header))
+		if tc.length > uint64(maxInt) {
+			if err == nil {
+				t.Errorf("%d: want an error on this platform", tc.length)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: %v", tc.length, err)
+		}
+		if want, got := tc.length, length; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+		if want, got := byte(hasMoreBitFlag), flags&hasMoreBitFlag; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+
+	long := appendFrameHeader(nil, 0, 1<<32)
+	long[1] = 0x80 // beyond any int
+	if _, _, err := readFrameHeader(bytes.NewReader(long)); err == nil {
+		t.Error("want an error for a length overflowing int")
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	sender := NewConnection(local)
+	sender.securityMechanism = NewSecurityNull()
+	receiver := NewConnection(remote)
+	receiver.securityMechanism = NewSecurityNull()
+
+	frames := [][]byte{
+		bytes.Repeat([]byte{1}, 255),
+		bytes.Repeat([]byte{2}, 256),
+		nil,
+		bytes.Repeat([]byte{3}, 1<<16+1),
+	}
+	go sender.SendMultipart(frames)
+
+	_, got, err := receiver.readMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := len(frames), len(got); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range frames {
+		if !bytes.Equal(frames[i], got[i]) {
+			t.Errorf("frame %d: want %d bytes, got %d", i, len(frames[i]), len(got[i]))
+		}
+	}
+}
+
+func TestLargeFrames(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	sender := NewConnection(local)
+	sender.securityMechanism = NewSecurityNull()
+	receiver := NewConnection(remote)
+	receiver.securityMechanism = NewSecurityNull()
+
+	var progress []uint64
+	receiver.SetLargeFrames(1000, func(read, total uint64) {
+		progress = append(progress, read)
+	})
+
+	frames := [][]byte{
+		bytes.Repeat([]byte{1}, 1000),
+		bytes.Repeat([]byte{2}, 3*frameSegment+1),
+	}
+	go sender.SendMultipart(frames)
+
+	_, got, err := receiver.readMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range frames {
+		if !bytes.Equal(frames[i], got[i]) {
+			t.Errorf("frame %d: want %d bytes, got %d", i, len(frames[i]), len(got[i]))
+		}
+	}
+
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] || progress[i]-progress[i-1] > frameSegment {
+			t.Fatalf("progress %d: want at most %d more than %d, got %d", i, frameSegment, progress[i-1], progress[i])
+		}
+	}
+	if want, got := uint64(len(frames[1])), progress[len(progress)-1]; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestLargeFrameLyingLength(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	receiver := NewConnection(remote)
+	receiver.SetLargeFrames(1000, nil)
+
+	// the header announces a terabyte, but only 10 bytes follow
+	go func() {
+		local.Write(appendFrameHeader(nil, 0, 1<<40))
+		local.Write(make([]byte, 10))
+		local.Close()
+	}()
+	if _, length, err := readFrameHeader(receiver.rw); err != nil {
+		t.Fatal(err)
+	} else if _, err := receiver.readBody(length); err != io.ErrUnexpectedEOF {
+		t.Errorf("want %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
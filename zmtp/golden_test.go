@@ -0,0 +1,92 @@
+package zmtp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// recorder keeps a copy of everything written to its conn.
+type recorder struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.written.Write(b)
+	return r.Conn.Write(b)
+}
+
+// TestGolden checks the bytes each end of a connection writes,
+// from the greeting to the first message, against the captures
+// in testdata/golden, for every socket type and the mechanisms
+// whose handshakes are deterministic. CURVE's are not, as each
+// handshake uses new keys and nonces. Run with -update to
+// capture them again after a deliberate change to the wire format.
+func TestGolden(t *testing.T) {
+	for _, mechanism := range []string{"null", "plain"} {
+		for _, pair := range []struct {
+			client, server SocketType
+			first          [][]byte
+		}{
+			{ClientSocketType, ServerSocketType, [][]byte{[]byte("HELLO")}},
+			{PushSocketType, PullSocketType, [][]byte{[]byte("HELLO")}},
+			{DealerSocketType, RouterSocketType, [][]byte{[]byte("HELLO")}},
+			{ReqSocketType, RepSocketType, [][]byte{{}, []byte("HELLO")}},
+			{PubSocketType, SubSocketType, [][]byte{[]byte("HELLO")}},
+			{XPubSocketType, XSubSocketType, [][]byte{[]byte("HELLO")}},
+		} {
+			name := strings.ToLower(string(pair.client) + "-" + string(pair.server) + "-" + mechanism)
+			t.Run(name, func(t *testing.T) {
+				var clientMechanism, serverMechanism SecurityMechanism = NewSecurityNull(), NewSecurityNull()
+				if mechanism == "plain" {
+					clientMechanism, serverMechanism = NewSecurityPlainClient("admin", "secret"), NewSecurityPlainServer()
+				}
+
+				a, b := tcpPipe(t)
+				defer a.Close()
+				defer b.Close()
+				client, server := &recorder{Conn: b}, &recorder{Conn: a}
+
+				errc := make(chan error, 1)
+				go func() {
+					_, err := NewConnection(server).Prepare(serverMechanism, pair.server, nil, true, nil)
+					errc <- err
+				}()
+				cc := NewConnection(client)
+				if _, err := cc.Prepare(clientMechanism, pair.client, nil, false, nil); err != nil {
+					t.Fatal(err)
+				}
+				if err := <-errc; err != nil {
+					t.Fatal(err)
+				}
+				if err := cc.SendMultipart(pair.first); err != nil {
+					t.Fatal(err)
+				}
+
+				got := "client:\n" + hex.Dump(client.written.Bytes()) + "server:\n" + hex.Dump(server.written.Bytes())
+				path := filepath.Join("testdata", "golden", name+".txt")
+				if *update {
+					if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(want) != got {
+					t.Errorf("wire format changed, want\n%s\ngot\n%s", want, got)
+				}
+			})
+		}
+	}
+}
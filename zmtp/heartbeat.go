@@ -0,0 +1,54 @@
+package zmtp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Heartbeat commands, see ZMTP 3.1.
+const (
+	pingCommand = "PING"
+	pongCommand = "PONG"
+
+	// maxPingContext is the largest context
+	// a PING command may carry.
+	maxPingContext = 16
+)
+
+// PingBody returns the body of a PING command asking the
+// peer to drop the connection if it receives nothing for ttl,
+// rounded to deciseconds, zero meaning never. The peer echoes
+// context, up to 16 bytes of it, in its PONG.
+func PingBody(ttl time.Duration, context []byte) []byte {
+	deciseconds := ttl / (100 * time.Millisecond)
+	if deciseconds > 0xFFFF {
+		deciseconds = 0xFFFF
+	}
+	if len(context) > maxPingContext {
+		context = context[:maxPingContext]
+	}
+	body := binary.BigEndian.AppendUint16(nil, uint16(deciseconds))
+	return append(body, context...)
+}
+
+// handlePing answers the PING command of body with a PONG
+// echoing its context. If the ping sets a TTL, reading fails
+// unless something is received within it, on transports with
+// read deadlines; each ping from the peer pushes it back.
+func (c *Connection) handlePing(body []byte) error {
+	var context []byte
+	if len(body) >= 2 {
+		ttl := time.Duration(binary.BigEndian.Uint16(body)) * 100 * time.Millisecond
+		if d, ok := c.rw.(readDeadliner); ok && ttl > 0 {
+			d.SetReadDeadline(time.Now().Add(ttl))
+		}
+		context = body[2:]
+	}
+	if len(context) > maxPingContext {
+		context = context[:maxPingContext]
+	}
+	if err := c.SendCommand(pongCommand, context); err != nil {
+		return err
+	}
+	return c.Flush()
+}
@@ -0,0 +1,69 @@
+package zmtp
+
+import "sync"
+
+// Frame buffers are pooled in size classes of powers
+// of two, from minPooled to maxPooled bytes.
+const (
+	minPooled = 64
+	maxPooled = 64 << 10
+)
+
+var bufferPools [11]sync.Pool // one per class, minPooled<<10 == maxPooled
+
+// bufferClass returns the index in bufferPools of the
+// smallest class holding n bytes, or -1 if n is too large.
+func bufferClass(n int) int {
+	if n > maxPooled {
+		return -1
+	}
+	class, size := 0, minPooled
+	for size < n {
+		class++
+		size <<= 1
+	}
+	return class
+}
+
+// getBuffer returns a buffer of length n, taken from the
+// pool of its size class if n is not too large for one.
+func getBuffer(n int) []byte {
+	class := bufferClass(n)
+	if class < 0 {
+		return make([]byte, n)
+	}
+	if b, ok := bufferPools[class].Get().([]byte); ok {
+		return b[:n]
+	}
+	return make([]byte, n, minPooled<<class)
+}
+
+// ReleaseBuffer returns a frame buffer read by a connection
+// using the buffer pool, see SetBufferPool, for it to be
+// reused by later reads. The buffer must not be used once
+// released. Buffers of other sizes are ignored.
+func ReleaseBuffer(b []byte) {
+	class := bufferClass(cap(b))
+	if class < 0 || cap(b) != minPooled<<class {
+		return
+	}
+	bufferPools[class].Put(b[:0])
+}
+
+// SetBufferPool makes the connection read the bodies of frames
+// into pooled buffers, and mark the user messages holding them
+// as Pooled, so that the application can hand the buffers back
+// with ReleaseBuffer once done with them. Large frames, see
+// SetLargeFrames, and frames too large for the pool are
+// allocated as usual. It must be called before receiving.
+func (c *Connection) SetBufferPool(enabled bool) {
+	c.pooled = enabled
+}
+
+// release returns b to the pool if the connection uses it,
+// once the frame it holds was decoded into another buffer.
+func (c *Connection) release(b []byte) {
+	if c.pooled {
+		ReleaseBuffer(b)
+	}
+}
@@ -0,0 +1,33 @@
+package zmtp
+
+import "testing"
+
+func TestBufferPool(t *testing.T) {
+	for _, tc := range []struct {
+		n, cap int
+	}{
+		{0, 64},
+		{64, 64},
+		{65, 128},
+		{1000, 1024},
+		{maxPooled, maxPooled},
+		{maxPooled + 1, maxPooled + 1},
+	} {
+		b := getBuffer(tc.n)
+		if want, got := tc.n, len(b); want != got {
+			t.Errorf("%d: want %v, got %v", tc.n, want, got)
+		}
+		if want, got := tc.cap, cap(b); want != got {
+			t.Errorf("%d: want capacity %v, got %v", tc.n, want, got)
+		}
+		ReleaseBuffer(b)
+	}
+
+	// buffers not from the pool, or sliced off its
+	// start, are not taken back
+	ReleaseBuffer(make([]byte, 100))
+	ReleaseBuffer(getBuffer(128)[1:])
+	if want, got := 128, cap(getBuffer(100)); want != got {
+		t.Errorf("want capacity %v, got %v", want, got)
+	}
+}
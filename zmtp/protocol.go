@@ -1,8 +1,13 @@
 package zmtp
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
 const (
@@ -19,8 +24,50 @@ const (
 	hasMoreBitFlag   = 0x1
 	isLongBitFlag    = 0x2
 	isCommandBitFlag = 0x4
+
+	// reservedBitFlags must be zero in every frame
+	reservedBitFlags = 0xF8
 )
 
+// errReservedFlags is returned when reading a frame with
+// reserved flags set. ZMTP frames carry no markers to
+// resynchronize on, so the connection cannot be used
+// after that.
+var errReservedFlags = errors.New("gomq/zmtp: frame has reserved flags set")
+
+// ErrMessageTooLarge is wrapped by the errors receiving fails
+// with when the peer announces a message larger than the
+// connection's limit, see SetMaxMessageSize. The message is not
+// read, and the connection cannot be used after that.
+var ErrMessageTooLarge = errors.New("gomq/zmtp: message too large")
+
+// ErrHandshakeTimeout is wrapped by the errors of Prepare
+// when the handshake outlasts the connection's handshake
+// timeout, see SetHandshakeTimeout.
+var ErrHandshakeTimeout = errors.New("gomq/zmtp: handshake timed out")
+
+// ErrAuthFailed is wrapped by the errors of Prepare when the
+// server rejects the client's credentials: on the server, with
+// the error of its authenticator, see SetAuthenticator, and on
+// the client, with the reason the server sent.
+var ErrAuthFailed = errors.New("gomq/zmtp: authentication failed")
+
+// ErrUnsupportedVersion is wrapped by the errors of Prepare
+// when the peer speaks a version of ZMTP older than 3.0, such as
+// the ZMTP 2.0 of libzmq 3.x. gomq only speaks ZMTP 3, so the
+// handshake fails as soon as the peer's version is received,
+// with an error such as "unsupported peer version 2.0".
+var ErrUnsupportedVersion = errors.New("gomq/zmtp: unsupported peer version")
+
+// oldVersion returns the version of ZMTP older than 3.0
+// announced by a greeting with the given revision octet.
+func oldVersion(revision uint8) string {
+	if revision == 1 {
+		return "2.0"
+	}
+	return fmt.Sprintf("revision %d", revision)
+}
+
 // MessageType represents a "type" of ZMTP message
 // (User, Command, Error)
 type MessageType int
@@ -61,12 +108,74 @@ type greeting struct {
 	_               [31]byte
 }
 
-func (g *greeting) unmarshal(r io.Reader) error {
+// unmarshal reads a greeting from r in the stages of RFC 23,
+// failing as soon as the bytes read so far cannot belong to
+// a ZMTP 3 greeting, so that garbage sent by port scanners
+// is rejected without waiting for a full greeting. If strict
+// is set, it fails with a *Violation, and also checks that
+// the filler is zeroed.
+func (g *greeting) unmarshal(r io.Reader, strict bool) error {
 	var buf [64]byte
-	_, err := io.ReadFull(r, buf[:])
-	if err != nil {
+	violation := func(err error, v *Violation) error {
+		if strict {
+			return v
+		}
+		return err
+	}
+
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return err
+	}
+	if buf[0] != signaturePrefix {
+		return violation(fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", buf[0], signaturePrefix), &Violation{
+			Rule:     "RFC 23 greeting signature",
+			Field:    "signature octet 0",
+			Expected: fmt.Sprintf("%#02x", signaturePrefix),
+			Got:      fmt.Sprintf("%#02x", buf[0]),
+		})
+	}
+
+	if _, err := io.ReadFull(r, buf[1:10]); err != nil {
+		return err
+	}
+	if buf[9] != signatureSuffix {
+		return violation(fmt.Errorf("Signature suffix received does not correspond with expected signature. Received: %#v. Expected: %#v.", buf[9], signatureSuffix), &Violation{
+			Rule:     "RFC 23 greeting signature",
+			Field:    "signature octet 9",
+			Expected: fmt.Sprintf("%#02x", signatureSuffix),
+			Got:      fmt.Sprintf("%#02x", buf[9]),
+		})
+	}
+
+	if _, err := io.ReadFull(r, buf[10:11]); err != nil {
+		return err
+	}
+	if buf[10] < majorVersion {
+		// older peers, which RFC 23 lets downgrade, are
+		// told apart from peers breaking the rules
+		return fmt.Errorf("%w %v", ErrUnsupportedVersion, oldVersion(buf[10]))
+	}
+
+	if _, err := io.ReadFull(r, buf[11:]); err != nil {
 		return err
 	}
+	if err := checkMechanismName(buf[12:32]); err != nil {
+		return violation(err, &Violation{
+			Rule:     "RFC 23 greeting",
+			Field:    "mechanism",
+			Expected: "1 to 20 of 'A'-'Z', '0'-'9', '-', '_', '.' and '+', null padded",
+			Got:      fmt.Sprintf("%q", buf[12:32]),
+		})
+	}
+	if strict && bytes.Count(buf[33:], []byte{0}) != len(buf[33:]) {
+		return &Violation{
+			Rule:     "RFC 23 greeting",
+			Field:    "filler",
+			Expected: "31 zero octets",
+			Got:      fmt.Sprintf("% x", buf[33:]),
+		}
+	}
+
 	g.SignaturePrefix = buf[0]
 	// padding 1 ignored
 	g.SignatureSuffix = buf[9]
@@ -79,6 +188,31 @@ func (g *greeting) unmarshal(r io.Reader) error {
 	return nil
 }
 
+// checkMechanismName checks that b holds a null padded
+// mechanism name of 1 to 20 characters among 'A'-'Z',
+// '0'-'9', '-', '_', '.' and '+', as RFC 23 requires.
+func checkMechanismName(b []byte) error {
+	n := bytes.IndexByte(b, 0)
+	if n < 0 {
+		n = len(b)
+	}
+	if n == 0 {
+		return errors.New("Empty security mechanism name")
+	}
+
+	for i, c := range b {
+		switch {
+		case i >= n && c == 0:
+		case i < n && 'A' <= c && c <= 'Z',
+			i < n && '0' <= c && c <= '9',
+			i < n && strings.IndexByte("-_.+", c) >= 0:
+		default:
+			return fmt.Errorf("Invalid security mechanism name %q", b)
+		}
+	}
+	return nil
+}
+
 func (g *greeting) marshal(w io.Writer) error {
 	var buf [64]byte
 	buf[0] = g.SignaturePrefix
@@ -94,6 +228,40 @@ func (g *greeting) marshal(w io.Writer) error {
 	return err
 }
 
+// readDeadliner is implemented by transports, such
+// as net.Conn, that support read deadlines.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// deadliner is implemented by transports, such as
+// net.Conn, that support read and write deadlines.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// timeoutReader is a reader that fails if r has not
+// returned any data within timeout of each call to Read,
+// or past deadline, if set.
+type timeoutReader struct {
+	r        io.Reader
+	timeout  time.Duration
+	deadline time.Time
+}
+
+func (t timeoutReader) Read(b []byte) (int, error) {
+	if d, ok := t.r.(readDeadliner); ok && t.timeout > 0 {
+		next := time.Now().Add(t.timeout)
+		if !t.deadline.IsZero() && t.deadline.Before(next) {
+			next = t.deadline
+		}
+		if err := d.SetReadDeadline(next); err != nil {
+			return 0, err
+		}
+	}
+	return t.r.Read(b)
+}
+
 // Command represents an underlying ZMTP command
 type Command struct {
 	Index int
@@ -108,4 +276,20 @@ type Message struct {
 	Body        [][]byte
 	Err         error
 	MessageType MessageType
+
+	// Peer identifies the connection the message was
+	// received on, for receivers that set it.
+	Peer string
+
+	// Received is when the message was received,
+	// for receivers that set it.
+	Received time.Time
+
+	// Pooled reports whether the frames of the message were
+	// read into pooled buffers, see SetBufferPool.
+	Pooled bool
+
+	// Timing, if set, records where time went
+	// receiving the message, see SetTiming.
+	Timing *Timing
 }
@@ -0,0 +1,60 @@
+package zmtp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGreetingUnmarshal(t *testing.T) {
+	var valid bytes.Buffer
+	g := greeting{
+		SignaturePrefix: signaturePrefix,
+		SignatureSuffix: signatureSuffix,
+		Version:         version,
+	}
+	copy(g.Mechanism[:], "NULL")
+	if err := g.marshal(&valid); err != nil {
+		t.Fatal(err)
+	}
+
+	var got greeting
+	if err := got.unmarshal(bytes.NewReader(valid.Bytes()), false); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "NULL", fromNullPaddedString(got.Mechanism[:]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// garbage is rejected after the first byte
+	r := bytes.NewReader([]byte("GET / HTTP/1.1\r\n"))
+	if err := got.unmarshal(r, false); err == nil {
+		t.Error("want error for bad signature")
+	}
+	if want, got := 15, r.Len(); want != got {
+		t.Errorf("want %v bytes left unread, got %v", want, got)
+	}
+
+	// ZMTP 2.0 peers are told apart after their revision
+	old := append(append([]byte(nil), valid.Bytes()[:10]...), 0x01, 0x05, 0x00, 0x00)
+	for _, strict := range []bool{false, true} {
+		r := bytes.NewReader(old)
+		err := got.unmarshal(r, strict)
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("want %v, got %v", ErrUnsupportedVersion, err)
+		}
+		if want, got := "gomq/zmtp: unsupported peer version 2.0", fmt.Sprint(err); want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+		if want, got := 3, r.Len(); want != got {
+			t.Errorf("want %v bytes left unread, got %v", want, got)
+		}
+	}
+
+	invalid := append([]byte(nil), valid.Bytes()...)
+	copy(invalid[12:], "null")
+	if err := got.unmarshal(bytes.NewReader(invalid), false); err == nil {
+		t.Error("want error for invalid mechanism name")
+	}
+}
@@ -24,3 +24,54 @@ type SecurityMechanism interface {
 	Handshake() error
 	Encrypt([]byte) []byte
 }
+
+// IsEncrypted reports whether traffic protected by this
+// type of security mechanism is encrypted on the wire.
+func (t SecurityMechanismType) IsEncrypted() bool {
+	return t == CurveSecurityMechanismType
+}
+
+// SecurityDetails describes the security negotiated
+// for a single connection.
+type SecurityDetails struct {
+	Mechanism     SecurityMechanismType
+	Encrypted     bool
+	Cipher        string // empty when Encrypted is false
+	PublicKey     []byte // this end's public key, if any
+	PeerPublicKey []byte // the other end's public key, if any
+}
+
+// SecurityDetailer is implemented by security mechanisms
+// that can report more than their type, such as the
+// cipher and public keys in use.
+type SecurityDetailer interface {
+	Details() SecurityDetails
+}
+
+// sessionMechanism is implemented by security mechanisms that
+// run their own handshake on each connection, exchanging the
+// metadata, and protect the frames sent afterwards.
+type sessionMechanism interface {
+	isServer() bool
+	handshake(c *Connection, metadata []byte) (securitySession, []byte, error)
+}
+
+// AcceptsAnyClient reports whether m is the server end of a
+// PLAIN or CURVE mechanism without an authenticator or
+// authorizer of its own, which accepts every client unless
+// the connection is given one, see Connection.SetAuthenticator.
+func AcceptsAnyClient(m SecurityMechanism) bool {
+	switch m := m.(type) {
+	case *SecurityPlain:
+		return m.asServer && m.authenticate == nil
+	case *SecurityCurve:
+		return m.asServer && m.authorize == nil
+	}
+	return false
+}
+
+// securitySession protects the frames of one connection.
+type securitySession interface {
+	encode(more, command bool, body []byte) ([]byte, error)
+	decode(frame []byte) (more, command bool, body []byte, err error)
+}
@@ -0,0 +1,590 @@
+package zmtp
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Nonce prefixes of CurveZMQ, see RFC 26.
+const (
+	helloNoncePrefix    = "CurveZMQHELLO---"
+	welcomeNoncePrefix  = "WELCOME-"
+	cookieNoncePrefix   = "COOKIE--"
+	initiateNoncePrefix = "CurveZMQINITIATE"
+	vouchNoncePrefix    = "VOUCH---"
+	readyNoncePrefix    = "CurveZMQREADY---"
+	clientMessagePrefix = "CurveZMQMESSAGEC"
+	serverMessagePrefix = "CurveZMQMESSAGES"
+)
+
+// messageCommand starts the frames carrying
+// the encrypted frames of a CURVE connection.
+const messageCommand = "\x07MESSAGE"
+
+// Flags of the frames carried by MESSAGE.
+const (
+	curveMoreFlag    = 0x01
+	curveCommandFlag = 0x02
+)
+
+const (
+	helloBodyLen    = 2 + 72 + 32 + 8 + 80
+	welcomeBodyLen  = 16 + 144
+	cookieLen       = 16 + 80
+	vouchLen        = 16 + 80
+	minInitiateLen  = cookieLen + 8 + boxOverhead + 32 + vouchLen
+	minReadyLen     = 8 + boxOverhead
+	minMessageLen   = len(messageCommand) + 8 + boxOverhead + 1
+	curveCipherName = "curve25519-xsalsa20-poly1305"
+)
+
+// maxCachedKeys bounds the keys a server keeps
+// with SetSessionResumption.
+const maxCachedKeys = 1024
+
+var (
+	errCurveHandshake = errors.New("gomq/zmtp: invalid CURVE handshake")
+	errCurveMessage   = errors.New("gomq/zmtp: invalid CURVE message")
+	errCurveKey       = errors.New("gomq/zmtp: invalid CURVE key")
+	errCurveRole      = errors.New("gomq/zmtp: both ends of the connection are CURVE clients or servers")
+	errCurveNonce     = errors.New("gomq/zmtp: CURVE nonces exhausted, the connection must be reestablished")
+)
+
+// SecurityCurve implements the CurveSecurityMechanismType. It
+// authenticates and encrypts connections with CurveZMQ, as
+// specified by RFC 25 and RFC 26, interoperating with libzmq.
+// The server end of a connection knows its long-term keypair,
+// the client end its own and the server's public key. Keys
+// are given Z85 encoded, see NewCurveKeypair.
+type SecurityCurve struct {
+	asServer  bool
+	publicKey [32]byte
+	secretKey [32]byte
+	serverKey [32]byte
+	authorize func(clientKey []byte) bool
+
+	lock      sync.Mutex
+	lifetime  time.Duration
+	transient *transientKeys
+	keys      map[[32]byte]cachedKey
+}
+
+// transientKeys is a client's transient keypair, reused
+// until it expires, see SetSessionResumption. nonce is the
+// last short nonce sent with it, which keeps counting across
+// connections, so that no nonce is used twice under helloKey.
+type transientKeys struct {
+	public, secret [32]byte
+	helloKey       [32]byte
+	nonce          uint64
+	expires        time.Time
+}
+
+// cachedKey is a key a server shares with a
+// client's transient key, see SetSessionResumption.
+type cachedKey struct {
+	key     [32]byte
+	expires time.Time
+}
+
+// NewCurveKeypair generates a long-term CURVE keypair and
+// returns its public and secret keys, Z85 encoded.
+func NewCurveKeypair() (publicKey, secretKey string, err error) {
+	pk, sk, err := newKeypair()
+	if err != nil {
+		return "", "", err
+	}
+	publicKey, _ = Z85Encode(pk[:])
+	secretKey, _ = Z85Encode(sk[:])
+	return publicKey, secretKey, nil
+}
+
+// NewSecurityCurveServer returns a SecurityCurve mechanism
+// for the server end of connections, with the server's
+// long-term keypair.
+func NewSecurityCurveServer(publicKey, secretKey string) (*SecurityCurve, error) {
+	s := &SecurityCurve{asServer: true}
+	if err := s.setKeypair(publicKey, secretKey); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSecurityCurveClient returns a SecurityCurve mechanism for
+// the client end of connections, with the server's long-term
+// public key and the client's long-term keypair.
+func NewSecurityCurveClient(serverKey, publicKey, secretKey string) (*SecurityCurve, error) {
+	s := &SecurityCurve{}
+	if err := decodeKey(&s.serverKey, serverKey); err != nil {
+		return nil, err
+	}
+	if err := s.setKeypair(publicKey, secretKey); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SecurityCurve) setKeypair(publicKey, secretKey string) error {
+	if err := decodeKey(&s.publicKey, publicKey); err != nil {
+		return err
+	}
+	if err := decodeKey(&s.secretKey, secretKey); err != nil {
+		return err
+	}
+	if pk, err := derivePublicKey(&s.secretKey); err != nil || subtle.ConstantTimeCompare(pk[:], s.publicKey[:]) != 1 {
+		return fmt.Errorf("gomq/zmtp: CURVE public key does not match secret key")
+	}
+	return nil
+}
+
+func decodeKey(key *[32]byte, z85 string) error {
+	b, err := Z85Decode(z85)
+	if err != nil || len(b) != len(key) {
+		return errCurveKey
+	}
+	copy(key[:], b)
+	return nil
+}
+
+// SetAuthorizer registers a function servers call with the
+// long-term public key of each client once it proved owning
+// it, rejecting the client if the function returns false.
+// By default, every client is accepted.
+func (s *SecurityCurve) SetAuthorizer(fn func(clientKey []byte) bool) {
+	s.authorize = fn
+}
+
+// SetSessionResumption makes reconnections within lifetime
+// of each other skip part of the key agreement, for clients
+// that reconnect often, such as on mobile networks. Clients
+// reuse their transient keypair with the server for lifetime,
+// along with the key it shares with the server's long-term
+// key, and servers keep the key they share with each client
+// transient key for as long, once it authenticated a HELLO.
+// The short nonces of the client's HELLO and INITIATE keep
+// counting from one connection to the next, so that no nonce
+// is reused under the same key. Each connection still gets its
+// own session key, the server's transient keypair being new
+// for each, but those made within lifetime are only as safe
+// as the client's transient secret key, which is kept in
+// memory meanwhile. Zero, the default, disables it.
+func (s *SecurityCurve) SetSessionResumption(lifetime time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lifetime = lifetime
+	s.transient = nil
+	s.keys = nil
+}
+
+// transientKeypair returns the client's transient keypair,
+// the key it shares with the server's long-term key and the
+// short nonce of the HELLO, the INITIATE taking the next one.
+func (s *SecurityCurve) transientKeypair() (tpk, tsk, helloKey [32]byte, nonce uint64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if t := s.transient; t != nil && now.Before(t.expires) && t.nonce < math.MaxUint64-2 {
+		t.nonce += 2
+		return t.public, t.secret, t.helloKey, t.nonce - 1, nil
+	}
+	if tpk, tsk, err = newKeypair(); err != nil {
+		return tpk, tsk, helloKey, 0, err
+	}
+	if helloKey, err = boxKey(&s.serverKey, &tsk); err != nil {
+		return tpk, tsk, helloKey, 0, err
+	}
+	if s.lifetime > 0 {
+		s.transient = &transientKeys{public: tpk, secret: tsk, helloKey: helloKey, nonce: 2, expires: now.Add(s.lifetime)}
+	}
+	return tpk, tsk, helloKey, 1, nil
+}
+
+// clientKey returns the key the server's long-term key
+// shares with the client transient key pk, and whether
+// it was cached.
+func (s *SecurityCurve) clientKey(pk *[32]byte) ([32]byte, bool, error) {
+	s.lock.Lock()
+	cached, ok := s.keys[*pk]
+	s.lock.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.key, true, nil
+	}
+	key, err := boxKey(pk, &s.secretKey)
+	return key, false, err
+}
+
+// cacheClientKey keeps the key shared with the client transient
+// key pk, if resumption is enabled. It is only called once a
+// HELLO opened with it, so that peers that cannot make one do
+// not evict the keys of others.
+func (s *SecurityCurve) cacheClientKey(pk *[32]byte, key [32]byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.lifetime <= 0 {
+		return
+	}
+	now := time.Now()
+	if s.keys == nil {
+		s.keys = make(map[[32]byte]cachedKey)
+	}
+	for k, cached := range s.keys {
+		if len(s.keys) < maxCachedKeys && now.Before(cached.expires) {
+			continue
+		}
+		delete(s.keys, k)
+	}
+	s.keys[*pk] = cachedKey{key: key, expires: now.Add(s.lifetime)}
+}
+
+// Type returns the security mechanisms type
+func (s *SecurityCurve) Type() SecurityMechanismType {
+	return CurveSecurityMechanismType
+}
+
+// Handshake does nothing, CURVE handshakes are run on
+// each connection by Connection.Prepare.
+func (s *SecurityCurve) Handshake() error {
+	return nil
+}
+
+// Encrypt returns data unchanged, frames are encrypted
+// on each connection once the handshake is done.
+func (s *SecurityCurve) Encrypt(data []byte) []byte {
+	return data
+}
+
+// Details reports the cipher and the mechanism's long-term
+// public key. Connections report the peer's key as well.
+func (s *SecurityCurve) Details() SecurityDetails {
+	return SecurityDetails{
+		Mechanism: CurveSecurityMechanismType,
+		Encrypted: true,
+		Cipher:    curveCipherName,
+		PublicKey: append([]byte(nil), s.publicKey[:]...),
+	}
+}
+
+func (s *SecurityCurve) isServer() bool {
+	return s.asServer
+}
+
+// handshake runs the CurveZMQ handshake on c, sending metadata
+// and returning the session protecting c's frames along with
+// the metadata of the other end.
+func (s *SecurityCurve) handshake(c *Connection, metadata []byte) (securitySession, []byte, error) {
+	if c.otherEndAsServer == s.asServer {
+		return nil, nil, errCurveRole
+	}
+	if s.asServer {
+		return s.serverHandshake(c, metadata)
+	}
+	return s.clientHandshake(c, metadata)
+}
+
+func (s *SecurityCurve) clientHandshake(c *Connection, metadata []byte) (securitySession, []byte, error) {
+	tpk, tsk, helloKey, helloNonce, err := s.transientKeypair()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// HELLO
+	hello := make([]byte, 2+72, helloBodyLen)
+	hello[0], hello[1] = 1, 0
+	hello = append(hello, tpk[:]...)
+	hello = appendShortNonce(hello, helloNonce)
+	nonce := shortNonce(helloNoncePrefix, helloNonce)
+	hello = sealSecretBox(hello, make([]byte, 64), &nonce, &helloKey)
+	if err := c.SendCommand("HELLO", hello); err != nil {
+		return nil, nil, err
+	}
+
+	// WELCOME
+	welcome, err := c.readHandshakeCommand("WELCOME")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(welcome) != welcomeBodyLen {
+		return nil, nil, errCurveHandshake
+	}
+	nonce = longNonce(welcomeNoncePrefix, welcome[:16])
+	plain, err := openSecretBox(nil, welcome[16:], &nonce, &helloKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var serverTransientKey [32]byte
+	copy(serverTransientKey[:], plain[:32])
+	cookie := plain[32:]
+
+	// INITIATE
+	session := &curveSession{
+		peerKey:    s.serverKey,
+		publicKey:  s.publicKey,
+		sendPrefix: clientMessagePrefix,
+		recvPrefix: serverMessagePrefix,
+		sendNonce:  helloNonce + 1,
+	}
+	if session.key, err = boxKey(&serverTransientKey, &tsk); err != nil {
+		return nil, nil, err
+	}
+	vouchKey, err := boxKey(&serverTransientKey, &s.secretKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vouch, err := randomBytes(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = longNonce(vouchNoncePrefix, vouch)
+	vouch = sealSecretBox(vouch, append(tpk[:], s.serverKey[:]...), &nonce, &vouchKey)
+
+	plain = append(append(append([]byte(nil), s.publicKey[:]...), vouch...), metadata...)
+	initiate := appendShortNonce(append([]byte(nil), cookie...), session.sendNonce)
+	nonce = shortNonce(initiateNoncePrefix, session.sendNonce)
+	initiate = sealSecretBox(initiate, plain, &nonce, &session.key)
+	if err := c.SendCommand("INITIATE", initiate); err != nil {
+		return nil, nil, err
+	}
+
+	// READY
+	ready, err := c.readHandshakeCommand("READY")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ready) < minReadyLen {
+		return nil, nil, errCurveHandshake
+	}
+	session.recvNonce = binary.BigEndian.Uint64(ready[:8])
+	nonce = longNonce(readyNoncePrefix[:16], nil)
+	copy(nonce[16:], ready[:8])
+	peerMetadata, err := openSecretBox(nil, ready[8:], &nonce, &session.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, peerMetadata, nil
+}
+
+func (s *SecurityCurve) serverHandshake(c *Connection, metadata []byte) (securitySession, []byte, error) {
+	// HELLO
+	hello, err := c.readHandshakeCommand("HELLO")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(hello) != helloBodyLen || hello[0] != 1 {
+		return nil, nil, errCurveHandshake
+	}
+	var clientTransientKey [32]byte
+	copy(clientTransientKey[:], hello[74:106])
+	helloKey, cached, err := s.clientKey(&clientTransientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := longNonce(helloNoncePrefix[:16], nil)
+	copy(nonce[16:], hello[106:114])
+	if _, err := openSecretBox(nil, hello[114:], &nonce, &helloKey); err != nil {
+		return nil, nil, err
+	}
+	if !cached {
+		s.cacheClientKey(&clientTransientKey, helloKey)
+	}
+
+	// WELCOME, with a cookie holding the transient keys
+	tpk, tsk, err := newKeypair()
+	if err != nil {
+		return nil, nil, err
+	}
+	var cookieKey [32]byte
+	if _, err := rand.Read(cookieKey[:]); err != nil {
+		return nil, nil, err
+	}
+	cookie, err := randomBytes(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = longNonce(cookieNoncePrefix, cookie)
+	cookie = sealSecretBox(cookie, append(clientTransientKey[:], tsk[:]...), &nonce, &cookieKey)
+
+	welcome, err := randomBytes(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = longNonce(welcomeNoncePrefix, welcome)
+	welcome = sealSecretBox(welcome, append(tpk[:], cookie...), &nonce, &helloKey)
+	if err := c.SendCommand("WELCOME", welcome); err != nil {
+		return nil, nil, err
+	}
+
+	// INITIATE
+	initiate, err := c.readHandshakeCommand("INITIATE")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(initiate) < minInitiateLen {
+		return nil, nil, errCurveHandshake
+	}
+	nonce = longNonce(cookieNoncePrefix, initiate[:16])
+	plain, err := openSecretBox(nil, initiate[16:cookieLen], &nonce, &cookieKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare(plain[:32], clientTransientKey[:]) != 1 {
+		return nil, nil, errCurveHandshake
+	}
+
+	session := &curveSession{
+		publicKey:  s.publicKey,
+		sendPrefix: serverMessagePrefix,
+		recvPrefix: clientMessagePrefix,
+		sendNonce:  1,
+		recvNonce:  binary.BigEndian.Uint64(initiate[cookieLen : cookieLen+8]),
+	}
+	if session.key, err = boxKey(&clientTransientKey, &tsk); err != nil {
+		return nil, nil, err
+	}
+	nonce = longNonce(initiateNoncePrefix[:16], nil)
+	copy(nonce[16:], initiate[cookieLen:cookieLen+8])
+	plain, err = openSecretBox(nil, initiate[cookieLen+8:], &nonce, &session.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	copy(session.peerKey[:], plain[:32])
+
+	vouchKey, err := boxKey(&session.peerKey, &tsk)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = longNonce(vouchNoncePrefix, plain[32:48])
+	vouch, err := openSecretBox(nil, plain[48:32+vouchLen], &nonce, &vouchKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare(vouch, append(clientTransientKey[:], s.publicKey[:]...)) != 1 {
+		return nil, nil, errCurveHandshake
+	}
+	if s.authorize != nil && !s.authorize(append([]byte(nil), session.peerKey[:]...)) {
+		c.sendError("Unauthorized")
+		return nil, nil, fmt.Errorf("%w: CURVE client not authorized", ErrAuthFailed)
+	}
+	if err := c.authenticateClient(CurveSecurityMechanismType, [][]byte{append([]byte(nil), session.peerKey[:]...)}); err != nil {
+		return nil, nil, err
+	}
+	peerMetadata := plain[32+vouchLen:]
+
+	// READY
+	ready := appendShortNonce(nil, 1)
+	nonce = shortNonce(readyNoncePrefix, 1)
+	ready = sealSecretBox(ready, metadata, &nonce, &session.key)
+	if err := c.SendCommand("READY", ready); err != nil {
+		return nil, nil, err
+	}
+	return session, peerMetadata, nil
+}
+
+// curveSession protects the frames of a CURVE connection
+// with the key shared by both ends' transient keys.
+type curveSession struct {
+	key                    [32]byte
+	publicKey, peerKey     [32]byte
+	sendPrefix, recvPrefix string
+	sendNonce, recvNonce   uint64
+}
+
+// encode seals a frame under the next nonce. Nonces are never
+// reused: once the counter is exhausted, encoding fails.
+func (s *curveSession) encode(more, command bool, body []byte) ([]byte, error) {
+	if s.sendNonce == math.MaxUint64 {
+		return nil, errCurveNonce
+	}
+	s.sendNonce++
+	var flags byte
+	if more {
+		flags |= curveMoreFlag
+	}
+	if command {
+		flags |= curveCommandFlag
+	}
+
+	out := make([]byte, 0, minMessageLen+len(body))
+	out = appendShortNonce(append(out, messageCommand...), s.sendNonce)
+	nonce := shortNonce(s.sendPrefix, s.sendNonce)
+	return sealSecretBox(out, append([]byte{flags}, body...), &nonce, &s.key), nil
+}
+
+// decode opens a frame, accepting only nonces greater than
+// the last one accepted, so that frames cannot be replayed
+// or reordered. A frame failing to open leaves the session
+// as it was.
+func (s *curveSession) decode(frame []byte) (more, command bool, body []byte, err error) {
+	if len(frame) < minMessageLen || string(frame[:len(messageCommand)]) != messageCommand {
+		return false, false, nil, errCurveMessage
+	}
+	frame = frame[len(messageCommand):]
+
+	n := binary.BigEndian.Uint64(frame[:8])
+	if n <= s.recvNonce {
+		return false, false, nil, errCurveMessage
+	}
+	nonce := shortNonce(s.recvPrefix, n)
+	plain, err := openSecretBox(nil, frame[8:], &nonce, &s.key)
+	if err != nil {
+		return false, false, nil, err
+	}
+	s.recvNonce = n
+	return plain[0]&curveMoreFlag != 0, plain[0]&curveCommandFlag != 0, plain[1:], nil
+}
+
+func (s *curveSession) Details() SecurityDetails {
+	return SecurityDetails{
+		Mechanism:     CurveSecurityMechanismType,
+		Encrypted:     true,
+		Cipher:        curveCipherName,
+		PublicKey:     append([]byte(nil), s.publicKey[:]...),
+		PeerPublicKey: append([]byte(nil), s.peerKey[:]...),
+	}
+}
+
+// shortNonce returns the nonce made of a 16 byte
+// prefix and the 8 byte big endian counter n.
+func shortNonce(prefix string, n uint64) [24]byte {
+	var nonce [24]byte
+	copy(nonce[:], prefix)
+	binary.BigEndian.PutUint64(nonce[16:], n)
+	return nonce
+}
+
+// longNonce returns the nonce made of an 8 byte prefix
+// and 16 random bytes, or of a 16 byte prefix to which
+// the caller copies 8 bytes.
+func longNonce(prefix string, random []byte) [24]byte {
+	var nonce [24]byte
+	copy(nonce[copy(nonce[:], prefix):], random)
+	return nonce
+}
+
+func appendShortNonce(b []byte, n uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+func newKeypair() (pk, sk [32]byte, err error) {
+	if _, err = rand.Read(sk[:]); err != nil {
+		return pk, sk, err
+	}
+	pk, err = derivePublicKey(&sk)
+	return pk, sk, err
+}
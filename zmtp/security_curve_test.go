@@ -0,0 +1,448 @@
+package zmtp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZ85(t *testing.T) {
+	data := []byte{0x86, 0x4F, 0xD2, 0x6F, 0xB5, 0x59, 0xF7, 0x5B}
+
+	s, err := Z85Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HelloWorld", s; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	b, err := Z85Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := data, b; !bytes.Equal(want, got) {
+		t.Errorf("want %x, got %x", want, got)
+	}
+
+	if _, err := Z85Decode("Hello"[:4]); err == nil {
+		t.Errorf("want an error decoding a truncated string")
+	}
+}
+
+func TestSecretBox(t *testing.T) {
+	var (
+		k [32]byte
+		n [24]byte
+	)
+	for i := range k {
+		k[i] = byte(i)
+	}
+	for i := range n {
+		n[i] = byte(100 + i)
+	}
+
+	box := sealSecretBox(nil, nil, &n, &k)
+	if want, got := "f49572d6194281e3c87fbb4e2106932c", hex.EncodeToString(box); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	box = sealSecretBox(nil, []byte("HELLO"), &n, &k)
+	m, err := openSecretBox(nil, box, &n, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "HELLO", string(m); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	box[len(box)-1] ^= 1
+	if _, err := openSecretBox(nil, box, &n, &k); err != errBoxOpen {
+		t.Errorf("want %v, got %v", errBoxOpen, err)
+	}
+}
+
+// poly1305Reference computes the tag of m with key as
+// RFC 8439 defines it, with big integers.
+func poly1305Reference(m []byte, key *[32]byte) [16]byte {
+	le := func(b []byte) *big.Int {
+		r := make([]byte, len(b))
+		for i := range b {
+			r[len(b)-1-i] = b[i]
+		}
+		return new(big.Int).SetBytes(r)
+	}
+	clamp, _ := new(big.Int).SetString("0ffffffc0ffffffc0ffffffc0fffffff", 16)
+	r := new(big.Int).And(le(key[:16]), clamp)
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 130), big.NewInt(5))
+
+	a := new(big.Int)
+	for len(m) > 0 {
+		n := 16
+		if len(m) < n {
+			n = len(m)
+		}
+		a.Add(a, le(append(m[:n:n], 1)))
+		a.Mul(a, r).Mod(a, p)
+		m = m[n:]
+	}
+	a.Add(a, le(key[16:]))
+
+	var tag [16]byte
+	b := a.Bytes()
+	for i := 0; i < len(tag) && i < len(b); i++ {
+		tag[i] = b[len(b)-1-i]
+	}
+	return tag
+}
+
+func TestPoly1305(t *testing.T) {
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	ietf := []byte("Any submission to the IETF intended by the Contributor for publication as all or part of an IETF Internet-Draft or RFC and any statement made within the context of an IETF activity is considered an \"IETF Contribution\". Such statements include oral statements in IETF sessions, as well as written and electronic communications made at any time or place, which are addressed to")
+
+	// the vectors of RFC 8439, section 2.5.2 and appendix A.3
+	for i, tc := range []struct {
+		key string
+		msg []byte
+		tag string
+	}{
+		{"85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b", []byte("Cryptographic Forum Research Group"), "a8061dc1305136c6c22b8baf0c0127a9"},
+		{strings.Repeat("00", 32), make([]byte, 64), strings.Repeat("00", 16)},
+		{strings.Repeat("00", 16) + "36e5f6b5c5e06070f0efca96227a863e", ietf, "36e5f6b5c5e06070f0efca96227a863e"},
+		{"36e5f6b5c5e06070f0efca96227a863e" + strings.Repeat("00", 16), ietf, "f3477e7cd95417af89a6b8794c310cf0"},
+		{"1c9240a5eb55d38af333888604f6b5f0473917c1402b80099dca5cbc207075c0", []byte("'Twas brillig, and the slithy toves\nDid gyre and gimble in the wabe:\nAll mimsy were the borogoves,\nAnd the mome raths outgrabe."), "4541669a7eaaee61e708dc7cbcc5eb62"},
+		// h not fully reduced by the partial reductions
+		{"02" + strings.Repeat("00", 31), unhex(strings.Repeat("ff", 16)), "03" + strings.Repeat("00", 15)},
+		// adding s overflows 2^128
+		{"02" + strings.Repeat("00", 15) + strings.Repeat("ff", 16), unhex("02" + strings.Repeat("00", 15)), "03" + strings.Repeat("00", 15)},
+		// a limb of all ones with a carry from the limb below
+		{"01" + strings.Repeat("00", 31), unhex(strings.Repeat("ff", 16) + "f0" + strings.Repeat("ff", 15) + "11" + strings.Repeat("00", 15)), "05" + strings.Repeat("00", 15)},
+		// h is exactly p = 2^130-5
+		{"01" + strings.Repeat("00", 31), unhex(strings.Repeat("ff", 16) + "fb" + strings.Repeat("fe", 15) + strings.Repeat("01", 16)), strings.Repeat("00", 16)},
+		// h is exactly p-1
+		{"02" + strings.Repeat("00", 31), unhex("fd" + strings.Repeat("ff", 15)), "fa" + strings.Repeat("ff", 15)},
+		// h between p and 2^130
+		{"0100000000000000040000000000000000000000000000000000000000000000", unhex("e33594d7505e43b900000000000000003394d7505e4379cd01000000000000000000000000000000000000000000000001" + strings.Repeat("00", 15)), "14000000000000005500000000000000"},
+		{"0100000000000000040000000000000000000000000000000000000000000000", unhex("e33594d7505e43b900000000000000003394d7505e4379cd010000000000000000000000000000000000000000000000"), "13000000000000000000000000000000"},
+	} {
+		tag := poly1305(tc.msg, mustHex(t, tc.key))
+		if want, got := tc.tag, hex.EncodeToString(tag[:]); want != got {
+			t.Errorf("vector %d: want %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestPoly1305Blocks(t *testing.T) {
+	var key [32]byte
+	for i := range key {
+		key[i] = byte(0xff - i)
+	}
+	m := make([]byte, 64)
+	for i := range m {
+		m[i] = byte(0xf0 + i)
+	}
+
+	// every length around the 16 byte block boundaries,
+	// where the final block is padded or taken whole
+	for n := 0; n <= len(m); n++ {
+		if want, got := poly1305Reference(m[:n], &key), poly1305(m[:n], &key); want != got {
+			t.Errorf("%d bytes: want %x, got %x", n, want, got)
+		}
+	}
+}
+
+// mustHex decodes s into a 32 byte array.
+func mustHex(t *testing.T, s string) *[32]byte {
+	t.Helper()
+	var k [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(k) {
+		t.Fatalf("invalid key %q", s)
+	}
+	copy(k[:], b)
+	return &k
+}
+
+func TestBoxKey(t *testing.T) {
+	// The keys of Alice and Bob in "Cryptography in NaCl".
+	aliceSecret := mustHex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	bobSecret := mustHex(t, "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb")
+
+	alicePublic, err := derivePublicKey(aliceSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a", hex.EncodeToString(alicePublic[:]); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	bobPublic, err := derivePublicKey(bobSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f", hex.EncodeToString(bobPublic[:]); want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	for _, k := range [][2]*[32]byte{{&bobPublic, aliceSecret}, {&alicePublic, bobSecret}} {
+		key, err := boxKey(k[0], k[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := "1b27556473e985d462cd51197a9a46c76009549eac6474f206c4ee0844f68389", hex.EncodeToString(key[:]); want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+
+	// A low order point would make the shared key predictable.
+	if _, err := boxKey(new([32]byte), aliceSecret); err == nil {
+		t.Error("want error for the all zero public key")
+	}
+}
+
+func TestCurveSessionNonces(t *testing.T) {
+	var key [32]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	sender := &curveSession{key: key, sendPrefix: clientMessagePrefix}
+	receiver := &curveSession{key: key, recvPrefix: clientMessagePrefix}
+
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		frame, err := sender.encode(false, false, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	if want, got := uint64(3), sender.sendNonce; want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	if _, _, _, err := receiver.decode(frames[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := receiver.decode(frames[0]); err != errCurveMessage {
+		t.Errorf("replay: want %v, got %v", errCurveMessage, err)
+	}
+
+	tampered := append([]byte(nil), frames[2]...)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, _, err := receiver.decode(tampered); err != errBoxOpen {
+		t.Errorf("tampered: want %v, got %v", errBoxOpen, err)
+	}
+	if want, got := uint64(1), receiver.recvNonce; want != got {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, _, body, err := receiver.decode(frames[2]); err != nil || !bytes.Equal(body, []byte{2}) {
+		t.Fatalf("want frame 2, got %v and %v", body, err)
+	}
+	if _, _, _, err := receiver.decode(frames[1]); err != errCurveMessage {
+		t.Errorf("reordered: want %v, got %v", errCurveMessage, err)
+	}
+
+	sender.sendNonce = math.MaxUint64 - 1
+	if _, err := sender.encode(false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.encode(false, false, nil); err != errCurveNonce {
+		t.Errorf("want %v, got %v", errCurveNonce, err)
+	}
+}
+
+// tcpPipe returns both ends of a loopback TCP connection,
+// which unlike net.Pipe lets both ends write their greeting.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	b, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func TestSecurityCurve(t *testing.T) {
+	serverPublic, serverSecret, err := NewCurveKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, clientSecret, err := NewCurveKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewSecurityCurveServer(serverPublic, serverSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewSecurityCurveClient(serverPublic, clientPublic, clientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSecurityCurveServer(clientPublic, serverSecret); err == nil {
+		t.Errorf("want an error for a mismatched keypair")
+	}
+
+	var authorized []byte
+	server.SetAuthorizer(func(key []byte) bool {
+		authorized = key
+		return true
+	})
+
+	a, b := tcpPipe(t)
+	defer a.Close()
+	defer b.Close()
+	sc, cc := NewConnection(a), NewConnection(b)
+
+	errc := make(chan error, 1)
+	go func() {
+		metadata, err := cc.Prepare(client, DealerSocketType, nil, false, map[string]string{"name": "client"})
+		if err == nil && metadata["name"] != "server" {
+			t.Errorf("want %q, got %q", "server", metadata["name"])
+		}
+		if err == nil {
+			err = cc.SendMultipart([][]byte{[]byte("HELLO"), []byte("WORLD")})
+		}
+		errc <- err
+	}()
+
+	metadata, err := sc.Prepare(server, RouterSocketType, nil, false, map[string]string{"name": "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "client", metadata["name"]; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	clientKey, _ := Z85Decode(clientPublic)
+	if want, got := clientKey, authorized; !bytes.Equal(want, got) {
+		t.Errorf("want %x, got %x", want, got)
+	}
+	if want, got := clientKey, sc.Security().PeerPublicKey; !bytes.Equal(want, got) {
+		t.Errorf("want %x, got %x", want, got)
+	}
+
+	isCommand, frames, err := sc.readMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isCommand {
+		t.Errorf("want a message, got a command")
+	}
+	if want, got := 2, len(frames); want != got {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if want, got := "HELLO WORLD", string(frames[0])+" "+string(frames[1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSecurityCurveResumption(t *testing.T) {
+	serverPublic, serverSecret, _ := NewCurveKeypair()
+	clientPublic, clientSecret, _ := NewCurveKeypair()
+	server, _ := NewSecurityCurveServer(serverPublic, serverSecret)
+	client, _ := NewSecurityCurveClient(serverPublic, clientPublic, clientSecret)
+	server.SetSessionResumption(time.Minute)
+	client.SetSessionResumption(time.Minute)
+
+	var transient [32]byte
+	for i := 0; i < 2; i++ {
+		a, b := tcpPipe(t)
+		sc, cc := NewConnection(a), NewConnection(b)
+		errc := make(chan error, 1)
+		go func() {
+			_, err := cc.Prepare(client, DealerSocketType, nil, false, nil)
+			if err == nil {
+				err = cc.SendMultipart([][]byte{[]byte("HELLO")})
+			}
+			errc <- err
+		}()
+		if _, err := sc.Prepare(server, RouterSocketType, nil, false, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, frames, err := sc.readMultipart(); err != nil || string(frames[0]) != "HELLO" {
+			t.Errorf("want %q, got %q, %v", "HELLO", frames, err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		a.Close()
+		b.Close()
+
+		// the second connection reuses the keys of the first,
+		// with the nonces following those of the first
+		if i == 0 {
+			transient = client.transient.public
+		} else if transient != client.transient.public {
+			t.Error("want the client transient keypair reused")
+		}
+		if want, got := uint64(2*(i+1)), client.transient.nonce; want != got {
+			t.Errorf("want nonce %v, got %v", want, got)
+		}
+		if want, got := 1, len(server.keys); want != got {
+			t.Errorf("want %v cached keys, got %v", want, got)
+		}
+	}
+
+	// keys are only kept with resumption enabled
+	client.SetSessionResumption(0)
+	if _, _, _, _, err := client.transientKeypair(); err != nil {
+		t.Fatal(err)
+	}
+	if client.transient != nil {
+		t.Error("want no transient keypair kept")
+	}
+}
+
+func TestSecurityCurveWrongServerKey(t *testing.T) {
+	serverPublic, serverSecret, _ := NewCurveKeypair()
+	otherPublic, _, _ := NewCurveKeypair()
+	clientPublic, clientSecret, _ := NewCurveKeypair()
+
+	server, _ := NewSecurityCurveServer(serverPublic, serverSecret)
+	client, _ := NewSecurityCurveClient(otherPublic, clientPublic, clientSecret)
+	server.SetSessionResumption(time.Minute)
+
+	a, b := tcpPipe(t)
+	sc, cc := NewConnection(a), NewConnection(b)
+
+	go func() {
+		cc.Prepare(client, DealerSocketType, nil, false, nil)
+		b.Close()
+	}()
+
+	_, err := sc.Prepare(server, RouterSocketType, nil, false, nil)
+	a.Close()
+	if err == nil {
+		t.Fatalf("want an error, got none")
+	}
+
+	// keys are only cached for HELLOs that authenticate
+	if want, got := 0, len(server.keys); want != got {
+		t.Errorf("want %v cached keys, got %v", want, got)
+	}
+}
@@ -0,0 +1,142 @@
+package zmtp
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errPlainHello = errors.New("gomq/zmtp: invalid PLAIN HELLO command")
+
+// SecurityPlain implements the PlainSecurityMechanismType, as
+// specified by RFC 24. Clients send a username and password in
+// clear text, which servers check with their authenticator.
+type SecurityPlain struct {
+	asServer     bool
+	username     string
+	password     string
+	authenticate func(username, password string) bool
+}
+
+// NewSecurityPlainClient returns a SecurityPlain mechanism for
+// the client end of connections, which presents username and
+// password to the server.
+func NewSecurityPlainClient(username, password string) *SecurityPlain {
+	return &SecurityPlain{username: username, password: password}
+}
+
+// NewSecurityPlainServer returns a SecurityPlain mechanism for
+// the server end of connections.
+func NewSecurityPlainServer() *SecurityPlain {
+	return &SecurityPlain{asServer: true}
+}
+
+// SetAuthenticator registers a function servers call with the
+// username and password each client presents, rejecting the
+// client with an ERROR command if the function returns false.
+// By default, every client is accepted.
+func (s *SecurityPlain) SetAuthenticator(fn func(username, password string) bool) {
+	s.authenticate = fn
+}
+
+// Type returns the security mechanisms type
+func (s *SecurityPlain) Type() SecurityMechanismType {
+	return PlainSecurityMechanismType
+}
+
+// Handshake does nothing, PLAIN handshakes are run on
+// each connection by Connection.Prepare.
+func (s *SecurityPlain) Handshake() error {
+	return nil
+}
+
+// Encrypt returns data unchanged, PLAIN does not encrypt.
+func (s *SecurityPlain) Encrypt(data []byte) []byte {
+	return data
+}
+
+func (s *SecurityPlain) isServer() bool {
+	return s.asServer
+}
+
+// handshake runs the PLAIN handshake on c, sending metadata
+// and returning the metadata of the other end. Frames are
+// sent as is afterwards, so there is no session.
+func (s *SecurityPlain) handshake(c *Connection, metadata []byte) (securitySession, []byte, error) {
+	if c.otherEndAsServer == s.asServer {
+		return nil, nil, errors.New("gomq/zmtp: both ends of the connection are PLAIN clients or servers")
+	}
+	if s.asServer {
+		return s.serverHandshake(c, metadata)
+	}
+	return s.clientHandshake(c, metadata)
+}
+
+func (s *SecurityPlain) clientHandshake(c *Connection, metadata []byte) (securitySession, []byte, error) {
+	if len(s.username) > 255 || len(s.password) > 255 {
+		return nil, nil, errors.New("gomq/zmtp: PLAIN username and password may not be longer than 255 bytes")
+	}
+
+	hello := make([]byte, 0, 2+len(s.username)+len(s.password))
+	hello = append(append(hello, byte(len(s.username))), s.username...)
+	hello = append(append(hello, byte(len(s.password))), s.password...)
+	if err := c.SendCommand("HELLO", hello); err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.readHandshakeCommand("WELCOME"); err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.SendCommand("INITIATE", metadata); err != nil {
+		return nil, nil, err
+	}
+	ready, err := c.readHandshakeCommand("READY")
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, ready, nil
+}
+
+func (s *SecurityPlain) serverHandshake(c *Connection, metadata []byte) (securitySession, []byte, error) {
+	hello, err := c.readHandshakeCommand("HELLO")
+	if err != nil {
+		return nil, nil, err
+	}
+	username, hello, ok := cutShortString(hello)
+	if !ok {
+		return nil, nil, errPlainHello
+	}
+	password, hello, ok := cutShortString(hello)
+	if !ok || len(hello) != 0 {
+		return nil, nil, errPlainHello
+	}
+
+	if s.authenticate != nil && !s.authenticate(username, password) {
+		c.sendError("Invalid username or password")
+		return nil, nil, fmt.Errorf("gomq/zmtp: PLAIN client %q not authenticated", username)
+	}
+	if err := c.authenticateClient(PlainSecurityMechanismType, [][]byte{[]byte(username), []byte(password)}); err != nil {
+		return nil, nil, err
+	}
+	if err := c.SendCommand("WELCOME", nil); err != nil {
+		return nil, nil, err
+	}
+
+	initiate, err := c.readHandshakeCommand("INITIATE")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.SendCommand("READY", metadata); err != nil {
+		return nil, nil, err
+	}
+	return nil, initiate, nil
+}
+
+// cutShortString cuts the string preceded by its
+// one byte length from the front of b.
+func cutShortString(b []byte) (string, []byte, bool) {
+	if len(b) == 0 || int(b[0]) > len(b)-1 {
+		return "", nil, false
+	}
+	n := int(b[0])
+	return string(b[1 : 1+n]), b[1+n:], true
+}
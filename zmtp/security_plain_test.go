@@ -0,0 +1,67 @@
+package zmtp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecurityPlain(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		ok       bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+	} {
+		server := NewSecurityPlainServer()
+		var username string
+		server.SetAuthenticator(func(user, pass string) bool {
+			username = user
+			return pass == "secret"
+		})
+		client := NewSecurityPlainClient("admin", tc.password)
+
+		a, b := tcpPipe(t)
+		sc, cc := NewConnection(a), NewConnection(b)
+
+		errc := make(chan error, 1)
+		go func() {
+			metadata, err := cc.Prepare(client, DealerSocketType, nil, false, map[string]string{"name": "client"})
+			if err == nil && metadata["name"] != "server" {
+				t.Errorf("want %q, got %q", "server", metadata["name"])
+			}
+			errc <- err
+		}()
+
+		metadata, err := sc.Prepare(server, RouterSocketType, nil, false, map[string]string{"name": "server"})
+		clientErr := <-errc
+		a.Close()
+		b.Close()
+
+		if want, got := "admin", username; want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("want an error for password %q", tc.password)
+			}
+			if clientErr == nil || !strings.Contains(clientErr.Error(), "Invalid username or password") {
+				t.Errorf("want the client refused, got %v", clientErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clientErr != nil {
+			t.Fatal(clientErr)
+		}
+		if want, got := "client", metadata["name"]; want != got {
+			t.Errorf("want %q, got %q", want, got)
+		}
+		if want, got := PlainSecurityMechanismType, sc.Security().Mechanism; want != got {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	}
+}
@@ -2,6 +2,21 @@ package zmtp
 
 import "errors"
 
+// ErrIncompatibleSocketType is wrapped by the errors of Prepare
+// when the peer's socket type cannot talk to this end's, such
+// as a PUB socket connecting to a REP socket, after the socket
+// type compatibility rules of RFC 23 and RFC 28.
+var ErrIncompatibleSocketType = errors.New("gomq/zmtp: incompatible socket types")
+
+// peerSocketType returns the socket type a peer announced,
+// for error messages.
+func peerSocketType(socketType string) string {
+	if socketType == "" {
+		return "untyped"
+	}
+	return socketType
+}
+
 // Socket is a ZMTP socket
 type Socket interface {
 	Type() SocketType
@@ -36,6 +51,8 @@ func NewSocket(socketType SocketType) (Socket, error) {
 		return xpubSocket{}, nil
 	case XSubSocketType:
 		return xsubSocket{}, nil
+	case PairSocketType:
+		return pairSocket{}, nil
 	default:
 		return nil, errors.New("Invalid socket type")
 	}
@@ -214,8 +231,7 @@ func (pubSocket) IsSocketTypeCompatible(socketType SocketType) bool {
 }
 
 func (pubSocket) IsCommandTypeValid(name string) bool {
-	// FIXME
-	return false
+	return name == "SUBSCRIBE" || name == "CANCEL"
 }
 
 type subSocket struct{}
@@ -252,8 +268,7 @@ func (xpubSocket) IsSocketTypeCompatible(socketType SocketType) bool {
 }
 
 func (xpubSocket) IsCommandTypeValid(name string) bool {
-	// FIXME
-	return false
+	return name == "SUBSCRIBE" || name == "CANCEL"
 }
 
 type xsubSocket struct{}
@@ -274,3 +289,17 @@ func (xsubSocket) IsCommandTypeValid(name string) bool {
 	// FIXME
 	return false
 }
+
+type pairSocket struct{}
+
+func (pairSocket) Type() SocketType {
+	return PairSocketType
+}
+
+func (pairSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == PairSocketType
+}
+
+func (pairSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
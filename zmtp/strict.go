@@ -0,0 +1,111 @@
+package zmtp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Violation is the error of a connection in strict mode whose
+// peer broke a rule of ZMTP, RFC 23, or of the request-reply
+// pattern, RFC 28, see SetStrict. It tells which rule was broken,
+// what the rule expects of which field, and what was received.
+type Violation struct {
+	Rule     string
+	Field    string
+	Expected string
+	Got      string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("gomq/zmtp: %s violated: %s is %s, expected %s", v.Rule, v.Field, v.Got, v.Expected)
+}
+
+// SetStrict makes the connection check its peer against the
+// letter of RFC 23, beyond what interoperability requires, and
+// fail with a *Violation detailing the first rule the peer
+// broke. It must be set before Prepare.
+func (c *Connection) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+// violation returns v if the connection is in strict mode,
+// and err otherwise.
+func (c *Connection) violation(err error, v *Violation) error {
+	if c.strict {
+		return v
+	}
+	return err
+}
+
+// checkPropertyName checks, in strict mode, that name is
+// a valid metadata property name.
+func (c *Connection) checkPropertyName(name string) error {
+	if !c.strict {
+		return nil
+	}
+	if name != "" && strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.+") == "" {
+		return nil
+	}
+	return &Violation{
+		Rule:     "RFC 23 metadata",
+		Field:    "property name",
+		Expected: "1 to 255 of ALPHA, DIGIT, '-', '_', '.' and '+'",
+		Got:      fmt.Sprintf("%q", name),
+	}
+}
+
+// truncatedMetadata returns the violation of a metadata
+// field of length bytes with only left bytes of the body
+// remaining. Unlike other violations, it is returned in
+// lenient mode too, as the body cannot be parsed further.
+func truncatedMetadata(field string, length uint64, left int) *Violation {
+	return &Violation{
+		Rule:     "RFC 23 metadata",
+		Field:    field,
+		Expected: fmt.Sprintf("%d bytes", length),
+		Got:      fmt.Sprintf("%d bytes left in the body", left),
+	}
+}
+
+// checkCommandName checks, in strict mode, that name
+// is a valid command name.
+func (c *Connection) checkCommandName(name string) error {
+	if !c.strict {
+		return nil
+	}
+	if name != "" && strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz") == "" {
+		return nil
+	}
+	return &Violation{
+		Rule:     "RFC 23 command",
+		Field:    "command name",
+		Expected: "1 to 255 of ALPHA",
+		Got:      fmt.Sprintf("%q", name),
+	}
+}
+
+// readFrameHeader reads the header of the next frame,
+// see readFrameHeader.
+func (c *Connection) readFrameHeader() (byte, uint64, error) {
+	var r io.Reader = c.rw
+	if c.tracing() {
+		t := &traceReader{r: r}
+		defer func() {
+			if len(t.read) > 0 {
+				c.tracef("recv frame header: % x", t.read)
+			}
+		}()
+		r = t
+	}
+	flags, length, err := readFrameHeader(r)
+	if err == errReservedFlags {
+		err = c.violation(err, &Violation{
+			Rule:     "RFC 23 framing",
+			Field:    "flags",
+			Expected: "reserved bits 7 to 3 cleared",
+			Got:      fmt.Sprintf("%#02x", flags),
+		})
+	}
+	return flags, length, err
+}
@@ -0,0 +1,116 @@
+package zmtp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestStrictGreeting(t *testing.T) {
+	var valid bytes.Buffer
+	g := greeting{SignaturePrefix: signaturePrefix, SignatureSuffix: signatureSuffix, Version: version}
+	toNullPaddedString("NULL", g.Mechanism[:])
+	if err := g.marshal(&valid); err != nil {
+		t.Fatal(err)
+	}
+	filled := valid.Bytes()
+	filled[40] = 0x2a
+
+	var got greeting
+	if err := got.unmarshal(bytes.NewReader(filled), false); err != nil {
+		t.Fatal(err)
+	}
+	err := got.unmarshal(bytes.NewReader(filled), true)
+	var v *Violation
+	if !errors.As(err, &v) {
+		t.Fatalf("want a violation, got %v", err)
+	}
+	if want, got := "filler", v.Field; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	filled[0] = 0x00
+	if err := got.unmarshal(bytes.NewReader(filled), true); !errors.As(err, &v) || v.Field != "signature octet 0" || v.Got != "0x00" {
+		t.Errorf("want a signature violation, got %v", err)
+	}
+}
+
+func TestStrictMetadata(t *testing.T) {
+	socket, err := NewSocket(DealerSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Connection{socket: socket, strict: true}
+
+	var body bytes.Buffer
+	c.writeMetadata(&body, "Socket-Type", "ROUTER")
+	if _, err := c.parseMetadata(body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	body.Reset()
+	c.writeMetadata(&body, "bad name", "")
+	c.writeMetadata(&body, "Socket-Type", "ROUTER")
+	var v *Violation
+	if _, err := c.parseMetadata(body.Bytes()); !errors.As(err, &v) || v.Field != "property name" {
+		t.Errorf("want a property name violation, got %v", err)
+	}
+
+	body.Reset()
+	c.writeMetadata(&body, "Identity", "")
+	if _, err := c.parseMetadata(body.Bytes()); !errors.As(err, &v) || v.Got != "missing" {
+		t.Errorf("want a missing socket type violation, got %v", err)
+	}
+}
+
+func TestTruncatedMetadata(t *testing.T) {
+	socket, err := NewSocket(DealerSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		body  []byte
+		field string
+	}{
+		{[]byte{5, 'a', 'b'}, "property name"},
+		{[]byte{1, 'a'}, "property value length"},
+		{[]byte{1, 'a', 0, 0}, "property value length"},
+		{[]byte{1, 'a', 0, 0, 0, 3, 'x'}, "property value"},
+		{[]byte{1, 'a', 0xff, 0xff, 0xff, 0xff}, "property value"},
+	} {
+		for _, strict := range []bool{false, true} {
+			c := &Connection{socket: socket, strict: strict}
+			var v *Violation
+			if _, err := c.parseMetadata(tc.body); !errors.As(err, &v) || v.Field != tc.field {
+				t.Errorf("% x, strict %v: want a %s violation, got %v", tc.body, strict, tc.field, err)
+			}
+		}
+	}
+}
+
+func TestStrictFrames(t *testing.T) {
+	frame := []byte{0x84, 0x05, 0x05, 'R', 'E', 'A', 'D', 'Y'}
+	for _, strict := range []bool{false, true} {
+		c := NewConnection(struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewReader(frame), io.Discard})
+		c.SetStrict(strict)
+
+		_, _, err := c.read()
+		var v *Violation
+		if want, got := strict, errors.As(err, &v); want != got {
+			t.Errorf("strict %v: want a violation %v, got %v", strict, want, err)
+		}
+		if err == nil {
+			t.Errorf("strict %v: want reserved flags refused", strict)
+		}
+	}
+
+	c := &Connection{strict: true}
+	if _, err := c.parseCommand([]byte("\x05RE4DY")); err == nil {
+		t.Error("want a command name violation")
+	}
+}
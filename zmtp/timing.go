@@ -0,0 +1,74 @@
+package zmtp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Timing records where time went receiving a message, for the
+// messages sampled with SetTiming.
+type Timing struct {
+	// Read is the time spent reading the message's frames
+	// from the transport, from its first frame header on,
+	// so that waiting for the message is not counted.
+	Read time.Duration
+
+	// Parse is the time spent decoding the message's
+	// frames, such as decrypting them, and parsing it
+	// if it is a command.
+	Parse time.Duration
+
+	// Done is when the message was ready to be passed on.
+	Done time.Time
+}
+
+// SetTiming makes the connection record a Timing for one in
+// every n messages it receives, passed on in Message.Timing.
+// Zero, the default, records none. It is goroutine safe.
+func (c *Connection) SetTiming(n int) {
+	atomic.StoreInt64(&c.timingEvery, int64(n))
+}
+
+// sampleTiming returns a Timing for the next message
+// received if it is sampled, and nil otherwise.
+func (c *Connection) sampleTiming() *Timing {
+	every := atomic.LoadInt64(&c.timingEvery)
+	if every <= 0 {
+		return nil
+	}
+	c.timingCount++
+	if c.timingCount%every != 0 {
+		return nil
+	}
+	return &Timing{}
+}
+
+// now returns the current time if t is recording.
+func (t *Timing) now() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// read adds the time since start to the reading time.
+func (t *Timing) read(start time.Time) {
+	if t != nil {
+		t.Read += time.Since(start)
+	}
+}
+
+// parse adds the time since start to the parsing time.
+func (t *Timing) parse(start time.Time) {
+	if t != nil {
+		t.Parse += time.Since(start)
+	}
+}
+
+// done records that the message is ready and returns t.
+func (t *Timing) done() *Timing {
+	if t != nil {
+		t.Done = time.Now()
+	}
+	return t
+}
@@ -0,0 +1,61 @@
+package zmtp
+
+import (
+	"fmt"
+	"io"
+)
+
+// tracer holds the function a connection traces to.
+type tracer struct {
+	fn func(line string)
+}
+
+// SetTrace makes the connection report to fn, one line at a
+// time, the bytes of the greetings it exchanges, the commands
+// it sends and receives, and the headers of its frames, in
+// hex, to help diagnose interoperability problems. The bodies
+// of HELLO commands, which hold PLAIN passwords, are left out.
+// A nil fn stops tracing. It may be called at any time, and
+// before Prepare for the handshake to be traced.
+func (c *Connection) SetTrace(fn func(line string)) {
+	c.trace.Store(tracer{fn: fn})
+}
+
+// tracing reports whether the connection is being traced.
+func (c *Connection) tracing() bool {
+	t, _ := c.trace.Load().(tracer)
+	return t.fn != nil
+}
+
+// tracef formats a trace line and reports it,
+// if the connection is being traced.
+func (c *Connection) tracef(format string, args ...interface{}) {
+	if t, _ := c.trace.Load().(tracer); t.fn != nil {
+		t.fn(fmt.Sprintf(format, args...))
+	}
+}
+
+// traceCommand traces the command name with body,
+// sent or received as dir says.
+func (c *Connection) traceCommand(dir, name string, body []byte) {
+	if !c.tracing() {
+		return
+	}
+	if name == "HELLO" {
+		c.tracef("%s command %s: (%d bytes)", dir, name, len(body))
+		return
+	}
+	c.tracef("%s command %s: % x", dir, name, body)
+}
+
+// traceReader records the bytes read from r.
+type traceReader struct {
+	r    io.Reader
+	read []byte
+}
+
+func (t *traceReader) Read(b []byte) (int, error) {
+	n, err := t.r.Read(b)
+	t.read = append(t.read, b[:n]...)
+	return n, err
+}
@@ -0,0 +1,61 @@
+package zmtp
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	local, remote := tcpPipe(t)
+	defer local.Close()
+	defer remote.Close()
+
+	var (
+		lock  sync.Mutex
+		lines []string
+	)
+	client := NewConnection(local)
+	client.SetTrace(func(line string) {
+		lock.Lock()
+		lines = append(lines, line)
+		lock.Unlock()
+	})
+	server := NewConnection(remote)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := server.Prepare(NewSecurityPlainServer(), PullSocketType, nil, true, nil)
+		errc <- err
+	}()
+	if _, err := client.Prepare(NewSecurityPlainClient("admin", "secret"), PushSocketType, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	trace := strings.Join(lines, "\n")
+	lock.Unlock()
+	for _, want := range []string{
+		"send greeting: ff 00 00 00 00 00 00 00 00 7f 03 00 50 4c 41 49 4e",
+		"recv greeting: ff 00 00 00 00 00 00 00 00 7f 03 00 50 4c 41 49 4e",
+		"send command HELLO: (",
+		"recv command WELCOME: ",
+		"send frame header: 04 ",
+		"recv frame header: 04 ",
+	} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("want %q in:\n%s", want, trace)
+		}
+	}
+	if strings.Contains(trace, "73 65 63 72 65 74") {
+		t.Errorf("want the password left out of:\n%s", trace)
+	}
+
+	client.SetTrace(nil)
+	if client.tracing() {
+		t.Error("want tracing stopped")
+	}
+}
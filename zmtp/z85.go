@@ -0,0 +1,56 @@
+package zmtp
+
+import (
+	"errors"
+	"strings"
+)
+
+// z85Alphabet is the alphabet of Z85, see RFC 32.
+const z85Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+var errZ85 = errors.New("gomq/zmtp: invalid Z85 data")
+
+// Z85Encode encodes b with Z85, the encoding ZeroMQ uses to
+// print CURVE keys. The length of b must be a multiple of 4.
+func Z85Encode(b []byte) (string, error) {
+	if len(b)%4 != 0 {
+		return "", errZ85
+	}
+
+	out := make([]byte, 0, len(b)/4*5)
+	for i := 0; i < len(b); i += 4 {
+		v := uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])
+		var chunk [5]byte
+		for j := 4; j >= 0; j-- {
+			chunk[j] = z85Alphabet[v%85]
+			v /= 85
+		}
+		out = append(out, chunk[:]...)
+	}
+	return string(out), nil
+}
+
+// Z85Decode decodes s, encoded with Z85. The length of s
+// must be a multiple of 5.
+func Z85Decode(s string) ([]byte, error) {
+	if len(s)%5 != 0 {
+		return nil, errZ85
+	}
+
+	out := make([]byte, 0, len(s)/5*4)
+	for i := 0; i < len(s); i += 5 {
+		var v uint64
+		for j := 0; j < 5; j++ {
+			d := strings.IndexByte(z85Alphabet, s[i+j])
+			if d < 0 {
+				return nil, errZ85
+			}
+			v = v*85 + uint64(d)
+		}
+		if v > 0xFFFFFFFF {
+			return nil, errZ85
+		}
+		out = append(out, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return out, nil
+}
@@ -0,0 +1,151 @@
+package gomq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// wsGreetingSize is the size of a ZMTP greeting, which
+// ZWS connections replace with the WebSocket handshake.
+const wsGreetingSize = 64
+
+// Flags starting each ZWS message.
+const (
+	zwsMore    = 0x01
+	zwsCommand = 0x02
+)
+
+var errWSHandshake = errors.New("gomq: invalid WebSocket handshake")
+
+func init() {
+	RegisterTransport(wsTransport("ws"))
+	RegisterTransport(wsTransport("wss"))
+}
+
+// wsTransport is the ws:// or wss:// transport, carrying ZMTP
+// over WebSocket as ZWS 2.0 does, RFC 45, so that sockets can
+// go through HTTP infrastructure and talk to JavaScript
+// clients. Addresses are a host, a port and a path, as in
+// "ws://example.com:8080/feed". There is no ZMTP greeting:
+// the WebSocket subprotocol, such as "ZWS2.0/NULL", names the
+// security mechanism, and each ZMTP frame is sent as a binary
+// message starting with a flags byte. wss:// runs over TLS
+// with the socket's config, see SetTLSConfig, so sockets dial
+// and listen through dialNet and listenNet, and the
+// transport's own Dial and Listen methods fail for wss://.
+// In the browser, under GOOS=js, sockets connect through the
+// WebSocket API instead, and cannot listen.
+type wsTransport string
+
+func (t wsTransport) Scheme() string { return string(t) }
+
+func (t wsTransport) SplitAddress(address string) (hostport, rest string) {
+	return splitWSAddress(address)
+}
+
+// splitWSAddress splits address into its host and
+// port, and its path, which defaults to "/".
+func splitWSAddress(address string) (hostport, path string) {
+	if i := strings.IndexByte(address, '/'); i >= 0 {
+		return address[:i], address[i:]
+	}
+	return address, "/"
+}
+
+// wsAddr is the address of a ws:// or wss:// endpoint.
+type wsAddr struct {
+	scheme, address string
+}
+
+func (a wsAddr) Network() string { return a.scheme }
+func (a wsAddr) String() string  { return a.address }
+
+// zwsProtocols returns the WebSocket subprotocols
+// standing for mechanism, the preferred one first.
+func zwsProtocols(mechanism string) []string {
+	if mechanism == "NULL" {
+		return []string{"ZWS2.0/NULL", "ZWS2.0"}
+	}
+	return []string{"ZWS2.0/" + mechanism}
+}
+
+// parseGreeting returns the mechanism of the ZMTP greeting
+// written by this end, and whether it is the ZMTP server.
+func parseGreeting(greeting []byte) (mechanism string, asServer bool) {
+	return string(bytes.TrimRight(greeting[12:32], "\x00")), greeting[32] == 1
+}
+
+// zwsGreeting makes up the ZMTP greeting of the peer once
+// the WebSocket handshake agreed on mechanism, the peer being
+// a ZMTP server if this end is not.
+func zwsGreeting(mechanism string, asServer bool) []byte {
+	greeting := make([]byte, wsGreetingSize)
+	greeting[0], greeting[9], greeting[10] = 0xFF, 0x7F, 3
+	copy(greeting[12:32], mechanism)
+	if !asServer {
+		greeting[32] = 1
+	}
+	return greeting
+}
+
+// appendZMTPFrame appends the ZMTP frame carried by
+// the ZWS message msg to b.
+func appendZMTPFrame(b, msg []byte) ([]byte, error) {
+	if len(msg) == 0 {
+		return b, errWSHandshake
+	}
+
+	var flags byte
+	if msg[0]&zwsMore != 0 {
+		flags |= 0x01
+	}
+	if msg[0]&zwsCommand != 0 {
+		flags |= 0x04
+	}
+	body := msg[1:]
+	b = appendWSFrameHeader(b, flags, len(body))
+	return append(b, body...), nil
+}
+
+// appendWSFrameHeader appends the header of a ZMTP frame.
+func appendWSFrameHeader(b []byte, flags byte, length int) []byte {
+	if length <= 255 {
+		return append(b, flags, byte(length))
+	}
+	b = append(b, flags|0x02)
+	return binary.BigEndian.AppendUint64(b, uint64(length))
+}
+
+// nextZWSMessage returns the ZWS message carrying the first
+// ZMTP frame of stream, and what is left of stream, reusing
+// its memory. It returns a nil message until stream holds a
+// complete frame.
+func nextZWSMessage(stream []byte) (msg, rest []byte) {
+	if len(stream) < 2 {
+		return nil, stream
+	}
+	flags := stream[0]
+	size, header := uint64(stream[1]), 2
+	if flags&0x02 != 0 {
+		if len(stream) < 9 {
+			return nil, stream
+		}
+		size, header = binary.BigEndian.Uint64(stream[1:9]), 9
+	}
+	if uint64(len(stream)-header) < size {
+		return nil, stream
+	}
+
+	msg = make([]byte, 1+size)
+	if flags&0x01 != 0 {
+		msg[0] |= zwsMore
+	}
+	if flags&0x04 != 0 {
+		msg[0] |= zwsCommand
+	}
+	end := header + int(size)
+	copy(msg[1:], stream[header:end])
+	return msg, stream[:copy(stream, stream[end:])]
+}